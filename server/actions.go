@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// Actions taken on posts flagged by moderation
+const (
+	moderationActionDelete = "delete"
+	moderationActionFlag   = "flag"
+	moderationActionRedact = "redact"
+
+	// moderationActionNone is recorded for flagged posts left in place in
+	// monitor-only mode
+	moderationActionNone = "none"
+)
+
+// pendingReviewEmoji is the reaction the bot adds to posts flagged for review
+const pendingReviewEmoji = "warning"
+
+// flaggedPostAction controls what happens to a post once it is flagged
+type flaggedPostAction struct {
+	action          string
+	reviewChannelID string
+
+	// monitorOnly records and logs flagged posts without acting on them or
+	// notifying their authors, so thresholds can be tuned on real traffic
+	monitorOnly bool
+}
+
+func newFlaggedPostAction(action, reviewChannelID string, monitorOnly bool) (*flaggedPostAction, error) {
+	switch action {
+	case "":
+		action = moderationActionDelete
+	case moderationActionDelete, moderationActionRedact:
+	case moderationActionFlag:
+		if !model.IsValidId(reviewChannelID) {
+			return nil, errors.New("a valid review channel ID is required to flag posts for review")
+		}
+	default:
+		return nil, errors.Errorf("unknown moderation action %q", action)
+	}
+
+	return &flaggedPostAction{
+		action:          action,
+		reviewChannelID: reviewChannelID,
+		monitorOnly:     monitorOnly,
+	}, nil
+}
+
+// taken returns the action actually applied to flagged posts, which is none
+// in monitor-only mode
+func (a *flaggedPostAction) taken() string {
+	if a.monitorOnly {
+		return moderationActionNone
+	}
+	return a.action
+}
+
+// handleFlaggedPost applies the configured moderation action to a flagged
+// post. In monitor-only mode the post is only logged and recorded.
+func (p *PostProcessor) handleFlaggedPost(api plugin.API, post *model.Post, categories moderation.Result, decision moderation.Decision) {
+	p.logModerationEvent(api, post, categories, decision)
+	p.recordModerationEvent(api, post, categories)
+	p.recordComplianceEvent(api, post, categories, decision)
+	p.metrics.postFlagged(categories)
+	p.eventWebhooks.flaggedPost(api, post, categories, p.action.action, p.action.monitorOnly)
+
+	if p.action.monitorOnly {
+		api.LogInfo("Monitor-only mode, leaving flagged post in place", append(p.policy.loggedIDs("post_id", post.Id), "action", p.action.action)...)
+		return
+	}
+
+	switch p.action.action {
+	case moderationActionFlag:
+		if err := p.flagPostForReview(api, post); err != nil {
+			api.LogError("Failed to flag post for review", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+		}
+	case moderationActionRedact:
+		if err := p.redactPost(api, post, categories); err != nil {
+			api.LogError("Failed to redact post flagged by content moderation", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+		}
+	default:
+		if p.deletionGracePeriod > 0 {
+			p.schedulePostDeletion(api, post, categories)
+			return
+		}
+		p.deleteFlaggedPost(api, post, categories)
+	}
+}
+
+// flagPostForReview leaves the post in place, marks it as pending review and
+// asks the moderators to review it
+func (p *PostProcessor) flagPostForReview(api plugin.API, post *model.Post) error {
+	return p.markPendingReview(api, post, p.action.reviewChannelID, reviewNotificationTemplate)
+}
+
+// markPendingReview adds the pending review reaction to the post and posts
+// the template, filled with a link to the post, in the review channel
+func (p *PostProcessor) markPendingReview(api plugin.API, post *model.Post, reviewChannelID, template string) error {
+	// A reaction rather than a post property keeps the post from being edited,
+	// which would queue it for moderation again
+	if _, err := api.AddReaction(&model.Reaction{
+		UserId:    p.botID,
+		PostId:    post.Id,
+		EmojiName: pendingReviewEmoji,
+		ChannelId: post.ChannelId,
+	}); err != nil {
+		return errors.Wrap(err, "failed to mark post as pending review")
+	}
+
+	if _, err := api.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: reviewChannelID,
+		Message:   fmt.Sprintf(template, postPermalink(api, post.Id)),
+	}); err != nil {
+		return errors.Wrap(err, "failed to notify review channel")
+	}
+
+	return nil
+}
+
+// isRedaction reports whether an edit of the post is the bot redacting it,
+// which is not moderated again
+func (p *PostProcessor) isRedaction(post *model.Post) bool {
+	_, redacting := p.redactions.LoadAndDelete(post.Id)
+	return redacting && post.Message == redactedMessage
+}
+
+// redactPost replaces the message of the post with a placeholder, removes
+// its moderated attachments and files, and lets the author know what was
+// removed
+func (p *PostProcessor) redactPost(api plugin.API, post *model.Post, categories moderation.Result) error {
+	redacted := post.Clone()
+	redacted.Message = redactedMessage
+	if p.moderateAttachments {
+		redacted.DelProp("attachments")
+	}
+	if p.moderatesFiles() {
+		redacted.FileIds = nil
+	}
+
+	// The post was already redacted, and was flagged again for content the
+	// redaction keeps
+	if !postContentChanged(redacted, post) {
+		return nil
+	}
+
+	p.redactions.Store(post.Id, struct{}{})
+	if _, err := api.UpdatePost(redacted); err != nil {
+		p.redactions.Delete(post.Id)
+		return errors.Wrap(err, "failed to update post")
+	}
+
+	notify, suppressed := p.notificationAllowed(api, post)
+	if !notify {
+		return nil
+	}
+
+	messages := messagesForLocale(userLocale(api, post.UserId))
+	template := messages.dmRedacted
+	if p.notifications.dmContentMode == dmContentNone {
+		template = messages.dmRedactedWithoutContent
+	}
+
+	return p.notifyAuthor(api, post, template, messages, categories, suppressed)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFlaggedPostAction(t *testing.T) {
+	channelID := model.NewId()
+
+	tests := []struct {
+		name           string
+		action         string
+		channelID      string
+		expectedAction string
+		expectError    bool
+	}{
+		{name: "Defaults to delete", expectedAction: moderationActionDelete},
+		{name: "Redact", action: moderationActionRedact, expectedAction: moderationActionRedact},
+		{name: "Flag with review channel", action: moderationActionFlag, channelID: channelID, expectedAction: moderationActionFlag},
+		{name: "Flag without review channel", action: moderationActionFlag, expectError: true},
+		{name: "Unknown action", action: "quarantine", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := newFlaggedPostAction(tt.action, tt.channelID, false)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedAction, action.action)
+		})
+	}
+}
+
+func TestHandleFlaggedPost(t *testing.T) {
+	reviewChannelID := model.NewId()
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+	newProcessor := func(action string) *PostProcessor {
+		return &PostProcessor{
+			botID:         "bot",
+			action:        &flaggedPostAction{action: action, reviewChannelID: reviewChannelID},
+			notifications: &notificationSettings{dmContentMode: dmContentFull},
+		}
+	}
+
+	t.Run("Delete", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("DeletePost", "post1").Return(nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1" && p.Message == notificationTranslations["en"].channel
+		})).Return(&model.Post{}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm"
+		})).Return(&model.Post{}, nil)
+
+		newProcessor(moderationActionDelete).handleFlaggedPost(api, post, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Flag for review", func(t *testing.T) {
+		siteURL := "https://chat.example.com"
+
+		api := &plugintest.API{}
+		api.On("AddReaction", &model.Reaction{
+			UserId:    "bot",
+			PostId:    "post1",
+			EmojiName: pendingReviewEmoji,
+			ChannelId: "channel1",
+		}).Return(&model.Reaction{}, nil)
+		api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: &siteURL}})
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.UserId == "bot" &&
+				p.ChannelId == reviewChannelID &&
+				p.Message == "_A post with potentially offensive content was flagged for review:_ https://chat.example.com/_redirect/pl/post1"
+		})).Return(&model.Post{}, nil)
+
+		newProcessor(moderationActionFlag).handleFlaggedPost(api, post, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Redact", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("UpdatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.Id == "post1" && p.Message == redactedMessage
+		})).Return(&model.Post{}, nil)
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm" &&
+				p.Message == "_Your post with the following content was flagged and redacted:_\n\nOffensive message"
+		})).Return(&model.Post{}, nil)
+
+		newProcessor(moderationActionRedact).handleFlaggedPost(api, post, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		assert.Equal(t, "Offensive message", post.Message)
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Redact removes moderated attachments", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("UpdatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.Message == redactedMessage && p.GetProp("attachments") == nil
+		})).Return(&model.Post{}, nil)
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+		processor := newProcessor(moderationActionRedact)
+		processor.moderateAttachments = true
+		processor.handleFlaggedPost(api, newAttachmentPost(), moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Redact removes moderated files", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("UpdatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.Message == redactedMessage && len(p.FileIds) == 0
+		})).Return(&model.Post{}, nil)
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+		processor := newProcessor(moderationActionRedact)
+		processor.moderateFilenames = true
+		processor.handleFlaggedPost(api, &model.Post{Id: "post1", UserId: "user1", Message: "Offensive message", FileIds: []string{"file1"}}, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Redact removes files left on a redacted post", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("UpdatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.Message == redactedMessage && len(p.FileIds) == 0
+		})).Return(&model.Post{}, nil)
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+		processor := newProcessor(moderationActionRedact)
+		processor.moderateFilenames = true
+		processor.handleFlaggedPost(api, &model.Post{Id: "post1", UserId: "user1", Message: redactedMessage, FileIds: []string{"file1"}}, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Redact skips already redacted post", func(t *testing.T) {
+		api := &plugintest.API{}
+
+		newProcessor(moderationActionRedact).handleFlaggedPost(api, &model.Post{Id: "post1", UserId: "user1", Message: redactedMessage}, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertNotCalled(t, "UpdatePost", mock.Anything)
+	})
+
+	t.Run("Monitor only leaves the post in place", func(t *testing.T) {
+		logChannelID := model.NewId()
+
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+		api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == logChannelID && strings.Contains(p.Message, "| Action | none, monitor only (would delete) |")
+		})).Return(&model.Post{}, nil)
+		api.On("LogInfo", "Monitor-only mode, leaving flagged post in place", "post_id", "post1", "action", moderationActionDelete)
+
+		processor := &PostProcessor{
+			botID:         "bot",
+			action:        &flaggedPostAction{action: moderationActionDelete, monitorOnly: true},
+			notifications: &notificationSettings{dmContentMode: dmContentFull, logChannelID: logChannelID},
+		}
+		processor.handleFlaggedPost(api, post, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+		api.AssertNotCalled(t, "GetDirectChannel", mock.Anything, mock.Anything)
+		api.AssertExpectations(t)
+	})
+}
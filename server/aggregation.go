@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+const (
+	aggregationAny      = "any"
+	aggregationSum      = "sum"
+	aggregationWeighted = "weighted"
+	aggregationCount    = "count"
+
+	// defaultAggregateScore is the score the summed or weighted severities
+	// must reach when no aggregate threshold is configured
+	defaultAggregateScore = 8
+
+	// defaultAggregateCount is the number of categories that must reach their
+	// threshold when no aggregate threshold is configured
+	defaultAggregateCount = 2
+)
+
+// severityAggregator decides whether a result is flagged. It is given the
+// severity of every enabled category and of those reaching their own
+// threshold, and returns the categories that flagged the result, or none
+// when it is not flagged.
+type severityAggregator func(agg *severityAggregation, enabled, above moderation.Result) moderation.Result
+
+var severityAggregators = map[string]severityAggregator{
+	aggregationAny:      aggregateAny,
+	aggregationSum:      aggregateSum,
+	aggregationWeighted: aggregateWeighted,
+	aggregationCount:    aggregateCount,
+}
+
+// severityAggregation combines the category severities of a result into a
+// single decision. All methods are safe to call on nil settings, which flag
+// any category reaching its threshold.
+type severityAggregation struct {
+	strategy  string
+	aggregate severityAggregator
+
+	// threshold is the score the sum and weighted strategies must reach, or
+	// the number of categories the count strategy requires
+	threshold int
+
+	// weights multiply the severity of each category in the weighted
+	// strategy, keyed by lowercase category name. Other categories weigh 1.
+	weights map[string]float64
+}
+
+// newSeverityAggregation returns the aggregation settings for the strategy. A
+// threshold that is not positive uses the default of the strategy.
+func newSeverityAggregation(strategy string, threshold int, weights map[string]float64) (*severityAggregation, error) {
+	if strategy == "" {
+		strategy = aggregationAny
+	}
+	aggregate, ok := severityAggregators[strategy]
+	if !ok {
+		return nil, errors.Errorf("unknown severity aggregation strategy '%s'", strategy)
+	}
+
+	if threshold <= 0 {
+		threshold = defaultAggregateScore
+		if strategy == aggregationCount {
+			threshold = defaultAggregateCount
+		}
+	}
+
+	return &severityAggregation{
+		strategy:  strategy,
+		aggregate: aggregate,
+		threshold: threshold,
+		weights:   weights,
+	}, nil
+}
+
+// flagged returns the categories that flag the result
+func (a *severityAggregation) flagged(enabled, above moderation.Result) moderation.Result {
+	if a == nil {
+		return aggregateAny(a, enabled, above)
+	}
+	return a.aggregate(a, enabled, above)
+}
+
+// weight returns the weight of the category in the weighted strategy
+func (a *severityAggregation) weight(category string) float64 {
+	if weight, ok := a.weights[canonicalCategory(category)]; ok {
+		return weight
+	}
+	return 1
+}
+
+// String describes the strategy for the status command
+func (a *severityAggregation) String() string {
+	switch {
+	case a == nil || a.strategy == aggregationAny:
+		return "any category at its threshold"
+	case a.strategy == aggregationCount:
+		return fmt.Sprintf("at least %d categories at their threshold", a.threshold)
+	default:
+		return fmt.Sprintf("%s of severities reaching %d", a.strategy, a.threshold)
+	}
+}
+
+// aggregateAny flags the result when any category reaches its threshold
+func aggregateAny(_ *severityAggregation, _, above moderation.Result) moderation.Result {
+	return above
+}
+
+// aggregateCount flags the result when enough categories reach their
+// threshold
+func aggregateCount(agg *severityAggregation, _, above moderation.Result) moderation.Result {
+	if len(above) < agg.threshold {
+		return nil
+	}
+	return above
+}
+
+// aggregateSum flags the result when the severities of the enabled categories
+// add up to the threshold, reporting every category that contributed
+func aggregateSum(agg *severityAggregation, enabled, _ moderation.Result) moderation.Result {
+	total := 0
+	for _, severity := range enabled {
+		total += severity
+	}
+	if total < agg.threshold {
+		return nil
+	}
+	return contributingCategories(agg, enabled)
+}
+
+// aggregateWeighted flags the result when the weighted severities of the
+// enabled categories add up to the threshold, reporting every category that
+// contributed
+func aggregateWeighted(agg *severityAggregation, enabled, _ moderation.Result) moderation.Result {
+	total := 0.0
+	for category, severity := range enabled {
+		total += float64(severity) * agg.weight(category)
+	}
+	if total < float64(agg.threshold) {
+		return nil
+	}
+	return contributingCategories(agg, enabled)
+}
+
+// contributingCategories returns the categories adding to an aggregate score
+func contributingCategories(agg *severityAggregation, enabled moderation.Result) moderation.Result {
+	contributing := make(moderation.Result)
+	for category, severity := range enabled {
+		if severity > 0 && (agg.strategy != aggregationWeighted || agg.weight(category) > 0) {
+			contributing[category] = severity
+		}
+	}
+	return contributing
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeverityAggregation(t *testing.T) {
+	// No category reaches the threshold of 4 on its own, but two are close
+	result := moderation.Result{"Hate": 3, "Violence": 3, "Sexual": 2, "SelfHarm": 0}
+
+	tests := []struct {
+		name      string
+		strategy  string
+		threshold int
+		weights   map[string]float64
+		flagged   moderation.Result
+	}{
+		{
+			name:     "Any category",
+			strategy: aggregationAny,
+		},
+		{
+			name:     "Sum reaching the default score",
+			strategy: aggregationSum,
+			flagged:  moderation.Result{"Hate": 3, "Violence": 3, "Sexual": 2},
+		},
+		{
+			name:      "Sum below the score",
+			strategy:  aggregationSum,
+			threshold: 9,
+		},
+		{
+			name:      "Weighted sum",
+			strategy:  aggregationWeighted,
+			threshold: 9,
+			weights:   map[string]float64{"violence": 2, "sexual": 0},
+			flagged:   moderation.Result{"Hate": 3, "Violence": 3},
+		},
+		{
+			name:     "Weighted sum with weights lowering the score",
+			strategy: aggregationWeighted,
+			weights:  map[string]float64{"hate": 0.5, "violence": 0.5},
+		},
+		{
+			name:     "Category count",
+			strategy: aggregationCount,
+		},
+		{
+			name:      "Category count with a single category",
+			strategy:  aggregationCount,
+			threshold: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregation, err := newSeverityAggregation(tt.strategy, tt.threshold, tt.weights)
+			require.NoError(t, err)
+			policy := &moderationPolicy{thresholdValue: 4, aggregation: aggregation}
+
+			assert.Equal(t, len(tt.flagged) > 0, policy.resultSeverityAboveThreshold(result, 4))
+			if len(tt.flagged) > 0 {
+				assert.Equal(t, tt.flagged, policy.flaggedCategories(result, 4))
+			}
+		})
+	}
+
+	t.Run("Category count uses the category thresholds", func(t *testing.T) {
+		aggregation, err := newSeverityAggregation(aggregationCount, 0, nil)
+		require.NoError(t, err)
+		policy := &moderationPolicy{
+			thresholdValue:     4,
+			categoryThresholds: map[string]int{"hate": 3, "violence": 3},
+			aggregation:        aggregation,
+		}
+		assert.Equal(t, moderation.Result{"Hate": 3, "Violence": 3}, policy.flaggedCategories(result, 4))
+	})
+
+	t.Run("Disabled categories add nothing to the sum", func(t *testing.T) {
+		aggregation, err := newSeverityAggregation(aggregationSum, 0, nil)
+		require.NoError(t, err)
+		policy := &moderationPolicy{
+			thresholdValue:     4,
+			disabledCategories: map[string]struct{}{"sexual": {}},
+			aggregation:        aggregation,
+		}
+		assert.False(t, policy.resultSeverityAboveThreshold(result, 4))
+	})
+}
+
+func TestNewSeverityAggregation(t *testing.T) {
+	aggregation, err := newSeverityAggregation("", 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, aggregationAny, aggregation.strategy)
+
+	aggregation, err = newSeverityAggregation(aggregationCount, 0, nil)
+	require.NoError(t, err)
+	assert.Equal(t, defaultAggregateCount, aggregation.threshold)
+
+	_, err = newSeverityAggregation("max", 0, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// moderatedText returns the text of the post that is moderated: its message
+// and, when enabled, the user-controlled text of its message attachments
+func moderatedText(post *model.Post, includeAttachments bool) string {
+	var parts []string
+	if post.Message != "" {
+		parts = append(parts, post.Message)
+	}
+	if includeAttachments {
+		parts = append(parts, attachmentTexts(post)...)
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// attachmentTexts returns the pretext, title, text and field titles and
+// values of the message attachments of the post. Attachments of posts made
+// by bots and plugins are generated rather than written by users, so they
+// are skipped. Posts from incoming webhooks are included since their
+// content comes from outside the server.
+func attachmentTexts(post *model.Post) []string {
+	if isTrueProp(post.GetProp(model.PostPropsFromBot)) || isTrueProp(post.GetProp("from_plugin")) {
+		return nil
+	}
+
+	var texts []string
+	add := func(text string) {
+		if text = strings.TrimSpace(text); text != "" {
+			texts = append(texts, text)
+		}
+	}
+
+	for _, attachment := range post.Attachments() {
+		if attachment == nil {
+			continue
+		}
+
+		add(attachment.Pretext)
+		add(attachment.Title)
+		add(attachment.Text)
+		for _, field := range attachment.Fields {
+			if field == nil {
+				continue
+			}
+			add(field.Title)
+			if field.Value != nil {
+				add(fmt.Sprint(field.Value))
+			}
+		}
+	}
+
+	return texts
+}
+
+// isTrueProp reports whether a post property is set to true. Properties
+// decoded from JSON may hold either a bool or a string.
+func isTrueProp(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
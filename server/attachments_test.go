@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newAttachmentPost() *model.Post {
+	post := &model.Post{Id: "post1", UserId: "user1", Message: "Nice weather today"}
+	post.AddProp("attachments", []any{
+		map[string]any{
+			"pretext": "Daily report",
+			"title":   "Summary",
+			"text":    "All good",
+			"footer":  "Sent by the reporting integration",
+			"fields": []any{
+				map[string]any{"title": "Comment", "value": "Offensive remark", "short": true},
+				map[string]any{"title": "Count", "value": 3},
+			},
+		},
+	})
+	return post
+}
+
+func TestAttachmentTexts(t *testing.T) {
+	t.Run("User-controlled fields are extracted", func(t *testing.T) {
+		assert.Equal(t, []string{"Daily report", "Summary", "All good", "Comment", "Offensive remark", "Count", "3"}, attachmentTexts(newAttachmentPost()))
+	})
+
+	t.Run("Incoming webhook attachments are extracted", func(t *testing.T) {
+		post := newAttachmentPost()
+		post.AddProp(model.PostPropsFromWebhook, "true")
+		assert.NotEmpty(t, attachmentTexts(post))
+	})
+
+	t.Run("Bot and plugin attachments are skipped", func(t *testing.T) {
+		post := newAttachmentPost()
+		post.AddProp(model.PostPropsFromBot, "true")
+		assert.Empty(t, attachmentTexts(post))
+
+		post = newAttachmentPost()
+		post.AddProp("from_plugin", true)
+		assert.Empty(t, attachmentTexts(post))
+	})
+
+	t.Run("No attachments", func(t *testing.T) {
+		assert.Empty(t, attachmentTexts(&model.Post{Message: "Hello"}))
+	})
+}
+
+func TestModeratedText(t *testing.T) {
+	post := newAttachmentPost()
+	assert.Equal(t, "Nice weather today", moderatedText(post, false))
+	assert.Equal(t, "Nice weather today\n\nDaily report\n\nSummary\n\nAll good\n\nComment\n\nOffensive remark\n\nCount\n\n3", moderatedText(post, true))
+
+	post.Message = ""
+	assert.Equal(t, "Daily report\n\nSummary\n\nAll good\n\nComment\n\nOffensive remark\n\nCount\n\n3", moderatedText(post, true))
+}
+
+func TestModeratePostAttachments(t *testing.T) {
+	newModerator := func() *MockModerator {
+		mockModerator := &MockModerator{}
+		mockModerator.On("ModerateText", mock.Anything, mock.MatchedBy(func(text string) bool {
+			return text == "Nice weather today"
+		})).Return(moderation.Result{"hate": 0}, nil)
+		mockModerator.On("ModerateText", mock.Anything, mock.Anything).Return(moderation.Result{"hate": 6}, nil)
+		return mockModerator
+	}
+
+	t.Run("Offensive attachment field is flagged", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		mockAPI.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "post1", "severity_threshold", 4, "computed_severity_hate", 6, "severity_breakdown", "hate: 6").Return()
+
+		processor := &PostProcessor{
+			moderator:           newModerator(),
+			policy:              &moderationPolicy{thresholdValue: 4},
+			moderateAttachments: true,
+		}
+
+		err := processor.moderatePost(mockAPI, newAttachmentPost())
+		assert.ErrorIs(t, err, ErrModerationRejection)
+		mockAPI.AssertExpectations(t)
+	})
+
+	t.Run("Attachments are ignored when disabled", func(t *testing.T) {
+		mockModerator := newModerator()
+		processor := &PostProcessor{
+			moderator: mockModerator,
+			policy:    &moderationPolicy{thresholdValue: 4},
+		}
+
+		err := processor.moderatePost(&plugintest.API{}, newAttachmentPost())
+		assert.NoError(t, err)
+		mockModerator.AssertCalled(t, "ModerateText", mock.Anything, "Nice weather today")
+	})
+}
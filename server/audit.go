@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/store/sqlstore"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	auditLevelOff     = "off"
+	auditLevelFlagged = "flagged"
+	auditLevelAll     = "all"
+
+	auditDecisionAllowed = "allowed"
+	auditDecisionFlagged = "flagged"
+)
+
+// auditStore persists the audit record of each moderation decision
+type auditStore interface {
+	InsertAuditRecord(record *sqlstore.AuditRecord) error
+	GetAuditDecisionCounts(from, to int64) (map[string]int, error)
+}
+
+// auditSettings controls which moderation decisions are audited and whether
+// the audit records include the moderated message
+type auditSettings struct {
+	level         string
+	redactMessage bool
+}
+
+func newAuditSettings(level string, redactMessage bool) (*auditSettings, error) {
+	switch level {
+	case "":
+		level = auditLevelOff
+	case auditLevelOff, auditLevelFlagged, auditLevelAll:
+	default:
+		return nil, errors.Errorf("unknown audit level '%s'", level)
+	}
+
+	return &auditSettings{
+		level:         level,
+		redactMessage: redactMessage,
+	}, nil
+}
+
+// auditDecision records the moderation decision for the post, when auditing
+// is enabled for the decision and an audit store is configured. Failures are
+// logged so that they never prevent the moderation action.
+func (p *PostProcessor) auditDecision(api plugin.API, post *model.Post, result moderation.Result, flagged bool) {
+	if p.audit == nil || p.auditStore == nil || p.audit.level == auditLevelOff {
+		return
+	}
+	if !flagged && p.audit.level != auditLevelAll {
+		return
+	}
+
+	record := &sqlstore.AuditRecord{
+		PostID:    post.Id,
+		UserID:    post.UserId,
+		ChannelID: post.ChannelId,
+		Result:    result,
+		Threshold: p.policy.postThreshold(api, post),
+		Decision:  auditDecisionAllowed,
+	}
+	if flagged {
+		record.Decision = auditDecisionFlagged
+	}
+	if !p.audit.redactMessage {
+		record.Message = post.Message
+	}
+
+	if err := p.auditStore.InsertAuditRecord(record); err != nil {
+		api.LogError("Failed to record moderation audit record", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+	}
+}
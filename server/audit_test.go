@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/store/sqlstore"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAuditStore keeps audit records in memory
+type fakeAuditStore struct {
+	records []*sqlstore.AuditRecord
+	err     error
+}
+
+func (s *fakeAuditStore) InsertAuditRecord(record *sqlstore.AuditRecord) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *fakeAuditStore) GetAuditDecisionCounts(from, to int64) (map[string]int, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	counts := make(map[string]int)
+	for _, record := range s.records {
+		if record.CreateAt >= from && record.CreateAt < to {
+			counts[record.Decision]++
+		}
+	}
+	return counts, nil
+}
+
+func TestNewAuditSettings(t *testing.T) {
+	settings, err := newAuditSettings("", false)
+	require.NoError(t, err)
+	assert.Equal(t, auditLevelOff, settings.level)
+
+	settings, err = newAuditSettings(auditLevelAll, true)
+	require.NoError(t, err)
+	assert.Equal(t, &auditSettings{level: auditLevelAll, redactMessage: true}, settings)
+
+	_, err = newAuditSettings("verbose", false)
+	assert.Error(t, err)
+}
+
+func TestModeratePostAudit(t *testing.T) {
+	moderator := &MockModerator{}
+	moderator.On("ModerateText", mock.Anything, "offensive").Return(moderation.Result{"Hate": 6, "Violence": 0}, nil)
+	moderator.On("ModerateText", mock.Anything, "harmless").Return(moderation.Result{"Hate": 0, "Violence": 0}, nil)
+
+	offensive := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "offensive"}
+	harmless := &model.Post{Id: "post2", UserId: "user1", ChannelId: "strict", Message: "harmless"}
+
+	moderate := func(t *testing.T, audit *auditSettings) []*sqlstore.AuditRecord {
+		api := &plugintest.API{}
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+		store := &fakeAuditStore{}
+		processor := &PostProcessor{
+			moderator:  moderator,
+			policy:     newModerationPolicy(4, nil, map[string]int{"strict": 2}, nil, nil),
+			audit:      audit,
+			auditStore: store,
+		}
+
+		assert.ErrorIs(t, processor.moderatePost(api, offensive), ErrModerationRejection)
+		assert.NoError(t, processor.moderatePost(api, harmless))
+		return store.records
+	}
+
+	t.Run("Off", func(t *testing.T) {
+		assert.Empty(t, moderate(t, &auditSettings{level: auditLevelOff}))
+	})
+
+	t.Run("Flagged only", func(t *testing.T) {
+		records := moderate(t, &auditSettings{level: auditLevelFlagged})
+		assert.Equal(t, []*sqlstore.AuditRecord{{
+			PostID:    "post1",
+			UserID:    "user1",
+			ChannelID: "channel1",
+			Result:    map[string]int{"Hate": 6, "Violence": 0},
+			Threshold: 4,
+			Decision:  auditDecisionFlagged,
+			Message:   "offensive",
+		}}, records)
+	})
+
+	t.Run("All decisions with redacted messages", func(t *testing.T) {
+		records := moderate(t, &auditSettings{level: auditLevelAll, redactMessage: true})
+		require.Len(t, records, 2)
+		assert.Equal(t, auditDecisionFlagged, records[0].Decision)
+		assert.Equal(t, &sqlstore.AuditRecord{
+			PostID:    "post2",
+			UserID:    "user1",
+			ChannelID: "strict",
+			Result:    map[string]int{"Hate": 0, "Violence": 0},
+			Threshold: 2,
+			Decision:  auditDecisionAllowed,
+		}, records[1])
+		assert.Empty(t, records[0].Message)
+	})
+}
+
+func TestAuditDecisionStoreFailure(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogError", "Failed to record moderation audit record", "post_id", "post1", "err", mock.Anything).Return()
+
+	processor := &PostProcessor{
+		policy:     newModerationPolicy(4, nil, nil, nil, nil),
+		audit:      &auditSettings{level: auditLevelAll},
+		auditStore: &fakeAuditStore{err: errors.New("database is down")},
+	}
+	processor.auditDecision(api, &model.Post{Id: "post1"}, moderation.Result{}, false)
+
+	api.AssertExpectations(t)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// queueBackpressure adds workers while the moderation queue is backed up, so
+// that a burst of posts is worked through before the queue fills and posts
+// are dropped. Added workers share the rate limiter of the processor, so they
+// only help while the provider latency, not the rate limit, holds up
+// moderation. All methods are safe to call on a nil queueBackpressure, which
+// never adds workers.
+type queueBackpressure struct {
+	// highWaterMark is the queue depth at which workers are added, and
+	// lowWaterMark the depth at which the added workers exit again
+	highWaterMark int
+	lowWaterMark  int
+
+	// overloaded is set from the queue reaching its high-water mark until it
+	// drains to its low-water mark
+	overloaded atomic.Bool
+}
+
+// newQueueBackpressure returns the backpressure settings of a queue holding
+// up to maxQueueSize posts. The high-water mark defaults to 80% of the queue
+// and the low-water mark to half of the high-water mark.
+func newQueueBackpressure(highWaterMark, lowWaterMark, maxQueueSize int) (*queueBackpressure, error) {
+	if highWaterMark == 0 {
+		highWaterMark = maxQueueSize * 8 / 10
+	}
+	if lowWaterMark == 0 {
+		lowWaterMark = highWaterMark / 2
+	}
+
+	if highWaterMark <= 0 || highWaterMark > maxQueueSize {
+		return nil, errors.Errorf("queue high-water mark must be between 1 and the maximum queue size of %d, got %d", maxQueueSize, highWaterMark)
+	}
+	if lowWaterMark < 0 || lowWaterMark >= highWaterMark {
+		return nil, errors.Errorf("queue low-water mark must be below the high-water mark of %d, got %d", highWaterMark, lowWaterMark)
+	}
+
+	return &queueBackpressure{
+		highWaterMark: highWaterMark,
+		lowWaterMark:  lowWaterMark,
+	}, nil
+}
+
+// checkBackpressure doubles the workers once the queue reaches its high-water
+// mark. Workers are only added to a started processor.
+func (p *PostProcessor) checkBackpressure(api plugin.API) {
+	if p.backpressure == nil || p.workersDone == nil {
+		return
+	}
+
+	depth := p.queueDepth()
+	if depth < p.backpressure.highWaterMark || p.backpressure.overloaded.Swap(true) {
+		return
+	}
+
+	api.LogWarn("Content moderation queue reached its high-water mark, adding workers until it drains",
+		"queue_depth", depth, "high_water_mark", p.backpressure.highWaterMark, "added_workers", p.workerCount)
+
+	// The queue is still open, so the initial workers are running and the
+	// wait group cannot have reached zero
+	for range p.workerCount {
+		p.workers.Add(1)
+		go p.runWorker(api, true)
+	}
+}
+
+// relieved reports whether the queue has drained to its low-water mark, so
+// that added workers can exit
+func (b *queueBackpressure) relieved(api plugin.API, depth int) bool {
+	if b == nil {
+		return true
+	}
+	if depth > b.lowWaterMark {
+		return false
+	}
+
+	if b.overloaded.CompareAndSwap(true, false) {
+		api.LogInfo("Content moderation queue drained to its low-water mark, removing added workers",
+			"queue_depth", depth, "low_water_mark", b.lowWaterMark)
+	}
+	return true
+}
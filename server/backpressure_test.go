@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewQueueBackpressure(t *testing.T) {
+	backpressure, err := newQueueBackpressure(0, 0, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, 800, backpressure.highWaterMark)
+	assert.Equal(t, 400, backpressure.lowWaterMark)
+
+	backpressure, err = newQueueBackpressure(500, 100, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, 500, backpressure.highWaterMark)
+	assert.Equal(t, 100, backpressure.lowWaterMark)
+
+	_, err = newQueueBackpressure(2000, 0, 1000)
+	assert.EqualError(t, err, "queue high-water mark must be between 1 and the maximum queue size of 1000, got 2000")
+
+	_, err = newQueueBackpressure(500, 500, 1000)
+	assert.EqualError(t, err, "queue low-water mark must be below the high-water mark of 500, got 500")
+}
+
+// concurrencyModerator blocks every request until released, and records the
+// highest number of requests in progress at once
+type concurrencyModerator struct {
+	release chan struct{}
+
+	mu      sync.Mutex
+	active  int
+	maxSeen int
+
+	// started receives the number of requests in progress whenever a
+	// request starts
+	started chan int
+}
+
+func (m *concurrencyModerator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	m.mu.Lock()
+	m.active++
+	m.maxSeen = max(m.maxSeen, m.active)
+	active := m.active
+	m.mu.Unlock()
+	m.started <- active
+
+	<-m.release
+
+	m.mu.Lock()
+	m.active--
+	m.mu.Unlock()
+	return moderation.Result{}, nil
+}
+
+func (m *concurrencyModerator) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func TestQueueBackpressure(t *testing.T) {
+	const posts = 30
+
+	moderator := &concurrencyModerator{release: make(chan struct{}), started: make(chan int, posts)}
+	settings := testProcessorSettings(moderator)
+	settings.postsPerMinuteLimit = 60000
+	settings.workerCount = 2
+	settings.maxQueueSize = minQueueSize
+	settings.queueHighWaterMark = 10
+	settings.queueLowWaterMark = 2
+	processor, err := newPostProcessor(settings)
+	require.NoError(t, err)
+
+	api := &plugintest.API{}
+	api.On("LogWarn", "Content moderation queue reached its high-water mark, adding workers until it drains",
+		"queue_depth", 10, "high_water_mark", 10, "added_workers", 2).Return().Once()
+	api.On("LogInfo", "Content moderation queue drained to its low-water mark, removing added workers",
+		"queue_depth", mock.Anything, "low_water_mark", 2).Return().Once()
+	api.On("LogInfo", "Content moderation processor started", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+	api.On("KVDelete", mock.Anything).Return(nil)
+	processor.start(api)
+
+	// The provider stalls while posts keep arriving, so the queue backs up
+	// behind the two workers
+	for i := range posts {
+		processor.queuePostForProcessing(api, &model.Post{Id: fmt.Sprintf("post%d", i), UserId: "user1", Message: "text"})
+	}
+
+	// Two more workers are added once the queue reaches its high-water mark
+	timeout := time.After(5 * time.Second)
+	for active := 0; active < 4; {
+		select {
+		case active = <-moderator.started:
+		case <-timeout:
+			require.FailNow(t, "workers were not added")
+		}
+	}
+
+	close(moderator.release)
+	assert.True(t, processor.drain(5*time.Second))
+	assert.Equal(t, 4, moderator.maxSeen, "no more than the added workers run")
+	assert.False(t, processor.backpressure.overloaded.Load())
+	api.AssertExpectations(t)
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/azure"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const statusCommandTrigger = "moderation-status"
+
+func (p *Plugin) registerCommands() error {
+	if err := p.API.RegisterCommand(&model.Command{
+		Trigger:          statusCommandTrigger,
+		AutoComplete:     true,
+		AutoCompleteDesc: "Show the status of the content moderation plugin",
+		DisplayName:      "Content Moderation Status",
+		Description:      "Show the status of the content moderation plugin.",
+	}); err != nil {
+		return errors.Wrapf(err, "failed to register %s command", statusCommandTrigger)
+	}
+	if err := p.API.RegisterCommand(&model.Command{
+		Trigger:          moderationCommandTrigger,
+		AutoComplete:     true,
+		AutoCompleteDesc: "Manage content moderation exclusions and pending deletions",
+		AutoCompleteHint: "[exclude|unexclude|exclusions|cancel-deletion]",
+		DisplayName:      "Content Moderation",
+		Description:      "Manage the users and channels excluded from content moderation.",
+	}); err != nil {
+		return errors.Wrapf(err, "failed to register %s command", moderationCommandTrigger)
+	}
+	return nil
+}
+
+// ExecuteCommand handles the plugin's slash commands
+func (p *Plugin) ExecuteCommand(_ *plugin.Context, args *model.CommandArgs) (*model.CommandResponse, *model.AppError) {
+	fields := strings.Fields(args.Command)
+	if len(fields) > 0 && strings.TrimPrefix(fields[0], "/") == moderationCommandTrigger {
+		return p.executeModerationCommand(args, fields[1:]), nil
+	}
+	if len(fields) == 0 || strings.TrimPrefix(fields[0], "/") != statusCommandTrigger {
+		return ephemeralResponse(fmt.Sprintf("Unknown command: %s", args.Command)), nil
+	}
+
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return ephemeralResponse("You must be a system admin to view the content moderation status."), nil
+	}
+
+	return ephemeralResponse(p.statusMessage(p.getConfiguration())), nil
+}
+
+func ephemeralResponse(text string) *model.CommandResponse {
+	return &model.CommandResponse{
+		ResponseType: model.CommandResponseTypeEphemeral,
+		Text:         text,
+	}
+}
+
+// statusMessage summarizes the moderation configuration and the state of the
+// processor. Secrets are redacted.
+func (p *Plugin) statusMessage(config *configuration) string {
+	var b strings.Builder
+	b.WriteString("#### Content moderation status\n\n")
+
+	processor := p.getProcessor()
+	if processor == nil {
+		if config.Enabled {
+			b.WriteString("Content moderation is enabled but not running. Check the server logs for initialization errors.")
+		} else {
+			b.WriteString("Content moderation is disabled.")
+		}
+		return b.String()
+	}
+
+	if config.MonitorOnly {
+		b.WriteString("**Mode:** monitor only, flagged posts are logged but left in place\n\n")
+	}
+
+	b.WriteString("**Providers:**\n")
+	for _, moderatorType := range config.TypeList() {
+		fmt.Fprintf(&b, "- %s\n", providerStatus(config, moderatorType))
+	}
+
+	policy := processor.policy
+	if policy.thresholdFallback {
+		fmt.Fprintf(&b, "\n**Threshold:** %d (fallback, the configured threshold could not be parsed)\n", policy.thresholdValue)
+	} else {
+		fmt.Fprintf(&b, "\n**Threshold:** %d\n", policy.thresholdValue)
+	}
+	if policy.warnThreshold != noWarnThreshold {
+		fmt.Fprintf(&b, "**Warn threshold:** %d\n", policy.warnThreshold)
+	}
+	if policy.replyThreshold != nil {
+		fmt.Fprintf(&b, "**Reply threshold:** %d\n", *policy.replyThreshold)
+	}
+	if len(policy.categoryThresholds) > 0 {
+		fmt.Fprintf(&b, "**Category thresholds:** %s\n", moderation.Result(policy.categoryThresholds).String())
+	}
+	if len(policy.channelThresholds) > 0 {
+		fmt.Fprintf(&b, "**Channel thresholds:** %s\n", moderation.Result(policy.channelThresholds).String())
+	}
+	if policy.aggregation != nil && policy.aggregation.strategy != aggregationAny {
+		fmt.Fprintf(&b, "**Severity aggregation:** %s\n", policy.aggregation)
+	}
+
+	if len(processor.unresolvedExcludedUsers) > 0 {
+		fmt.Fprintf(&b, "**Unresolved excluded users:** %s (these users are moderated)\n", strings.Join(processor.unresolvedExcludedUsers, ", "))
+	}
+
+	fmt.Fprintf(&b, "**Queue depth:** %d of %d\n", processor.queueDepth(), processor.queueCapacity())
+	fmt.Fprintf(&b, "**Dropped posts:** %d\n", processor.droppedPostCount())
+
+	health := "healthy"
+	if processor.degraded.Load() {
+		health = "degraded, the last health check or moderation request failed"
+	}
+	fmt.Fprintf(&b, "**Provider health:** %s", health)
+
+	if reporter, ok := processor.moderator.(moderation.RateLimitReporter); ok {
+		if quota := rateLimitStatus(reporter.RateLimit(), time.Now()); quota != "" {
+			fmt.Fprintf(&b, "\n**Provider quota:** %s", quota)
+		}
+	}
+
+	return b.String()
+}
+
+// rateLimitStatus describes the remaining provider quota and any throttling
+// in effect, or returns an empty string when the provider reported neither
+func rateLimitStatus(rateLimit moderation.RateLimit, now time.Time) string {
+	var parts []string
+	switch {
+	case rateLimit.Remaining >= 0 && rateLimit.Limit >= 0:
+		parts = append(parts, fmt.Sprintf("%d of %d requests remaining", rateLimit.Remaining, rateLimit.Limit))
+	case rateLimit.Remaining >= 0:
+		parts = append(parts, fmt.Sprintf("%d requests remaining", rateLimit.Remaining))
+	}
+
+	if wait := rateLimit.ResumeAt.Sub(now); wait > 0 {
+		parts = append(parts, fmt.Sprintf("throttled for another %s", wait.Round(time.Second)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// providerStatus describes how a provider is configured, with its secret redacted
+func providerStatus(config *configuration, moderatorType string) string {
+	switch moderatorType {
+	case "azure":
+		var status string
+		switch {
+		case config.AzureAuthMode == azure.AuthModeAAD && config.AzureClientSecret == "":
+			status = fmt.Sprintf("azure: endpoint `%s`, AAD managed identity", valueOr(config.Endpoint, "not set"))
+		case config.AzureAuthMode == azure.AuthModeAAD:
+			status = fmt.Sprintf("azure: endpoint `%s`, AAD client `%s`, client secret %s",
+				valueOr(config.Endpoint, "not set"), config.AzureClientID, redactSecret(config.AzureClientSecret))
+		default:
+			status = fmt.Sprintf("azure: endpoint `%s`, API key %s", valueOr(config.Endpoint, "not set"), redactSecret(config.APIKey))
+		}
+		if config.AzureInsecureSkipVerify {
+			status += ", TLS verification disabled"
+		}
+		return status
+	case "openai":
+		return fmt.Sprintf("openai: endpoint `%s`, API key %s", valueOr(config.OpenAIEndpoint, "default"), redactSecret(config.OpenAIAPIKey))
+	case "perspective":
+		return fmt.Sprintf("perspective: API key %s", redactSecret(config.PerspectiveAPIKey))
+	case "blocklist":
+		return fmt.Sprintf("blocklist: %d terms", len(config.BlocklistTermList()))
+	case "regex":
+		return "regex: local rules"
+	case "webhook":
+		return fmt.Sprintf("webhook: endpoint `%s`, token %s", valueOr(config.WebhookURL, "not set"), redactSecret(config.WebhookToken))
+	default:
+		return fmt.Sprintf("%s: unknown provider", moderatorType)
+	}
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// redactSecret hides all but the last four characters of long secrets
+func redactSecret(secret string) string {
+	switch {
+	case secret == "":
+		return "not set"
+	case len(secret) <= 8:
+		return "`****`"
+	default:
+		return "`****" + secret[len(secret)-4:] + "`"
+	}
+}
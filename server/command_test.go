@@ -0,0 +1,108 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteStatusCommand(t *testing.T) {
+	args := &model.CommandArgs{UserId: "user1", Command: "/moderation-status"}
+
+	t.Run("Requires system admin", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "user1", model.PermissionManageSystem).Return(false)
+
+		p := &Plugin{}
+		p.SetAPI(api)
+
+		resp, appErr := p.ExecuteCommand(nil, args)
+		assert.Nil(t, appErr)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, resp.ResponseType)
+		assert.Equal(t, "You must be a system admin to view the content moderation status.", resp.Text)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "user1", model.PermissionManageSystem).Return(true)
+
+		p := &Plugin{configuration: &configuration{}}
+		p.SetAPI(api)
+
+		resp, appErr := p.ExecuteCommand(nil, args)
+		assert.Nil(t, appErr)
+		assert.Contains(t, resp.Text, "Content moderation is disabled.")
+	})
+
+	t.Run("Running", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "user1", model.PermissionManageSystem).Return(true)
+
+		processor := &PostProcessor{
+			policy:  newModerationPolicy(4, map[string]int{"sexual": 2}, nil, nil, nil),
+			postsCh: make(chan *model.Post, 10),
+
+			unresolvedExcludedUsers: []string{"nobody"},
+		}
+		processor.postsCh <- &model.Post{Id: "post1"}
+		processor.droppedCount.Add(3)
+		processor.setDegraded(true)
+
+		p := &Plugin{
+			configuration: &configuration{
+				Enabled:        true,
+				Type:           "blocklist,azure",
+				Endpoint:       "https://example.cognitiveservices.azure.com/",
+				APIKey:         "super-secret-api-key",
+				BlocklistTerms: "foo,bar",
+			},
+			processor: processor,
+		}
+		p.SetAPI(api)
+
+		resp, appErr := p.ExecuteCommand(nil, args)
+		assert.Nil(t, appErr)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, resp.ResponseType)
+		assert.Contains(t, resp.Text, "- blocklist: 2 terms\n- azure: endpoint `https://example.cognitiveservices.azure.com/`, API key `****-key`")
+		assert.NotContains(t, resp.Text, "super-secret")
+		assert.Contains(t, resp.Text, "**Threshold:** 4")
+		assert.Contains(t, resp.Text, "**Category thresholds:** sexual: 2")
+		assert.Contains(t, resp.Text, "**Unresolved excluded users:** nobody (these users are moderated)")
+		assert.Contains(t, resp.Text, "**Queue depth:** 1 of 10")
+		assert.Contains(t, resp.Text, "**Dropped posts:** 3")
+		assert.Contains(t, resp.Text, "**Provider health:** degraded")
+	})
+}
+
+func TestRedactSecret(t *testing.T) {
+	assert.Equal(t, "not set", redactSecret(""))
+	assert.Equal(t, "`****`", redactSecret("short"))
+	assert.Equal(t, "`****wxyz`", redactSecret("abcdefghijklmnopqrstuvwxyz"))
+}
+
+func TestProviderStatusAAD(t *testing.T) {
+	config := &configuration{Endpoint: "https://example.cognitiveservices.azure.com/", AzureAuthMode: "aad"}
+	assert.Equal(t, "azure: endpoint `https://example.cognitiveservices.azure.com/`, AAD managed identity", providerStatus(config, "azure"))
+
+	config.AzureClientID = "client"
+	config.AzureClientSecret = "abcdefghijklmnopqrstuvwxyz"
+	assert.Equal(t, "azure: endpoint `https://example.cognitiveservices.azure.com/`, AAD client `client`, client secret `****wxyz`", providerStatus(config, "azure"))
+
+	config.AzureInsecureSkipVerify = true
+	assert.Equal(t, "azure: endpoint `https://example.cognitiveservices.azure.com/`, AAD client `client`, client secret `****wxyz`, TLS verification disabled", providerStatus(config, "azure"))
+}
+
+func TestRateLimitStatus(t *testing.T) {
+	now := time.Now()
+
+	assert.Equal(t, "", rateLimitStatus(moderation.UnknownRateLimit(), now))
+	assert.Equal(t, "120 of 1000 requests remaining", rateLimitStatus(moderation.RateLimit{Limit: 1000, Remaining: 120}, now))
+	assert.Equal(t, "7 requests remaining", rateLimitStatus(moderation.RateLimit{Limit: -1, Remaining: 7}, now))
+	assert.Equal(t, "0 of 1000 requests remaining, throttled for another 5s",
+		rateLimitStatus(moderation.RateLimit{Limit: 1000, Remaining: 0, ResumeAt: now.Add(5 * time.Second)}, now))
+	assert.Equal(t, "", rateLimitStatus(moderation.RateLimit{Limit: -1, Remaining: -1, ResumeAt: now.Add(-time.Second)}, now))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// compliancePostType marks the compliance records posted by the bot
+	compliancePostType = "custom_content_moderation_compliance"
+
+	// complianceRecordProp holds the structured compliance record on the post
+	complianceRecordProp = "content_moderation_event"
+
+	complianceEventPostFlagged = "post_flagged"
+)
+
+// complianceSettings controls the compliance records of moderation actions.
+// The plugin API offers no way to add entries to compliance exports, so each
+// record is posted by the bot to a dedicated channel, where message exports
+// and eDiscovery capture it like any other post. The methods are safe to call
+// on nil settings, which record nothing.
+type complianceSettings struct {
+	channelID string
+
+	// redactMessage leaves the original message out of the records, as it
+	// does for audit records
+	redactMessage bool
+}
+
+// newComplianceSettings returns the compliance settings, or nil when no
+// compliance channel is configured
+func newComplianceSettings(channelID string, redactMessage bool) (*complianceSettings, error) {
+	if channelID == "" {
+		return nil, nil
+	}
+	if !model.IsValidId(channelID) {
+		return nil, errors.Errorf("invalid compliance channel ID '%s'", channelID)
+	}
+
+	return &complianceSettings{
+		channelID:     channelID,
+		redactMessage: redactMessage,
+	}, nil
+}
+
+// complianceRecord is the structured record of a moderation action
+type complianceRecord struct {
+	Event     string `json:"event"`
+	PostID    string `json:"post_id"`
+	UserID    string `json:"user_id"`
+	ChannelID string `json:"channel_id"`
+
+	// Actor is the bot user that acted on the post
+	Actor string `json:"actor"`
+
+	// Action is the moderation action applied, and MonitorOnly reports that
+	// it was only logged and the post was left in place
+	Action      string `json:"action"`
+	MonitorOnly bool   `json:"monitor_only"`
+
+	Categories moderation.Result `json:"flagged_categories"`
+	Result     moderation.Result `json:"result,omitempty"`
+	Threshold  int               `json:"threshold"`
+	Providers  []string          `json:"providers,omitempty"`
+	Language   string            `json:"language,omitempty"`
+
+	// Message is the original message, omitted when redacted
+	Message         string `json:"message,omitempty"`
+	MessageRedacted bool   `json:"message_redacted"`
+
+	Timestamp int64 `json:"timestamp"`
+}
+
+// recordComplianceEvent posts the compliance record of the flagged post to
+// the compliance channel, when one is configured. Failures are logged so
+// that they never prevent the moderation action.
+func (p *PostProcessor) recordComplianceEvent(api plugin.API, post *model.Post, categories moderation.Result, decision moderation.Decision) {
+	if p.compliance == nil {
+		return
+	}
+
+	record := p.complianceRecord(api, post, categories, decision, time.Now())
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		api.LogError("Failed to encode compliance record", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+		return
+	}
+
+	compliancePost := &model.Post{
+		UserId:    p.botID,
+		ChannelId: p.compliance.channelID,
+		Type:      compliancePostType,
+		// The record is also written out in the message, since not every
+		// export format includes post properties
+		Message: "```json\n" + string(data) + "\n```",
+	}
+	compliancePost.AddProp(complianceRecordProp, record)
+
+	if _, appErr := api.CreatePost(compliancePost); appErr != nil {
+		api.LogError("Failed to post compliance record", append(p.policy.loggedIDs("post_id", post.Id), "err", errors.Wrap(appErr, "failed to create post"))...)
+	}
+}
+
+// complianceRecord returns the compliance record of the flagged post
+func (p *PostProcessor) complianceRecord(api plugin.API, post *model.Post, categories moderation.Result, decision moderation.Decision, at time.Time) complianceRecord {
+	record := complianceRecord{
+		Event:           complianceEventPostFlagged,
+		PostID:          post.Id,
+		UserID:          post.UserId,
+		ChannelID:       post.ChannelId,
+		Actor:           p.botID,
+		Action:          p.action.action,
+		MonitorOnly:     p.action.monitorOnly,
+		Categories:      categories,
+		Result:          decision.Result,
+		Threshold:       p.policy.postThreshold(api, post),
+		Providers:       decision.Providers,
+		Language:        decision.Language,
+		MessageRedacted: p.compliance.redactMessage,
+		Timestamp:       model.GetMillisForTime(at),
+	}
+	if !p.compliance.redactMessage {
+		record.Message = post.Message
+	}
+	return record
+}
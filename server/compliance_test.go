@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewComplianceSettings(t *testing.T) {
+	settings, err := newComplianceSettings("", true)
+	require.NoError(t, err)
+	assert.Nil(t, settings, "compliance records are off without a channel")
+
+	_, err = newComplianceSettings("not-a-channel", true)
+	assert.Error(t, err)
+}
+
+func TestRecordComplianceEvent(t *testing.T) {
+	const complianceChannelID = "cccccccccccccccccccccccccc"
+
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+	categories := moderation.Result{"Hate": 6}
+	decision := moderation.Decision{
+		Result:    moderation.Result{"Hate": 6, "Violence": 2},
+		Providers: []string{"azure"},
+		Language:  "en",
+	}
+
+	flag := func(t *testing.T, redactMessage bool) (*model.Post, *plugintest.API) {
+		api := &plugintest.API{}
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("DeletePost", "post1").Return(nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+		settings, err := newComplianceSettings(complianceChannelID, redactMessage)
+		require.NoError(t, err)
+		processor := &PostProcessor{
+			botID:         "bot",
+			policy:        &moderationPolicy{thresholdValue: 4},
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{dmContentMode: dmContentNone},
+			compliance:    settings,
+		}
+		processor.handleFlaggedPost(api, post, categories, decision)
+
+		var recorded *model.Post
+		for _, call := range api.Calls {
+			if call.Method != "CreatePost" {
+				continue
+			}
+			if created := call.Arguments.Get(0).(*model.Post); created.ChannelId == complianceChannelID {
+				require.Nil(t, recorded, "only one compliance record is posted")
+				recorded = created
+			}
+		}
+		require.NotNil(t, recorded, "the flagged post is recorded in the compliance channel")
+		return recorded, api
+	}
+
+	t.Run("Records the decision, actor and original message", func(t *testing.T) {
+		recorded, api := flag(t, false)
+		api.AssertCalled(t, "DeletePost", "post1")
+
+		assert.Equal(t, "bot", recorded.UserId)
+		assert.Equal(t, compliancePostType, recorded.Type)
+
+		record, ok := recorded.GetProp(complianceRecordProp).(complianceRecord)
+		require.True(t, ok)
+		assert.NotZero(t, record.Timestamp)
+		record.Timestamp = 0
+		assert.Equal(t, complianceRecord{
+			Event:      complianceEventPostFlagged,
+			PostID:     "post1",
+			UserID:     "user1",
+			ChannelID:  "channel1",
+			Actor:      "bot",
+			Action:     moderationActionDelete,
+			Categories: categories,
+			Result:     decision.Result,
+			Threshold:  4,
+			Providers:  []string{"azure"},
+			Language:   "en",
+			Message:    "Offensive message",
+		}, record)
+
+		// The message holds the same record, for exports without post properties
+		require.True(t, strings.HasPrefix(recorded.Message, "```json\n"))
+		var exported complianceRecord
+		require.NoError(t, json.Unmarshal([]byte(strings.Trim(recorded.Message, "`json\n")), &exported))
+		assert.Equal(t, "post1", exported.PostID)
+		assert.Equal(t, "Offensive message", exported.Message)
+	})
+
+	t.Run("Redacts the original message", func(t *testing.T) {
+		recorded, _ := flag(t, true)
+
+		record := recorded.GetProp(complianceRecordProp).(complianceRecord)
+		assert.Empty(t, record.Message)
+		assert.True(t, record.MessageRedacted)
+		assert.NotContains(t, recorded.Message, "Offensive message")
+	})
+}
@@ -2,9 +2,15 @@ package main
 
 import (
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/azure"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/openai"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/perspective"
 	"github.com/pkg/errors"
 )
 
@@ -23,13 +29,154 @@ type configuration struct {
 	Enabled          bool   `json:"enabled"`
 	ExcludedUsers    string `json:"excludedUsers"`
 	ExcludedChannels string `json:"excludedChannels"`
+	IncludedChannels string `json:"includedChannels"`
+	PriorityChannels string `json:"priorityChannels"`
+	TeamModeration   string `json:"teamModeration"`
 	BotUsername      string `json:"botUsername"`
 
-	Type string `json:"type"`
+	SkipBotPosts     bool `json:"skipBotPosts"`
+	SkipWebhookPosts bool `json:"skipWebhookPosts"`
 
-	Endpoint  string `json:"azure_endpoint"`
-	APIKey    string `json:"azure_apiKey"`
-	Threshold string `json:"azure_threshold"`
+	ModerateFilenames   bool `json:"moderateFilenames"`
+	ModerateImages      bool `json:"moderateImages"`
+	MaxImageSizeMB      int  `json:"maxImageSizeMB"`
+	HoldOversizedImages bool `json:"holdOversizedImages"`
+
+	TextFileExtensions string `json:"textFileExtensions"`
+	MaxTextFileSizeKB  int    `json:"maxTextFileSizeKB"`
+
+	ModerateAttachments bool `json:"moderateAttachments"`
+	ModerateReactions   bool `json:"moderateReactions"`
+	ModerateProfiles    bool `json:"moderateProfiles"`
+	StripMarkdown       bool `json:"stripMarkdown"`
+	ModerateEditDelta   bool `json:"moderateEditDelta"`
+
+	AllowedTerms string `json:"allowedTerms"`
+
+	MinMessageCharacters int `json:"minMessageCharacters"`
+	MinMessageWords      int `json:"minMessageWords"`
+
+	MaxModeratedCharacters int    `json:"maxModeratedCharacters"`
+	OverLimitAction        string `json:"overLimitAction"`
+
+	LanguageDetection         bool   `json:"languageDetection"`
+	SupportedLanguages        string `json:"supportedLanguages"`
+	UnsupportedLanguageAction string `json:"unsupportedLanguageAction"`
+
+	PostsPerMinuteLimit   int `json:"postsPerMinuteLimit"`
+	DispatchJitterPercent int `json:"dispatchJitterPercent"`
+	WorkerCount           int `json:"workerCount"`
+	MaxQueueSize          int `json:"maxQueueSize"`
+	QueueHighWaterMark    int `json:"queueHighWaterMark"`
+	QueueLowWaterMark     int `json:"queueLowWaterMark"`
+
+	MaxConcurrentInlineModerations int `json:"maxConcurrentInlineModerations"`
+
+	ResultCacheSize       int `json:"resultCacheSize"`
+	ResultCacheTTLMinutes int `json:"resultCacheTTLMinutes"`
+
+	ModerationTimeout string `json:"moderationTimeout"`
+	ProviderTimeouts  string `json:"providerTimeouts"`
+
+	CircuitBreakerFailures        int `json:"circuitBreakerFailures"`
+	CircuitBreakerCooldownSeconds int `json:"circuitBreakerCooldownSeconds"`
+
+	MaxModerationAttempts int    `json:"maxModerationAttempts"`
+	DeadLetterAction      string `json:"deadLetterAction"`
+	DeadLetterChannel     string `json:"deadLetterChannel"`
+
+	ModerationFailurePolicy string `json:"moderationFailurePolicy"`
+
+	ModerationAction           string `json:"moderationAction"`
+	DeletionGracePeriodSeconds int    `json:"deletionGracePeriodSeconds"`
+	ReviewChannel              string `json:"reviewChannel"`
+	MonitorOnly                bool   `json:"monitorOnly"`
+
+	ChannelNotificationTemplate string `json:"channelNotificationTemplate"`
+	DMOnlyNotifications         bool   `json:"dmOnlyNotifications"`
+	DMNotificationTemplate      string `json:"dmNotificationTemplate"`
+	DMContentMode               string `json:"dmContentMode"`
+	DMPreviewLength             int    `json:"dmPreviewLength"`
+	DMCategorySeverities        bool   `json:"dmCategorySeverities"`
+
+	NotificationCooldownSeconds int `json:"notificationCooldownSeconds"`
+
+	PolicyAcknowledgement bool   `json:"policyAcknowledgement"`
+	PolicyText            string `json:"policyText"`
+
+	ModerationLogChannelID         string `json:"moderationLogChannelId"`
+	ModerationLogSeverityBreakdown bool   `json:"moderationLogSeverityBreakdown"`
+
+	AuditLevel         string `json:"auditLevel"`
+	AuditRedactMessage bool   `json:"auditRedactMessage"`
+
+	ComplianceChannelID string `json:"complianceChannelId"`
+
+	LogIDMode string `json:"logIdMode"`
+
+	EventWebhookURLs   string `json:"eventWebhookURLs"`
+	EventWebhookSecret string `json:"eventWebhookSecret"`
+
+	Type                 string `json:"type"`
+	ChainContinueOnError bool   `json:"chain_continueOnError"`
+	FallbackProvider     string `json:"fallbackProvider"`
+
+	Endpoint          string `json:"azure_endpoint"`
+	APIKey            string `json:"azure_apiKey"`
+	AzureAuthMode     string `json:"azure_authMode"`
+	AzureTenantID     string `json:"azure_tenantId"`
+	AzureClientID     string `json:"azure_clientId"`
+	AzureClientSecret string `json:"azure_clientSecret"`
+	Threshold         string `json:"azure_threshold"`
+	AzureMaxRetries   int    `json:"azure_maxRetries"`
+	AzureCategories   string `json:"azure_categories"`
+	AzureBlocklists   string `json:"azure_blocklists"`
+	AzureAPIVersion   string `json:"azure_apiVersion"`
+
+	AzureProxyURL              string `json:"azure_proxyUrl"`
+	AzureCACertFile            string `json:"azure_caCertFile"`
+	AzureInsecureSkipVerify    bool   `json:"azure_insecureSkipVerify"`
+	AzureConnectTimeoutSeconds int    `json:"azure_connectTimeoutSeconds"`
+
+	WarnThreshold  string `json:"warnThreshold"`
+	ReplyThreshold string `json:"replyThreshold"`
+
+	FallbackThreshold   string `json:"fallbackThreshold"`
+	FallbackMonitorOnly bool   `json:"fallbackMonitorOnly"`
+
+	CategoryThresholds string `json:"categoryThresholds"`
+	ChannelThresholds  string `json:"channelThresholds"`
+
+	SeverityAggregation          string `json:"severityAggregation"`
+	SeverityAggregationThreshold int    `json:"severityAggregationThreshold"`
+	CategoryWeights              string `json:"categoryWeights"`
+
+	DirectMessageModeration string `json:"directMessageModeration"`
+
+	ModerationSchedule         string `json:"moderationSchedule"`
+	ModerationScheduleTimezone string `json:"moderationScheduleTimezone"`
+	OffHoursThreshold          string `json:"offHoursThreshold"`
+
+	OpenAIEndpoint     string `json:"openai_endpoint"`
+	OpenAIAPIKey       string `json:"openai_apiKey"`
+	OpenAIModel        string `json:"openai_model"`
+	OpenAIOrganization string `json:"openai_organization"`
+
+	PerspectiveAPIKey     string `json:"perspective_apiKey"`
+	PerspectiveAttributes string `json:"perspective_attributes"`
+	PerspectiveLanguages  string `json:"perspective_languages"`
+
+	BlocklistTerms           string `json:"blocklist_terms"`
+	BlocklistWholeWord       bool   `json:"blocklist_wholeWord"`
+	BlocklistCaseSensitive   bool   `json:"blocklist_caseSensitive"`
+	BlocklistAggregation     string `json:"blocklist_aggregation"`
+	BlocklistEscalationCount int    `json:"blocklist_escalationCount"`
+
+	RegexRules string `json:"regex_rules"`
+
+	WebhookURL            string `json:"webhook_url"`
+	WebhookToken          string `json:"webhook_token"`
+	WebhookCategoriesPath string `json:"webhook_categoriesPath"`
 }
 
 func (c *configuration) ExcludedUserSet() map[string]struct{} {
@@ -47,31 +194,452 @@ func (c *configuration) ExcludedUserSet() map[string]struct{} {
 }
 
 func (c *configuration) ExcludedChannelSet() map[string]struct{} {
-	excludedMap := make(map[string]struct{})
-	if strings.TrimSpace(c.ExcludedChannels) == "" {
-		return excludedMap
+	return channelIDSet(c.ExcludedChannels)
+}
+
+// IncludedChannelSet returns the channels to moderate. An empty set moderates
+// every channel that is not excluded.
+func (c *configuration) IncludedChannelSet() map[string]struct{} {
+	return channelIDSet(c.IncludedChannels)
+}
+
+// PriorityChannelSet returns the channels whose posts are moderated before
+// those of other channels
+func (c *configuration) PriorityChannelSet() map[string]struct{} {
+	return channelIDSet(c.PriorityChannels)
+}
+
+func channelIDSet(channelIDs string) map[string]struct{} {
+	channelMap := make(map[string]struct{})
+	if strings.TrimSpace(channelIDs) == "" {
+		return channelMap
 	}
-	for _, channelID := range strings.Split(c.ExcludedChannels, ",") {
+	for _, channelID := range strings.Split(channelIDs, ",") {
 		trimmedID := strings.TrimSpace(channelID)
 		if trimmedID != "" {
-			excludedMap[trimmedID] = struct{}{}
+			channelMap[trimmedID] = struct{}{}
 		}
 	}
-	return excludedMap
+	return channelMap
+}
+
+// TypeList returns the configured moderator types in the order they should run
+func (c *configuration) TypeList() []string {
+	return splitList(c.Type)
+}
+
+// EventWebhookURLList returns the URLs that receive moderation events
+func (c *configuration) EventWebhookURLList() []string {
+	return splitList(c.EventWebhookURLs)
+}
+
+// AzureCategoryList returns the Azure categories to evaluate, or nil to
+// evaluate every category. Names are matched regardless of case.
+func (c *configuration) AzureCategoryList() ([]string, error) {
+	var categories []string
+	for _, name := range splitList(c.AzureCategories) {
+		category, ok := azure.ParseCategory(name)
+		if !ok {
+			return nil, errors.Errorf("unknown Azure category '%s'", name)
+		}
+		categories = append(categories, category)
+	}
+	return categories, nil
+}
+
+// AzureBlocklistList returns the names of the blocklists managed in the
+// Azure resource that text is checked against
+func (c *configuration) AzureBlocklistList() []string {
+	return splitList(c.AzureBlocklists)
+}
+
+// DisabledCategorySet returns the canonical categories of the Azure
+// categories left out of the enabled categories. It is empty unless the Azure
+// provider is configured with a list of categories.
+func (c *configuration) DisabledCategorySet() (map[string]struct{}, error) {
+	disabled := make(map[string]struct{})
+	if !slices.Contains(c.TypeList(), "azure") {
+		return disabled, nil
+	}
+
+	enabled, err := c.AzureCategoryList()
+	if err != nil || len(enabled) == 0 {
+		return disabled, err
+	}
+
+	for _, category := range azure.Categories {
+		if !slices.Contains(enabled, category) {
+			disabled[azure.CategoryMapping.Canonical(category)] = struct{}{}
+		}
+	}
+	return disabled, nil
+}
+
+// PerspectiveAttributeList returns the configured Perspective attributes
+func (c *configuration) PerspectiveAttributeList() []string {
+	return splitList(c.PerspectiveAttributes)
+}
+
+// PerspectiveLanguageList returns the configured Perspective languages
+func (c *configuration) PerspectiveLanguageList() []string {
+	return splitList(c.PerspectiveLanguages)
+}
+
+// SupportedLanguageList returns the languages the moderation provider supports
+func (c *configuration) SupportedLanguageList() []string {
+	return splitList(c.SupportedLanguages)
+}
+
+// AllowedTermList returns the terms removed from text before moderation,
+// which may be separated by commas or newlines
+func (c *configuration) AllowedTermList() []string {
+	return splitList(strings.ReplaceAll(c.AllowedTerms, "\n", ","))
+}
+
+// TextFileExtensionList returns the extensions of the attached text files
+// whose contents are moderated
+func (c *configuration) TextFileExtensionList() []string {
+	return splitList(c.TextFileExtensions)
+}
+
+// BlocklistTermList returns the configured blocklist terms, which may be
+// separated by commas or newlines
+func (c *configuration) BlocklistTermList() []string {
+	return splitList(strings.ReplaceAll(c.BlocklistTerms, "\n", ","))
+}
+
+// splitList splits a comma-separated setting into its trimmed, non-empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		trimmed := strings.TrimSpace(item)
+		if trimmed != "" {
+			items = append(items, trimmed)
+		}
+	}
+	return items
+}
+
+// ResultCacheTTL returns how long moderation results are cached, defaulting
+// to an hour
+func (c *configuration) ResultCacheTTL() time.Duration {
+	if c.ResultCacheTTLMinutes <= 0 {
+		return defaultResultCacheTTL
+	}
+	return time.Duration(c.ResultCacheTTLMinutes) * time.Minute
+}
+
+// CircuitBreakerFailuresValue returns the number of consecutive provider
+// failures that open the circuit breaker, or 0 when the breaker is disabled
+func (c *configuration) CircuitBreakerFailuresValue() int {
+	switch {
+	case c.CircuitBreakerFailures < 0:
+		return 0
+	case c.CircuitBreakerFailures == 0:
+		return defaultCircuitBreakerFailures
+	default:
+		return c.CircuitBreakerFailures
+	}
+}
+
+// CircuitBreakerCooldown returns how long an open circuit breaker rejects
+// requests before letting a trial request through, defaulting to 30 seconds
+func (c *configuration) CircuitBreakerCooldown() time.Duration {
+	if c.CircuitBreakerCooldownSeconds <= 0 {
+		return defaultCircuitBreakerCooldown
+	}
+	return time.Duration(c.CircuitBreakerCooldownSeconds) * time.Second
+}
+
+// DispatchJitterValue returns the dispatch jitter as a fraction of the
+// processing interval
+func (c *configuration) DispatchJitterValue() (float64, error) {
+	if c.DispatchJitterPercent < 0 || c.DispatchJitterPercent > maxDispatchJitterPercent {
+		return 0, errors.Errorf("dispatch jitter must be between 0 and %d percent, got %d", maxDispatchJitterPercent, c.DispatchJitterPercent)
+	}
+	return float64(c.DispatchJitterPercent) / 100, nil
+}
+
+// PostsPerMinuteLimitValue returns the maximum number of posts moderated per
+// minute, or zero to use the default
+func (c *configuration) PostsPerMinuteLimitValue() (int, error) {
+	if c.PostsPerMinuteLimit > maxPostsPerMinuteLimit {
+		return 0, errors.Errorf("posts per minute limit must be at most %d, got %d", maxPostsPerMinuteLimit, c.PostsPerMinuteLimit)
+	}
+	return c.PostsPerMinuteLimit, nil
+}
+
+// MaxQueueSizeValue returns the maximum number of posts waiting for
+// moderation, or zero to use the default
+func (c *configuration) MaxQueueSizeValue() (int, error) {
+	if c.MaxQueueSize != 0 && c.MaxQueueSize < minQueueSize {
+		return 0, errors.Errorf("maximum queue size must be at least %d, got %d", minQueueSize, c.MaxQueueSize)
+	}
+	return c.MaxQueueSize, nil
 }
 
-// ThresholdValue returns the threshold as an integer
+// parseTimeout parses a timeout such as "10s" or "500ms", rejecting timeouts
+// shorter than minModerationTimeout
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not parse timeout '%s'", value)
+	}
+	if timeout < minModerationTimeout {
+		return 0, errors.Errorf("timeout '%s' must be at least %s", value, minModerationTimeout)
+	}
+	return timeout, nil
+}
+
+// ModerationTimeoutValue returns the time allowed for moderating a post,
+// covering every request made for it
+func (c *configuration) ModerationTimeoutValue() (time.Duration, error) {
+	if strings.TrimSpace(c.ModerationTimeout) == "" {
+		return defaultModerationTimeout, nil
+	}
+	return parseTimeout(c.ModerationTimeout)
+}
+
+// ProviderTimeoutMap returns the per-provider request timeouts, keyed by
+// moderator type. Timeouts are written as "type=duration" pairs separated by
+// commas, and may not be longer than the moderation timeout since they would
+// never apply.
+func (c *configuration) ProviderTimeoutMap() (map[string]time.Duration, error) {
+	moderationTimeout, err := c.ModerationTimeoutValue()
+	if err != nil {
+		return nil, err
+	}
+
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range splitList(c.ProviderTimeouts) {
+		moderatorType, value, found := strings.Cut(entry, "=")
+		moderatorType = strings.ToLower(strings.TrimSpace(moderatorType))
+		if !found || moderatorType == "" {
+			return nil, errors.Errorf("provider timeout '%s' must have the form type=duration", entry)
+		}
+		timeout, err := parseTimeout(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timeout for provider '%s'", moderatorType)
+		}
+		if timeout > moderationTimeout {
+			return nil, errors.Errorf("timeout for provider '%s' is longer than the moderation timeout of %s", moderatorType, moderationTimeout)
+		}
+		timeouts[moderatorType] = timeout
+	}
+	return timeouts, nil
+}
+
+// parseThreshold parses a threshold given either as an integer severity or as
+// a named severity level such as "low" or "medium"
+func parseThreshold(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if severity, ok := moderation.ParseSeverityLevel(value); ok {
+		return severity, nil
+	}
+	val, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Errorf("'%s' is neither a number nor one of the severity levels safe, low, medium or high", value)
+	}
+	return val, nil
+}
+
+// ThresholdValue returns the threshold as an integer. Named severity levels
+// are accepted alongside integers.
 func (c *configuration) ThresholdValue() (int, error) {
 	if c.Threshold == "" {
 		return 0, errors.New("required threshold configuration is unset")
 	}
-	val, err := strconv.Atoi(c.Threshold)
+	val, err := parseThreshold(c.Threshold)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not parse threshold value")
+	}
+	return val, nil
+}
+
+// WarnThresholdValue returns the severity from which the authors of allowed
+// posts are warned, or noWarnThreshold when it is unset
+func (c *configuration) WarnThresholdValue() (int, error) {
+	if strings.TrimSpace(c.WarnThreshold) == "" {
+		return noWarnThreshold, nil
+	}
+	val, err := parseThreshold(c.WarnThreshold)
+	if err != nil {
+		return 0, errors.Wrap(err, "could not parse warn threshold value")
+	}
+	if val <= 0 || val > moderation.MaxSeverity {
+		return 0, errors.Errorf("warn threshold %d is outside the range 1-%d", val, moderation.MaxSeverity)
+	}
+	return val, nil
+}
+
+// ReplyThresholdValue returns the threshold applied to thread replies, or
+// false when replies use the same thresholds as root posts. Named severity
+// levels are accepted alongside integers.
+func (c *configuration) ReplyThresholdValue() (int, bool, error) {
+	if strings.TrimSpace(c.ReplyThreshold) == "" {
+		return 0, false, nil
+	}
+	val, err := parseThreshold(c.ReplyThreshold)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "could not parse reply threshold value")
+	}
+	if val < 0 || val > moderation.MaxSeverity {
+		return 0, false, errors.Errorf("reply threshold %d is outside the range 0-%d", val, moderation.MaxSeverity)
+	}
+	return val, true, nil
+}
+
+// FallbackProviderValue returns the local provider that moderates text while
+// the configured providers fail, or an empty string when there is none
+func (c *configuration) FallbackProviderValue() (string, error) {
+	provider := strings.ToLower(strings.TrimSpace(c.FallbackProvider))
+	switch provider {
+	case "", "blocklist", "regex":
+		return provider, nil
+	default:
+		return "", errors.Errorf("invalid fallback provider %q, must be blocklist or regex", c.FallbackProvider)
+	}
+}
+
+// FallbackThresholdValue returns the threshold used when the threshold cannot
+// be parsed, defaulting to the default threshold of the plugin
+func (c *configuration) FallbackThresholdValue() (int, error) {
+	if strings.TrimSpace(c.FallbackThreshold) == "" {
+		return defaultFallbackThreshold, nil
+	}
+	val, err := parseThreshold(c.FallbackThreshold)
 	if err != nil {
-		return 0, errors.Wrapf(err, "could not parse threshold value: '%s'", c.Threshold)
+		return 0, errors.Wrap(err, "could not parse fallback threshold value")
 	}
 	return val, nil
 }
 
+// withFallbackThreshold returns a copy of the configuration using the
+// fallback threshold in place of the threshold, in monitor-only mode when
+// configured. Authors are not warned while falling back, since the warn
+// threshold was chosen against the threshold that could not be parsed.
+func (c *configuration) withFallbackThreshold() (*configuration, error) {
+	fallback, err := c.FallbackThresholdValue()
+	if err != nil {
+		return nil, err
+	}
+
+	config := c.Clone()
+	config.Threshold = strconv.Itoa(fallback)
+	config.MonitorOnly = c.MonitorOnly || c.FallbackMonitorOnly
+	config.WarnThreshold = ""
+	return config, nil
+}
+
+// OffHoursThresholdValue returns the threshold applied outside the moderation
+// schedule, or noOffHoursThreshold when posts are not moderated off hours
+func (c *configuration) OffHoursThresholdValue() (int, error) {
+	if strings.TrimSpace(c.OffHoursThreshold) == "" {
+		return noOffHoursThreshold, nil
+	}
+	val, err := strconv.Atoi(strings.TrimSpace(c.OffHoursThreshold))
+	if err != nil || val < 0 {
+		return 0, errors.Errorf("could not parse off-hours threshold value: '%s'", c.OffHoursThreshold)
+	}
+	return val, nil
+}
+
+// canonicalCategory returns the name results report a configured category
+// under: the canonical category of a provider category such as "SelfHarm" or
+// "IDENTITY_ATTACK", and otherwise the lowercase name, as for the categories
+// of regex rules and webhooks
+func canonicalCategory(name string) string {
+	for _, mapping := range []moderation.CategoryMapping{azure.CategoryMapping, openai.CategoryMapping, perspective.AttributeMapping} {
+		if category, ok := mapping.Lookup(name); ok {
+			return category
+		}
+	}
+	return strings.ToLower(name)
+}
+
+// CategoryThresholdMap returns the per-category threshold overrides, keyed by
+// canonical category name. Overrides are written as "Category=threshold" pairs
+// separated by commas.
+func (c *configuration) CategoryThresholdMap() (map[string]int, error) {
+	thresholds := make(map[string]int)
+	for _, entry := range splitList(c.CategoryThresholds) {
+		category, value, found := strings.Cut(entry, "=")
+		category = strings.TrimSpace(category)
+		if !found || category == "" {
+			return nil, errors.Errorf("category threshold '%s' must have the form Category=threshold", entry)
+		}
+		threshold, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse threshold for category '%s'", category)
+		}
+		thresholds[canonicalCategory(category)] = threshold
+	}
+	return thresholds, nil
+}
+
+// CategoryWeightMap returns the category weights of the weighted severity
+// aggregation, keyed by canonical category name. Weights are written as
+// "Category=weight" pairs separated by commas.
+func (c *configuration) CategoryWeightMap() (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, entry := range splitList(c.CategoryWeights) {
+		category, value, found := strings.Cut(entry, "=")
+		category = strings.TrimSpace(category)
+		if !found || category == "" {
+			return nil, errors.Errorf("category weight '%s' must have the form Category=weight", entry)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || weight < 0 {
+			return nil, errors.Errorf("could not parse weight for category '%s': '%s'", category, value)
+		}
+		weights[canonicalCategory(category)] = weight
+	}
+	return weights, nil
+}
+
+// ChannelThresholdMap returns the per-channel threshold overrides, keyed by
+// channel ID. Overrides are written as "channelID=threshold" pairs separated by
+// commas. Channel IDs are not validated here.
+func (c *configuration) ChannelThresholdMap() (map[string]int, error) {
+	thresholds := make(map[string]int)
+	for _, entry := range splitList(c.ChannelThresholds) {
+		channelID, value, found := strings.Cut(entry, "=")
+		channelID = strings.TrimSpace(channelID)
+		if !found || channelID == "" {
+			return nil, errors.Errorf("channel threshold '%s' must have the form channelID=threshold", entry)
+		}
+		threshold, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not parse threshold for channel '%s'", channelID)
+		}
+		thresholds[channelID] = threshold
+	}
+	return thresholds, nil
+}
+
+// TeamModerationMap returns the per-team moderation overrides, keyed by team
+// ID. Overrides are written as "teamID=enabled" or "teamID=disabled" pairs
+// separated by commas. Team IDs are not validated here.
+func (c *configuration) TeamModerationMap() (map[string]bool, error) {
+	overrides := make(map[string]bool)
+	for _, entry := range splitList(c.TeamModeration) {
+		teamID, value, found := strings.Cut(entry, "=")
+		teamID = strings.TrimSpace(teamID)
+		if !found || teamID == "" {
+			return nil, errors.Errorf("team override '%s' must have the form teamID=enabled or teamID=disabled", entry)
+		}
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case teamModerationEnabled:
+			overrides[teamID] = true
+		case teamModerationDisabled:
+			overrides[teamID] = false
+		default:
+			return nil, errors.Errorf("team override for '%s' must be enabled or disabled", teamID)
+		}
+	}
+	return overrides, nil
+}
+
 // Clone shallow copies the configuration. Your implementation may require a deep copy if
 // your configuration has reference types.
 func (c *configuration) Clone() *configuration {
@@ -121,6 +689,7 @@ func (p *Plugin) setConfiguration(configuration *configuration) {
 		"moderationEnabled", configuration.Enabled,
 		"excludedUsers", configuration.ExcludedUsers,
 		"excludedChannels", configuration.ExcludedChannels,
+		"includedChannels", configuration.IncludedChannels,
 		"moderationThreshold", configuration.Threshold,
 		"botUsername", configuration.BotUsername)
 
@@ -138,9 +707,16 @@ func (p *Plugin) OnConfigurationChange() error {
 
 	p.setConfiguration(config)
 
-	// Initialize or reinitialize the moderator with the new configuration
+	// The configuration is loaded once before activation, and OnActivate
+	// initializes moderation with it
+	if !p.isActive() {
+		return nil
+	}
+
+	// Rebuild the processor with the new configuration. The running processor
+	// is kept when the new configuration cannot be loaded.
 	if err := p.initialize(config); err != nil {
-		p.API.LogError("Failed to reinitialize after configuration change", "err", err)
+		p.API.LogError("Failed to apply configuration change, moderation continues with the previous configuration", "err", err)
 		return nil
 	}
 
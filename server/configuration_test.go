@@ -0,0 +1,378 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThresholdValue(t *testing.T) {
+	for _, tt := range []struct {
+		threshold string
+		expected  int
+	}{
+		{"safe", 0},
+		{"Low", 2},
+		{"MEDIUM", 4},
+		{" high ", 6},
+		{"4", 4},
+		{"3", 3},
+	} {
+		t.Run(tt.threshold, func(t *testing.T) {
+			value, err := (&configuration{Threshold: tt.threshold}).ThresholdValue()
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+
+	for _, threshold := range []string{"", "severe", "2.5"} {
+		t.Run("Invalid "+threshold, func(t *testing.T) {
+			_, err := (&configuration{Threshold: threshold}).ThresholdValue()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestWarnThresholdValue(t *testing.T) {
+	value, err := (&configuration{}).WarnThresholdValue()
+	require.NoError(t, err)
+	assert.Equal(t, noWarnThreshold, value)
+
+	value, err = (&configuration{WarnThreshold: "Low"}).WarnThresholdValue()
+	require.NoError(t, err)
+	assert.Equal(t, 2, value)
+
+	for _, threshold := range []string{"safe", "7", "severe"} {
+		_, err := (&configuration{WarnThreshold: threshold}).WarnThresholdValue()
+		assert.Error(t, err, threshold)
+	}
+}
+
+func TestReplyThresholdValue(t *testing.T) {
+	_, ok, err := (&configuration{}).ReplyThresholdValue()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	value, ok, err := (&configuration{ReplyThreshold: "High"}).ReplyThresholdValue()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 6, value)
+
+	value, ok, err = (&configuration{ReplyThreshold: " 0 "}).ReplyThresholdValue()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, value)
+
+	for _, threshold := range []string{"-1", "7", "severe"} {
+		_, _, err := (&configuration{ReplyThreshold: threshold}).ReplyThresholdValue()
+		assert.Error(t, err, threshold)
+	}
+}
+
+func TestFallbackProviderValue(t *testing.T) {
+	for value, expected := range map[string]string{"": "", " Blocklist ": "blocklist", "regex": "regex"} {
+		provider, err := (&configuration{FallbackProvider: value}).FallbackProviderValue()
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, provider, value)
+	}
+
+	for _, value := range []string{"azure", "webhook", "none"} {
+		_, err := (&configuration{FallbackProvider: value}).FallbackProviderValue()
+		assert.Error(t, err, value)
+	}
+}
+
+func TestFallbackThreshold(t *testing.T) {
+	value, err := (&configuration{}).FallbackThresholdValue()
+	require.NoError(t, err)
+	assert.Equal(t, defaultFallbackThreshold, value)
+
+	config := &configuration{Threshold: "extreme", FallbackThreshold: "medium", WarnThreshold: "low"}
+	fallback, err := config.withFallbackThreshold()
+	require.NoError(t, err)
+	assert.Equal(t, "4", fallback.Threshold)
+	assert.False(t, fallback.MonitorOnly)
+	assert.Empty(t, fallback.WarnThreshold)
+	assert.Equal(t, "extreme", config.Threshold, "the configuration itself is left unchanged")
+
+	config.FallbackMonitorOnly = true
+	fallback, err = config.withFallbackThreshold()
+	require.NoError(t, err)
+	assert.True(t, fallback.MonitorOnly)
+
+	config.FallbackThreshold = "extreme"
+	_, err = config.withFallbackThreshold()
+	assert.Error(t, err)
+}
+
+func TestCategoryThresholdMap(t *testing.T) {
+	t.Run("Unset", func(t *testing.T) {
+		config := &configuration{}
+		thresholds, err := config.CategoryThresholdMap()
+		require.NoError(t, err)
+		assert.Empty(t, thresholds)
+	})
+
+	t.Run("Valid overrides", func(t *testing.T) {
+		config := &configuration{CategoryThresholds: "Sexual=2, SelfHarm = 2,Violence=6"}
+		thresholds, err := config.CategoryThresholdMap()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"sexual": 2, "self_harm": 2, "violence": 6}, thresholds)
+	})
+
+	t.Run("Provider categories apply to their canonical category", func(t *testing.T) {
+		config := &configuration{CategoryThresholds: "self-harm=3,IDENTITY_ATTACK=2,INSULT=5,pii=1"}
+		thresholds, err := config.CategoryThresholdMap()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"self_harm": 3, "hate": 2, "harassment": 5, "pii": 1}, thresholds)
+	})
+
+	t.Run("Invalid entry", func(t *testing.T) {
+		config := &configuration{CategoryThresholds: "Sexual"}
+		_, err := config.CategoryThresholdMap()
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid threshold", func(t *testing.T) {
+		config := &configuration{CategoryThresholds: "Sexual=low"}
+		_, err := config.CategoryThresholdMap()
+		assert.Error(t, err)
+	})
+}
+
+func TestCategoryWeightMap(t *testing.T) {
+	t.Run("Valid weights", func(t *testing.T) {
+		config := &configuration{CategoryWeights: "Violence=2, Hate = 1.5,Sexual=0"}
+		weights, err := config.CategoryWeightMap()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]float64{"violence": 2, "hate": 1.5, "sexual": 0}, weights)
+	})
+
+	t.Run("Invalid entry", func(t *testing.T) {
+		config := &configuration{CategoryWeights: "Violence"}
+		_, err := config.CategoryWeightMap()
+		assert.Error(t, err)
+	})
+
+	t.Run("Negative weight", func(t *testing.T) {
+		config := &configuration{CategoryWeights: "Violence=-1"}
+		_, err := config.CategoryWeightMap()
+		assert.Error(t, err)
+	})
+}
+
+func TestChannelThresholdMap(t *testing.T) {
+	t.Run("Valid overrides", func(t *testing.T) {
+		config := &configuration{ChannelThresholds: "channel1=6, channel2 = 2"}
+		thresholds, err := config.ChannelThresholdMap()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]int{"channel1": 6, "channel2": 2}, thresholds)
+	})
+
+	t.Run("Invalid entry", func(t *testing.T) {
+		config := &configuration{ChannelThresholds: "=6"}
+		_, err := config.ChannelThresholdMap()
+		assert.Error(t, err)
+	})
+}
+
+func TestTeamModerationMap(t *testing.T) {
+	t.Run("Valid overrides", func(t *testing.T) {
+		config := &configuration{TeamModeration: "team1=enabled, team2 = Disabled"}
+		overrides, err := config.TeamModerationMap()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]bool{"team1": true, "team2": false}, overrides)
+	})
+
+	for _, value := range []string{"team1", "=enabled", "team1=on"} {
+		t.Run("Invalid "+value, func(t *testing.T) {
+			config := &configuration{TeamModeration: value}
+			_, err := config.TeamModerationMap()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestPostsPerMinuteLimitValue(t *testing.T) {
+	limit, err := (&configuration{}).PostsPerMinuteLimitValue()
+	require.NoError(t, err)
+	assert.Equal(t, 0, limit)
+
+	limit, err = (&configuration{PostsPerMinuteLimit: maxPostsPerMinuteLimit}).PostsPerMinuteLimitValue()
+	require.NoError(t, err)
+	assert.Equal(t, maxPostsPerMinuteLimit, limit)
+
+	_, err = (&configuration{PostsPerMinuteLimit: 100000000000}).PostsPerMinuteLimitValue()
+	assert.Error(t, err)
+}
+
+func TestMaxQueueSizeValue(t *testing.T) {
+	size, err := (&configuration{}).MaxQueueSizeValue()
+	require.NoError(t, err)
+	assert.Equal(t, 0, size)
+
+	size, err = (&configuration{MaxQueueSize: 50000}).MaxQueueSizeValue()
+	require.NoError(t, err)
+	assert.Equal(t, 50000, size)
+
+	_, err = (&configuration{MaxQueueSize: 10}).MaxQueueSizeValue()
+	assert.Error(t, err)
+
+	_, err = (&configuration{MaxQueueSize: -1}).MaxQueueSizeValue()
+	assert.Error(t, err)
+}
+
+func TestCircuitBreakerSettings(t *testing.T) {
+	assert.Equal(t, defaultCircuitBreakerFailures, (&configuration{}).CircuitBreakerFailuresValue())
+	assert.Equal(t, 10, (&configuration{CircuitBreakerFailures: 10}).CircuitBreakerFailuresValue())
+	assert.Equal(t, 0, (&configuration{CircuitBreakerFailures: -1}).CircuitBreakerFailuresValue())
+
+	assert.Equal(t, defaultCircuitBreakerCooldown, (&configuration{}).CircuitBreakerCooldown())
+	assert.Equal(t, 2*time.Minute, (&configuration{CircuitBreakerCooldownSeconds: 120}).CircuitBreakerCooldown())
+}
+
+func TestModerationTimeoutValue(t *testing.T) {
+	timeout, err := (&configuration{}).ModerationTimeoutValue()
+	require.NoError(t, err)
+	assert.Equal(t, defaultModerationTimeout, timeout)
+
+	timeout, err = (&configuration{ModerationTimeout: " 30s "}).ModerationTimeoutValue()
+	require.NoError(t, err)
+	assert.Equal(t, 30*time.Second, timeout)
+
+	_, err = (&configuration{ModerationTimeout: "10ms"}).ModerationTimeoutValue()
+	assert.Error(t, err)
+
+	_, err = (&configuration{ModerationTimeout: "10"}).ModerationTimeoutValue()
+	assert.Error(t, err)
+}
+
+func TestProviderTimeoutMap(t *testing.T) {
+	t.Run("Valid timeouts", func(t *testing.T) {
+		config := &configuration{ProviderTimeouts: "blocklist=200ms, Azure = 8s"}
+		timeouts, err := config.ProviderTimeoutMap()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]time.Duration{"blocklist": 200 * time.Millisecond, "azure": 8 * time.Second}, timeouts)
+	})
+
+	t.Run("Longer than the moderation timeout", func(t *testing.T) {
+		config := &configuration{ProviderTimeouts: "azure=20s"}
+		_, err := config.ProviderTimeoutMap()
+		assert.Error(t, err)
+
+		config.ModerationTimeout = "30s"
+		_, err = config.ProviderTimeoutMap()
+		assert.NoError(t, err)
+	})
+
+	for _, value := range []string{"azure", "=5s", "azure=fast", "blocklist=1ms"} {
+		t.Run("Invalid "+value, func(t *testing.T) {
+			_, err := (&configuration{ProviderTimeouts: value}).ProviderTimeoutMap()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAzureCategoryList(t *testing.T) {
+	categories, err := (&configuration{}).AzureCategoryList()
+	require.NoError(t, err)
+	assert.Nil(t, categories)
+
+	categories, err = (&configuration{AzureCategories: "sexual, SelfHarm"}).AzureCategoryList()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Sexual", "SelfHarm"}, categories)
+
+	_, err = (&configuration{AzureCategories: "Sexual,Spam"}).AzureCategoryList()
+	assert.Error(t, err)
+}
+
+func TestDisabledCategorySet(t *testing.T) {
+	disabled, err := (&configuration{Type: "azure", AzureCategories: "Sexual,Violence"}).DisabledCategorySet()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"hate": {}, "self_harm": {}}, disabled)
+
+	disabled, err = (&configuration{Type: "azure"}).DisabledCategorySet()
+	require.NoError(t, err)
+	assert.Empty(t, disabled)
+
+	// The categories only apply to Azure results
+	disabled, err = (&configuration{Type: "openai", AzureCategories: "Sexual"}).DisabledCategorySet()
+	require.NoError(t, err)
+	assert.Empty(t, disabled)
+}
+
+func TestOnConfigurationChange(t *testing.T) {
+	config := &configuration{Enabled: true, Type: "blocklist", BlocklistTerms: "badword", Threshold: "4", WorkerCount: 1}
+
+	api := &plugintest.API{}
+	api.On("LoadPluginConfiguration", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*configuration) = *config
+	}).Return(nil)
+	api.On("EnsureBotUser", mock.Anything).Return("bot", nil)
+	api.On("KVList", 0, kvListPageSize).Return([]string{}, nil)
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("LogError", "Moderation threshold could not be parsed, moderating with the fallback threshold until it is fixed",
+		"err", mock.Anything, "fallback_threshold", mock.Anything, "monitor_only", mock.Anything).Return()
+
+	// Anything matches missing arguments, so this matches every info log,
+	// including the summary of the configuration change
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	p := &Plugin{}
+	p.SetAPI(api)
+
+	// The configuration loaded before activation is applied by OnActivate
+	require.NoError(t, p.OnConfigurationChange())
+	assert.Nil(t, p.getProcessor())
+
+	p.setActive(true)
+	require.NoError(t, p.OnConfigurationChange())
+	first := p.getProcessor()
+	require.NotNil(t, first)
+	decision := moderation.Decision{Result: moderation.Result{"blocklist": 3}}
+	assert.NoError(t, first.policy.checkResult(api, "post1", "channel1", decision))
+
+	// A new threshold takes effect without reactivating the plugin, once the
+	// previous processor has stopped
+	config.Threshold = "2"
+	require.NoError(t, p.OnConfigurationChange())
+	second := p.getProcessor()
+	require.NotNil(t, second)
+	assert.NotSame(t, first, second)
+	assert.True(t, first.closed)
+	assert.Equal(t, 2, second.policy.thresholdValue)
+	assert.ErrorIs(t, second.policy.checkResult(api, "post1", "channel1", decision), ErrModerationRejection)
+
+	// A configuration that cannot be loaded keeps the running processor
+	config.Threshold = "extreme"
+	config.FallbackThreshold = "extreme"
+	require.NoError(t, p.OnConfigurationChange())
+	assert.Same(t, second, p.getProcessor())
+	assert.False(t, second.closed)
+
+	// A threshold that cannot be parsed is replaced by the fallback threshold
+	config.FallbackThreshold = "high"
+	config.FallbackMonitorOnly = true
+	require.NoError(t, p.OnConfigurationChange())
+	fallback := p.getProcessor()
+	require.NotNil(t, fallback)
+	assert.NotSame(t, second, fallback)
+	assert.True(t, second.closed)
+	assert.Equal(t, moderation.SeverityHigh, fallback.policy.thresholdValue)
+	assert.True(t, fallback.policy.thresholdFallback)
+	assert.True(t, fallback.action.monitorOnly)
+	api.AssertCalled(t, "LogError", "Moderation threshold could not be parsed, moderating with the fallback threshold until it is fixed",
+		"err", mock.Anything, "fallback_threshold", "6", "monitor_only", true)
+
+	// Disabling moderation stops the running processor
+	config.Enabled = false
+	require.NoError(t, p.OnConfigurationChange())
+	assert.Nil(t, p.getProcessor())
+	assert.True(t, fallback.closed)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// Actions taken for posts that could not be moderated after every attempt
+const (
+	deadLetterDrop   = "drop"
+	deadLetterNotify = "notify"
+	deadLetterHold   = "hold"
+)
+
+// Policies for posts that could not be moderated. Fail-open leaves the post
+// visible, fail-closed removes it.
+const (
+	failurePolicyOpen   = "failOpen"
+	failurePolicyClosed = "failClosed"
+)
+
+const (
+	defaultMaxModerationAttempts = 3
+	defaultRetryBackoff          = time.Second
+	maxRetryBackoff              = 30 * time.Second
+)
+
+const deadLetterNotificationTemplate = "_Content moderation failed for a post after %d attempts and the post was not moderated:_ %s"
+
+// retryPolicy controls how often moderation is retried while the provider is
+// unavailable, and what happens to a post once every attempt has failed
+type retryPolicy struct {
+	maxAttempts         int
+	backoff             time.Duration
+	deadLetterAction    string
+	deadLetterChannelID string
+
+	// failClosed removes posts that could not be moderated instead of
+	// leaving them visible
+	failClosed bool
+}
+
+func newRetryPolicy(maxAttempts int, deadLetterAction, deadLetterChannelID, failurePolicy string) (*retryPolicy, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxModerationAttempts
+	}
+
+	switch deadLetterAction {
+	case "":
+		deadLetterAction = deadLetterHold
+	case deadLetterDrop, deadLetterHold:
+	case deadLetterNotify:
+		if !model.IsValidId(deadLetterChannelID) {
+			return nil, errors.New("a valid dead letter channel ID is required to notify about failed posts")
+		}
+	default:
+		return nil, errors.Errorf("unknown dead letter action %q", deadLetterAction)
+	}
+
+	switch failurePolicy {
+	case "", failurePolicyOpen, failurePolicyClosed:
+	default:
+		return nil, errors.Errorf("unknown moderation failure policy %q", failurePolicy)
+	}
+
+	return &retryPolicy{
+		maxAttempts:         maxAttempts,
+		backoff:             defaultRetryBackoff,
+		deadLetterAction:    deadLetterAction,
+		deadLetterChannelID: deadLetterChannelID,
+		failClosed:          failurePolicy == failurePolicyClosed,
+	}, nil
+}
+
+// backoffFor returns the delay before the attempt following the given one,
+// doubling after every failure up to maxRetryBackoff
+func (r *retryPolicy) backoffFor(attempt int) time.Duration {
+	backoff := r.backoff
+	for i := 1; i < attempt && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxRetryBackoff)
+}
+
+// handleDeadLetter applies the dead letter action to a post that could not be
+// moderated after every attempt, then removes the post in fail-closed mode
+func (p *PostProcessor) handleDeadLetter(api plugin.API, post *model.Post) {
+	api.LogWarn("Giving up on moderating post after repeated failures",
+		append(p.policy.loggedIDs("post_id", post.Id), "attempts", p.retry.maxAttempts, "action", p.retry.deadLetterAction)...)
+
+	switch p.retry.deadLetterAction {
+	case deadLetterDrop:
+		p.removeQueuedPost(api, post.Id)
+	case deadLetterNotify:
+		p.removeQueuedPost(api, post.Id)
+		if _, appErr := api.CreatePost(&model.Post{
+			UserId:    p.botID,
+			ChannelId: p.retry.deadLetterChannelID,
+			Message:   fmt.Sprintf(deadLetterNotificationTemplate, p.retry.maxAttempts, postPermalink(api, post.Id)),
+		}); appErr != nil {
+			api.LogError("Failed to post dead letter notification", append(p.policy.loggedIDs("post_id", post.Id), "err", appErr)...)
+		}
+	}
+
+	if p.retry.failClosed && p.removeUnmoderatedPost(api, post) {
+		return
+	}
+
+	if p.retry.deadLetterAction == deadLetterHold {
+		// Held posts are moderated again once the provider recovers
+		p.holdPostForRescan(api, post.Id)
+	}
+}
+
+// removeUnmoderatedPost deletes a post that could not be moderated, so that
+// unmoderated content does not stay visible, and lets the author know. It
+// returns whether the post was deleted.
+func (p *PostProcessor) removeUnmoderatedPost(api plugin.API, post *model.Post) bool {
+	if p.action.monitorOnly {
+		api.LogInfo("Monitor-only mode, leaving unmoderated post in place", p.policy.loggedIDs("post_id", post.Id)...)
+		return false
+	}
+
+	// A deleted post cannot be moderated later, so it is no longer held
+	p.removeQueuedPost(api, post.Id)
+
+	if appErr := api.DeletePost(post.Id); appErr != nil {
+		api.LogError("Failed to delete post that could not be moderated", append(p.policy.loggedIDs("post_id", post.Id), "err", appErr)...)
+		return false
+	}
+
+	dmChannel, appErr := api.GetDirectChannel(p.botID, post.UserId)
+	if appErr != nil {
+		api.LogError("Failed to create DM channel", append(p.policy.loggedIDs("user_id", post.UserId), "err", appErr)...)
+		return true
+	}
+
+	if _, appErr := api.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: dmChannel.Id,
+		Message:   messagesForLocale(userLocale(api, post.UserId)).dmUnavailable,
+	}); appErr != nil {
+		api.LogError("Failed to notify author of removed unmoderated post", append(p.policy.loggedIDs("post_id", post.Id), "err", appErr)...)
+	}
+	return true
+}
+
+// postPermalink returns a link to the post that works regardless of its team
+func postPermalink(api plugin.API, postID string) string {
+	siteURL := ""
+	if config := api.GetConfig(); config != nil && config.ServiceSettings.SiteURL != nil {
+		siteURL = *config.ServiceSettings.SiteURL
+	}
+	return fmt.Sprintf("%s/_redirect/pl/%s", siteURL, postID)
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	channelID := model.NewId()
+
+	tests := []struct {
+		name                string
+		maxAttempts         int
+		action              string
+		channelID           string
+		failurePolicy       string
+		expectedMaxAttempts int
+		expectedAction      string
+		expectedFailClosed  bool
+		expectError         bool
+	}{
+		{
+			name:                "Defaults",
+			expectedMaxAttempts: defaultMaxModerationAttempts,
+			expectedAction:      deadLetterHold,
+		},
+		{
+			name:                "Drop",
+			maxAttempts:         5,
+			action:              deadLetterDrop,
+			expectedMaxAttempts: 5,
+			expectedAction:      deadLetterDrop,
+		},
+		{
+			name:                "Notify with channel",
+			maxAttempts:         1,
+			action:              deadLetterNotify,
+			channelID:           channelID,
+			expectedMaxAttempts: 1,
+			expectedAction:      deadLetterNotify,
+		},
+		{
+			name:        "Notify without channel",
+			action:      deadLetterNotify,
+			expectError: true,
+		},
+		{
+			name:        "Unknown action",
+			action:      "archive",
+			expectError: true,
+		},
+		{
+			name:                "Fail closed",
+			failurePolicy:       failurePolicyClosed,
+			expectedMaxAttempts: defaultMaxModerationAttempts,
+			expectedAction:      deadLetterHold,
+			expectedFailClosed:  true,
+		},
+		{
+			name:                "Fail open",
+			failurePolicy:       failurePolicyOpen,
+			expectedMaxAttempts: defaultMaxModerationAttempts,
+			expectedAction:      deadLetterHold,
+		},
+		{
+			name:          "Unknown failure policy",
+			failurePolicy: "failSafe",
+			expectError:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retry, err := newRetryPolicy(tt.maxAttempts, tt.action, tt.channelID, tt.failurePolicy)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedMaxAttempts, retry.maxAttempts)
+			assert.Equal(t, tt.expectedAction, retry.deadLetterAction)
+			assert.Equal(t, tt.expectedFailClosed, retry.failClosed)
+			assert.Equal(t, defaultRetryBackoff, retry.backoff)
+		})
+	}
+}
+
+func TestBackoffFor(t *testing.T) {
+	retry := &retryPolicy{backoff: time.Second}
+
+	assert.Equal(t, time.Second, retry.backoffFor(1))
+	assert.Equal(t, 2*time.Second, retry.backoffFor(2))
+	assert.Equal(t, 4*time.Second, retry.backoffFor(3))
+	assert.Equal(t, maxRetryBackoff, retry.backoffFor(10))
+}
+
+func TestProcessPostRetries(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Test message"}
+	deadLetterChannelID := model.NewId()
+
+	newProcessor := func(moderator moderation.Moderator, action string) *PostProcessor {
+		return &PostProcessor{
+			botID:     "bot",
+			moderator: moderator,
+			policy:    &moderationPolicy{thresholdValue: 4},
+			retry: &retryPolicy{
+				maxAttempts:         3,
+				backoff:             time.Millisecond,
+				deadLetterAction:    action,
+				deadLetterChannelID: deadLetterChannelID,
+			},
+		}
+	}
+
+	failingModerator := func() *MockModerator {
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Test message").
+			Return(moderation.Result{}, errors.New("API error"))
+		return moderator
+	}
+
+	t.Run("Flaky moderator succeeds after retries", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", "Retrying content moderation", "post_id", "post1", "attempt", mock.Anything, "backoff", mock.Anything).Return()
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Test message").
+			Return(moderation.Result{}, errors.New("API error")).Twice()
+		moderator.On("ModerateText", mock.Anything, "Test message").
+			Return(moderation.Result{"hate": 0}, nil).Once()
+
+		newProcessor(moderator, deadLetterHold).processPost(api, post)
+
+		moderator.AssertNumberOfCalls(t, "ModerateText", 3)
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Always failing moderator is held", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+		api.On("KVGet", pendingRescanKey).Return(nil, nil)
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["post1"]`), model.PluginKVSetOptions{Atomic: true}).Return(true, nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		moderator := failingModerator()
+		processor := newProcessor(moderator, deadLetterHold)
+		processor.processPost(api, post)
+
+		moderator.AssertNumberOfCalls(t, "ModerateText", 3)
+		assert.True(t, processor.degraded.Load())
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Open circuit breaker skips retries", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", "Moderation provider circuit breaker is open, not retrying", "post_id", "post1", "attempt", 1).Return()
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVGet", pendingRescanKey).Return(nil, nil)
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["post1"]`), model.PluginKVSetOptions{Atomic: true}).Return(true, nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		moderator := failingModerator()
+		newProcessor(moderation.Breaker(moderator, 1, time.Hour), deadLetterHold).processPost(api, post)
+
+		moderator.AssertNumberOfCalls(t, "ModerateText", 1)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Rejected credentials skip retries", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", "Moderation provider rejected its credentials, not retrying", "post_id", "post1", "attempt", 1).Return()
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVGet", pendingRescanKey).Return(nil, nil)
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["post1"]`), model.PluginKVSetOptions{Atomic: true}).Return(true, nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Test message").
+			Return(moderation.Result(nil), moderation.NewError(moderation.ErrorAuth, errors.New("API returned status 401")))
+		newProcessor(moderator, deadLetterHold).processPost(api, post)
+
+		moderator.AssertNumberOfCalls(t, "ModerateText", 1)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Always failing moderator is dropped", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		moderator := failingModerator()
+		newProcessor(moderator, deadLetterDrop).processPost(api, post)
+
+		moderator.AssertNumberOfCalls(t, "ModerateText", 3)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Always failing moderator notifies the dead letter channel", func(t *testing.T) {
+		siteURL := "https://chat.example.com"
+
+		api := &plugintest.API{}
+		api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+		api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: &siteURL}})
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.UserId == "bot" &&
+				p.ChannelId == deadLetterChannelID &&
+				p.Message == "_Content moderation failed for a post after 3 attempts and the post was not moderated:_ https://chat.example.com/_redirect/pl/post1"
+		})).Return(&model.Post{}, nil)
+
+		moderator := failingModerator()
+		newProcessor(moderator, deadLetterNotify).processPost(api, post)
+
+		moderator.AssertNumberOfCalls(t, "ModerateText", 3)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Fail-open leaves the post in place", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+		api.On("KVGet", pendingRescanKey).Return(nil, nil)
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["post1"]`), model.PluginKVSetOptions{Atomic: true}).Return(true, nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		processor := newProcessor(failingModerator(), deadLetterHold)
+		processor.action = &flaggedPostAction{action: moderationActionDelete}
+		processor.processPost(api, post)
+
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Fail-closed removes the post and tells its author", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+		api.On("DeletePost", "post1").Return(nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Locale: "de"}, nil)
+		api.On("CreatePost", &model.Post{
+			UserId:    "bot",
+			ChannelId: "dm",
+			Message:   notificationTranslations["de"].dmUnavailable,
+		}).Return(&model.Post{}, nil)
+
+		processor := newProcessor(failingModerator(), deadLetterHold)
+		processor.retry.failClosed = true
+		processor.action = &flaggedPostAction{action: moderationActionDelete}
+		processor.processPost(api, post)
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Fail-closed in monitor-only mode leaves the post in place", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogInfo", "Monitor-only mode, leaving unmoderated post in place", "post_id", "post1").Return()
+		api.On("KVGet", pendingRescanKey).Return(nil, nil)
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["post1"]`), model.PluginKVSetOptions{Atomic: true}).Return(true, nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		processor := newProcessor(failingModerator(), deadLetterHold)
+		processor.retry.failClosed = true
+		processor.action = &flaggedPostAction{action: moderationActionDelete, monitorOnly: true}
+		processor.processPost(api, post)
+
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+		api.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// directMessageSkip exempts direct and group messages from moderation
+const directMessageSkip = "skip"
+
+// directMessageSettings controls the moderation of direct and group messages.
+// They are moderated like channel posts by default, and can instead be skipped
+// or moderated with their own threshold.
+type directMessageSettings struct {
+	skip bool
+
+	// threshold replaces the global threshold for direct and group messages
+	// when hasThreshold is set
+	threshold    int
+	hasThreshold bool
+
+	// directChannels caches whether each channel looked up is a direct or
+	// group message channel, since the type of a channel never changes
+	directChannels sync.Map
+}
+
+// newDirectMessageSettings parses the direct message moderation setting,
+// which is empty to moderate direct messages like channel posts,
+// directMessageSkip to skip them, or a threshold to apply to them
+func newDirectMessageSettings(mode string) (*directMessageSettings, error) {
+	switch mode {
+	case "":
+		return &directMessageSettings{}, nil
+	case directMessageSkip:
+		return &directMessageSettings{skip: true}, nil
+	}
+
+	threshold, err := parseThreshold(mode)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not parse direct message threshold")
+	}
+	return &directMessageSettings{threshold: threshold, hasThreshold: true}, nil
+}
+
+// skipChannel reports whether posts in the channel are exempt from moderation
+// because it is a direct or group message channel
+func (d *directMessageSettings) skipChannel(api plugin.API, channelID string) bool {
+	return d.skip && d.isDirect(api, channelID)
+}
+
+// thresholdForChannel returns the direct message threshold when one is set
+// and the channel is a direct or group message channel
+func (d *directMessageSettings) thresholdForChannel(api plugin.API, channelID string) (int, bool) {
+	if !d.hasThreshold || !d.isDirect(api, channelID) {
+		return 0, false
+	}
+	return d.threshold, true
+}
+
+// isDirect reports whether the channel is a direct or group message channel,
+// caching successful lookups. Channels that cannot be looked up are treated
+// as regular channels.
+func (d *directMessageSettings) isDirect(api plugin.API, channelID string) bool {
+	if direct, ok := d.directChannels.Load(channelID); ok {
+		return direct.(bool)
+	}
+
+	channel, appErr := api.GetChannel(channelID)
+	if appErr != nil {
+		api.LogWarn("Failed to get channel to resolve its type for content moderation", "channel_id", channelID, "err", appErr)
+		return false
+	}
+
+	direct := channel.IsGroupOrDirect()
+	d.directChannels.Store(channelID, direct)
+	return direct
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDirectMessageSettings(t *testing.T) {
+	settings, err := newDirectMessageSettings("")
+	require.NoError(t, err)
+	assert.False(t, settings.skip)
+	assert.False(t, settings.hasThreshold)
+
+	settings, err = newDirectMessageSettings(directMessageSkip)
+	require.NoError(t, err)
+	assert.True(t, settings.skip)
+
+	settings, err = newDirectMessageSettings("low")
+	require.NoError(t, err)
+	assert.True(t, settings.hasThreshold)
+	assert.Equal(t, moderation.SeverityLow, settings.threshold)
+
+	_, err = newDirectMessageSettings("lenient")
+	assert.Error(t, err)
+}
+
+func TestModerateDirectMessages(t *testing.T) {
+	channels := map[string]*model.Channel{
+		"dm":      {Id: "dm", Type: model.ChannelTypeDirect},
+		"group":   {Id: "group", Type: model.ChannelTypeGroup},
+		"channel": {Id: "channel", Type: model.ChannelTypeOpen},
+	}
+
+	newAPI := func() *plugintest.API {
+		api := &plugintest.API{}
+		for id, channel := range channels {
+			api.On("GetChannel", id).Return(channel, nil)
+		}
+		api.On("LogInfo", "Content was flagged by moderation", "post_id", "", "severity_threshold", mock.Anything,
+			"computed_severity_hate", 3, "severity_breakdown", "hate: 3").Return()
+		return api
+	}
+
+	newProcessor := func(t *testing.T, mode string) (*PostProcessor, *MockModerator) {
+		directMessages, err := newDirectMessageSettings(mode)
+		require.NoError(t, err)
+
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Borderline content").Return(moderation.Result{"hate": 3}, nil)
+
+		policy := &moderationPolicy{thresholdValue: 4, directMessages: directMessages}
+		return &PostProcessor{moderator: moderator, excludedUsers: map[string]struct{}{}, policy: policy}, moderator
+	}
+
+	moderate := func(processor *PostProcessor, api *plugintest.API, channelID string) error {
+		return processor.moderatePost(api, &model.Post{UserId: "user1", ChannelId: channelID, Message: "Borderline content"})
+	}
+
+	t.Run("Moderated like channels by default", func(t *testing.T) {
+		api := newAPI()
+		processor, moderator := newProcessor(t, "")
+
+		assert.NoError(t, moderate(processor, api, "dm"))
+		assert.NoError(t, moderate(processor, api, "channel"))
+		moderator.AssertNumberOfCalls(t, "ModerateText", 2)
+		api.AssertNotCalled(t, "GetChannel", mock.Anything)
+	})
+
+	t.Run("Skipped", func(t *testing.T) {
+		api := newAPI()
+		processor, moderator := newProcessor(t, directMessageSkip)
+
+		assert.NoError(t, moderate(processor, api, "dm"))
+		assert.NoError(t, moderate(processor, api, "group"))
+		assert.NoError(t, moderate(processor, api, "dm"))
+		moderator.AssertNotCalled(t, "ModerateText", mock.Anything, mock.Anything)
+
+		assert.NoError(t, moderate(processor, api, "channel"))
+		moderator.AssertNumberOfCalls(t, "ModerateText", 1)
+
+		// Channel types are looked up once
+		api.AssertNumberOfCalls(t, "GetChannel", 3)
+	})
+
+	t.Run("Separate threshold", func(t *testing.T) {
+		api := newAPI()
+		processor, _ := newProcessor(t, "2")
+
+		assert.ErrorIs(t, moderate(processor, api, "dm"), ErrModerationRejection)
+		assert.ErrorIs(t, moderate(processor, api, "group"), ErrModerationRejection)
+		assert.NoError(t, moderate(processor, api, "channel"))
+		api.AssertCalled(t, "LogInfo", "Content was flagged by moderation", "post_id", "", "severity_threshold", 2,
+			"computed_severity_hate", 3, "severity_breakdown", "hate: 3")
+	})
+
+	t.Run("Channel override wins over the direct message threshold", func(t *testing.T) {
+		api := newAPI()
+		processor, _ := newProcessor(t, "2")
+		processor.policy.channelThresholds = map[string]int{"dm": 6}
+
+		assert.NoError(t, moderate(processor, api, "dm"))
+		api.AssertNotCalled(t, "GetChannel", "dm")
+	})
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// maxDispatchJitterPercent bounds the dispatch jitter, so that no interval
+// between requests drops below half the processing interval
+const maxDispatchJitterPercent = 50
+
+// dispatchLimiter releases one moderation request at a time, spaced by the
+// processing interval. It acts as a token bucket holding a single token
+// shared by every worker, like a ticker whose ticks are dropped when no
+// worker is waiting. Each interval can be varied by a jitter, so that posts
+// arriving in a burst do not reach the provider in lockstep. Intervals are
+// measured from the previous deadline rather than from when the timer fired,
+// so the average rate stays at the configured limit.
+type dispatchLimiter struct {
+	// C receives a token whenever a request may be sent
+	C <-chan struct{}
+
+	stop chan struct{}
+}
+
+// newDispatchLimiter starts a limiter waiting next() between tokens
+func newDispatchLimiter(next func() time.Duration) *dispatchLimiter {
+	tokens := make(chan struct{}, 1)
+	stop := make(chan struct{})
+
+	go func() {
+		deadline := time.Now().Add(next())
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+			}
+
+			select {
+			case tokens <- struct{}{}:
+			default:
+			}
+
+			// A limiter that fell more than an interval behind, such as after
+			// a long pause of the process, starts over rather than catching
+			// up with a burst of tokens
+			deadline = deadline.Add(next())
+			if now := time.Now(); deadline.Before(now) {
+				deadline = now
+			}
+			timer.Reset(time.Until(deadline))
+		}
+	}()
+
+	return &dispatchLimiter{C: tokens, stop: stop}
+}
+
+// Stop stops releasing tokens
+func (l *dispatchLimiter) Stop() {
+	close(l.stop)
+}
+
+// dispatchInterval returns the delay before the next moderation request: the
+// processing interval varied uniformly by up to the jitter either way, which
+// averages out to the processing interval
+func (p *PostProcessor) dispatchInterval() time.Duration {
+	if p.dispatchJitter <= 0 || p.random == nil {
+		return p.processingInterval
+	}
+	offset := (2*p.random() - 1) * p.dispatchJitter * float64(p.processingInterval)
+	return p.processingInterval + time.Duration(offset)
+}
+
+// requestPacingKey is the context key of the flag recording that a provider
+// request was already sent for a post
+type requestPacingKey struct{}
+
+// paceRequests returns a context under which every provider request after
+// the first waits for the rate limiter. Workers wait for the limiter before
+// moderating a post, which only pays for its first request, while a post can
+// need many: one per text chunk, attachment file name, image and text file.
+func paceRequests(ctx context.Context) context.Context {
+	return context.WithValue(ctx, requestPacingKey{}, new(atomic.Bool))
+}
+
+// waitForTurn waits for the rate limiter before a provider request, unless
+// it is the first request made under a context returned by paceRequests.
+// Requests made under other contexts do not wait.
+func (p *PostProcessor) waitForTurn(ctx context.Context) {
+	sent, ok := ctx.Value(requestPacingKey{}).(*atomic.Bool)
+	if ok && sent.Swap(true) {
+		p.waitForRateLimit()
+	}
+}
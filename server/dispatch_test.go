@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchInterval(t *testing.T) {
+	processor := &PostProcessor{processingInterval: 100 * time.Millisecond, random: rand.New(rand.NewPCG(1, 2)).Float64}
+	assert.Equal(t, 100*time.Millisecond, processor.dispatchInterval(), "no jitter is applied by default")
+
+	processor.dispatchJitter = 0.2
+
+	const dispatches = 10000
+	var total time.Duration
+	shortest, longest := time.Hour, time.Duration(0)
+	for range dispatches {
+		interval := processor.dispatchInterval()
+		total += interval
+		shortest = min(shortest, interval)
+		longest = max(longest, interval)
+	}
+
+	assert.InDelta(t, 100*time.Millisecond, total/dispatches, float64(time.Millisecond), "the average interval matches the configured rate")
+	assert.GreaterOrEqual(t, shortest, 80*time.Millisecond)
+	assert.LessOrEqual(t, longest, 120*time.Millisecond)
+	assert.Less(t, shortest, 85*time.Millisecond, "intervals vary across the jitter")
+	assert.Greater(t, longest, 115*time.Millisecond, "intervals vary across the jitter")
+}
+
+func TestDispatchLimiter(t *testing.T) {
+	const (
+		interval   = 5 * time.Millisecond
+		dispatches = 60
+	)
+
+	processor := &PostProcessor{processingInterval: interval, dispatchJitter: 0.5, random: rand.New(rand.NewPCG(3, 4)).Float64}
+	limiter := newDispatchLimiter(processor.dispatchInterval)
+	defer limiter.Stop()
+
+	times := make([]time.Time, 0, dispatches+1)
+	for range dispatches + 1 {
+		<-limiter.C
+		times = append(times, time.Now())
+	}
+
+	shortest, longest := time.Hour, time.Duration(0)
+	for i := 1; i < len(times); i++ {
+		gap := times[i].Sub(times[i-1])
+		shortest = min(shortest, gap)
+		longest = max(longest, gap)
+	}
+
+	average := times[dispatches].Sub(times[0]) / dispatches
+	assert.InDelta(t, interval, average, float64(interval)*0.15, "the average interval matches the configured rate")
+	assert.Greater(t, longest-shortest, interval/2, "individual intervals vary")
+}
+
+func TestDispatchJitterValue(t *testing.T) {
+	jitter, err := (&configuration{}).DispatchJitterValue()
+	require.NoError(t, err)
+	assert.Zero(t, jitter)
+
+	jitter, err = (&configuration{DispatchJitterPercent: 25}).DispatchJitterValue()
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, jitter)
+
+	for _, percent := range []int{-1, maxDispatchJitterPercent + 1} {
+		_, err := (&configuration{DispatchJitterPercent: percent}).DispatchJitterValue()
+		assert.Error(t, err, percent)
+	}
+}
+
+func TestModeratePostPacesRequests(t *testing.T) {
+	tokens := make(chan struct{}, 10)
+	for range cap(tokens) {
+		tokens <- struct{}{}
+	}
+
+	stub := &moderation.Stub{Default: moderation.Result{"hate": 0}}
+	processor := &PostProcessor{
+		moderator:         stub,
+		policy:            newModerationPolicy(4, nil, nil, nil, nil),
+		moderateFilenames: true,
+		limiter:           &dispatchLimiter{C: tokens},
+	}
+
+	api := &plugintest.API{}
+	for _, name := range []string{"one.txt", "two.txt", "three.txt"} {
+		api.On("GetFileInfo", name).Return(&model.FileInfo{Id: name, Name: name}, nil)
+	}
+
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Test message", FileIds: []string{"one.txt", "two.txt", "three.txt"}}
+	require.NoError(t, processor.moderatePost(api, post))
+
+	// The worker paid for the message, and each file name waits for a token
+	assert.Equal(t, []string{"Test message", "one.txt", "two.txt", "three.txt"}, stub.Texts())
+	assert.Len(t, tokens, cap(tokens)-3)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+const (
+	// minEditDeltaTextLength is the shortest edited text moderated by its
+	// delta. Shorter texts are cheap to moderate in full.
+	minEditDeltaTextLength = 280
+
+	// maxEditDeltaShare is the largest share of the edited text the delta may
+	// cover. Edits changing more of the text are moderated in full.
+	maxEditDeltaShare = 0.5
+
+	// editDeltaContextWords is the number of unchanged words kept on each side
+	// of the changed text, so that an edit such as removing a negation is
+	// moderated along with the words it changes the meaning of
+	editDeltaContextWords = 5
+)
+
+// editDeltas holds the changed text of edited posts until workers moderate
+// them, so that a small edit to a long post is moderated without sending the
+// whole post again. A delta is kept through retries and rescans, and forgotten
+// once the post is moderated or given up on. Deltas are kept in memory and
+// keyed by post ID, so posts re-queued after a restart, and posts edited again
+// before they are moderated, are moderated in full. All methods are safe to
+// call on nil deltas, which moderate every edit in full.
+type editDeltas struct {
+	mu      sync.Mutex
+	pending map[string]editDelta
+}
+
+// editDelta is the changed text of an edit, along with the full text it was
+// computed for
+type editDelta struct {
+	text  string
+	delta string
+}
+
+// newEditDeltas returns the edit deltas, or nil when edits are moderated in full
+func newEditDeltas(enabled bool) *editDeltas {
+	if !enabled {
+		return nil
+	}
+	return &editDeltas{pending: make(map[string]editDelta)}
+}
+
+// record keeps the delta between the moderated texts of the old and new post,
+// when the edit is small enough to be moderated by its delta. Deltas are
+// dropped once they outnumber the posts the queues can hold, since posts
+// deleted while queued never take theirs.
+func (d *editDeltas) record(postID, oldText, newText string, capacity int) {
+	if d == nil {
+		return
+	}
+
+	delta, ok := textDelta(oldText, newText)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// The previous edit has not been moderated yet, and its changes are not
+	// part of this delta
+	if _, pending := d.pending[postID]; !ok || pending {
+		delete(d.pending, postID)
+		return
+	}
+	if len(d.pending) >= capacity {
+		d.pending = make(map[string]editDelta)
+	}
+	d.pending[postID] = editDelta{text: newText, delta: delta}
+}
+
+// get returns the delta recorded for the post, if it was computed for the
+// text about to be moderated. The delta is kept until forget is called, so
+// that retries moderate the same delta.
+func (d *editDeltas) get(postID, text string) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	edit, ok := d.pending[postID]
+	if !ok || edit.text != text {
+		return "", false
+	}
+	return edit.delta, true
+}
+
+// forget drops the delta recorded for the post, if it was computed for the
+// text that was moderated. A delta recorded for a later edit is kept.
+func (d *editDeltas) forget(postID, text string) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if edit, ok := d.pending[postID]; ok && edit.text == text {
+		delete(d.pending, postID)
+	}
+}
+
+// recordEdit records the delta of an edited post, when edits are moderated by
+// their delta
+func (p *PostProcessor) recordEdit(oldPost, newPost *model.Post) {
+	if p.edits == nil || oldPost == nil {
+		return
+	}
+	p.edits.record(newPost.Id, moderatedText(oldPost, p.moderateAttachments), moderatedText(newPost, p.moderateAttachments), p.queueCapacity())
+}
+
+// forgetEdit drops the delta of the post once it is moderated or given up on
+func (p *PostProcessor) forgetEdit(post *model.Post) {
+	if p.edits == nil {
+		return
+	}
+	p.edits.forget(post.Id, moderatedText(post, p.moderateAttachments))
+}
+
+// textDelta returns the text that changed between the old and new text, as a
+// single span from the first to the last change, widened to whole words and
+// a few words of context. It reports false when the new text should be
+// moderated in full: when it is short, when text was only removed, or when
+// the span covers too much of it.
+func textDelta(oldText, newText string) (string, bool) {
+	if utf8.RuneCountInString(newText) < minEditDeltaTextLength || oldText == "" {
+		return "", false
+	}
+
+	oldRunes, newRunes := []rune(oldText), []rune(newText)
+
+	prefix := 0
+	for prefix < len(oldRunes) && prefix < len(newRunes) && oldRunes[prefix] == newRunes[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldRunes)-prefix && suffix < len(newRunes)-prefix &&
+		oldRunes[len(oldRunes)-1-suffix] == newRunes[len(newRunes)-1-suffix] {
+		suffix++
+	}
+
+	start, end := prefix, len(newRunes)-suffix
+	if start >= end {
+		// Text was only removed, which can change the meaning of what is left
+		return "", false
+	}
+
+	start = wordStart(newRunes, start, editDeltaContextWords)
+	end = wordEnd(newRunes, end, editDeltaContextWords)
+
+	delta := strings.TrimSpace(string(newRunes[start:end]))
+	if delta == "" || float64(end-start) > float64(len(newRunes))*maxEditDeltaShare {
+		return "", false
+	}
+	return delta, true
+}
+
+// wordStart moves back from i to the start of the word it is in, if any,
+// then to the start of the given number of words before it
+func wordStart(runes []rune, i, words int) int {
+	for i > 0 && i < len(runes) && !unicode.IsSpace(runes[i]) && !unicode.IsSpace(runes[i-1]) {
+		i--
+	}
+	for range words {
+		for i > 0 && unicode.IsSpace(runes[i-1]) {
+			i--
+		}
+		for i > 0 && !unicode.IsSpace(runes[i-1]) {
+			i--
+		}
+	}
+	return i
+}
+
+// wordEnd moves forward from i to the end of the word it is in, if any,
+// then to the end of the given number of words after it
+func wordEnd(runes []rune, i, words int) int {
+	for i > 0 && i < len(runes) && !unicode.IsSpace(runes[i-1]) && !unicode.IsSpace(runes[i]) {
+		i++
+	}
+	for range words {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			i++
+		}
+	}
+	return i
+}
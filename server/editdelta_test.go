@@ -0,0 +1,229 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// longText is a post long enough for its edits to be moderated by their delta
+var longText = strings.Repeat("The quarterly report covers revenue, hiring and the roadmap for next year. ", 5) +
+	"Let me know what you think of the draft. " +
+	strings.Repeat("Feedback on the budget section is especially welcome before Friday. ", 3)
+
+func TestTextDelta(t *testing.T) {
+	t.Run("Small edits send the changed words with context", func(t *testing.T) {
+		newText := strings.Replace(longText, "what you think of", "what you honestly think of", 1)
+
+		delta, ok := textDelta(longText, newText)
+		require.True(t, ok)
+		assert.Equal(t, "Let me know what you honestly think of the draft. Feedback", delta)
+	})
+
+	t.Run("Edits within a word send the whole word", func(t *testing.T) {
+		newText := strings.Replace(longText, "draft", "drafts", 1)
+
+		delta, ok := textDelta(longText, newText)
+		require.True(t, ok)
+		assert.Contains(t, delta, " drafts. ")
+	})
+
+	t.Run("Large edits are moderated in full", func(t *testing.T) {
+		newText := strings.Repeat("Completely different text replacing most of the post. ", 5) + longText[len(longText)/2:]
+
+		_, ok := textDelta(longText, newText)
+		assert.False(t, ok)
+	})
+
+	t.Run("Removing text is moderated in full", func(t *testing.T) {
+		_, ok := textDelta(longText, strings.Replace(longText, " of the draft", "", 1))
+		assert.False(t, ok)
+	})
+
+	t.Run("Short posts are moderated in full", func(t *testing.T) {
+		_, ok := textDelta("A short post", "A short edited post")
+		assert.False(t, ok)
+	})
+
+	t.Run("Unchanged text is moderated in full", func(t *testing.T) {
+		_, ok := textDelta(longText, longText)
+		assert.False(t, ok)
+	})
+}
+
+func TestEditDeltas(t *testing.T) {
+	edits := newEditDeltas(true)
+	newText := strings.Replace(longText, "draft", "offensive draft", 1)
+
+	edits.record("post1", longText, newText, 10)
+	_, ok := edits.get("post1", "a later edit of the post")
+	assert.False(t, ok, "deltas only apply to the text they were computed for")
+
+	delta, ok := edits.get("post1", newText)
+	assert.True(t, ok)
+	assert.Contains(t, delta, "offensive draft")
+	_, ok = edits.get("post1", newText)
+	assert.True(t, ok, "deltas are kept until forgotten")
+
+	edits.forget("post1", "a later edit of the post")
+	_, ok = edits.get("post1", newText)
+	assert.True(t, ok, "only the delta of the moderated text is forgotten")
+	edits.forget("post1", newText)
+	_, ok = edits.get("post1", newText)
+	assert.False(t, ok)
+
+	// Edits that are moderated in full forget the previous delta
+	edits.record("post1", longText, newText, 10)
+	edits.record("post1", newText, "A short post", 10)
+	_, ok = edits.get("post1", newText)
+	assert.False(t, ok)
+
+	// Editing again before the previous edit is moderated moderates in full
+	laterText := strings.Replace(newText, "Friday", "Monday", 1)
+	edits.record("post1", longText, newText, 10)
+	edits.record("post1", newText, laterText, 10)
+	_, ok = edits.get("post1", laterText)
+	assert.False(t, ok)
+
+	var disabled *editDeltas
+	disabled.record("post1", longText, newText, 10)
+	_, ok = disabled.get("post1", newText)
+	assert.False(t, ok)
+	disabled.forget("post1", newText)
+	assert.Nil(t, newEditDeltas(false))
+}
+
+func TestEditDeltaKeptThroughRetries(t *testing.T) {
+	oldPost := &model.Post{Id: "post1", UserId: "user1", Message: longText}
+	newPost := &model.Post{Id: "post1", UserId: "user1", Message: strings.Replace(longText, "the draft", "the second draft", 1)}
+
+	newProcessor := func(moderator moderation.Moderator, retry *retryPolicy) *PostProcessor {
+		processor := &PostProcessor{
+			moderator: moderator,
+			policy:    newModerationPolicy(4, nil, nil, nil, nil),
+			postsCh:   make(chan *model.Post, 10),
+			edits:     newEditDeltas(true),
+			retry:     retry,
+			action:    &flaggedPostAction{action: moderationActionDelete},
+		}
+		processor.recordEdit(oldPost, newPost)
+		return processor
+	}
+
+	isDelta := func(text string) bool { return len(text) < len(newPost.Message)/2 }
+
+	t.Run("Retries moderate the delta and success forgets it", func(t *testing.T) {
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, mock.MatchedBy(isDelta)).Return(moderation.Result(nil), errors.New("service unavailable")).Once()
+		moderator.On("ModerateText", mock.Anything, mock.MatchedBy(isDelta)).Return(moderation.Result{"hate": 0}, nil).Once()
+
+		api := &plugintest.API{}
+		api.On("LogDebug", "Retrying content moderation", "post_id", "post1", "attempt", 1, "backoff", mock.Anything).Return()
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		processor := newProcessor(moderator, &retryPolicy{maxAttempts: 2, deadLetterAction: deadLetterDrop})
+		processor.processPost(api, newPost)
+
+		moderator.AssertExpectations(t)
+		_, ok := processor.edits.get("post1", moderatedText(newPost, false))
+		assert.False(t, ok)
+	})
+
+	t.Run("Held posts keep the delta for their rescan", func(t *testing.T) {
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, mock.MatchedBy(isDelta)).Return(moderation.Result(nil), errors.New("service unavailable"))
+
+		api := &plugintest.API{}
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVGet", pendingRescanKey).Return(nil, nil)
+		api.On("KVSetWithOptions", pendingRescanKey, mock.Anything, mock.Anything).Return(true, nil)
+		api.On("KVDelete", mock.Anything).Return(nil)
+
+		processor := newProcessor(moderator, &retryPolicy{maxAttempts: 1, deadLetterAction: deadLetterHold})
+		processor.processPost(api, newPost)
+
+		_, ok := processor.edits.get("post1", moderatedText(newPost, false))
+		assert.True(t, ok)
+	})
+
+	t.Run("Dropped posts forget the delta", func(t *testing.T) {
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, mock.MatchedBy(isDelta)).Return(moderation.Result(nil), errors.New("service unavailable"))
+
+		api := &plugintest.API{}
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVDelete", mock.Anything).Return(nil)
+
+		processor := newProcessor(moderator, &retryPolicy{maxAttempts: 1, deadLetterAction: deadLetterDrop})
+		processor.processPost(api, newPost)
+
+		_, ok := processor.edits.get("post1", moderatedText(newPost, false))
+		assert.False(t, ok)
+	})
+}
+
+func TestModerateEditedPost(t *testing.T) {
+	edit := func(t *testing.T, useDeltas bool, newText string) (error, *MockModerator) {
+		api := &plugintest.API{}
+		api.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "post1", "severity_threshold", 4, "computed_severity_hate", 6, "severity_breakdown", "hate: 6").Return().Maybe()
+
+		moderator := &MockModerator{}
+		offensive := func(text string) bool { return strings.Contains(text, "idiot") }
+		moderator.On("ModerateText", mock.Anything, mock.MatchedBy(offensive)).Return(moderation.Result{"hate": 6}, nil)
+		moderator.On("ModerateText", mock.Anything, mock.Anything).Return(moderation.Result{"hate": 0}, nil)
+
+		processor := &PostProcessor{
+			moderator: moderator,
+			policy:    newModerationPolicy(4, nil, nil, nil, nil),
+			postsCh:   make(chan *model.Post, 10),
+			edits:     newEditDeltas(useDeltas),
+		}
+
+		oldPost := &model.Post{Id: "post1", UserId: "user1", Message: longText}
+		newPost := &model.Post{Id: "post1", UserId: "user1", Message: newText}
+		processor.recordEdit(oldPost, newPost)
+		return processor.moderatePost(api, newPost), moderator
+	}
+
+	moderatedTexts := func(moderator *MockModerator) []string {
+		var texts []string
+		for _, call := range moderator.Calls {
+			texts = append(texts, call.Arguments.String(1))
+		}
+		return texts
+	}
+
+	for name, newText := range map[string]string{
+		"Small offensive edit": strings.Replace(longText, "the draft", "the draft, you idiot", 1),
+		"Small harmless edit":  strings.Replace(longText, "the draft", "the second draft", 1),
+		"Large offensive edit": strings.Repeat("Rewritten by an idiot with plenty of new words. ", 8),
+	} {
+		t.Run(name, func(t *testing.T) {
+			fullErr, full := edit(t, false, newText)
+			deltaErr, delta := edit(t, true, newText)
+
+			assert.Equal(t, errors.Is(fullErr, ErrModerationRejection), errors.Is(deltaErr, ErrModerationRejection), "delta and full moderation reach the same decision")
+			assert.Equal(t, []string{newText}, moderatedTexts(full))
+
+			texts := moderatedTexts(delta)
+			require.Len(t, texts, 1)
+			if name == "Large offensive edit" {
+				assert.Equal(t, newText, texts[0], "large edits are moderated in full")
+			} else {
+				assert.Less(t, len(texts[0]), len(newText)/2, "small edits only send the changed text")
+			}
+		})
+	}
+}
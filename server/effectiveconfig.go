@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/azure"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// effectiveConfig is the response of the configuration API endpoint. It
+// describes the running configuration without any secret: credentials are
+// only reported as set, and user, channel and event webhook lists only by
+// their size.
+type effectiveConfig struct {
+	Enabled            bool             `json:"enabled"`
+	Providers          []providerConfig `json:"providers"`
+	Threshold          string           `json:"threshold"`
+	CategoryThresholds string           `json:"category_thresholds"`
+	ChannelThresholds  int              `json:"channel_thresholds"`
+	OffHoursThreshold  string           `json:"off_hours_threshold"`
+	ExcludedUsers      int              `json:"excluded_users"`
+	ExcludedChannels   int              `json:"excluded_channels"`
+	IncludedChannels   int              `json:"included_channels"`
+	Action             string           `json:"action"`
+	MonitorOnly        bool             `json:"monitor_only"`
+	DeadLetterAction   string           `json:"dead_letter_action"`
+	FailurePolicy      string           `json:"failure_policy"`
+	EventWebhooks      int              `json:"event_webhooks"`
+}
+
+// providerConfig describes one configured moderation provider
+type providerConfig struct {
+	Type           string `json:"type"`
+	Endpoint       string `json:"endpoint,omitempty"`
+	AuthMode       string `json:"auth_mode,omitempty"`
+	CredentialsSet bool   `json:"credentials_set"`
+}
+
+// getEffectiveConfig handles the configuration API endpoint, so that support
+// and external tools can compare the deployed configuration with the
+// intended one
+func (p *Plugin) getEffectiveConfig(w http.ResponseWriter, r *http.Request) {
+	response := newEffectiveConfig(p.getConfiguration())
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
+
+// newEffectiveConfig describes the configuration, applying the defaults used
+// for unset settings
+func newEffectiveConfig(config *configuration) *effectiveConfig {
+	channelThresholds, _ := config.ChannelThresholdMap()
+
+	effective := &effectiveConfig{
+		Enabled:            config.Enabled,
+		Providers:          []providerConfig{},
+		Threshold:          strings.TrimSpace(config.Threshold),
+		CategoryThresholds: strings.TrimSpace(config.CategoryThresholds),
+		ChannelThresholds:  len(channelThresholds),
+		OffHoursThreshold:  strings.TrimSpace(config.OffHoursThreshold),
+		ExcludedUsers:      len(config.ExcludedUserSet()),
+		ExcludedChannels:   len(config.ExcludedChannelSet()),
+		IncludedChannels:   len(config.IncludedChannelSet()),
+		Action:             valueOr(config.ModerationAction, moderationActionDelete),
+		MonitorOnly:        config.MonitorOnly,
+		DeadLetterAction:   valueOr(config.DeadLetterAction, deadLetterHold),
+		FailurePolicy:      valueOr(config.ModerationFailurePolicy, failurePolicyOpen),
+		EventWebhooks:      len(config.EventWebhookURLList()),
+	}
+
+	for _, moderatorType := range config.TypeList() {
+		effective.Providers = append(effective.Providers, newProviderConfig(config, moderatorType))
+	}
+	return effective
+}
+
+// newProviderConfig describes the provider of the given type
+func newProviderConfig(config *configuration, moderatorType string) providerConfig {
+	provider := providerConfig{Type: moderatorType}
+
+	switch moderatorType {
+	case "azure":
+		provider.Endpoint = maskEndpoint(config.Endpoint)
+		provider.AuthMode = valueOr(config.AzureAuthMode, azure.AuthModeKey)
+		if provider.AuthMode == azure.AuthModeAAD {
+			// A managed identity needs no secret
+			provider.CredentialsSet = config.AzureClientSecret != "" || config.AzureTenantID == ""
+		} else {
+			provider.CredentialsSet = config.APIKey != ""
+		}
+	case "openai":
+		provider.Endpoint = maskEndpoint(config.OpenAIEndpoint)
+		provider.CredentialsSet = config.OpenAIAPIKey != ""
+	case "perspective":
+		provider.CredentialsSet = config.PerspectiveAPIKey != ""
+	case "webhook":
+		provider.Endpoint = maskEndpoint(config.WebhookURL)
+		provider.CredentialsSet = config.WebhookToken != ""
+	}
+	return provider
+}
+
+// maskEndpoint removes the password and hides the query parameter values of
+// an endpoint, which may carry credentials. Endpoints that cannot be parsed are hidden
+// entirely.
+func maskEndpoint(endpoint string) string {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return ""
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return model.FakeSetting
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.User(u.User.Username())
+	}
+
+	if u.RawQuery != "" {
+		query := u.Query()
+		params := make([]string, 0, len(query))
+		for key := range query {
+			params = append(params, url.QueryEscape(key)+"="+model.FakeSetting)
+		}
+		slices.Sort(params)
+		u.RawQuery = strings.Join(params, "&")
+	}
+	u.Fragment = ""
+
+	return u.String()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetEffectiveConfig(t *testing.T) {
+	const apiKey = "0123456789abcdef0123456789abcdef"
+
+	get := func(t *testing.T, config *configuration, userID string) *httptest.ResponseRecorder {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("HasPermissionTo", "user", model.PermissionManageSystem).Return(false)
+		p := &Plugin{configuration: config}
+		p.SetAPI(api)
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/config", nil)
+		r.Header.Set("Mattermost-User-ID", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("Secrets never appear", func(t *testing.T) {
+		w := get(t, &configuration{
+			Enabled:            true,
+			Type:               "azure,webhook",
+			Endpoint:           "https://example.cognitiveservices.azure.com/",
+			APIKey:             apiKey,
+			Threshold:          "medium",
+			ExcludedUsers:      "user1, user2",
+			ExcludedChannels:   "channel1",
+			ModerationAction:   moderationActionRedact,
+			WebhookURL:         "https://user:" + apiKey + "@moderation.example.com/check?key=" + apiKey + "&mode=strict",
+			WebhookToken:       apiKey,
+			EventWebhookURLs:   "https://siem.example.com/events?token=" + apiKey,
+			EventWebhookSecret: apiKey,
+		}, "admin")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), apiKey)
+
+		var config effectiveConfig
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&config))
+		assert.Equal(t, effectiveConfig{
+			Enabled: true,
+			Providers: []providerConfig{
+				{Type: "azure", Endpoint: "https://example.cognitiveservices.azure.com/", AuthMode: "key", CredentialsSet: true},
+				{Type: "webhook", Endpoint: "https://user@moderation.example.com/check?key=" + model.FakeSetting + "&mode=" + model.FakeSetting, CredentialsSet: true},
+			},
+			Threshold:        "medium",
+			ExcludedUsers:    2,
+			ExcludedChannels: 1,
+			Action:           moderationActionRedact,
+			DeadLetterAction: deadLetterHold,
+			FailurePolicy:    failurePolicyOpen,
+			EventWebhooks:    1,
+		}, config)
+	})
+
+	t.Run("Missing credentials are reported", func(t *testing.T) {
+		w := get(t, &configuration{Type: "openai"}, "admin")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var config effectiveConfig
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&config))
+		assert.Equal(t, []providerConfig{{Type: "openai"}}, config.Providers)
+	})
+
+	t.Run("Non-admins are rejected", func(t *testing.T) {
+		w := get(t, &configuration{APIKey: apiKey}, "user")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.NotContains(t, w.Body.String(), apiKey)
+	})
+}
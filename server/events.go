@@ -0,0 +1,40 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/store/sqlstore"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+const (
+	defaultFlaggedPostsLimit = 50
+	maxFlaggedPostsLimit     = 200
+)
+
+// moderationEventStore persists moderation events for the flagged posts and
+// statistics APIs
+type moderationEventStore interface {
+	InsertModerationEvent(event *sqlstore.ModerationEvent) error
+	GetModerationEvents(since, before int64, limit int) ([]*sqlstore.ModerationEvent, error)
+	GetModerationEventCounts(from, to int64) ([]*sqlstore.ModerationEventCount, error)
+}
+
+// recordModerationEvent stores the moderation event, when an event store is
+// configured. Failures are logged so that they never prevent the moderation
+// action.
+func (p *PostProcessor) recordModerationEvent(api plugin.API, post *model.Post, categories moderation.Result) {
+	if p.events == nil {
+		return
+	}
+
+	if err := p.events.InsertModerationEvent(&sqlstore.ModerationEvent{
+		PostID:     post.Id,
+		UserID:     post.UserId,
+		ChannelID:  post.ChannelId,
+		Categories: categories,
+		Action:     p.action.taken(),
+	}); err != nil {
+		api.LogError("Failed to record moderation event", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/store/sqlstore"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEventStore keeps moderation events in memory
+type fakeEventStore struct {
+	events []*sqlstore.ModerationEvent
+	err    error
+
+	since  int64
+	before int64
+	limit  int
+}
+
+func (s *fakeEventStore) InsertModerationEvent(event *sqlstore.ModerationEvent) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *fakeEventStore) GetModerationEvents(since, before int64, limit int) ([]*sqlstore.ModerationEvent, error) {
+	s.since = since
+	s.before = before
+	s.limit = limit
+	return s.events, s.err
+}
+
+// GetModerationEventCounts groups the events in the range like the SQL store,
+// by channel and categories
+func (s *fakeEventStore) GetModerationEventCounts(from, to int64) ([]*sqlstore.ModerationEventCount, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	var counts []*sqlstore.ModerationEventCount
+	for _, event := range s.events {
+		if event.CreateAt < from || event.CreateAt >= to {
+			continue
+		}
+		i := slices.IndexFunc(counts, func(count *sqlstore.ModerationEventCount) bool {
+			return count.ChannelID == event.ChannelID && maps.Equal(count.Categories, event.Categories)
+		})
+		if i < 0 {
+			counts = append(counts, &sqlstore.ModerationEventCount{ChannelID: event.ChannelID, Categories: event.Categories})
+			i = len(counts) - 1
+		}
+		counts[i].Count++
+	}
+	return counts, nil
+}
+
+func TestRecordModerationEvent(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1"}
+	categories := moderation.Result{"hate": 4}
+
+	t.Run("No event store", func(t *testing.T) {
+		processor := &PostProcessor{action: &flaggedPostAction{action: moderationActionDelete}}
+		processor.recordModerationEvent(&plugintest.API{}, post, categories)
+	})
+
+	t.Run("Stores the event", func(t *testing.T) {
+		store := &fakeEventStore{}
+		processor := &PostProcessor{action: &flaggedPostAction{action: moderationActionFlag}, events: store}
+		processor.recordModerationEvent(&plugintest.API{}, post, categories)
+
+		require.Len(t, store.events, 1)
+		assert.Equal(t, &sqlstore.ModerationEvent{
+			PostID:     "post1",
+			UserID:     "user1",
+			ChannelID:  "channel1",
+			Categories: map[string]int{"hate": 4},
+			Action:     moderationActionFlag,
+		}, store.events[0])
+	})
+
+	t.Run("Monitor-only mode records no action", func(t *testing.T) {
+		store := &fakeEventStore{}
+		processor := &PostProcessor{action: &flaggedPostAction{action: moderationActionDelete, monitorOnly: true}, events: store}
+		processor.recordModerationEvent(&plugintest.API{}, post, categories)
+
+		require.Len(t, store.events, 1)
+		assert.Equal(t, moderationActionNone, store.events[0].Action)
+	})
+
+	t.Run("Failures are logged", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogError", "Failed to record moderation event", "post_id", "post1", "err", mock.Anything).Return()
+
+		processor := &PostProcessor{action: &flaggedPostAction{action: moderationActionDelete}, events: &fakeEventStore{err: errors.New("database is down")}}
+		processor.recordModerationEvent(api, post, categories)
+
+		api.AssertExpectations(t)
+	})
+}
+
+func TestGetFlaggedPosts(t *testing.T) {
+	request := func(p *Plugin, url string) *httptest.ResponseRecorder {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+		p.SetAPI(api)
+
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.Header.Set("Mattermost-User-ID", "admin")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("Returns stored events", func(t *testing.T) {
+		store := &fakeEventStore{events: []*sqlstore.ModerationEvent{{
+			ID:         "event1",
+			PostID:     "post1",
+			UserID:     "user1",
+			ChannelID:  "channel1",
+			Categories: map[string]int{"hate": 4},
+			Action:     moderationActionDelete,
+			CreateAt:   1700000000000,
+		}}}
+
+		w := request(&Plugin{eventStore: store}, "/api/v1/flagged?limit=10&since=1600000000000&before=1800000000000")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 10, store.limit)
+		assert.Equal(t, int64(1600000000000), store.since)
+		assert.Equal(t, int64(1800000000000), store.before)
+
+		var events []map[string]any
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+		assert.Equal(t, []map[string]any{{
+			"id":         "event1",
+			"post_id":    "post1",
+			"user_id":    "user1",
+			"channel_id": "channel1",
+			"categories": map[string]any{"hate": float64(4)},
+			"action":     moderationActionDelete,
+			"create_at":  float64(1700000000000),
+		}}, events)
+	})
+
+	t.Run("Defaults and caps the limit", func(t *testing.T) {
+		store := &fakeEventStore{}
+
+		w := request(&Plugin{eventStore: store}, "/api/v1/flagged")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, defaultFlaggedPostsLimit, store.limit)
+		assert.Equal(t, int64(0), store.since)
+		assert.Equal(t, int64(0), store.before)
+
+		w = request(&Plugin{eventStore: store}, "/api/v1/flagged?limit=100000")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, maxFlaggedPostsLimit, store.limit)
+	})
+
+	t.Run("Rejects invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=ten", "since=-1", "since=yesterday", "before=0", "before=tomorrow"} {
+			w := request(&Plugin{eventStore: &fakeEventStore{}}, "/api/v1/flagged?"+query)
+			assert.Equal(t, http.StatusBadRequest, w.Code, query)
+		}
+	})
+
+	t.Run("Store failure", func(t *testing.T) {
+		w := request(&Plugin{eventStore: &fakeEventStore{err: errors.New("database is down")}}, "/api/v1/flagged")
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+
+	t.Run("No event store", func(t *testing.T) {
+		w := request(&Plugin{}, "/api/v1/flagged")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
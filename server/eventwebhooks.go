@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// eventWebhookSignatureHeader carries the hex encoded HMAC-SHA256 of the
+	// request body, keyed with the event webhook secret
+	eventWebhookSignatureHeader = "X-Content-Moderation-Signature"
+
+	// eventWebhookQueueSize bounds the events waiting to be delivered. Events
+	// are dropped once it is full, so a slow receiver never holds up
+	// moderation.
+	eventWebhookQueueSize = 1000
+
+	// maxEventWebhookAttempts bounds the delivery attempts of each event to
+	// each webhook
+	maxEventWebhookAttempts = 3
+
+	eventWebhookRetryDelay = time.Second
+	eventWebhookTimeout    = 10 * time.Second
+)
+
+// eventWebhookPayload is the JSON body sent to event webhooks for each
+// flagged post
+type eventWebhookPayload struct {
+	PostID      string            `json:"post_id"`
+	UserID      string            `json:"user_id"`
+	ChannelID   string            `json:"channel_id"`
+	Categories  []string          `json:"categories"`
+	Severities  moderation.Result `json:"severities"`
+	Action      string            `json:"action"`
+	MonitorOnly bool              `json:"monitor_only"`
+	Timestamp   int64             `json:"timestamp"`
+}
+
+// eventWebhooks pushes moderation events to external services such as a
+// SIEM. Events are delivered in the background by a single sender, with a
+// bounded number of retries. All methods are safe to call on a nil
+// eventWebhooks, which sends nothing.
+type eventWebhooks struct {
+	urls   []string
+	secret string
+	client *http.Client
+
+	// sleep waits between delivery attempts and is replaced in tests
+	sleep func(time.Duration)
+
+	// logRedaction controls how post IDs appear in logs
+	logRedaction *logRedaction
+
+	eventsCh chan *eventWebhookPayload
+
+	// mu guards closing eventsCh, so that no event is sent to the channel
+	// once stop has closed it
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newEventWebhooks returns the event webhooks for the given URLs, or nil when
+// there are none. Payloads are signed when the secret is set.
+func newEventWebhooks(urls []string, secret string) (*eventWebhooks, error) {
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	for _, webhookURL := range urls {
+		parsed, err := url.Parse(webhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, errors.Errorf("event webhook URL '%s' must be an absolute http or https URL", webhookURL)
+		}
+	}
+
+	return &eventWebhooks{
+		urls:     urls,
+		secret:   secret,
+		client:   &http.Client{Timeout: eventWebhookTimeout},
+		sleep:    time.Sleep,
+		eventsCh: make(chan *eventWebhookPayload, eventWebhookQueueSize),
+	}, nil
+}
+
+// start delivers queued events until stop is called
+func (w *eventWebhooks) start(api plugin.API) {
+	if w == nil {
+		return
+	}
+
+	go func() {
+		for event := range w.eventsCh {
+			w.deliver(api, event)
+		}
+	}()
+}
+
+// stop stops accepting events. Events already queued are still delivered.
+func (w *eventWebhooks) stop() {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.eventsCh)
+	}
+}
+
+// flaggedPost queues the moderation event of a flagged post for delivery,
+// without waiting for the webhooks
+func (w *eventWebhooks) flaggedPost(api plugin.API, post *model.Post, categories moderation.Result, action string, monitorOnly bool) {
+	if w == nil {
+		return
+	}
+
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+
+	event := &eventWebhookPayload{
+		PostID:      post.Id,
+		UserID:      post.UserId,
+		ChannelID:   post.ChannelId,
+		Categories:  names,
+		Severities:  categories,
+		Action:      action,
+		MonitorOnly: monitorOnly,
+		Timestamp:   model.GetMillis(),
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return
+	}
+
+	select {
+	case w.eventsCh <- event:
+	default:
+		api.LogWarn("Event webhook queue is full, dropping moderation event", w.logRedaction.ids("post_id", post.Id)...)
+	}
+}
+
+// deliver sends the event to every webhook. Failures are logged so that they
+// never prevent the moderation action.
+func (w *eventWebhooks) deliver(api plugin.API, event *eventWebhookPayload) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		api.LogError("Failed to marshal moderation event for event webhooks", append(w.logRedaction.ids("post_id", event.PostID), "err", err)...)
+		return
+	}
+
+	for _, webhookURL := range w.urls {
+		if err := w.send(webhookURL, body); err != nil {
+			api.LogError("Failed to send moderation event to event webhook", append(w.logRedaction.ids("post_id", event.PostID), "url", maskEndpoint(webhookURL), "err", err)...)
+		}
+	}
+}
+
+// send posts the body to the webhook, retrying with a growing delay until it
+// is accepted or maxEventWebhookAttempts is reached
+func (w *eventWebhooks) send(webhookURL string, body []byte) error {
+	delay := eventWebhookRetryDelay
+
+	var err error
+	for attempt := 1; attempt <= maxEventWebhookAttempts; attempt++ {
+		if attempt > 1 {
+			w.sleep(delay)
+			delay *= 2
+		}
+
+		if err = w.post(webhookURL, body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// post makes a single delivery attempt
+func (w *eventWebhooks) post(webhookURL string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), eventWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.secret != "" {
+		req.Header.Set(eventWebhookSignatureHeader, signEventPayload(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("event webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// signEventPayload returns the signature of the body, in the form
+// "sha256=<hex encoded HMAC-SHA256>"
+func signEventPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
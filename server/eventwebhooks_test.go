@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedEvent is a request received by a test event webhook
+type receivedEvent struct {
+	body      []byte
+	signature string
+}
+
+func TestEventWebhooks(t *testing.T) {
+	const secret = "webhook-secret"
+
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+	// newReceiver returns a webhook that fails the first failures requests
+	// and reports every request it receives
+	newReceiver := func(t *testing.T, failures int) (*httptest.Server, chan receivedEvent) {
+		received := make(chan receivedEvent, 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+			received <- receivedEvent{body: body, signature: r.Header.Get(eventWebhookSignatureHeader)}
+
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		t.Cleanup(server.Close)
+		return server, received
+	}
+
+	newWebhooks := func(t *testing.T, secret string, urls ...string) *eventWebhooks {
+		webhooks, err := newEventWebhooks(urls, secret)
+		require.NoError(t, err)
+		webhooks.sleep = func(time.Duration) {}
+		return webhooks
+	}
+
+	receive := func(t *testing.T, received chan receivedEvent) receivedEvent {
+		select {
+		case event := <-received:
+			return event
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for the event webhook")
+			return receivedEvent{}
+		}
+	}
+
+	t.Run("Flagged post sends a signed event", func(t *testing.T) {
+		server, received := newReceiver(t, 0)
+
+		api := &plugintest.API{}
+		api.On("LogInfo", "Monitor-only mode, leaving flagged post in place", "post_id", "post1", "action", moderationActionDelete)
+
+		processor := &PostProcessor{
+			action:        &flaggedPostAction{action: moderationActionDelete, monitorOnly: true},
+			notifications: &notificationSettings{dmContentMode: dmContentNone},
+			eventWebhooks: newWebhooks(t, secret, server.URL),
+		}
+		processor.eventWebhooks.start(api)
+		defer processor.eventWebhooks.stop()
+
+		processor.handleFlaggedPost(api, post, moderation.Result{"violence": 5, "hate": 4}, moderation.Decision{Result: moderation.Result{"hate": 4, "violence": 5, "sexual": 0}})
+
+		event := receive(t, received)
+		assert.Equal(t, signEventPayload(secret, event.body), event.signature)
+
+		var payload map[string]any
+		require.NoError(t, json.Unmarshal(event.body, &payload))
+		assert.Equal(t, map[string]any{
+			"post_id":      "post1",
+			"user_id":      "user1",
+			"channel_id":   "channel1",
+			"categories":   []any{"hate", "violence"},
+			"severities":   map[string]any{"hate": float64(4), "violence": float64(5)},
+			"action":       moderationActionDelete,
+			"monitor_only": true,
+			"timestamp":    payload["timestamp"],
+		}, payload)
+		assert.NotContains(t, string(event.body), post.Message)
+	})
+
+	t.Run("Failed deliveries are retried a bounded number of times", func(t *testing.T) {
+		recovering, recoveringReceived := newReceiver(t, maxEventWebhookAttempts-1)
+		failing, failingReceived := newReceiver(t, maxEventWebhookAttempts+1)
+
+		api := &plugintest.API{}
+		logged := make(chan struct{})
+		api.On("LogError", "Failed to send moderation event to event webhook", "post_id", "post1", "url", failing.URL, "err", mock.Anything).
+			Run(func(mock.Arguments) { close(logged) })
+
+		webhooks := newWebhooks(t, "", failing.URL, recovering.URL)
+		webhooks.start(api)
+		defer webhooks.stop()
+
+		webhooks.flaggedPost(api, post, moderation.Result{"hate": 4}, moderationActionDelete, false)
+
+		for range maxEventWebhookAttempts {
+			assert.Empty(t, receive(t, failingReceived).signature, "events are not signed without a secret")
+		}
+		for range maxEventWebhookAttempts {
+			receive(t, recoveringReceived)
+		}
+
+		select {
+		case <-logged:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "timed out waiting for the delivery failure to be logged")
+		}
+		assert.Empty(t, failingReceived)
+		assert.Empty(t, recoveringReceived)
+	})
+
+	t.Run("Full queue drops events without blocking", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogWarn", "Event webhook queue is full, dropping moderation event", "post_id", "post1").Once()
+
+		// The webhooks are not started, so queued events are never delivered
+		webhooks := newWebhooks(t, "", "https://siem.example.com/events")
+		for range eventWebhookQueueSize + 1 {
+			webhooks.flaggedPost(api, post, moderation.Result{"hate": 4}, moderationActionDelete, false)
+		}
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Configuration", func(t *testing.T) {
+		webhooks, err := newEventWebhooks(nil, secret)
+		require.NoError(t, err)
+		assert.Nil(t, webhooks)
+
+		// Nil webhooks send nothing
+		webhooks.start(nil)
+		webhooks.flaggedPost(nil, post, moderation.Result{"hate": 4}, moderationActionDelete, false)
+		webhooks.stop()
+
+		_, err = newEventWebhooks([]string{"https://siem.example.com/events", "siem.example.com"}, secret)
+		assert.EqualError(t, err, "event webhook URL 'siem.example.com' must be an absolute http or https URL")
+
+		config := &configuration{EventWebhookURLs: " https://a.example.com/events, ,https://b.example.com/events "}
+		assert.Equal(t, []string{"https://a.example.com/events", "https://b.example.com/events"}, config.EventWebhookURLList())
+	})
+}
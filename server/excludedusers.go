@@ -0,0 +1,51 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// resolveExcludedUsers looks up each excluded user entry, which may be a user
+// ID, a username, optionally prefixed with @, or an email address, and
+// returns the IDs of the users found along with the entries that matched no
+// user. Unresolved entries are logged, since the users they were meant to
+// exclude are still moderated.
+func resolveExcludedUsers(api plugin.API, entries map[string]struct{}) (map[string]struct{}, []string) {
+	userIDs := make(map[string]struct{}, len(entries))
+	var unresolved []string
+	for entry := range entries {
+		user, appErr := lookupUser(api, entry)
+		if appErr != nil {
+			api.LogWarn("Excluded user could not be resolved, the user is moderated", "entry", entry, "err", appErr)
+			unresolved = append(unresolved, entry)
+			continue
+		}
+		userIDs[user.Id] = struct{}{}
+	}
+
+	if len(unresolved) > 0 {
+		// Sorted, so that the summary reads the same on every load
+		slices.Sort(unresolved)
+		api.LogWarn("Some excluded users could not be resolved",
+			"resolved", len(userIDs), "unresolved", strings.Join(unresolved, ", "))
+	}
+
+	return userIDs, unresolved
+}
+
+// lookupUser returns the user an excluded user entry refers to
+func lookupUser(api plugin.API, entry string) (*model.User, *model.AppError) {
+	switch {
+	case model.IsValidId(entry):
+		return api.GetUser(entry)
+	case strings.HasPrefix(entry, "@"):
+		return api.GetUserByUsername(strings.TrimPrefix(entry, "@"))
+	case strings.Contains(entry, "@"):
+		return api.GetUserByEmail(entry)
+	default:
+		return api.GetUserByUsername(entry)
+	}
+}
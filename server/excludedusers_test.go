@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveExcludedUsers(t *testing.T) {
+	knownID := model.NewId()
+	unknownID := "zzzzzzzzzzzzzzzzzzzzzzzzzz"
+	notFound := model.NewAppError("GetUser", "app.user.missing_account.const", nil, "", http.StatusNotFound)
+
+	api := &plugintest.API{}
+	api.On("GetUser", knownID).Return(&model.User{Id: knownID}, nil)
+	api.On("GetUser", unknownID).Return(nil, notFound)
+	api.On("GetUserByUsername", "alice").Return(&model.User{Id: "alice-id"}, nil)
+	api.On("GetUserByUsername", "bob").Return(&model.User{Id: "bob-id"}, nil)
+	api.On("GetUserByUsername", "nobody").Return(nil, notFound)
+	api.On("GetUserByEmail", "carol@example.com").Return(&model.User{Id: "carol-id"}, nil)
+	for _, entry := range []string{unknownID, "nobody"} {
+		api.On("LogWarn", "Excluded user could not be resolved, the user is moderated", "entry", entry, "err", notFound).Return().Once()
+	}
+	api.On("LogWarn", "Some excluded users could not be resolved", "resolved", 4, "unresolved", "nobody, "+unknownID).Return().Once()
+
+	entries := map[string]struct{}{knownID: {}, unknownID: {}, "alice": {}, "@bob": {}, "nobody": {}, "carol@example.com": {}}
+	userIDs, unresolved := resolveExcludedUsers(api, entries)
+
+	assert.Equal(t, map[string]struct{}{knownID: {}, "alice-id": {}, "bob-id": {}, "carol-id": {}}, userIDs)
+	assert.Equal(t, []string{"nobody", unknownID}, unresolved)
+	api.AssertExpectations(t)
+
+	t.Run("No entries", func(t *testing.T) {
+		userIDs, unresolved := resolveExcludedUsers(&plugintest.API{}, map[string]struct{}{})
+		assert.Empty(t, userIDs)
+		assert.Empty(t, unresolved)
+	})
+}
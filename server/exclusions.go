@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	moderationCommandTrigger = "moderation"
+
+	moderationCommandUsage = "Usage:\n" +
+		"- `/moderation exclude user @username` or `/moderation exclude channel ~channel` stops moderating a user or channel\n" +
+		"- `/moderation unexclude user @username` or `/moderation unexclude channel ~channel` moderates them again\n" +
+		"- `/moderation exclusions list` lists the excluded users and channels\n" +
+		"- `/moderation cancel-deletion <post ID or link>` keeps a flagged post waiting for its deletion grace period to end"
+)
+
+// executeModerationCommand handles the /moderation command, which manages
+// the excluded users and channels without editing the plugin settings and
+// keeps flagged posts pending deletion. The lists are saved to the plugin
+// configuration, which applies them without restarting the plugin.
+func (p *Plugin) executeModerationCommand(args *model.CommandArgs, fields []string) *model.CommandResponse {
+	if !p.API.HasPermissionTo(args.UserId, model.PermissionManageSystem) {
+		return ephemeralResponse("You must be a system admin to manage content moderation.")
+	}
+
+	switch {
+	case len(fields) == 2 && fields[0] == "exclusions" && fields[1] == "list":
+		return ephemeralResponse(p.exclusionsMessage(p.getConfiguration()))
+	case len(fields) == 2 && fields[0] == "cancel-deletion":
+		return ephemeralResponse(p.cancelDeletion(args.UserId, fields[1]))
+	case len(fields) == 3 && (fields[0] == "exclude" || fields[0] == "unexclude"):
+		exclude := fields[0] == "exclude"
+		switch fields[1] {
+		case "user":
+			return ephemeralResponse(p.updateExcludedUser(fields[2], exclude))
+		case "channel":
+			return ephemeralResponse(p.updateExcludedChannel(args.TeamId, fields[2], exclude))
+		}
+	}
+
+	return ephemeralResponse(moderationCommandUsage)
+}
+
+// cancelDeletion keeps the flagged post, given by ID or permalink, when it is
+// waiting for its deletion grace period to end, and returns the response to
+// the command
+func (p *Plugin) cancelDeletion(userID, target string) string {
+	postID := target[strings.LastIndex(target, "/")+1:]
+	if !model.IsValidId(postID) {
+		return fmt.Sprintf("%s is not a post ID or link.", target)
+	}
+
+	processor := p.getProcessor()
+	if processor == nil || !processor.cancelPostDeletion(p.API, postID, userID) {
+		return fmt.Sprintf("No deletion is pending for post `%s`.", postID)
+	}
+	return fmt.Sprintf("Post `%s` will not be deleted.", postID)
+}
+
+// updateExcludedUser adds the user to the excluded users, or removes every
+// entry referring to them, and returns the response to the command
+func (p *Plugin) updateExcludedUser(target string, exclude bool) string {
+	user, appErr := lookupUser(p.API, target)
+	if appErr != nil {
+		return fmt.Sprintf("User %s not found.", target)
+	}
+
+	config := p.getConfiguration().Clone()
+	entries := splitList(config.ExcludedUsers)
+
+	// Entries may name the user by ID, username or email address
+	refersToUser := func(entry string) bool {
+		if entry == user.Id {
+			return true
+		}
+		entryUser, appErr := lookupUser(p.API, entry)
+		return appErr == nil && entryUser.Id == user.Id
+	}
+
+	if exclude {
+		if slices.ContainsFunc(entries, refersToUser) {
+			return fmt.Sprintf("@%s is already excluded from moderation.\n\n%s", user.Username, p.exclusionsMessage(config))
+		}
+		entries = append(entries, user.Id)
+	} else {
+		remaining := slices.DeleteFunc(slices.Clone(entries), refersToUser)
+		if len(remaining) == len(entries) {
+			return fmt.Sprintf("@%s is not excluded from moderation.\n\n%s", user.Username, p.exclusionsMessage(config))
+		}
+		entries = remaining
+	}
+
+	config.ExcludedUsers = strings.Join(entries, ",")
+	if err := p.saveConfiguration(config); err != nil {
+		p.API.LogError("Failed to save excluded users", "err", err)
+		return "Failed to save the excluded users. Check the server logs for details."
+	}
+
+	if exclude {
+		return fmt.Sprintf("@%s is now excluded from moderation.\n\n%s", user.Username, p.exclusionsMessage(config))
+	}
+	return fmt.Sprintf("@%s is moderated again.\n\n%s", user.Username, p.exclusionsMessage(config))
+}
+
+// updateExcludedChannel adds the channel to the excluded channels, or
+// removes it, and returns the response to the command. Channel names are
+// looked up in the team the command was run in.
+func (p *Plugin) updateExcludedChannel(teamID, target string, exclude bool) string {
+	var channel *model.Channel
+	var appErr *model.AppError
+	if model.IsValidId(target) {
+		channel, appErr = p.API.GetChannel(target)
+	} else {
+		channel, appErr = p.API.GetChannelByName(teamID, strings.TrimPrefix(target, "~"), false)
+	}
+	if appErr != nil {
+		return fmt.Sprintf("Channel %s not found.", target)
+	}
+
+	config := p.getConfiguration().Clone()
+	entries := splitList(config.ExcludedChannels)
+	excluded := slices.Contains(entries, channel.Id)
+
+	switch {
+	case exclude && excluded:
+		return fmt.Sprintf("~%s is already excluded from moderation.\n\n%s", channel.Name, p.exclusionsMessage(config))
+	case !exclude && !excluded:
+		return fmt.Sprintf("~%s is not excluded from moderation.\n\n%s", channel.Name, p.exclusionsMessage(config))
+	case exclude:
+		entries = append(entries, channel.Id)
+	default:
+		entries = slices.DeleteFunc(entries, func(entry string) bool { return entry == channel.Id })
+	}
+
+	config.ExcludedChannels = strings.Join(entries, ",")
+	if err := p.saveConfiguration(config); err != nil {
+		p.API.LogError("Failed to save excluded channels", "err", err)
+		return "Failed to save the excluded channels. Check the server logs for details."
+	}
+
+	if exclude {
+		return fmt.Sprintf("~%s is now excluded from moderation.\n\n%s", channel.Name, p.exclusionsMessage(config))
+	}
+	return fmt.Sprintf("~%s is moderated again.\n\n%s", channel.Name, p.exclusionsMessage(config))
+}
+
+// exclusionsMessage lists the excluded users and channels of the
+// configuration, by name where they can be found
+func (p *Plugin) exclusionsMessage(config *configuration) string {
+	var users []string
+	for _, entry := range splitList(config.ExcludedUsers) {
+		if user, appErr := lookupUser(p.API, entry); appErr == nil {
+			users = append(users, "@"+user.Username)
+		} else {
+			users = append(users, fmt.Sprintf("`%s` (not found)", entry))
+		}
+	}
+
+	var channels []string
+	for _, entry := range splitList(config.ExcludedChannels) {
+		if channel, appErr := p.API.GetChannel(entry); appErr == nil {
+			channels = append(channels, "~"+channel.Name)
+		} else {
+			channels = append(channels, fmt.Sprintf("`%s` (not found)", entry))
+		}
+	}
+
+	return fmt.Sprintf("**Excluded users:** %s\n**Excluded channels:** %s", listOrNone(users), listOrNone(channels))
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
+
+// saveConfiguration saves the configuration as the plugin settings. The
+// server then calls OnConfigurationChange, which applies it.
+func (p *Plugin) saveConfiguration(config *configuration) error {
+	// The settings are keyed by the JSON names of the configuration fields
+	data, err := json.Marshal(config)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode configuration")
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return errors.Wrap(err, "failed to decode configuration")
+	}
+
+	if appErr := p.API.SavePluginConfig(settings); appErr != nil {
+		return errors.Wrap(appErr, "failed to save plugin configuration")
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExecuteModerationCommand(t *testing.T) {
+	const (
+		bobID       = "bbbbbbbbbbbbbbbbbbbbbbbbbb"
+		aliceID     = "cccccccccccccccccccccccccc"
+		offTopicID  = "dddddddddddddddddddddddddd"
+		townSqID    = "eeeeeeeeeeeeeeeeeeeeeeeeee"
+		commandTeam = "team1"
+	)
+	notFound := model.NewAppError("Lookup", "app.missing", nil, "", http.StatusNotFound)
+
+	newAPI := func() *plugintest.API {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("GetUser", bobID).Return(&model.User{Id: bobID, Username: "bob"}, nil)
+		api.On("GetUser", aliceID).Return(&model.User{Id: aliceID, Username: "alice"}, nil)
+		api.On("GetUserByUsername", "bob").Return(&model.User{Id: bobID, Username: "bob"}, nil)
+		api.On("GetUserByUsername", "alice").Return(&model.User{Id: aliceID, Username: "alice"}, nil)
+		api.On("GetUserByUsername", "nobody").Return(nil, notFound)
+		api.On("GetChannel", offTopicID).Return(&model.Channel{Id: offTopicID, Name: "off-topic"}, nil)
+		api.On("GetChannel", townSqID).Return(&model.Channel{Id: townSqID, Name: "town-square"}, nil)
+		api.On("GetChannelByName", commandTeam, "off-topic", false).Return(&model.Channel{Id: offTopicID, Name: "off-topic"}, nil)
+		api.On("GetChannelByName", commandTeam, "missing", false).Return(nil, notFound)
+		return api
+	}
+
+	run := func(api *plugintest.API, config *configuration, command string) string {
+		p := &Plugin{configuration: config}
+		p.SetAPI(api)
+
+		resp, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: "admin", TeamId: commandTeam, Command: command})
+		assert.Nil(t, appErr)
+		assert.Equal(t, model.CommandResponseTypeEphemeral, resp.ResponseType)
+		return resp.Text
+	}
+
+	savedSetting := func(key, value string) any {
+		return mock.MatchedBy(func(settings map[string]any) bool {
+			return settings[key] == value && settings["enabled"] == true
+		})
+	}
+
+	t.Run("Requires system admin", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(false)
+
+		text := run(api, &configuration{}, "/moderation exclusions list")
+		assert.Equal(t, "You must be a system admin to manage content moderation.", text)
+	})
+
+	t.Run("List", func(t *testing.T) {
+		api := newAPI()
+
+		text := run(api, &configuration{ExcludedUsers: bobID + ",nobody", ExcludedChannels: offTopicID}, "/moderation exclusions list")
+		assert.Equal(t, "**Excluded users:** @bob, `nobody` (not found)\n**Excluded channels:** ~off-topic", text)
+		api.AssertNotCalled(t, "SavePluginConfig", mock.Anything)
+	})
+
+	t.Run("Exclude user", func(t *testing.T) {
+		api := newAPI()
+		api.On("SavePluginConfig", savedSetting("excludedUsers", "alice,"+bobID)).Return(nil)
+
+		text := run(api, &configuration{Enabled: true, ExcludedUsers: "alice"}, "/moderation exclude user @bob")
+		assert.Equal(t, "@bob is now excluded from moderation.\n\n**Excluded users:** @alice, @bob\n**Excluded channels:** none", text)
+		api.AssertNumberOfCalls(t, "SavePluginConfig", 1)
+	})
+
+	t.Run("Exclude user already excluded by username", func(t *testing.T) {
+		api := newAPI()
+
+		text := run(api, &configuration{Enabled: true, ExcludedUsers: "bob"}, "/moderation exclude user "+bobID)
+		assert.Contains(t, text, "@bob is already excluded from moderation.")
+		api.AssertNotCalled(t, "SavePluginConfig", mock.Anything)
+	})
+
+	t.Run("Exclude unknown user", func(t *testing.T) {
+		api := newAPI()
+
+		text := run(api, &configuration{Enabled: true}, "/moderation exclude user @nobody")
+		assert.Equal(t, "User @nobody not found.", text)
+		api.AssertNotCalled(t, "SavePluginConfig", mock.Anything)
+	})
+
+	t.Run("Unexclude user removes every entry for the user", func(t *testing.T) {
+		api := newAPI()
+		api.On("SavePluginConfig", savedSetting("excludedUsers", aliceID)).Return(nil)
+
+		text := run(api, &configuration{Enabled: true, ExcludedUsers: "bob, " + aliceID + "," + bobID}, "/moderation unexclude user @bob")
+		assert.Equal(t, "@bob is moderated again.\n\n**Excluded users:** @alice\n**Excluded channels:** none", text)
+		api.AssertNumberOfCalls(t, "SavePluginConfig", 1)
+	})
+
+	t.Run("Exclude channel", func(t *testing.T) {
+		api := newAPI()
+		api.On("SavePluginConfig", savedSetting("excludedChannels", townSqID+","+offTopicID)).Return(nil)
+
+		text := run(api, &configuration{Enabled: true, ExcludedChannels: townSqID}, "/moderation exclude channel ~off-topic")
+		assert.Equal(t, "~off-topic is now excluded from moderation.\n\n**Excluded users:** none\n**Excluded channels:** ~town-square, ~off-topic", text)
+		api.AssertNumberOfCalls(t, "SavePluginConfig", 1)
+	})
+
+	t.Run("Exclude unknown channel", func(t *testing.T) {
+		api := newAPI()
+
+		text := run(api, &configuration{Enabled: true}, "/moderation exclude channel ~missing")
+		assert.Equal(t, "Channel ~missing not found.", text)
+		api.AssertNotCalled(t, "SavePluginConfig", mock.Anything)
+	})
+
+	t.Run("Unexclude channel", func(t *testing.T) {
+		api := newAPI()
+		api.On("SavePluginConfig", savedSetting("excludedChannels", "")).Return(nil)
+
+		text := run(api, &configuration{Enabled: true, ExcludedChannels: offTopicID}, "/moderation unexclude channel "+offTopicID)
+		assert.Equal(t, "~off-topic is moderated again.\n\n**Excluded users:** none\n**Excluded channels:** none", text)
+		api.AssertNumberOfCalls(t, "SavePluginConfig", 1)
+	})
+
+	t.Run("Unexclude channel that is not excluded", func(t *testing.T) {
+		api := newAPI()
+
+		text := run(api, &configuration{Enabled: true}, "/moderation unexclude channel ~off-topic")
+		assert.Contains(t, text, "~off-topic is not excluded from moderation.")
+		api.AssertNotCalled(t, "SavePluginConfig", mock.Anything)
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		assert.Equal(t, moderationCommandUsage, run(newAPI(), &configuration{}, "/moderation exclude team town"))
+	})
+}
@@ -1,18 +1,57 @@
 package main
 
 import (
+	"slices"
+
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
 )
 
+// MessageHasBeenPosted queues every new post for moderation. Scheduled posts
+// only reach this hook once the server sends them, so they are moderated at
+// send time with the configuration in effect then rather than when they were
+// scheduled.
 func (p *Plugin) MessageHasBeenPosted(c *plugin.Context, post *model.Post) {
-	if p.processor != nil {
-		p.processor.queuePostForProcessing(p.API, post)
+	if processor := p.getProcessor(); processor != nil {
+		processor.queuePostForProcessing(p.API, post)
+	}
+}
+
+func (p *Plugin) MessageHasBeenUpdated(c *plugin.Context, newPost, oldPost *model.Post) {
+	if processor := p.getProcessor(); processor != nil && postContentChanged(newPost, oldPost) && !processor.isRedaction(newPost) {
+		processor.recordEdit(oldPost, newPost)
+		processor.queuePostForProcessing(p.API, newPost)
+	}
+}
+
+func (p *Plugin) ReactionHasBeenAdded(c *plugin.Context, reaction *model.Reaction) {
+	if processor := p.getProcessor(); processor != nil {
+		processor.keepPostByReaction(p.API, reaction)
+		processor.moderateReaction(p.API, reaction)
+	}
+}
+
+func (p *Plugin) UserHasBeenCreated(c *plugin.Context, user *model.User) {
+	if processor := p.getProcessor(); processor != nil {
+		processor.moderateProfile(p.API, user)
+	}
+}
+
+func (p *Plugin) UserHasLoggedIn(c *plugin.Context, user *model.User) {
+	if processor := p.getProcessor(); processor != nil {
+		processor.moderateProfile(p.API, user)
 	}
 }
 
-func (p *Plugin) MessageHasBeenUpdated(c *plugin.Context, post, _ *model.Post) {
-	if p.processor != nil {
-		p.processor.queuePostForProcessing(p.API, post)
+// postContentChanged reports whether an edit changed the moderated content of
+// a post, including the text of its message attachments. Edits that only
+// change other properties, such as reactions or pinning, are not moderated
+// again.
+func postContentChanged(newPost, oldPost *model.Post) bool {
+	if oldPost == nil {
+		return true
 	}
+	return newPost.Message != oldPost.Message ||
+		!slices.Equal(newPost.FileIds, oldPost.FileIds) ||
+		!slices.Equal(attachmentTexts(newPost), attachmentTexts(oldPost))
 }
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/blocklist"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageHasBeenUpdated(t *testing.T) {
+	oldPost := &model.Post{Id: "post1", Message: "Original message", FileIds: []string{"file1"}}
+
+	propsOnly := &model.Post{Id: "post1", Message: "Original message", FileIds: []string{"file1"}}
+	propsOnly.AddProp("custom_prop", "value")
+
+	attachmentEdited := &model.Post{Id: "post1", Message: "Original message", FileIds: []string{"file1"}}
+	attachmentEdited.AddProp("attachments", []*model.SlackAttachment{{Text: "Edited attachment"}})
+
+	tests := []struct {
+		name     string
+		newPost  *model.Post
+		oldPost  *model.Post
+		expected bool
+	}{
+		{
+			name:     "Only props changed",
+			newPost:  propsOnly,
+			oldPost:  oldPost,
+			expected: false,
+		},
+		{
+			name:     "Message changed",
+			newPost:  &model.Post{Id: "post1", Message: "Edited message", FileIds: []string{"file1"}},
+			oldPost:  oldPost,
+			expected: true,
+		},
+		{
+			name:     "Attachment changed",
+			newPost:  attachmentEdited,
+			oldPost:  oldPost,
+			expected: true,
+		},
+		{
+			name:     "Files changed",
+			newPost:  &model.Post{Id: "post1", Message: "Original message", FileIds: []string{"file1", "file2"}},
+			oldPost:  oldPost,
+			expected: true,
+		},
+		{
+			name:     "Old post unknown",
+			newPost:  &model.Post{Id: "post1", Message: "Original message"},
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			if tt.expected {
+				api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+			}
+
+			p := &Plugin{processor: &PostProcessor{postsCh: make(chan *model.Post, 10)}}
+			p.SetAPI(api)
+
+			p.MessageHasBeenUpdated(nil, tt.newPost, tt.oldPost)
+
+			if tt.expected {
+				assert.Len(t, p.processor.postsCh, 1)
+			} else {
+				assert.Empty(t, p.processor.postsCh)
+			}
+			api.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRedactionNotModeratedAgain(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+	api := &plugintest.API{}
+	api.On("UpdatePost", mock.Anything).Return(&model.Post{}, nil)
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+	api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+	api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+
+	processor := &PostProcessor{
+		botID:         "bot",
+		postsCh:       make(chan *model.Post, 10),
+		action:        &flaggedPostAction{action: moderationActionRedact},
+		notifications: &notificationSettings{dmContentMode: dmContentNone},
+	}
+	p := &Plugin{processor: processor}
+	p.SetAPI(api)
+
+	require.NoError(t, processor.redactPost(api, post, moderation.Result{"Hate": 4}))
+	redacted := post.Clone()
+	redacted.Message = redactedMessage
+
+	// The edit made by the bot is not queued
+	p.MessageHasBeenUpdated(nil, redacted, post)
+	assert.Empty(t, processor.postsCh)
+
+	// Later edits by the author are
+	edited := redacted.Clone()
+	edited.Message = "Offensive message again"
+	p.MessageHasBeenUpdated(nil, edited, redacted)
+	assert.Len(t, processor.postsCh, 1)
+}
+
+func TestScheduledPostModeratedAtSendTime(t *testing.T) {
+	// The server creates scheduled posts when they are due, long after they
+	// were scheduled
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Scheduled slur", CreateAt: model.GetMillis()}
+
+	newProcessor := func(term string) *PostProcessor {
+		mod, err := blocklist.New(&blocklist.Config{Terms: []blocklist.Term{{Text: term, Severity: moderation.MaxSeverity}}})
+		require.NoError(t, err)
+
+		return &PostProcessor{
+			botID:         "bot",
+			moderator:     mod,
+			policy:        &moderationPolicy{thresholdValue: 4},
+			postsCh:       make(chan *model.Post, 10),
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{dmContentMode: dmContentNone},
+		}
+	}
+
+	newAPI := func() *plugintest.API {
+		api := &plugintest.API{}
+		api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+		api.On("LogInfo", "Content was flagged by moderation", "post_id", "post1", "severity_threshold", 4, "computed_severity_blocklist", moderation.MaxSeverity,
+			"severity_breakdown", "blocklist: 6", "blocklist_match", true).Return()
+		api.On("DeletePost", "post1").Return(nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+		return api
+	}
+
+	// send replaces the configuration in effect when the post was scheduled
+	// with the one in effect when it is sent, and sends the post
+	send := func(api *plugintest.API, scheduledTerm, sentTerm string) {
+		p := &Plugin{processor: newProcessor(scheduledTerm)}
+		p.SetAPI(api)
+		p.setProcessor(newProcessor(sentTerm))
+
+		p.MessageHasBeenPosted(nil, post)
+
+		processor := p.getProcessor()
+		require.Len(t, processor.postsCh, 1)
+		processor.processPost(api, processor.beginProcessing(<-processor.postsCh))
+	}
+
+	t.Run("Term blocked after scheduling is caught", func(t *testing.T) {
+		api := newAPI()
+		send(api, "spam", "slur")
+		api.AssertCalled(t, "DeletePost", "post1")
+	})
+
+	t.Run("Term allowed after scheduling is not caught", func(t *testing.T) {
+		api := newAPI()
+		send(api, "slur", "spam")
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+	})
+}
+
+func TestEditIntroducingViolation(t *testing.T) {
+	oldPost := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Nice weather today"}
+
+	newPlugin := func(api *plugintest.API, moderator moderation.Moderator) *Plugin {
+		p := &Plugin{processor: &PostProcessor{
+			botID:         "bot",
+			moderator:     moderator,
+			policy:        &moderationPolicy{thresholdValue: 4},
+			postsCh:       make(chan *model.Post, 10),
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{dmContentMode: dmContentNone},
+		}}
+		p.SetAPI(api)
+		return p
+	}
+
+	t.Run("Violating edit is removed and its author notified", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("DeletePost", "post1").Return(nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1" && p.Message == notificationTranslations["en"].channel
+		})).Return(&model.Post{}, nil).Once()
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm"
+		})).Return(&model.Post{}, nil).Once()
+
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Hateful edit").Return(moderation.Result{"hate": 6}, nil).Once()
+
+		p := newPlugin(api, moderator)
+		edited := oldPost.Clone()
+		edited.Message = "Hateful edit"
+		p.MessageHasBeenUpdated(nil, edited, oldPost)
+
+		processor := p.processor
+		processor.processPost(api, processor.beginProcessing(<-processor.postsCh))
+
+		moderator.AssertExpectations(t)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Rapid edits are moderated once in their latest version", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Third edit").Return(moderation.Result{"hate": 0}, nil).Once()
+
+		p := newPlugin(api, moderator)
+		previous := oldPost
+		for _, message := range []string{"First edit", "Second edit", "Third edit"} {
+			edited := previous.Clone()
+			edited.Message = message
+			p.MessageHasBeenUpdated(nil, edited, previous)
+			previous = edited
+		}
+
+		processor := p.processor
+		assert.Len(t, processor.postsCh, 1)
+		post := processor.beginProcessing(<-processor.postsCh)
+		processor.processPost(api, post)
+		processor.finishProcessing(api, post)
+
+		// Once moderated, a later edit queues the post again
+		edited := previous.Clone()
+		edited.Message = "Fourth edit"
+		p.MessageHasBeenUpdated(nil, edited, previous)
+		assert.Len(t, processor.postsCh, 1)
+
+		moderator.AssertExpectations(t)
+	})
+}
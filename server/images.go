@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+
+	// Register the formats that can be decoded for resizing
+	_ "image/gif"
+	_ "image/png"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultMaxImageSizeMB is the largest image downloaded for moderation
+	// when no maximum is configured
+	defaultMaxImageSizeMB = 20
+
+	// maxImageDimension is the largest width or height accepted by Azure AI
+	// Content Safety
+	maxImageDimension = 7200
+
+	// maxResizedImagePixels bounds the images decoded for resizing, since a
+	// decoded image takes four bytes per pixel whatever its file size
+	maxResizedImagePixels = 40_000_000
+
+	// resizedImageQuality is the JPEG quality of resized images
+	resizedImageQuality = 85
+)
+
+// imageSettings controls the moderation of image attachments too large for
+// the provider. Images up to the maximum size are downloaded and, when
+// larger than the provider accepts, scaled down before they are moderated.
+// Larger images are skipped without being downloaded, so that a huge upload
+// cannot exhaust the moderation timeout or memory. All methods are safe to
+// call on nil settings, which use the default maximum and do not hold posts.
+type imageSettings struct {
+	// maxSize is the largest image downloaded, in bytes
+	maxSize int64
+
+	// holdOversized marks posts with images that could not be moderated as
+	// pending review and notifies the review channel
+	holdOversized   bool
+	reviewChannelID string
+}
+
+// newImageSettings returns the image settings. A maximum size that is not
+// positive uses the default.
+func newImageSettings(maxSizeMB int, holdOversized bool, reviewChannelID string) (*imageSettings, error) {
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultMaxImageSizeMB
+	}
+	if holdOversized && !model.IsValidId(reviewChannelID) {
+		return nil, errors.New("a valid review channel ID is required to hold posts with oversized images for review")
+	}
+
+	return &imageSettings{
+		maxSize:         int64(maxSizeMB) * 1024 * 1024,
+		holdOversized:   holdOversized,
+		reviewChannelID: reviewChannelID,
+	}, nil
+}
+
+// maxDownloadSize returns the largest image downloaded for moderation
+func (s *imageSettings) maxDownloadSize() int64 {
+	if s == nil {
+		return defaultMaxImageSizeMB * 1024 * 1024
+	}
+	return s.maxSize
+}
+
+// holdsOversized reports whether posts with images that could not be
+// moderated are held for review
+func (s *imageSettings) holdsOversized() bool {
+	return s != nil && s.holdOversized
+}
+
+// downscaleImage scales the image down until it is encoded as a JPEG no
+// larger than limit bytes. Transparency is lost, which does not matter for
+// moderation. GIF, JPEG and PNG images can be resized.
+func downscaleImage(data []byte, limit int) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read image")
+	}
+	if config.Width*config.Height > maxResizedImagePixels {
+		return nil, errors.Errorf("image of %dx%d pixels is too large to resize", config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode image")
+	}
+
+	// The encoded size roughly follows the pixel count, so the first attempt
+	// scales the area by the ratio of the sizes
+	bounds := img.Bounds()
+	scale := math.Sqrt(float64(limit) / float64(len(data)))
+	scale = min(scale, float64(maxImageDimension)/float64(max(bounds.Dx(), bounds.Dy())))
+
+	for range 5 {
+		width := max(1, int(float64(bounds.Dx())*scale))
+		height := max(1, int(float64(bounds.Dy())*scale))
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resizeImage(img, width, height), &jpeg.Options{Quality: resizedImageQuality}); err != nil {
+			return nil, errors.Wrap(err, "failed to encode resized image")
+		}
+		if buf.Len() <= limit {
+			return buf.Bytes(), nil
+		}
+		scale *= 0.75
+	}
+
+	return nil, errors.New("image could not be resized below the size limit")
+}
+
+// resizeImage scales the image to the given size, averaging the pixels each
+// resized pixel covers
+func resizeImage(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := range height {
+		top := bounds.Min.Y + y*bounds.Dy()/height
+		bottom := max(top+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := range width {
+			left := bounds.Min.X + x*bounds.Dx()/width
+			right := max(left+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, count uint64
+			for sy := top; sy < bottom; sy++ {
+				for sx := left; sx < right; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					count++
+				}
+			}
+			resized.Set(x, y, color.RGBA64{
+				R: uint16(r / count),
+				G: uint16(g / count),
+				B: uint16(b / count),
+				A: uint16(a / count),
+			})
+		}
+	}
+
+	return resized
+}
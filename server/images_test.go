@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// noisyPNG returns a PNG of random pixels, which barely compresses
+func noisyPNG(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	random := rand.New(rand.NewSource(1))
+	for y := range height {
+		for x := range width {
+			img.Set(x, y, color.RGBA{R: uint8(random.Intn(256)), G: uint8(random.Intn(256)), B: uint8(random.Intn(256)), A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestNewImageSettings(t *testing.T) {
+	settings, err := newImageSettings(0, false, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultMaxImageSizeMB*1024*1024), settings.maxDownloadSize())
+
+	settings, err = newImageSettings(8, true, model.NewId())
+	require.NoError(t, err)
+	assert.Equal(t, int64(8*1024*1024), settings.maxDownloadSize())
+	assert.True(t, settings.holdsOversized())
+
+	_, err = newImageSettings(8, true, "")
+	assert.Error(t, err)
+
+	var unset *imageSettings
+	assert.Equal(t, int64(defaultMaxImageSizeMB*1024*1024), unset.maxDownloadSize())
+	assert.False(t, unset.holdsOversized())
+}
+
+func TestDownscaleImage(t *testing.T) {
+	data := noisyPNG(t, 400, 300)
+	limit := len(data) / 4
+
+	resized, err := downscaleImage(data, limit)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(resized), limit)
+
+	img, format, err := image.Decode(bytes.NewReader(resized))
+	require.NoError(t, err)
+	assert.Equal(t, "jpeg", format)
+	assert.Less(t, img.Bounds().Dx(), 400)
+	assert.InDelta(t, 4.0/3.0, float64(img.Bounds().Dx())/float64(img.Bounds().Dy()), 0.05, "the aspect ratio is kept")
+
+	_, err = downscaleImage([]byte("not an image"), limit)
+	assert.Error(t, err)
+}
+
+func TestModerateOversizedImages(t *testing.T) {
+	reviewChannelID := model.NewId()
+
+	newProcessor := func(moderator moderation.Moderator, images *imageSettings) *PostProcessor {
+		settings := testProcessorSettings(moderator)
+		settings.moderateImages = true
+		settings.images = images
+		processor, err := newPostProcessor(settings)
+		require.NoError(t, err)
+		return processor
+	}
+
+	t.Run("Images over the maximum size are skipped and the post held for review", func(t *testing.T) {
+		images, err := newImageSettings(1, true, reviewChannelID)
+		require.NoError(t, err)
+
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "huge.png", MimeType: "image/png", Size: 2 * 1024 * 1024}, nil)
+		api.On("LogWarn", "Skipping moderation of image exceeding the maximum size", "post_id", "post1", "file_id", "file1", "size", int64(2*1024*1024)).Return().Once()
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("AddReaction", &model.Reaction{UserId: "bot", PostId: "post1", EmojiName: pendingReviewEmoji, ChannelId: "channel1"}).Return(&model.Reaction{}, nil).Once()
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == reviewChannelID && post.Message == "_A post with images too large to moderate was held for review:_ /_redirect/pl/post1"
+		})).Return(&model.Post{}, nil).Once()
+
+		moderator := &MockImageModerator{}
+		processor := newProcessor(moderator, images)
+
+		post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", FileIds: []string{"file1"}}
+		require.NoError(t, processor.moderatePost(api, post))
+
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "GetFile", "file1")
+		moderator.AssertNotCalled(t, "ModerateImage", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Images over the provider limit are resized before they are moderated", func(t *testing.T) {
+		data := noisyPNG(t, 1400, 1100)
+		require.Greater(t, len(data), maxImageSize)
+
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "photo.png", MimeType: "image/png", Size: int64(len(data))}, nil)
+		api.On("GetFile", "file1").Return(data, nil)
+
+		moderator := &MockImageModerator{}
+		moderator.On("ModerateImage", mock.Anything, mock.MatchedBy(func(resized []byte) bool {
+			return len(resized) <= maxImageSize
+		})).Return(moderation.Result{"Violence": 0}, nil).Once()
+
+		processor := newProcessor(moderator, nil)
+
+		post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", FileIds: []string{"file1"}}
+		require.NoError(t, processor.moderatePost(api, post))
+
+		moderator.AssertExpectations(t)
+		api.AssertNotCalled(t, "AddReaction", mock.Anything)
+	})
+}
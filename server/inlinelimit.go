@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultMaxInlineModerations is the number of inline moderation
+	// requests allowed at once when none is configured
+	defaultMaxInlineModerations = 4
+
+	// inlineModerationWait is how long an inline moderation request waits
+	// for another one to finish before giving up
+	inlineModerationWait = 2 * time.Second
+)
+
+// errInlineModerationBusy is returned when every inline moderation slot stayed
+// taken for the whole wait
+var errInlineModerationBusy = errors.New("too many moderation requests in progress")
+
+// inlineModerationLimiter caps the moderation requests made outside the
+// worker pool, while a hook or HTTP request waits for them: profile checks
+// when users sign up or log in, and post rescans. Workers are already bounded
+// by the worker count and rate limit, but each of these callers would
+// otherwise open its own provider connection, so a burst of logins could
+// exceed the provider's rate limit. All methods are safe to call on a nil
+// limiter, which never limits.
+type inlineModerationLimiter struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// newInlineModerationLimiter returns a limiter allowing size requests at once,
+// defaulting to defaultMaxInlineModerations
+func newInlineModerationLimiter(size int) (*inlineModerationLimiter, error) {
+	if size == 0 {
+		size = defaultMaxInlineModerations
+	}
+	if size < 0 {
+		return nil, errors.Errorf("maximum concurrent inline moderations must be positive, got %d", size)
+	}
+
+	return &inlineModerationLimiter{
+		slots: make(chan struct{}, size),
+		wait:  inlineModerationWait,
+	}, nil
+}
+
+// acquire takes a slot and returns the function releasing it. It returns
+// errInlineModerationBusy when no slot frees up within the wait.
+func (l *inlineModerationLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	timer := time.NewTimer(l.wait)
+	defer timer.Stop()
+
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-timer.C:
+		return nil, errInlineModerationBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
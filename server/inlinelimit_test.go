@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewInlineModerationLimiter(t *testing.T) {
+	limiter, err := newInlineModerationLimiter(0)
+	require.NoError(t, err)
+	assert.Equal(t, defaultMaxInlineModerations, cap(limiter.slots))
+
+	_, err = newInlineModerationLimiter(-1)
+	assert.Error(t, err)
+
+	release, err := (*inlineModerationLimiter)(nil).acquire(context.Background())
+	require.NoError(t, err)
+	release()
+}
+
+func TestInlineModerationLimit(t *testing.T) {
+	newProcessor := func(moderator *concurrencyModerator, size int, wait time.Duration) *PostProcessor {
+		limiter, err := newInlineModerationLimiter(size)
+		require.NoError(t, err)
+		limiter.wait = wait
+
+		return &PostProcessor{
+			moderator:        moderator,
+			moderateProfiles: true,
+			policy:           newModerationPolicy(4, nil, nil, nil, nil),
+			inline:           limiter,
+		}
+	}
+
+	t.Run("Flood of profile checks stays within the limit", func(t *testing.T) {
+		const logins = 10
+
+		api := &plugintest.API{}
+		api.On("KVGet", mock.Anything).Return(nil, nil)
+		api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+
+		moderator := &concurrencyModerator{release: make(chan struct{}), started: make(chan int, logins)}
+		processor := newProcessor(moderator, 2, time.Minute)
+
+		var wg sync.WaitGroup
+		for i := 0; i < logins; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				processor.moderateProfile(api, &model.User{Id: "user1", Username: "alice"})
+			}()
+		}
+
+		<-moderator.started
+		<-moderator.started
+		select {
+		case active := <-moderator.started:
+			require.Fail(t, "more requests than the limit were in progress", "active: %d", active)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(moderator.release)
+		wg.Wait()
+
+		assert.Equal(t, 2, moderator.maxSeen)
+		api.AssertNumberOfCalls(t, "KVSet", logins)
+	})
+
+	t.Run("Profile check gives up when no slot frees up", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", mock.Anything).Return(nil, nil)
+		api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+		api.On("LogError", "Failed to moderate user profile", "user_id", "user2", "err", errInlineModerationBusy).Return()
+
+		moderator := &concurrencyModerator{release: make(chan struct{}), started: make(chan int, 1)}
+		processor := newProcessor(moderator, 1, 10*time.Millisecond)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			processor.moderateProfile(api, &model.User{Id: "user1", Username: "alice"})
+		}()
+		<-moderator.started
+
+		processor.moderateProfile(api, &model.User{Id: "user2", Username: "bob"})
+		api.AssertCalled(t, "LogError", "Failed to moderate user profile", "user_id", "user2", "err", errInlineModerationBusy)
+
+		close(moderator.release)
+		<-done
+		assert.Equal(t, 1, moderator.maxSeen)
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// integrationSettings controls whether posts made by bot accounts and
+// incoming webhooks are moderated
+type integrationSettings struct {
+	skipBots     bool
+	skipWebhooks bool
+
+	// botUsers caches whether each author looked up is a bot account
+	botUsers sync.Map
+
+	// logRedaction controls how post and user IDs appear in logs
+	logRedaction *logRedaction
+}
+
+func newIntegrationSettings(skipBots, skipWebhooks bool) *integrationSettings {
+	return &integrationSettings{
+		skipBots:     skipBots,
+		skipWebhooks: skipWebhooks,
+	}
+}
+
+// skipPost reports whether the post was made by an integration that is not
+// moderated
+func (i *integrationSettings) skipPost(api plugin.API, post *model.Post) bool {
+	if i.skipWebhooks && isTrueProp(post.GetProp(model.PostPropsFromWebhook)) {
+		return true
+	}
+	return i.skipBots && i.isBot(api, post)
+}
+
+// isBot reports whether the post was made by a bot account. Authors that
+// cannot be looked up are treated as users, so their posts are moderated.
+func (i *integrationSettings) isBot(api plugin.API, post *model.Post) bool {
+	if isTrueProp(post.GetProp(model.PostPropsFromBot)) {
+		return true
+	}
+
+	if isBot, ok := i.botUsers.Load(post.UserId); ok {
+		return isBot.(bool)
+	}
+
+	user, appErr := api.GetUser(post.UserId)
+	if appErr != nil {
+		api.LogWarn("Failed to get post author to check for a bot account", append(i.logRedaction.ids("post_id", post.Id, "user_id", post.UserId), "err", appErr)...)
+		return false
+	}
+
+	i.botUsers.Store(post.UserId, user.IsBot)
+	return user.IsBot
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestIntegrationSettingsSkipPost(t *testing.T) {
+	userPost := &model.Post{Id: "post1", UserId: "user1", Message: "Hello"}
+
+	botPost := &model.Post{Id: "post2", UserId: "bot1", Message: "Build finished"}
+
+	webhookPost := &model.Post{Id: "post3", UserId: "user1", Message: "Alert"}
+	webhookPost.AddProp(model.PostPropsFromWebhook, "true")
+
+	newAPI := func() *plugintest.API {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetUser", "bot1").Return(&model.User{Id: "bot1", IsBot: true}, nil)
+		return api
+	}
+
+	t.Run("Nothing skipped by default", func(t *testing.T) {
+		api := &plugintest.API{}
+		integrations := newIntegrationSettings(false, false)
+		assert.False(t, integrations.skipPost(api, userPost))
+		assert.False(t, integrations.skipPost(api, botPost))
+		assert.False(t, integrations.skipPost(api, webhookPost))
+		api.AssertNotCalled(t, "GetUser", mock.Anything)
+	})
+
+	t.Run("Skip bot posts", func(t *testing.T) {
+		api := newAPI()
+		integrations := newIntegrationSettings(true, false)
+		assert.False(t, integrations.skipPost(api, userPost))
+		assert.True(t, integrations.skipPost(api, botPost))
+		assert.False(t, integrations.skipPost(api, webhookPost))
+	})
+
+	t.Run("Skip webhook posts", func(t *testing.T) {
+		api := &plugintest.API{}
+		integrations := newIntegrationSettings(false, true)
+		assert.False(t, integrations.skipPost(api, userPost))
+		assert.False(t, integrations.skipPost(api, botPost))
+		assert.True(t, integrations.skipPost(api, webhookPost))
+	})
+
+	t.Run("Bot posts marked by their props are not looked up", func(t *testing.T) {
+		api := &plugintest.API{}
+		post := &model.Post{Id: "post4", UserId: "bot2"}
+		post.AddProp(model.PostPropsFromBot, "true")
+		assert.True(t, newIntegrationSettings(true, false).skipPost(api, post))
+		api.AssertNotCalled(t, "GetUser", mock.Anything)
+	})
+
+	t.Run("Authors are looked up once", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "bot1").Return(&model.User{Id: "bot1", IsBot: true}, nil).Once()
+		integrations := newIntegrationSettings(true, false)
+		assert.True(t, integrations.skipPost(api, botPost))
+		assert.True(t, integrations.skipPost(api, botPost))
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Authors that cannot be looked up are moderated", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(nil, model.NewAppError("GetUser", "not_found", nil, "", 404))
+		api.On("LogWarn", "Failed to get post author to check for a bot account", "post_id", "post1", "user_id", "user1", "err", mock.Anything)
+		assert.False(t, newIntegrationSettings(true, false).skipPost(api, userPost))
+	})
+}
+
+func TestModeratePostSkipsIntegrations(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "bot1", Message: "Build finished"}
+
+	api := &plugintest.API{}
+	api.On("GetUser", "bot1").Return(&model.User{Id: "bot1", IsBot: true}, nil)
+	mockModerator := &MockModerator{}
+
+	processor := &PostProcessor{
+		moderator:    mockModerator,
+		policy:       &moderationPolicy{thresholdValue: 4},
+		integrations: newIntegrationSettings(true, false),
+	}
+	assert.NoError(t, processor.moderatePost(api, post))
+	mockModerator.AssertNotCalled(t, "ModerateText", mock.Anything, mock.Anything)
+
+	mockModerator.On("ModerateText", mock.Anything, "Build finished").Return(moderation.Result{"hate": 0}, nil)
+	processor.integrations = newIntegrationSettings(false, false)
+	assert.NoError(t, processor.moderatePost(api, post))
+	mockModerator.AssertExpectations(t)
+}
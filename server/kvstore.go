@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// queuedPostKeyPrefix prefixes the KV keys of posts waiting for moderation
+	queuedPostKeyPrefix = "queued_post_"
+
+	// pendingRescanKey is the KV key listing the IDs of the posts held while
+	// the moderation provider was unavailable, waiting for it to recover. The
+	// rescan loop reads this single key rather than listing every KV key.
+	pendingRescanKey = "rescan_posts"
+
+	// maxPendingRescanUpdateAttempts bounds the attempts to update the posts
+	// pending rescan while other workers or servers update them too
+	maxPendingRescanUpdateAttempts = 5
+
+	kvListPageSize = 100
+)
+
+// persistQueuedPost records that a post is waiting for moderation so that it
+// can be re-queued if the plugin stops before the post is processed
+func (p *PostProcessor) persistQueuedPost(api plugin.API, postID string) {
+	if appErr := api.KVSet(queuedPostKeyPrefix+postID, []byte{1}); appErr != nil {
+		api.LogError("Failed to persist queued post", append(p.policy.loggedIDs("post_id", postID), "err", appErr)...)
+	}
+}
+
+// removeQueuedPost removes the record of a post waiting for moderation
+func (p *PostProcessor) removeQueuedPost(api plugin.API, postID string) {
+	if appErr := api.KVDelete(queuedPostKeyPrefix + postID); appErr != nil {
+		api.LogError("Failed to remove persisted queued post", append(p.policy.loggedIDs("post_id", postID), "err", appErr)...)
+	}
+}
+
+// holdPostForRescan moves the record of a post that could not be moderated
+// from the queue to the pending rescan store, so that it is moderated again
+// once the provider recovers rather than on the next restart
+func (p *PostProcessor) holdPostForRescan(api plugin.API, postID string) {
+	err := updatePendingRescanIDs(api, func(postIDs []string) []string {
+		if slices.Contains(postIDs, postID) {
+			return postIDs
+		}
+		return append(postIDs, postID)
+	})
+	if err != nil {
+		api.LogError("Failed to persist post pending rescan", append(p.policy.loggedIDs("post_id", postID), "err", err)...)
+		return
+	}
+	p.removeQueuedPost(api, postID)
+}
+
+// removePendingRescans removes posts from the posts waiting to be rescanned
+func (p *PostProcessor) removePendingRescans(api plugin.API, postIDs []string) {
+	if len(postIDs) == 0 {
+		return
+	}
+
+	err := updatePendingRescanIDs(api, func(pending []string) []string {
+		return slices.DeleteFunc(pending, func(postID string) bool {
+			return slices.Contains(postIDs, postID)
+		})
+	})
+	if err != nil {
+		api.LogError("Failed to remove posts pending rescan", "count", len(postIDs), "err", err)
+	}
+}
+
+// listQueuedPostIDs returns the IDs of every post persisted as waiting for moderation
+func listQueuedPostIDs(api plugin.API) ([]string, error) {
+	return listPostIDsWithPrefix(api, queuedPostKeyPrefix)
+}
+
+// listPendingRescanIDs returns the IDs of every post waiting to be rescanned
+// once the moderation provider recovers
+func listPendingRescanIDs(api plugin.API) ([]string, error) {
+	postIDs, _, err := loadPendingRescanIDs(api)
+	return postIDs, err
+}
+
+// loadPendingRescanIDs returns the IDs of the posts waiting to be rescanned,
+// along with the stored value they were decoded from
+func loadPendingRescanIDs(api plugin.API) ([]string, []byte, error) {
+	data, appErr := api.KVGet(pendingRescanKey)
+	if appErr != nil {
+		return nil, nil, errors.Wrap(appErr, "failed to load posts pending rescan")
+	}
+	if data == nil {
+		return nil, nil, nil
+	}
+
+	var postIDs []string
+	if err := json.Unmarshal(data, &postIDs); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to decode posts pending rescan")
+	}
+	return postIDs, data, nil
+}
+
+// updatePendingRescanIDs replaces the IDs of the posts waiting to be
+// rescanned with the result of update. The IDs are compared and set
+// atomically, and update is applied again to the latest IDs when another
+// worker or server changed them first.
+func updatePendingRescanIDs(api plugin.API, update func([]string) []string) error {
+	for range maxPendingRescanUpdateAttempts {
+		postIDs, data, err := loadPendingRescanIDs(api)
+		if err != nil {
+			return err
+		}
+
+		postIDs = update(postIDs)
+		if len(postIDs) == 0 && data == nil {
+			return nil
+		}
+
+		// Saving no value deletes the key once every post is rescanned
+		var updated []byte
+		if len(postIDs) > 0 {
+			if updated, err = json.Marshal(postIDs); err != nil {
+				return errors.Wrap(err, "failed to encode posts pending rescan")
+			}
+		}
+
+		saved, appErr := api.KVSetWithOptions(pendingRescanKey, updated, model.PluginKVSetOptions{Atomic: true, OldValue: data})
+		if appErr != nil {
+			return errors.Wrap(appErr, "failed to save posts pending rescan")
+		}
+		if saved {
+			return nil
+		}
+	}
+	return errors.New("posts pending rescan changed concurrently too many times")
+}
+
+// listPostIDsWithPrefix returns the post IDs of every KV key with the prefix
+func listPostIDsWithPrefix(api plugin.API, prefix string) ([]string, error) {
+	var postIDs []string
+	for page := 0; ; page++ {
+		keys, appErr := api.KVList(page, kvListPageSize)
+		if appErr != nil {
+			return nil, errors.Wrap(appErr, "failed to list KV keys")
+		}
+
+		for _, key := range keys {
+			if postID, found := strings.CutPrefix(key, prefix); found {
+				postIDs = append(postIDs, postID)
+			}
+		}
+
+		if len(keys) < kvListPageSize {
+			return postIDs, nil
+		}
+	}
+}
+
+// requeuePersistedPosts queues every post left over from a previous run of
+// the plugin, skipping posts that no longer exist. Posts that cannot be
+// looked up keep their record, so that they are queued on the next restart.
+func (p *Plugin) requeuePersistedPosts() {
+	processor := p.getProcessor()
+	if processor == nil {
+		return
+	}
+
+	postIDs, err := listQueuedPostIDs(p.API)
+	if err != nil {
+		p.API.LogError("Failed to load persisted moderation queue", "err", err)
+		return
+	}
+
+	requeued := 0
+	for _, postID := range postIDs {
+		post, appErr := p.API.GetPost(postID)
+		if appErr != nil && appErr.StatusCode != http.StatusNotFound {
+			p.API.LogError("Failed to get persisted queued post", append(processor.policy.loggedIDs("post_id", postID), "err", appErr)...)
+			continue
+		}
+		if appErr != nil || post.DeleteAt != 0 {
+			processor.removeQueuedPost(p.API, postID)
+			continue
+		}
+
+		processor.queuePostForProcessing(p.API, post)
+		requeued++
+	}
+
+	if requeued > 0 {
+		p.API.LogInfo("Re-queued posts left over from before the plugin restarted", "count", requeued)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRequeuePersistedPosts(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("KVList", 0, kvListPageSize).Return([]string{
+		queuedPostKeyPrefix + "post1",
+		"unrelated_key",
+		queuedPostKeyPrefix + "deleted",
+		queuedPostKeyPrefix + "missing",
+		queuedPostKeyPrefix + "unavailable",
+	}, nil)
+
+	post := &model.Post{Id: "post1", Message: "Test message"}
+	api.On("GetPost", "post1").Return(post, nil)
+	api.On("GetPost", "deleted").Return(&model.Post{Id: "deleted", DeleteAt: 1}, nil)
+	api.On("GetPost", "missing").Return(nil, model.NewAppError("GetPost", "app.post.get.app_error", nil, "", http.StatusNotFound))
+	api.On("GetPost", "unavailable").Return(nil, model.NewAppError("GetPost", "app.post.get.app_error", nil, "", http.StatusInternalServerError))
+	api.On("LogError", "Failed to get persisted queued post", "post_id", "unavailable", "err", mock.Anything).Return()
+	api.On("KVDelete", queuedPostKeyPrefix+"deleted").Return(nil)
+	api.On("KVDelete", queuedPostKeyPrefix+"missing").Return(nil)
+	api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+	api.On("LogInfo", "Re-queued posts left over from before the plugin restarted", "count", 1).Return()
+
+	p := &Plugin{processor: &PostProcessor{postsCh: make(chan *model.Post, 10)}}
+	p.SetAPI(api)
+
+	p.requeuePersistedPosts()
+
+	assert.Len(t, p.processor.postsCh, 1)
+	assert.Equal(t, post, <-p.processor.postsCh)
+	api.AssertExpectations(t)
+	api.AssertNotCalled(t, "KVDelete", queuedPostKeyPrefix+"unavailable")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+const (
+	unsupportedLanguageSkip = "skip"
+	unsupportedLanguageHint = "hint"
+)
+
+// languageSettings controls language detection before text is moderated.
+// Detection is disabled when the detector is nil.
+type languageSettings struct {
+	detector moderation.LanguageDetector
+
+	// supported lists the languages the provider moderates well. An empty
+	// list treats every language as supported.
+	supported map[string]struct{}
+
+	// skipUnsupported skips moderating text in unsupported languages instead
+	// of moderating it with the detected language as a hint
+	skipUnsupported bool
+}
+
+func newLanguageSettings(detector moderation.LanguageDetector, supported []string, unsupportedAction string) (*languageSettings, error) {
+	settings := &languageSettings{
+		detector:  detector,
+		supported: make(map[string]struct{}, len(supported)),
+	}
+
+	switch unsupportedAction {
+	case "", unsupportedLanguageHint:
+	case unsupportedLanguageSkip:
+		settings.skipUnsupported = true
+	default:
+		return nil, errors.Errorf("unknown unsupported language action '%s'", unsupportedAction)
+	}
+
+	for _, language := range supported {
+		settings.supported[strings.ToLower(language)] = struct{}{}
+	}
+
+	return settings, nil
+}
+
+// apply detects the language of the text. It returns false when the text is
+// in an unsupported language that should not be moderated, and otherwise a
+// context carrying the detected language as a hint for the provider. Text
+// whose language cannot be detected is moderated as before.
+func (l *languageSettings) apply(ctx context.Context, text string) (context.Context, string, bool) {
+	if l == nil || l.detector == nil {
+		return ctx, "", true
+	}
+
+	language, ok := l.detector.DetectLanguage(text)
+	if !ok {
+		return ctx, "", true
+	}
+
+	if !l.supports(language) && l.skipUnsupported {
+		return ctx, language, false
+	}
+
+	return moderation.WithLanguage(ctx, language), language, true
+}
+
+func (l *languageSettings) supports(language string) bool {
+	if len(l.supported) == 0 {
+		return true
+	}
+	_, ok := l.supported[language]
+	return ok
+}
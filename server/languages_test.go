@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// staticDetector detects every text as the same language
+type staticDetector struct {
+	language string
+}
+
+func (d staticDetector) DetectLanguage(text string) (string, bool) {
+	return d.language, d.language != ""
+}
+
+func TestNewLanguageSettings(t *testing.T) {
+	settings, err := newLanguageSettings(nil, []string{"EN", "fr"}, "")
+	require.NoError(t, err)
+	assert.False(t, settings.skipUnsupported)
+	assert.Equal(t, map[string]struct{}{"en": {}, "fr": {}}, settings.supported)
+
+	settings, err = newLanguageSettings(nil, nil, unsupportedLanguageSkip)
+	require.NoError(t, err)
+	assert.True(t, settings.skipUnsupported)
+
+	_, err = newLanguageSettings(nil, nil, "ignore")
+	assert.Error(t, err)
+}
+
+func TestModeratePostLanguageDetection(t *testing.T) {
+	hasLanguage := func(language string) any {
+		return mock.MatchedBy(func(ctx context.Context) bool {
+			return moderation.LanguageFromContext(ctx) == language
+		})
+	}
+
+	t.Run("Unsupported language is skipped", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		mockAPI.On("LogDebug", "Skipping moderation of text in an unsupported language", "post_id", "post1", "language", "ru")
+		mockModerator := &MockModerator{}
+
+		languages, err := newLanguageSettings(staticDetector{"ru"}, []string{"en"}, unsupportedLanguageSkip)
+		require.NoError(t, err)
+		processor := &PostProcessor{
+			moderator: mockModerator,
+			policy:    &moderationPolicy{thresholdValue: 4},
+			languages: languages,
+		}
+
+		err = processor.moderatePost(mockAPI, &model.Post{Id: "post1", UserId: "user1", Message: "Привет"})
+		assert.NoError(t, err)
+		mockModerator.AssertNotCalled(t, "ModerateText")
+		mockAPI.AssertExpectations(t)
+	})
+
+	t.Run("Unsupported language is moderated with a hint", func(t *testing.T) {
+		mockModerator := &MockModerator{}
+		mockModerator.On("ModerateText", hasLanguage("ru"), "Привет").Return(moderation.Result{"hate": 0}, nil)
+
+		languages, err := newLanguageSettings(staticDetector{"ru"}, []string{"en"}, unsupportedLanguageHint)
+		require.NoError(t, err)
+		processor := &PostProcessor{
+			moderator: mockModerator,
+			policy:    &moderationPolicy{thresholdValue: 4},
+			languages: languages,
+		}
+
+		err = processor.moderatePost(&plugintest.API{}, &model.Post{Id: "post1", UserId: "user1", Message: "Привет"})
+		assert.NoError(t, err)
+		mockModerator.AssertExpectations(t)
+	})
+
+	t.Run("Supported and undetected languages are moderated", func(t *testing.T) {
+		for _, language := range []string{"en", ""} {
+			mockModerator := &MockModerator{}
+			mockModerator.On("ModerateText", hasLanguage(language), "hello").Return(moderation.Result{"hate": 0}, nil)
+
+			languages, err := newLanguageSettings(staticDetector{language}, []string{"en"}, unsupportedLanguageSkip)
+			require.NoError(t, err)
+			processor := &PostProcessor{
+				moderator: mockModerator,
+				policy:    &moderationPolicy{thresholdValue: 4},
+				languages: languages,
+			}
+
+			err = processor.moderatePost(&plugintest.API{}, &model.Post{Id: "post1", UserId: "user1", Message: "hello"})
+			assert.NoError(t, err)
+			mockModerator.AssertExpectations(t)
+		}
+	})
+
+	t.Run("Flagged decision records the language and providers", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		mockAPI.On("LogInfo", "Content was flagged by moderation", "post_id", "post1", "severity_threshold", 4,
+			"computed_severity_hate", 6, "severity_breakdown", "hate: 6", "providers", "openai", "language", "fr").Return()
+		mockModerator := &MockModerator{}
+		mockModerator.On("ModerateText", hasLanguage("fr"), "bonjour").Return(moderation.Result{"hate": 6}, nil)
+
+		languages, err := newLanguageSettings(staticDetector{"fr"}, nil, unsupportedLanguageHint)
+		require.NoError(t, err)
+		processor := &PostProcessor{
+			moderator: mockModerator,
+			policy:    &moderationPolicy{thresholdValue: 4},
+			languages: languages,
+			providers: []string{"openai"},
+		}
+
+		err = processor.moderatePost(mockAPI, &model.Post{Id: "post1", UserId: "user1", Message: "bonjour"})
+		var flagged *flaggedContentError
+		require.ErrorAs(t, err, &flagged)
+		assert.Equal(t, "fr", flagged.decision.Language)
+		assert.Equal(t, []string{"openai"}, flagged.decision.Providers)
+		assert.Equal(t, moderation.Result{"hate": 6}, flagged.decision.Result)
+		mockAPI.AssertExpectations(t)
+	})
+}
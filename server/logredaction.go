@@ -0,0 +1,119 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// How post and user IDs appear in moderation logs
+const (
+	logIDsPlain = "plain"
+	logIDsHash  = "hash"
+	logIDsOmit  = "omit"
+)
+
+const (
+	// logHashSaltKey is the KV store key of the salt used to hash IDs in logs
+	logHashSaltKey = "log_hash_salt"
+
+	logHashSaltSize = 32
+
+	// logHashLength is the number of hex characters kept from each hash,
+	// which is plenty to correlate log lines
+	logHashLength = 16
+)
+
+// logRedaction controls how post and user IDs appear in the logs of flagged
+// content and moderation failures, for privacy regimes that forbid logging
+// identities next to flagged content. Hashed IDs use a salt shared by every
+// server, so that log lines about the same post or user can still be
+// correlated.
+type logRedaction struct {
+	mode string
+	salt []byte
+}
+
+// newLogRedaction returns the log redaction settings for the mode. The salt
+// is only needed to hash IDs.
+func newLogRedaction(mode string, salt []byte) (*logRedaction, error) {
+	switch mode {
+	case "":
+		mode = logIDsPlain
+	case logIDsPlain, logIDsOmit:
+	case logIDsHash:
+		if len(salt) == 0 {
+			return nil, errors.New("a salt is required to hash IDs in logs")
+		}
+	default:
+		return nil, errors.Errorf("unknown log ID mode %q", mode)
+	}
+
+	return &logRedaction{mode: mode, salt: salt}, nil
+}
+
+// ids returns the key and ID pairs to log, such as "post_id" and the post ID.
+// Hashed IDs are logged under the key with a "_hash" suffix, and omitted IDs
+// are left out. Nil settings log IDs as they are.
+func (r *logRedaction) ids(keyValuePairs ...string) []any {
+	logged := make([]any, 0, len(keyValuePairs))
+	for i := 0; i+1 < len(keyValuePairs); i += 2 {
+		key, id := keyValuePairs[i], keyValuePairs[i+1]
+
+		switch {
+		case r == nil || r.mode == logIDsPlain:
+			logged = append(logged, key, id)
+		case r.mode == logIDsHash:
+			logged = append(logged, key+"_hash", r.hash(id))
+		}
+	}
+	return logged
+}
+
+// hash returns the truncated, salted hash of the ID
+func (r *logRedaction) hash(id string) string {
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil))[:logHashLength]
+}
+
+// loadLogHashSalt returns the salt used to hash IDs in logs, generating and
+// storing it the first time. Storing it atomically keeps servers in a cluster
+// from generating different salts.
+func loadLogHashSalt(api plugin.API) ([]byte, error) {
+	salt, appErr := api.KVGet(logHashSaltKey)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to load log hash salt")
+	}
+	if len(salt) > 0 {
+		return salt, nil
+	}
+
+	salt = make([]byte, logHashSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "failed to generate log hash salt")
+	}
+
+	saved, appErr := api.KVSetWithOptions(logHashSaltKey, salt, model.PluginKVSetOptions{Atomic: true, OldValue: nil})
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to save log hash salt")
+	}
+	if saved {
+		return salt, nil
+	}
+
+	// Another server saved its salt first
+	salt, appErr = api.KVGet(logHashSaltKey)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to load log hash salt")
+	}
+	if len(salt) == 0 {
+		return nil, errors.New("log hash salt is missing")
+	}
+	return salt, nil
+}
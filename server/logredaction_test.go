@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogRedaction(t *testing.T) {
+	salt := []byte("salt")
+
+	t.Run("Modes", func(t *testing.T) {
+		plain, err := newLogRedaction("", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []any{"post_id", "post1", "user_id", "user1"}, plain.ids("post_id", "post1", "user_id", "user1"))
+
+		omit, err := newLogRedaction(logIDsOmit, nil)
+		require.NoError(t, err)
+		assert.Empty(t, omit.ids("post_id", "post1", "user_id", "user1"))
+
+		hash, err := newLogRedaction(logIDsHash, salt)
+		require.NoError(t, err)
+		ids := hash.ids("post_id", "post1", "user_id", "user1")
+		require.Len(t, ids, 4)
+		assert.Equal(t, "post_id_hash", ids[0])
+		assert.Equal(t, "user_id_hash", ids[2])
+		assert.Len(t, ids[1], logHashLength)
+		assert.NotEqual(t, ids[1], ids[3])
+
+		// The same ID always hashes the same, so log lines can be correlated,
+		// while another salt gives unrelated hashes
+		assert.Equal(t, ids, hash.ids("post_id", "post1", "user_id", "user1"))
+		otherSalt, err := newLogRedaction(logIDsHash, []byte("other"))
+		require.NoError(t, err)
+		assert.NotEqual(t, ids[1], otherSalt.ids("post_id", "post1")[1])
+
+		var unset *logRedaction
+		assert.Equal(t, []any{"post_id", "post1"}, unset.ids("post_id", "post1"))
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		_, err := newLogRedaction(logIDsHash, nil)
+		assert.EqualError(t, err, "a salt is required to hash IDs in logs")
+
+		_, err = newLogRedaction("encrypt", salt)
+		assert.EqualError(t, err, `unknown log ID mode "encrypt"`)
+	})
+
+	t.Run("Raw IDs are absent from moderation logs", func(t *testing.T) {
+		post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+		for _, mode := range []string{logIDsHash, logIDsOmit} {
+			t.Run(mode, func(t *testing.T) {
+				redaction, err := newLogRedaction(mode, salt)
+				require.NoError(t, err)
+
+				// Anything matches missing arguments, so these match log
+				// calls with any number of key value pairs
+				api := &plugintest.API{}
+				for _, level := range []string{"LogDebug", "LogInfo", "LogWarn", "LogError"} {
+					api.On(level, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+				}
+				api.On("KVDelete", mock.Anything).Return(nil)
+
+				moderator := &MockModerator{}
+				moderator.On("ModerateText", mock.Anything, "Offensive message").Return(moderation.Result{}, errors.New("API error")).Once()
+				moderator.On("ModerateText", mock.Anything, "Offensive message").Return(moderation.Result{"hate": 6}, nil).Once()
+
+				policy := newModerationPolicy(4, nil, nil, nil, nil)
+				policy.logRedaction = redaction
+				processor := &PostProcessor{
+					moderator: moderator,
+					policy:    policy,
+					retry:     &retryPolicy{maxAttempts: 1, deadLetterAction: deadLetterDrop},
+				}
+
+				// A moderation failure, then flagged content
+				processor.processPost(api, post)
+				err = processor.moderatePost(api, post)
+				require.True(t, errors.Is(err, ErrModerationRejection))
+
+				logged := map[string]bool{}
+				for _, call := range api.Calls {
+					message := call.Arguments.String(0)
+					if message != "Content moderation error" && message != "Content was flagged by moderation" {
+						continue
+					}
+					logged[message] = true
+					for _, arg := range call.Arguments[1:] {
+						assert.NotEqual(t, "post1", fmt.Sprint(arg), message)
+						assert.NotEqual(t, "user1", fmt.Sprint(arg), message)
+					}
+				}
+				assert.Equal(t, map[string]bool{"Content moderation error": true, "Content was flagged by moderation": true}, logged)
+			})
+		}
+	})
+
+	t.Run("Raw IDs are absent from flag and dead letter logs", func(t *testing.T) {
+		post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+		for _, mode := range []string{logIDsHash, logIDsOmit} {
+			t.Run(mode, func(t *testing.T) {
+				redaction, err := newLogRedaction(mode, salt)
+				require.NoError(t, err)
+
+				api := &plugintest.API{}
+				for _, level := range []string{"LogDebug", "LogInfo", "LogWarn", "LogError"} {
+					api.On(level, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+				}
+				api.On("KVDelete", mock.Anything).Return(&model.AppError{Message: "KV store unavailable"})
+
+				policy := newModerationPolicy(4, nil, nil, nil, nil)
+				policy.logRedaction = redaction
+				processor := &PostProcessor{
+					policy:        policy,
+					action:        &flaggedPostAction{action: moderationActionDelete, monitorOnly: true},
+					retry:         &retryPolicy{maxAttempts: 1, deadLetterAction: deadLetterDrop},
+					notifications: &notificationSettings{},
+				}
+
+				processor.handleFlaggedPost(api, post, moderation.Result{"hate": 6}, moderation.Decision{})
+				processor.handleDeadLetter(api, post)
+
+				logged := map[string]bool{}
+				for _, call := range api.Calls {
+					if !strings.HasPrefix(call.Method, "Log") {
+						continue
+					}
+					message := call.Arguments.String(0)
+					logged[message] = true
+					for _, arg := range call.Arguments[1:] {
+						assert.NotEqual(t, "post1", fmt.Sprint(arg), message)
+						assert.NotEqual(t, "user1", fmt.Sprint(arg), message)
+					}
+				}
+				assert.True(t, logged["Monitor-only mode, leaving flagged post in place"])
+				assert.True(t, logged["Giving up on moderating post after repeated failures"])
+				assert.True(t, logged["Failed to remove persisted queued post"])
+			})
+		}
+	})
+}
+
+func TestLoadLogHashSalt(t *testing.T) {
+	t.Run("Generated and stored once", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", logHashSaltKey).Return(nil, nil)
+		var stored []byte
+		api.On("KVSetWithOptions", logHashSaltKey, mock.Anything, model.PluginKVSetOptions{Atomic: true}).
+			Run(func(args mock.Arguments) { stored = args.Get(1).([]byte) }).
+			Return(true, nil)
+
+		salt, err := loadLogHashSalt(api)
+		require.NoError(t, err)
+		assert.Len(t, salt, logHashSaltSize)
+		assert.Equal(t, stored, salt)
+	})
+
+	t.Run("Existing salt is reused", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", logHashSaltKey).Return([]byte("existing"), nil)
+
+		salt, err := loadLogHashSalt(api)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("existing"), salt)
+		api.AssertNotCalled(t, "KVSetWithOptions", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("Salt saved first by another server wins", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", logHashSaltKey).Return(nil, nil).Once()
+		api.On("KVSetWithOptions", logHashSaltKey, mock.Anything, model.PluginKVSetOptions{Atomic: true}).Return(false, nil)
+		api.On("KVGet", logHashSaltKey).Return([]byte("winner"), nil).Once()
+
+		salt, err := loadLogHashSalt(api)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("winner"), salt)
+	})
+}
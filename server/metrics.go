@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+const metricsNamespace = "mattermost_plugin_content_moderation"
+
+// moderationLatencyBuckets are the upper bounds, in seconds, of the
+// moderation request latency histogram
+var moderationLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metrics counts moderation outcomes for Prometheus. Labels are limited to
+// the categories reported by the providers to keep cardinality bounded. All
+// methods are safe to call on a nil metrics, which records nothing.
+type metrics struct {
+	postsModerated atomic.Int64
+	postsSkipped   atomic.Int64
+	providerErrors atomic.Int64
+	postsDropped   atomic.Int64
+
+	mu sync.Mutex
+
+	// postsFlagged counts flagged posts by category
+	postsFlagged map[string]int64
+
+	// latencyCounts holds the cumulative count of each latency bucket
+	latencyCounts []int64
+	latencySum    float64
+	latencyCount  int64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		postsFlagged:  make(map[string]int64),
+		latencyCounts: make([]int64, len(moderationLatencyBuckets)),
+	}
+}
+
+func (m *metrics) postModerated() {
+	if m != nil {
+		m.postsModerated.Add(1)
+	}
+}
+
+func (m *metrics) postSkipped() {
+	if m != nil {
+		m.postsSkipped.Add(1)
+	}
+}
+
+func (m *metrics) providerError() {
+	if m != nil {
+		m.providerErrors.Add(1)
+	}
+}
+
+func (m *metrics) postDropped() {
+	if m != nil {
+		m.postsDropped.Add(1)
+	}
+}
+
+// postFlagged counts a flagged post once for each flagged category
+func (m *metrics) postFlagged(categories moderation.Result) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for category := range categories {
+		m.postsFlagged[category]++
+	}
+}
+
+// observeLatency records the duration of a moderation request
+func (m *metrics) observeLatency(duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	seconds := duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, bound := range moderationLatencyBuckets {
+		if seconds <= bound {
+			m.latencyCounts[i]++
+		}
+	}
+	m.latencySum += seconds
+	m.latencyCount++
+}
+
+// writeTo writes the metrics in the Prometheus text exposition format
+func (m *metrics) writeTo(w io.Writer) {
+	writeCounter(w, "posts_moderated_total", "Posts checked by the moderation provider.", m.postsModerated.Load())
+	writeCounter(w, "posts_skipped_total", "Posts not moderated because of exclusions, empty content or the moderation schedule.", m.postsSkipped.Load())
+	writeCounter(w, "provider_errors_total", "Failed moderation provider requests.", m.providerErrors.Load())
+	writeCounter(w, "posts_dropped_total", "Posts dropped because the processing queue was full.", m.postsDropped.Load())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := metricsNamespace + "_posts_flagged_total"
+	fmt.Fprintf(w, "# HELP %s Posts flagged by moderation, by category.\n# TYPE %s counter\n", name, name)
+	categories := make([]string, 0, len(m.postsFlagged))
+	for category := range m.postsFlagged {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		fmt.Fprintf(w, "%s{category=%q} %d\n", name, category, m.postsFlagged[category])
+	}
+
+	name = metricsNamespace + "_moderate_text_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s Latency of text moderation requests.\n# TYPE %s histogram\n", name, name)
+	for i, bound := range moderationLatencyBuckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, bound, m.latencyCounts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, m.latencyCount)
+	fmt.Fprintf(w, "%s_sum %g\n", name, m.latencySum)
+	fmt.Fprintf(w, "%s_count %d\n", name, m.latencyCount)
+}
+
+func writeCounter(w io.Writer, name, help string, value int64) {
+	name = metricsNamespace + "_" + name
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
+
+// ServeMetrics exposes the moderation metrics to the Mattermost metrics
+// server, which serves them at /plugins/<plugin id>/metrics
+func (p *Plugin) ServeMetrics(_ *plugin.Context, w http.ResponseWriter, _ *http.Request) {
+	if p.metrics == nil {
+		http.Error(w, "metrics are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	p.metrics.writeTo(w)
+}
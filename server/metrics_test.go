@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestProcessPostRecordsMetrics(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("KVDelete", mock.Anything).Return(nil)
+	api.On("LogInfo", "Content was flagged by moderation", "post_id", "post1", "severity_threshold", 4,
+		mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("AddReaction", mock.Anything).Return(&model.Reaction{}, nil)
+	api.On("GetConfig").Return(&model.Config{})
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+	moderator := &MockModerator{}
+	moderator.On("ModerateText", mock.Anything, "offensive").Return(moderation.Result{"Hate": 6, "Violence": 4, "Sexual": 0}, nil)
+	moderator.On("ModerateText", mock.Anything, "harmless").Return(moderation.Result{"Hate": 0}, nil)
+
+	processor := &PostProcessor{
+		botID:         "bot",
+		moderator:     moderator,
+		policy:        newModerationPolicy(4, nil, nil, nil, nil),
+		excludedUsers: map[string]struct{}{"excluded": {}},
+		retry:         &retryPolicy{maxAttempts: 1},
+		action:        &flaggedPostAction{action: moderationActionFlag, reviewChannelID: model.NewId()},
+		notifications: &notificationSettings{},
+		metrics:       newMetrics(),
+	}
+
+	processor.processPost(api, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "offensive"})
+	processor.processPost(api, &model.Post{Id: "post2", UserId: "user1", ChannelId: "channel1", Message: "harmless"})
+	processor.processPost(api, &model.Post{Id: "post3", UserId: "excluded", ChannelId: "channel1", Message: "offensive"})
+
+	assert.Equal(t, map[string]int64{"Hate": 1, "Violence": 1}, processor.metrics.postsFlagged)
+	assert.Equal(t, int64(2), processor.metrics.postsModerated.Load())
+	assert.Equal(t, int64(1), processor.metrics.postsSkipped.Load())
+	assert.Equal(t, int64(2), processor.metrics.latencyCount)
+}
+
+func TestServeMetrics(t *testing.T) {
+	m := newMetrics()
+	m.postModerated()
+	m.postDropped()
+	m.postFlagged(moderation.Result{"Hate": 6})
+	m.observeLatency(300 * time.Millisecond)
+
+	p := &Plugin{metrics: m}
+	w := httptest.NewRecorder()
+	p.ServeMetrics(nil, w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE mattermost_plugin_content_moderation_posts_moderated_total counter",
+		"mattermost_plugin_content_moderation_posts_moderated_total 1",
+		"mattermost_plugin_content_moderation_posts_skipped_total 0",
+		"mattermost_plugin_content_moderation_posts_dropped_total 1",
+		`mattermost_plugin_content_moderation_posts_flagged_total{category="Hate"} 1`,
+		`mattermost_plugin_content_moderation_moderate_text_duration_seconds_bucket{le="0.25"} 0`,
+		`mattermost_plugin_content_moderation_moderate_text_duration_seconds_bucket{le="0.5"} 1`,
+		`mattermost_plugin_content_moderation_moderate_text_duration_seconds_bucket{le="+Inf"} 1`,
+		"mattermost_plugin_content_moderation_moderate_text_duration_seconds_count 1",
+	} {
+		assert.Contains(t, strings.Split(body, "\n"), line)
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *metrics
+	m.postModerated()
+	m.postSkipped()
+	m.providerError()
+	m.postDropped()
+	m.postFlagged(moderation.Result{"Hate": 6})
+	m.observeLatency(time.Second)
+}
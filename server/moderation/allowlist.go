@@ -0,0 +1,168 @@
+package moderation
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// allowlistBoundary matches a character that cannot be part of a word, so
+// that allowed terms are only removed as whole words
+const allowlistBoundary = `[^\p{L}\p{N}_]`
+
+// Ensure AllowlistModerator implements the Moderator, TextLengthLimiter,
+// RateLimitReporter and BatchModerator interfaces
+var (
+	_ Moderator         = (*AllowlistModerator)(nil)
+	_ TextLengthLimiter = (*AllowlistModerator)(nil)
+	_ RateLimitReporter = (*AllowlistModerator)(nil)
+	_ BatchModerator    = (*AllowlistModerator)(nil)
+	_ ImageModerator    = (*allowlistImageModerator)(nil)
+)
+
+// Allowlist removes terms known to be safe, such as medical or legal
+// vocabulary, from text before it is moderated
+type Allowlist struct {
+	// pattern matches any of the allowed terms as a whole word or phrase
+	pattern *regexp.Regexp
+}
+
+// NewAllowlist creates an allowlist of the terms. Terms match regardless of
+// case, and phrases regardless of the amount of whitespace between words. It
+// returns nil when there are no terms.
+func NewAllowlist(terms []string) (*Allowlist, error) {
+	alternatives := make([]string, 0, len(terms))
+	for _, term := range terms {
+		words := strings.Fields(term)
+		if len(words) == 0 {
+			continue
+		}
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		alternatives = append(alternatives, strings.Join(words, `\s+`))
+	}
+
+	if len(alternatives) == 0 {
+		return nil, nil
+	}
+
+	expr := "(?i)(^|" + allowlistBoundary + ")(?:" + strings.Join(alternatives, "|") + ")(" + allowlistBoundary + "|$)"
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile allowed terms")
+	}
+
+	return &Allowlist{pattern: pattern}, nil
+}
+
+// Strip removes every allowed term from the text, keeping the surrounding
+// text. It returns an empty string when no letters or digits remain.
+func (a *Allowlist) Strip(text string) string {
+	// A match consumes the boundary after it, which hides an allowed term
+	// directly following another, so replace until nothing matches
+	for a.pattern.MatchString(text) {
+		text = a.pattern.ReplaceAllString(text, "$1$2")
+	}
+
+	if !strings.ContainsFunc(text, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) {
+		return ""
+	}
+	return strings.TrimSpace(text)
+}
+
+// AllowlistModerator removes allowed terms from text before passing it to
+// another moderator, so that the terms cannot cause content to be flagged
+type AllowlistModerator struct {
+	inner     Moderator
+	allowlist *Allowlist
+}
+
+// allowlistImageModerator is returned for moderators that also moderate images
+type allowlistImageModerator struct {
+	*AllowlistModerator
+	imageModerator ImageModerator
+}
+
+// WithAllowlist wraps the moderator so that allowed terms are removed from
+// text before it is moderated. Images are moderated unchanged. The returned
+// moderator implements ImageModerator when inner does.
+func WithAllowlist(inner Moderator, allowlist *Allowlist) Moderator {
+	moderator := &AllowlistModerator{inner: inner, allowlist: allowlist}
+	if imageModerator, ok := inner.(ImageModerator); ok {
+		return &allowlistImageModerator{AllowlistModerator: moderator, imageModerator: imageModerator}
+	}
+	return moderator
+}
+
+// ModerateText moderates the text without its allowed terms. Text made up
+// only of allowed terms is not sent to the wrapped moderator.
+func (a *AllowlistModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	text = a.allowlist.Strip(text)
+	if text == "" {
+		return Result{}, nil
+	}
+	return a.inner.ModerateText(ctx, text)
+}
+
+// ModerateTexts moderates each text without its allowed terms. Texts made up
+// only of allowed terms are not sent to the wrapped moderator.
+func (a *AllowlistModerator) ModerateTexts(ctx context.Context, texts []string) ([]Result, error) {
+	results := make([]Result, len(texts))
+	stripped := make([]string, 0, len(texts))
+	indexes := make([]int, 0, len(texts))
+	for i, text := range texts {
+		if text = a.allowlist.Strip(text); text == "" {
+			results[i] = Result{}
+			continue
+		}
+		stripped = append(stripped, text)
+		indexes = append(indexes, i)
+	}
+
+	moderated, err := ModerateTexts(ctx, a.inner, stripped)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		results[i] = moderated[j]
+	}
+	return results, nil
+}
+
+// HealthCheck checks the wrapped moderator
+func (a *AllowlistModerator) HealthCheck(ctx context.Context) error {
+	return a.inner.HealthCheck(ctx)
+}
+
+// MaxTextLength returns the text length limit of the wrapped moderator, or 0
+// when it has none
+func (a *AllowlistModerator) MaxTextLength() int {
+	if limiter, ok := a.inner.(TextLengthLimiter); ok {
+		return limiter.MaxTextLength()
+	}
+	return 0
+}
+
+// RateLimit returns the rate limit of the wrapped moderator, or an unknown
+// rate limit when it does not report one
+func (a *AllowlistModerator) RateLimit() RateLimit {
+	if reporter, ok := a.inner.(RateLimitReporter); ok {
+		return reporter.RateLimit()
+	}
+	return UnknownRateLimit()
+}
+
+// MaxBatchSize returns the batch size of the wrapped moderator, or 0 when it
+// does not moderate texts in batches
+func (a *AllowlistModerator) MaxBatchSize() int {
+	return MaxBatchSize(a.inner)
+}
+
+// ModerateImage moderates the image with the wrapped moderator
+func (a *allowlistImageModerator) ModerateImage(ctx context.Context, data []byte) (Result, error) {
+	return a.imageModerator.ModerateImage(ctx, data)
+}
@@ -0,0 +1,90 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keywordModerator reports a Sexual severity of 4 for text containing the
+// keyword, like a provider over-flagging medical vocabulary
+type keywordModerator struct {
+	keyword string
+	texts   []string
+}
+
+func (m *keywordModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	m.texts = append(m.texts, text)
+	if strings.Contains(strings.ToLower(text), m.keyword) {
+		return Result{"Sexual": 4}, nil
+	}
+	return Result{"Sexual": 0}, nil
+}
+
+func (m *keywordModerator) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func TestAllowlistStrip(t *testing.T) {
+	allowlist, err := NewAllowlist([]string{"breast cancer", "  ", "STI"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "screening for  is on Monday", allowlist.Strip("Breast   Cancer screening for sti is on Monday"))
+	assert.Equal(t, "", allowlist.Strip("breast cancer, STI"))
+	assert.Equal(t, "STIs and stinging nettles", allowlist.Strip("STIs and stinging nettles"), "only whole words are removed")
+	assert.Equal(t, "", allowlist.Strip("sti,sti,sti"), "adjacent terms are all removed")
+
+	allowlist, err = NewAllowlist([]string{" ", ""})
+	require.NoError(t, err)
+	assert.Nil(t, allowlist)
+}
+
+func TestWithAllowlist(t *testing.T) {
+	ctx := context.Background()
+	allowlist, err := NewAllowlist([]string{"breast cancer"})
+	require.NoError(t, err)
+
+	t.Run("Medical term no longer trips Sexual", func(t *testing.T) {
+		inner := &keywordModerator{keyword: "breast"}
+		moderator := WithAllowlist(inner, allowlist)
+
+		result, err := moderator.ModerateText(ctx, "Breast cancer screening is next week")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"Sexual": 0}, result)
+		assert.Equal(t, []string{"screening is next week"}, inner.texts)
+	})
+
+	t.Run("Other content is still flagged", func(t *testing.T) {
+		inner := &keywordModerator{keyword: "breast"}
+		moderator := WithAllowlist(inner, allowlist)
+
+		result, err := moderator.ModerateText(ctx, "breast cancer awareness, and an explicit breast photo")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"Sexual": 4}, result)
+	})
+
+	t.Run("Text made up of allowed terms is not sent", func(t *testing.T) {
+		inner := &keywordModerator{keyword: "breast"}
+		moderator := WithAllowlist(inner, allowlist)
+
+		result, err := moderator.ModerateText(ctx, "Breast cancer")
+		require.NoError(t, err)
+		assert.Empty(t, result)
+		assert.Empty(t, inner.texts)
+	})
+
+	t.Run("Image support is preserved", func(t *testing.T) {
+		_, ok := WithAllowlist(&staticModerator{}, allowlist).(ImageModerator)
+		assert.False(t, ok)
+
+		imageModerator, ok := WithAllowlist(&imageStaticModerator{staticModerator{result: Result{"hate": 4}}}, allowlist).(ImageModerator)
+		require.True(t, ok)
+
+		result, err := imageModerator.ModerateImage(ctx, []byte("image"))
+		require.NoError(t, err)
+		assert.Equal(t, Result{"hate": 4}, result)
+	})
+}
@@ -0,0 +1,193 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// AuthModeKey authenticates with the subscription key of the resource
+	AuthModeKey = "key"
+
+	// AuthModeAAD authenticates with a Microsoft Entra ID (Azure AD) bearer
+	// token, obtained with client credentials when a client secret is
+	// configured and from the managed identity of the host otherwise
+	AuthModeAAD = "aad"
+
+	// cognitiveServicesScope is the token scope of Azure AI services
+	cognitiveServicesScope = "https://cognitiveservices.azure.com/.default"
+
+	// cognitiveServicesResource is the token resource of Azure AI services,
+	// used by the managed identity endpoint
+	cognitiveServicesResource = "https://cognitiveservices.azure.com/"
+
+	// defaultAuthorityHost issues tokens for client credentials
+	defaultAuthorityHost = "https://login.microsoftonline.com"
+
+	// defaultIMDSEndpoint is the Azure Instance Metadata Service endpoint
+	// issuing managed identity tokens
+	defaultIMDSEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+	// tokenRefreshMargin is how long before expiry a token is replaced, so
+	// that no request is sent with a token about to expire
+	tokenRefreshMargin = 5 * time.Minute
+)
+
+// tokenSource obtains bearer tokens and caches them until shortly before
+// they expire
+type tokenSource struct {
+	client *http.Client
+
+	tenantID     string
+	clientID     string
+	clientSecret string
+
+	// authorityHost and imdsEndpoint are the token endpoints, replaced in tests
+	authorityHost string
+	imdsEndpoint  string
+
+	// now returns the current time, replaced in tests
+	now func() time.Time
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// tokenResponse is returned by both token endpoints. The managed identity
+// endpoint encodes expires_in as a string.
+type tokenResponse struct {
+	AccessToken string          `json:"access_token"`
+	ExpiresIn   json.RawMessage `json:"expires_in"`
+}
+
+// newTokenSource validates the AAD credentials. Client credentials need the
+// tenant ID, client ID and client secret. Without a tenant ID or client
+// secret the managed identity of the host is used, selecting a user-assigned
+// identity when a client ID is set.
+func newTokenSource(client *http.Client, tenantID, clientID, clientSecret string) (*tokenSource, error) {
+	if tenantID != "" || clientSecret != "" {
+		var missing []string
+		for _, field := range []struct{ name, value string }{
+			{"tenant ID", tenantID},
+			{"client ID", clientID},
+			{"client secret", clientSecret},
+		} {
+			if field.value == "" {
+				missing = append(missing, field.name)
+			}
+		}
+		if len(missing) > 0 {
+			return nil, errors.Errorf("AAD client credentials require a %s", strings.Join(missing, " and "))
+		}
+	}
+
+	return &tokenSource{
+		client:        client,
+		tenantID:      tenantID,
+		clientID:      clientID,
+		clientSecret:  clientSecret,
+		authorityHost: defaultAuthorityHost,
+		imdsEndpoint:  defaultIMDSEndpoint,
+		now:           time.Now,
+	}, nil
+}
+
+// Token returns a valid bearer token, requesting a new one when the cached
+// token is missing or about to expire
+func (s *tokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && s.now().Add(tokenRefreshMargin).Before(s.expiry) {
+		return s.token, nil
+	}
+
+	req, err := s.tokenRequest(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to create token request")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", moderation.RequestError(errors.Wrap(err, "failed to request AAD token"))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", moderation.NewError(tokenErrorKind(resp.StatusCode), errors.Errorf("AAD token endpoint returned status %d: %s", resp.StatusCode, body))
+	}
+
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", moderation.NewError(moderation.ErrorDecode, errors.Wrap(err, "failed to decode AAD token response"))
+	}
+	if token.AccessToken == "" {
+		return "", moderation.NewError(moderation.ErrorDecode, errors.New("AAD token response has no access token"))
+	}
+
+	expiresIn, err := strconv.Atoi(strings.Trim(string(token.ExpiresIn), `"`))
+	if err != nil {
+		return "", moderation.NewError(moderation.ErrorDecode, errors.Wrap(err, "failed to parse AAD token expiry"))
+	}
+
+	s.token = token.AccessToken
+	s.expiry = s.now().Add(time.Duration(expiresIn) * time.Second)
+	return s.token, nil
+}
+
+// tokenErrorKind returns the kind of failure reported by the token endpoint.
+// The endpoint rejects unknown clients and bad secrets with a 400 as well as
+// a 401, so client errors other than throttling are authentication failures.
+func tokenErrorKind(statusCode int) moderation.ErrorKind {
+	kind := moderation.StatusErrorKind(statusCode)
+	if kind == moderation.ErrorTransport && statusCode < http.StatusInternalServerError {
+		return moderation.ErrorAuth
+	}
+	return kind
+}
+
+// tokenRequest builds the client credentials request, or the managed
+// identity request when no client secret is configured
+func (s *tokenSource) tokenRequest(ctx context.Context) (*http.Request, error) {
+	if s.clientSecret != "" {
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {s.clientID},
+			"client_secret": {s.clientSecret},
+			"scope":         {cognitiveServicesScope},
+		}
+		endpoint := s.authorityHost + "/" + url.PathEscape(s.tenantID) + "/oauth2/v2.0/token"
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}
+
+	query := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {cognitiveServicesResource},
+	}
+	if s.clientID != "" {
+		query.Set("client_id", s.clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.imdsEndpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	return req, nil
+}
@@ -0,0 +1,143 @@
+package azure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAnalyzeServer returns a Content Safety stub that records the
+// Authorization header of every request
+func newAnalyzeServer(t *testing.T, authorizations *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Ocp-Apim-Subscription-Key"))
+		*authorizations = append(*authorizations, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(`{"categoriesAnalysis":[]}`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAADClientCredentials(t *testing.T) {
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/tenant/oauth2/v2.0/token", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(t, "client", r.PostForm.Get("client_id"))
+		assert.Equal(t, "secret", r.PostForm.Get("client_secret"))
+		assert.Equal(t, cognitiveServicesScope, r.PostForm.Get("scope"))
+
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3600,"access_token":"token` + string(rune('0'+tokenRequests)) + `"}`))
+	}))
+	defer tokenServer.Close()
+
+	var authorizations []string
+	server := newAnalyzeServer(t, &authorizations)
+
+	mod, err := New(&moderation.Config{
+		Endpoint:     server.URL,
+		AuthMode:     AuthModeAAD,
+		TenantID:     "tenant",
+		ClientID:     "client",
+		ClientSecret: "secret",
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	mod.tokens.authorityHost = tokenServer.URL
+	mod.tokens.now = func() time.Time { return now }
+
+	for range 2 {
+		_, err = mod.ModerateText(context.Background(), "text")
+		require.NoError(t, err)
+	}
+
+	// The token is refreshed before it expires
+	now = now.Add(time.Hour - tokenRefreshMargin)
+	_, err = mod.ModerateText(context.Background(), "text")
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, tokenRequests)
+	assert.Equal(t, []string{"Bearer token1", "Bearer token1", "Bearer token2"}, authorizations)
+}
+
+func TestAADManagedIdentity(t *testing.T) {
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "true", r.Header.Get("Metadata"))
+		assert.Equal(t, cognitiveServicesResource, r.URL.Query().Get("resource"))
+		assert.Equal(t, "identity", r.URL.Query().Get("client_id"))
+
+		// The managed identity endpoint encodes the expiry as a string
+		_, _ = w.Write([]byte(`{"access_token":"managed","expires_in":"86399","token_type":"Bearer"}`))
+	}))
+	defer imds.Close()
+
+	var authorizations []string
+	server := newAnalyzeServer(t, &authorizations)
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, AuthMode: AuthModeAAD, ClientID: "identity"})
+	require.NoError(t, err)
+	mod.tokens.imdsEndpoint = imds.URL
+
+	require.NoError(t, mod.HealthCheck(context.Background()))
+	assert.Equal(t, []string{"Bearer managed"}, authorizations)
+}
+
+func TestAADTokenFailure(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+	}))
+	defer tokenServer.Close()
+
+	var authorizations []string
+	server := newAnalyzeServer(t, &authorizations)
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, AuthMode: AuthModeAAD, TenantID: "tenant", ClientID: "client", ClientSecret: "wrong"})
+	require.NoError(t, err)
+	mod.tokens.authorityHost = tokenServer.URL
+
+	_, err = mod.ModerateText(context.Background(), "text")
+	assert.ErrorContains(t, err, "invalid_client")
+	assert.Empty(t, authorizations)
+	kind, _ := moderation.KindOf(err)
+	assert.Equal(t, moderation.ErrorAuth, kind)
+}
+
+func TestNewAuthMode(t *testing.T) {
+	tests := []struct {
+		name   string
+		config moderation.Config
+		err    string
+	}{
+		{name: "Key", config: moderation.Config{APIKey: "key"}},
+		{name: "Key without API key", config: moderation.Config{AuthMode: AuthModeKey}, err: "API key is required"},
+		{name: "AAD without API key", config: moderation.Config{AuthMode: AuthModeAAD, TenantID: "tenant", ClientID: "client", ClientSecret: "secret"}},
+		{name: "System-assigned managed identity", config: moderation.Config{AuthMode: AuthModeAAD}},
+		{name: "Client secret without IDs", config: moderation.Config{AuthMode: AuthModeAAD, ClientSecret: "secret"}, err: "AAD client credentials require a tenant ID and client ID"},
+		{name: "Tenant without client secret", config: moderation.Config{AuthMode: AuthModeAAD, TenantID: "tenant", ClientID: "client"}, err: "AAD client credentials require a client secret"},
+		{name: "Unknown mode", config: moderation.Config{AuthMode: "certificate"}, err: `unknown auth mode "certificate"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Endpoint = "https://example.cognitiveservices.azure.com"
+			_, err := New(&tt.config)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -6,6 +6,12 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
 	"github.com/pkg/errors"
@@ -13,10 +19,30 @@ import (
 
 const (
 	// ContentSafetyTextAnalyzeEndpoint is the Azure AI Content Safety text analyze API path
-	ContentSafetyTextAnalyzeEndpoint = "/contentsafety/text:analyze?api-version=2024-09-01"
+	ContentSafetyTextAnalyzeEndpoint = "/contentsafety/text:analyze"
+
+	// ContentSafetyImageAnalyzeEndpoint is the Azure AI Content Safety image analyze API path
+	ContentSafetyImageAnalyzeEndpoint = "/contentsafety/image:analyze"
+
+	// DefaultAPIVersion is the API version requested when none is configured.
+	// It is the generally available version the request and response types
+	// are written against.
+	DefaultAPIVersion = "2024-09-01"
 
 	// DefaultOutputType is used to determine the result format provided by the API
 	DefaultOutputType = "FourSeverityLevels"
+
+	// healthCheckText is the text analyzed to verify the endpoint and API key
+	healthCheckText = "health check"
+
+	// MaxTextLength is the maximum number of characters the text analyze API
+	// accepts per request
+	MaxTextLength = 10000
+
+	// RateLimitLimitHeader and RateLimitRemainingHeader report the request
+	// quota of the Azure resource
+	RateLimitLimitHeader     = "X-Ratelimit-Limit-Requests"
+	RateLimitRemainingHeader = "X-Ratelimit-Remaining-Requests"
 )
 
 // These constants define the available content categories for moderation
@@ -27,8 +53,46 @@ const (
 	CategorySelfHarm = "SelfHarm"
 )
 
-// Ensure Moderator implements the moderation.Moderator interface
-var _ moderation.Moderator = (*Moderator)(nil)
+// CategoryBlocklist is the synthetic category reported with MaxSeverity
+// when text matches one of the configured blocklists. It is not evaluated by
+// the API, so it is not part of Categories.
+const CategoryBlocklist = "Blocklist"
+
+// Categories lists every category the API evaluates
+var Categories = []string{CategoryHate, CategorySexual, CategoryViolence, CategorySelfHarm}
+
+// CategoryMapping maps the categories the API evaluates onto the canonical
+// categories reported by the moderator
+var CategoryMapping = moderation.CategoryMapping{
+	"hate":     moderation.CategoryHate,
+	"sexual":   moderation.CategorySexual,
+	"violence": moderation.CategoryViolence,
+	"selfharm": moderation.CategorySelfHarm,
+}
+
+// ParseCategory returns the category matching the name regardless of case,
+// or false when the API has no such category
+func ParseCategory(name string) (string, bool) {
+	for _, category := range Categories {
+		if strings.EqualFold(category, strings.TrimSpace(name)) {
+			return category, true
+		}
+	}
+	return "", false
+}
+
+// apiVersionPattern matches Azure API versions such as "2024-09-01" and
+// "2023-10-15-preview"
+var apiVersionPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}(-preview)?$`)
+
+// Ensure Moderator implements the moderation.Moderator, moderation.ImageModerator,
+// moderation.TextLengthLimiter and moderation.RateLimitReporter interfaces
+var (
+	_ moderation.Moderator         = (*Moderator)(nil)
+	_ moderation.ImageModerator    = (*Moderator)(nil)
+	_ moderation.TextLengthLimiter = (*Moderator)(nil)
+	_ moderation.RateLimitReporter = (*Moderator)(nil)
+)
 
 // Moderator implements Azure AI Content Safety for text moderation
 type Moderator struct {
@@ -37,6 +101,28 @@ type Moderator struct {
 
 	// config holds the Azure moderator configuration
 	config *moderation.Config
+
+	// endpoint is the scheme and host of the Azure resource, and apiVersion
+	// the API version requested from it
+	endpoint   string
+	apiVersion string
+
+	// categories are the categories requested from the API
+	categories []string
+
+	// tokens issues bearer tokens with AAD authentication, or is nil when
+	// requests use the API key
+	tokens *tokenSource
+
+	// maxRetries is the number of times a throttled or failed request is retried
+	maxRetries int
+
+	// retryBackoff is the wait before the first retry
+	retryBackoff time.Duration
+
+	// rateLimit is the quota reported by the most recent response
+	rateLimitMu sync.Mutex
+	rateLimit   moderation.RateLimit
 }
 
 // TextAnalyzeRequest represents the request structure for Azure Content Safety text analysis
@@ -44,6 +130,23 @@ type TextAnalyzeRequest struct {
 	Text       string   `json:"text"`
 	Categories []string `json:"categories,omitempty"`
 	OutputType string   `json:"outputType,omitempty"`
+
+	// Language is the detected language of the text, sent as a hint when the
+	// plugin detected one
+	Language string `json:"language,omitempty"`
+
+	// BlocklistNames are the blocklists managed in the Azure resource that the
+	// text is checked against
+	BlocklistNames []string `json:"blocklistNames,omitempty"`
+}
+
+// ImageAnalyzeRequest represents the request structure for Azure Content Safety image analysis
+type ImageAnalyzeRequest struct {
+	Image struct {
+		Content []byte `json:"content"`
+	} `json:"image"`
+	Categories []string `json:"categories,omitempty"`
+	OutputType string   `json:"outputType,omitempty"`
 }
 
 // AnalyzeResponse represents the response from Azure Content Safety API
@@ -52,34 +155,144 @@ type AnalyzeResponse struct {
 		Category string `json:"category"`
 		Severity int    `json:"severity"`
 	} `json:"categoriesAnalysis"`
+	BlocklistsMatch []struct {
+		BlocklistName     string `json:"blocklistName"`
+		BlocklistItemID   string `json:"blocklistItemId"`
+		BlocklistItemText string `json:"blocklistItemText"`
+	} `json:"blocklistsMatch"`
 }
 
 // New creates a new Azure AI Content Safety moderator
 func New(config *moderation.Config) (*Moderator, error) {
-	if config.Endpoint == "" {
-		return nil, errors.New("endpoint URL is required")
+	endpoint, err := parseEndpoint(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	apiVersion := strings.TrimSpace(config.APIVersion)
+	if apiVersion == "" {
+		apiVersion = DefaultAPIVersion
+	}
+	if !apiVersionPattern.MatchString(apiVersion) {
+		return nil, errors.Errorf("invalid API version %q, expected a version such as %s", apiVersion, DefaultAPIVersion)
+	}
+
+	client, err := newHTTPClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens *tokenSource
+	switch config.AuthMode {
+	case "", AuthModeKey:
+		if config.APIKey == "" {
+			return nil, errors.New("API key is required")
+		}
+	case AuthModeAAD:
+		var err error
+		if tokens, err = newTokenSource(client, config.TenantID, config.ClientID, config.ClientSecret); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.Errorf("unknown auth mode %q", config.AuthMode)
 	}
 
-	if config.APIKey == "" {
-		return nil, errors.New("API key is required")
+	maxRetries := config.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	}
+
+	// Requesting fewer categories reduces the work done by the API
+	categories := Categories
+	if len(config.Categories) > 0 {
+		categories = make([]string, 0, len(config.Categories))
+		for _, name := range config.Categories {
+			category, ok := ParseCategory(name)
+			if !ok {
+				return nil, errors.Errorf("unknown category %q", name)
+			}
+			categories = append(categories, category)
+		}
 	}
 
 	return &Moderator{
-		client: &http.Client{},
-		config: config,
+		client:       client,
+		config:       config,
+		endpoint:     endpoint,
+		apiVersion:   apiVersion,
+		categories:   categories,
+		tokens:       tokens,
+		maxRetries:   max(maxRetries, 0),
+		retryBackoff: defaultRetryBackoff,
+		rateLimit:    moderation.UnknownRateLimit(),
 	}, nil
 }
 
-// ModerateText analyzes text content using Azure AI Content Safety API
-func (m *Moderator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
-	// Create the request for moderation
-	req, err := makeModerateTextRequest(ctx, m.config.Endpoint, text)
+// parseEndpoint validates the endpoint URL of the Azure resource, such as
+// https://<resource>.cognitiveservices.azure.com, and returns its scheme and
+// host. The API paths are added by the moderator, so an endpoint with a path
+// is rejected rather than producing requests that fail.
+func parseEndpoint(endpoint string) (string, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return "", errors.New("endpoint URL is required")
+	}
+
+	parsed, err := url.Parse(endpoint)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create moderation request")
+		return "", errors.Wrapf(err, "invalid endpoint URL %q", endpoint)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return "", errors.Errorf("endpoint URL %q must start with https://, such as https://<resource>.cognitiveservices.azure.com", endpoint)
 	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return "", errors.Errorf("endpoint URL %q must use https", endpoint)
+	}
+	if strings.TrimSuffix(parsed.Path, "/") != "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+		return "", errors.Errorf("endpoint URL %q must only contain the scheme and host, such as %s://%s", endpoint, parsed.Scheme, parsed.Host)
+	}
+
+	return parsed.Scheme + "://" + parsed.Host, nil
+}
+
+// analyzeURL returns the URL of the API path with the API version
+func (m *Moderator) analyzeURL(path string) string {
+	return m.endpoint + path + "?api-version=" + url.QueryEscape(m.apiVersion)
+}
 
-	// Send the request to the Azure API
-	result, err := sendRequest(m.client, m.config.APIKey, req)
+// MaxTextLength returns the maximum number of characters per text request
+func (m *Moderator) MaxTextLength() int {
+	return MaxTextLength
+}
+
+// RateLimit returns the quota reported by the most recent response, and when
+// the API accepts requests again after throttling
+func (m *Moderator) RateLimit() moderation.RateLimit {
+	m.rateLimitMu.Lock()
+	defer m.rateLimitMu.Unlock()
+	return m.rateLimit
+}
+
+// ModerateText analyzes text content using Azure AI Content Safety API. Text
+// longer than MaxTextLength is moderated in chunks.
+func (m *Moderator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	return moderation.ModerateChunks(ctx, text, MaxTextLength, m.moderateTextChunk)
+}
+
+func (m *Moderator) moderateTextChunk(ctx context.Context, text string) (moderation.Result, error) {
+	var result moderation.Result
+	err := m.withRetry(ctx, func() error {
+		// Create the request for moderation. The request body is consumed when
+		// sent, so every attempt needs a new request.
+		req, err := makeModerateTextRequest(ctx, m.analyzeURL(ContentSafetyTextAnalyzeEndpoint), text, m.categories, m.config.Blocklists)
+		if err != nil {
+			return errors.Wrap(err, "failed to create moderation request")
+		}
+
+		// Send the request to the Azure API
+		result, err = m.sendRequest(req)
+		return err
+	})
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to moderate text content")
 	}
@@ -87,12 +300,41 @@ func (m *Moderator) ModerateText(ctx context.Context, text string) (moderation.R
 	return result, nil
 }
 
-func makeModerateTextRequest(ctx context.Context, apiEndpoint string, text string) (*http.Request, error) {
+// ModerateImage analyzes image content using Azure AI Content Safety API
+func (m *Moderator) ModerateImage(ctx context.Context, data []byte) (moderation.Result, error) {
+	var result moderation.Result
+	err := m.withRetry(ctx, func() error {
+		req, err := makeModerateImageRequest(ctx, m.analyzeURL(ContentSafetyImageAnalyzeEndpoint), data, m.categories)
+		if err != nil {
+			return errors.Wrap(err, "failed to create image moderation request")
+		}
+
+		result, err = m.sendRequest(req)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to moderate image content")
+	}
+
+	return result, nil
+}
+
+// HealthCheck validates the endpoint and API key by analyzing a short text
+func (m *Moderator) HealthCheck(ctx context.Context) error {
+	if _, err := m.ModerateText(ctx, healthCheckText); err != nil {
+		return errors.Wrap(err, "Azure AI Content Safety health check failed")
+	}
+	return nil
+}
+
+func makeModerateTextRequest(ctx context.Context, endpoint string, text string, categories, blocklists []string) (*http.Request, error) {
 	// Create the request body
 	reqBody := TextAnalyzeRequest{
-		Text:       text,
-		Categories: []string{CategoryHate, CategorySexual, CategoryViolence, CategorySelfHarm},
-		OutputType: DefaultOutputType,
+		Text:           text,
+		Categories:     categories,
+		OutputType:     DefaultOutputType,
+		Language:       moderation.LanguageFromContext(ctx),
+		BlocklistNames: blocklists,
 	}
 
 	jsonBody, err := json.Marshal(reqBody)
@@ -101,7 +343,6 @@ func makeModerateTextRequest(ctx context.Context, apiEndpoint string, text strin
 	}
 
 	// Create the HTTP request
-	endpoint := apiEndpoint + ContentSafetyTextAnalyzeEndpoint
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(jsonBody))
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating request")
@@ -110,49 +351,98 @@ func makeModerateTextRequest(ctx context.Context, apiEndpoint string, text strin
 	return req, nil
 }
 
-// addRequestHeaders adds the required headers to the request
-func addRequestHeaders(req *http.Request, apiKey string) {
+func makeModerateImageRequest(ctx context.Context, endpoint string, data []byte, categories []string) (*http.Request, error) {
+	// The image content is base64 encoded by the JSON marshaler
+	reqBody := ImageAnalyzeRequest{
+		Categories: categories,
+		OutputType: DefaultOutputType,
+	}
+	reqBody.Image.Content = data
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+
+	return req, nil
+}
+
+// addRequestHeaders adds the required headers to the request, authenticating
+// with a bearer token in AAD mode and with the API key otherwise
+func (m *Moderator) addRequestHeaders(req *http.Request) error {
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Ocp-Apim-Subscription-Key", apiKey)
+
+	if m.tokens == nil {
+		req.Header.Set("Ocp-Apim-Subscription-Key", m.config.APIKey)
+		return nil
+	}
+
+	token, err := m.tokens.Token(req.Context())
+	if err != nil {
+		return errors.Wrap(err, "failed to authenticate with AAD")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
 }
 
 // parseResponseBody parses the response body into a structured AnalyzeResponse
 func parseResponseBody(responseBody io.Reader) (*AnalyzeResponse, error) {
 	var analyzeResp AnalyzeResponse
 	if err := json.NewDecoder(responseBody).Decode(&analyzeResp); err != nil {
-		return nil, errors.Wrap(err, "error decoding API response")
+		return nil, moderation.NewError(moderation.ErrorDecode, errors.Wrap(err, "error decoding API response"))
 	}
 	return &analyzeResp, nil
 }
 
-// convertToModerationResult converts API response to moderation.Result
+// convertToModerationResult converts API response to moderation.Result,
+// reporting each category under its canonical category. A blocklist match is
+// reported as CategoryBlocklist with MaxSeverity, so that it flags the text
+// regardless of the threshold.
 func convertToModerationResult(resp *AnalyzeResponse) moderation.Result {
 	result := make(moderation.Result)
 	for _, categoryResult := range resp.CategoriesAnalysis {
 		result[categoryResult.Category] = categoryResult.Severity
 	}
+	result = CategoryMapping.Normalize(result)
+	if len(resp.BlocklistsMatch) > 0 {
+		result[CategoryBlocklist] = moderation.MaxSeverity
+	}
 	return result
 }
 
 // sendRequest sends a request to the Azure API and processes the response
-func sendRequest(client *http.Client, apiKey string, req *http.Request) (moderation.Result, error) {
+func (m *Moderator) sendRequest(req *http.Request) (moderation.Result, error) {
 	// Add headers
-	addRequestHeaders(req, apiKey)
+	if err := m.addRequestHeaders(req); err != nil {
+		return nil, err
+	}
 
 	// Execute the request
-	resp, err := client.Do(req)
+	resp, err := m.client.Do(req)
 	if err != nil {
-		return nil, errors.Wrap(err, "error calling Azure AI Content Safety API")
+		return nil, moderation.RequestError(errors.Wrap(err, "error calling Azure AI Content Safety API"))
 	}
 	defer resp.Body.Close()
 
+	retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	m.recordRateLimit(resp, retryAfter)
+
 	// Handle non-successful responses
 	if resp.StatusCode != http.StatusOK {
 		body, e := io.ReadAll(resp.Body)
 		if e != nil {
-			return nil, errors.Wrapf(e, "failed to read error response body (status code: %d)", resp.StatusCode)
+			return nil, moderation.RequestError(errors.Wrapf(e, "failed to read error response body (status code: %d)", resp.StatusCode))
 		}
-		return nil, errors.Errorf("Azure API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, moderation.NewError(moderation.StatusErrorKind(resp.StatusCode), &statusError{
+			statusCode: resp.StatusCode,
+			body:       string(body),
+			retryAfter: retryAfter,
+		})
 	}
 
 	// Parse the response
@@ -164,3 +454,21 @@ func sendRequest(client *http.Client, apiKey string, req *http.Request) (moderat
 	// Convert to result
 	return convertToModerationResult(analyzeResp), nil
 }
+
+// recordRateLimit stores the quota reported by the response headers. A
+// throttled response also records when requests may resume, so that callers
+// can pause all requests rather than only the throttled one.
+func (m *Moderator) recordRateLimit(resp *http.Response, retryAfter time.Duration) {
+	m.rateLimitMu.Lock()
+	defer m.rateLimitMu.Unlock()
+
+	if limit, err := strconv.Atoi(resp.Header.Get(RateLimitLimitHeader)); err == nil {
+		m.rateLimit.Limit = limit
+	}
+	if remaining, err := strconv.Atoi(resp.Header.Get(RateLimitRemainingHeader)); err == nil {
+		m.rateLimit.Remaining = remaining
+	}
+	if resp.StatusCode == http.StatusTooManyRequests && retryAfter > 0 {
+		m.rateLimit.ResumeAt = time.Now().Add(retryAfter)
+	}
+}
@@ -0,0 +1,433 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModerateTextChunksLongMessages(t *testing.T) {
+	var mu sync.Mutex
+	var texts []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "key", r.Header.Get("Ocp-Apim-Subscription-Key"))
+
+		var req TextAnalyzeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		mu.Lock()
+		texts = append(texts, req.Text)
+		mu.Unlock()
+
+		if utf8.RuneCountInString(req.Text) > MaxTextLength {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"code":"InvalidRequestBody","message":"text is too long"}}`))
+			return
+		}
+
+		severity := 0
+		if strings.Contains(req.Text, "offensive") {
+			severity = 6
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"categoriesAnalysis": []map[string]any{
+				{"category": CategoryHate, "severity": severity},
+				{"category": CategoryViolence, "severity": 0},
+			},
+		})
+	}))
+	defer server.Close()
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+	require.NoError(t, err)
+
+	// The only offensive content is at the very end of a 50k character message
+	text := strings.Repeat("harmless words ", 3333) + "offensive"
+	require.Greater(t, utf8.RuneCountInString(text), 50000)
+
+	result, err := mod.ModerateText(context.Background(), text)
+	require.NoError(t, err)
+	assert.Equal(t, moderation.Result{moderation.CategoryHate: 6, moderation.CategoryViolence: 0}, result)
+
+	assert.Len(t, texts, 6)
+	assert.Equal(t, text, strings.Join(texts, ""))
+}
+
+func TestModerateTextLanguageHint(t *testing.T) {
+	var languages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req TextAnalyzeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		languages = append(languages, req.Language)
+		_, _ = w.Write([]byte(`{"categoriesAnalysis":[]}`))
+	}))
+	defer server.Close()
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+	require.NoError(t, err)
+
+	_, err = mod.ModerateText(context.Background(), "text")
+	require.NoError(t, err)
+	_, err = mod.ModerateText(moderation.WithLanguage(context.Background(), "fr"), "texte")
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", "fr"}, languages)
+}
+
+func TestModerateTextCategories(t *testing.T) {
+	var categories [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req TextAnalyzeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		categories = append(categories, req.Categories)
+		_, _ = w.Write([]byte(`{"categoriesAnalysis":[]}`))
+	}))
+	defer server.Close()
+
+	all, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+	require.NoError(t, err)
+	_, err = all.ModerateText(context.Background(), "text")
+	require.NoError(t, err)
+
+	some, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key", Categories: []string{"sexual", "SelfHarm"}})
+	require.NoError(t, err)
+	_, err = some.ModerateText(context.Background(), "text")
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{Categories, {CategorySexual, CategorySelfHarm}}, categories)
+
+	_, err = New(&moderation.Config{Endpoint: server.URL, APIKey: "key", Categories: []string{"Spam"}})
+	assert.EqualError(t, err, `unknown category "Spam"`)
+}
+
+func TestConvertToModerationResultCanonicalCategories(t *testing.T) {
+	result := convertToModerationResult(&AnalyzeResponse{
+		CategoriesAnalysis: []struct {
+			Category string `json:"category"`
+			Severity int    `json:"severity"`
+		}{
+			{Category: CategoryHate, Severity: 2},
+			{Category: CategorySexual, Severity: 4},
+			{Category: CategoryViolence, Severity: 0},
+			{Category: CategorySelfHarm, Severity: 6},
+		},
+	})
+
+	assert.Equal(t, moderation.Result{
+		moderation.CategoryHate:     2,
+		moderation.CategorySexual:   4,
+		moderation.CategoryViolence: 0,
+		moderation.CategorySelfHarm: 6,
+	}, result)
+}
+
+func TestModerateTextBlocklists(t *testing.T) {
+	var blocklists [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req TextAnalyzeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		blocklists = append(blocklists, req.BlocklistNames)
+
+		response := map[string]any{
+			"categoriesAnalysis": []map[string]any{
+				{"category": CategoryHate, "severity": 0},
+			},
+		}
+		if strings.Contains(req.Text, "project-falcon") {
+			response["blocklistsMatch"] = []map[string]any{
+				{"blocklistName": "codenames", "blocklistItemId": "item1", "blocklistItemText": "project-falcon"},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key", Blocklists: []string{"codenames", "competitors"}})
+	require.NoError(t, err)
+
+	result, err := mod.ModerateText(context.Background(), "Details of project-falcon")
+	require.NoError(t, err)
+	assert.Equal(t, moderation.Result{moderation.CategoryHate: 0, CategoryBlocklist: moderation.MaxSeverity}, result)
+
+	result, err = mod.ModerateText(context.Background(), "Harmless text")
+	require.NoError(t, err)
+	assert.Equal(t, moderation.Result{moderation.CategoryHate: 0}, result)
+
+	withoutBlocklists, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+	require.NoError(t, err)
+	_, err = withoutBlocklists.ModerateText(context.Background(), "text")
+	require.NoError(t, err)
+
+	assert.Equal(t, [][]string{{"codenames", "competitors"}, {"codenames", "competitors"}, nil}, blocklists)
+
+	_, ok := ParseCategory(CategoryBlocklist)
+	assert.False(t, ok, "the blocklist category is not evaluated by the API")
+}
+
+func TestRequestURL(t *testing.T) {
+	for _, apiVersion := range []string{"", "2024-09-01", "2023-10-15-preview"} {
+		t.Run("API version "+apiVersion, func(t *testing.T) {
+			var paths, versions []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.URL.Path)
+				versions = append(versions, r.URL.Query().Get("api-version"))
+				_ = json.NewEncoder(w).Encode(map[string]any{"categoriesAnalysis": []map[string]any{}})
+			}))
+			defer server.Close()
+
+			// A trailing slash, as copied from the Azure portal, is accepted
+			mod, err := New(&moderation.Config{Endpoint: server.URL + "/", APIKey: "key", APIVersion: apiVersion})
+			require.NoError(t, err)
+
+			_, err = mod.ModerateText(context.Background(), "text")
+			require.NoError(t, err)
+			_, err = mod.ModerateImage(context.Background(), []byte("image"))
+			require.NoError(t, err)
+
+			expected := apiVersion
+			if expected == "" {
+				expected = DefaultAPIVersion
+			}
+			assert.Equal(t, []string{"/contentsafety/text:analyze", "/contentsafety/image:analyze"}, paths)
+			assert.Equal(t, []string{expected, expected}, versions)
+		})
+	}
+}
+
+func TestNewValidatesEndpoint(t *testing.T) {
+	for endpoint, expected := range map[string]string{
+		"":                                    "endpoint URL is required",
+		"example.cognitiveservices.azure.com": "must start with https://",
+		"ftp://example.cognitiveservices.azure.com":                              "must use https",
+		"https://example.cognitiveservices.azure.com/contentsafety/text:analyze": "must only contain the scheme and host, such as https://example.cognitiveservices.azure.com",
+		"https://example.cognitiveservices.azure.com/?api-version=2024-09-01":    "must only contain the scheme and host",
+	} {
+		_, err := New(&moderation.Config{Endpoint: endpoint, APIKey: "key"})
+		require.Error(t, err, endpoint)
+		assert.Contains(t, err.Error(), expected, endpoint)
+	}
+
+	for _, endpoint := range []string{"https://eastus.api.cognitive.microsoft.com", " https://example.cognitiveservices.azure.com/ "} {
+		mod, err := New(&moderation.Config{Endpoint: endpoint, APIKey: "key"})
+		require.NoError(t, err, endpoint)
+		assert.Equal(t, strings.TrimSuffix(strings.TrimSpace(endpoint), "/"), mod.endpoint)
+	}
+
+	for _, apiVersion := range []string{"latest", "2024-09", "v2024-09-01"} {
+		_, err := New(&moderation.Config{Endpoint: "https://example.cognitiveservices.azure.com", APIKey: "key", APIVersion: apiVersion})
+		assert.ErrorContains(t, err, "invalid API version", apiVersion)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Run("Provider responds", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "key", r.Header.Get("Ocp-Apim-Subscription-Key"))
+
+			var req TextAnalyzeRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, healthCheckText, req.Text)
+			_, _ = w.Write([]byte(`{"categoriesAnalysis":[{"category":"Hate","severity":0}]}`))
+		}))
+		defer server.Close()
+
+		mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+		require.NoError(t, err)
+		assert.NoError(t, mod.HealthCheck(context.Background()))
+	})
+
+	t.Run("Invalid API key", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":"401","message":"Access denied due to invalid subscription key."}}`))
+		}))
+		defer server.Close()
+
+		mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+		require.NoError(t, err)
+
+		err = mod.HealthCheck(context.Background())
+		assert.ErrorContains(t, err, "Azure AI Content Safety health check failed")
+		kind, ok := moderation.KindOf(err)
+		require.True(t, ok)
+		assert.Equal(t, moderation.ErrorAuth, kind)
+	})
+}
+
+func TestModerateTextRetries(t *testing.T) {
+	respond := func(w http.ResponseWriter) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"categoriesAnalysis": []map[string]any{
+				{"category": CategoryHate, "severity": 2},
+			},
+		})
+	}
+
+	newModerator := func(t *testing.T, url string, maxRetries int) *Moderator {
+		mod, err := New(&moderation.Config{Endpoint: url, APIKey: "key", MaxRetries: maxRetries})
+		require.NoError(t, err)
+		mod.retryBackoff = time.Millisecond
+		return mod
+	}
+
+	t.Run("Throttled request eventually succeeds", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// The request body must be sent again on every attempt
+			var req TextAnalyzeRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			assert.Equal(t, "text", req.Text)
+
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			respond(w)
+		}))
+		defer server.Close()
+
+		result, err := newModerator(t, server.URL, 0).ModerateText(context.Background(), "text")
+		require.NoError(t, err)
+		assert.Equal(t, moderation.Result{moderation.CategoryHate: 2}, result)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("Server errors are retried up to the limit", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer server.Close()
+
+		_, err := newModerator(t, server.URL, 2).ModerateText(context.Background(), "text")
+		assert.Error(t, err)
+		assert.Equal(t, int32(3), calls.Load())
+		kind, _ := moderation.KindOf(err)
+		assert.Equal(t, moderation.ErrorTransport, kind)
+	})
+
+	t.Run("Client errors are not retried", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusUnauthorized)
+		}))
+		defer server.Close()
+
+		_, err := newModerator(t, server.URL, 0).ModerateText(context.Background(), "text")
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+		kind, _ := moderation.KindOf(err)
+		assert.Equal(t, moderation.ErrorAuth, kind)
+	})
+
+	t.Run("Negative retries disable retrying", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		_, err := newModerator(t, server.URL, -1).ModerateText(context.Background(), "text")
+		assert.Error(t, err)
+		assert.Equal(t, int32(1), calls.Load())
+		kind, _ := moderation.KindOf(err)
+		assert.Equal(t, moderation.ErrorRateLimit, kind)
+	})
+
+	t.Run("Retry-After past the deadline gives up immediately", func(t *testing.T) {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		start := time.Now()
+		_, err := newModerator(t, server.URL, 0).ModerateText(ctx, "text")
+		assert.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+}
+
+func TestModerateTextCanceled(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key", MaxRetries: 3})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// The request in flight is aborted and not retried
+	start := time.Now()
+	_, err = mod.ModerateText(ctx, "text")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-5", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, 10*time.Second, parseRetryAfter(now.Add(10*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	assert.Equal(t, maxRetryAfter, parseRetryAfter("86400", now))
+	assert.Equal(t, maxRetryAfter, parseRetryAfter(now.Add(24*time.Hour).Format(http.TimeFormat), now))
+}
+
+func TestRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RateLimitLimitHeader, "1000")
+		w.Header().Set(RateLimitRemainingHeader, "0")
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key", MaxRetries: -1})
+	require.NoError(t, err)
+	assert.Equal(t, moderation.UnknownRateLimit(), mod.RateLimit())
+
+	_, err = mod.ModerateText(context.Background(), "text")
+	assert.Error(t, err)
+
+	rateLimit := mod.RateLimit()
+	assert.Equal(t, 1000, rateLimit.Limit)
+	assert.Equal(t, 0, rateLimit.Remaining)
+	assert.WithinDuration(t, time.Now().Add(5*time.Second), rateLimit.ResumeAt, time.Second)
+}
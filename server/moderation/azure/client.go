@@ -0,0 +1,96 @@
+package azure
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+// DefaultConnectTimeout bounds establishing a connection to the API when no
+// connect timeout is configured
+const DefaultConnectTimeout = 30 * time.Second
+
+// newHTTPClient builds the HTTP client for the API and for AAD token requests
+// from the proxy, TLS and connection settings of the configuration. The
+// proxy and CA file are checked here, so that a mistake is reported when the
+// configuration is loaded rather than on every request.
+func newHTTPClient(config *moderation.Config) (*http.Client, error) {
+	connectTimeout := config.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: connectTimeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = connectTimeout
+
+	if proxy := strings.TrimSpace(config.ProxyURL); proxy != "" {
+		proxyURL, err := parseProxyURL(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	caCertFile := strings.TrimSpace(config.CACertFile)
+	if caCertFile != "" || config.InsecureSkipVerify {
+		tlsConfig := &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			// Only set when an admin explicitly turns off verification
+			InsecureSkipVerify: config.InsecureSkipVerify, //nolint:gosec
+		}
+		if caCertFile != "" {
+			pool, err := loadCACertPool(caCertFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// parseProxyURL validates the URL of an HTTP, HTTPS or SOCKS5 proxy
+func parseProxyURL(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid proxy URL %q", proxy)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, errors.Errorf("proxy URL %q must start with http://, https:// or socks5://", proxy)
+	}
+	if proxyURL.Host == "" {
+		return nil, errors.Errorf("proxy URL %q has no host", proxy)
+	}
+	return proxyURL, nil
+}
+
+// loadCACertPool returns the system certificate pool with the certificates of
+// the PEM file added
+func loadCACertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read CA certificate file")
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Errorf("CA certificate file %q contains no PEM certificates", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,102 @@
+package azure
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	transport := func(t *testing.T, config *moderation.Config) *http.Transport {
+		client, err := newHTTPClient(config)
+		require.NoError(t, err)
+		return client.Transport.(*http.Transport)
+	}
+
+	t.Run("Defaults", func(t *testing.T) {
+		tr := transport(t, &moderation.Config{})
+		if tr.TLSClientConfig != nil {
+			assert.False(t, tr.TLSClientConfig.InsecureSkipVerify)
+			assert.Nil(t, tr.TLSClientConfig.RootCAs)
+		}
+		assert.Equal(t, DefaultConnectTimeout, tr.TLSHandshakeTimeout)
+		assert.NotNil(t, tr.Proxy, "the proxy of the environment is used")
+	})
+
+	t.Run("Proxy and connect timeout", func(t *testing.T) {
+		tr := transport(t, &moderation.Config{ProxyURL: " http://proxy.example.com:3128 ", ConnectTimeout: 5 * time.Second})
+		require.NotNil(t, tr.Proxy)
+
+		req := httptest.NewRequest(http.MethodPost, "https://example.cognitiveservices.azure.com/contentsafety/text:analyze", nil)
+		proxyURL, err := tr.Proxy(req)
+		require.NoError(t, err)
+		assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+		assert.Equal(t, 5*time.Second, tr.TLSHandshakeTimeout)
+	})
+
+	t.Run("Skip verify", func(t *testing.T) {
+		tr := transport(t, &moderation.Config{InsecureSkipVerify: true})
+		require.NotNil(t, tr.TLSClientConfig)
+		assert.True(t, tr.TLSClientConfig.InsecureSkipVerify)
+		assert.Nil(t, tr.TLSClientConfig.RootCAs)
+	})
+
+	t.Run("Invalid settings", func(t *testing.T) {
+		for name, config := range map[string]*moderation.Config{
+			"proxy without scheme":   {ProxyURL: "proxy.example.com:3128"},
+			"proxy with ftp scheme":  {ProxyURL: "ftp://proxy.example.com"},
+			"proxy without host":     {ProxyURL: "http://"},
+			"missing CA file":        {CACertFile: filepath.Join(t.TempDir(), "missing.pem")},
+			"CA file without a cert": {CACertFile: writeFile(t, "not a certificate")},
+		} {
+			_, err := newHTTPClient(config)
+			assert.Error(t, err, name)
+
+			config.Endpoint = "https://example.cognitiveservices.azure.com"
+			config.APIKey = "key"
+			_, err = New(config)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestModerateTextWithCACertFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"categoriesAnalysis": []map[string]any{{"category": CategoryHate, "severity": 2}},
+		})
+	}))
+	defer server.Close()
+
+	// The test server's self-signed certificate is only trusted once its CA
+	// file is configured
+	untrusted, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key", MaxRetries: -1})
+	require.NoError(t, err)
+	_, err = untrusted.ModerateText(context.Background(), "text")
+	assert.Error(t, err)
+
+	caFile := writeFile(t, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})))
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key", CACertFile: caFile})
+	require.NoError(t, err)
+	assert.NotNil(t, mod.client.Transport.(*http.Transport).TLSClientConfig.RootCAs)
+
+	result, err := mod.ModerateText(context.Background(), "text")
+	require.NoError(t, err)
+	assert.Equal(t, moderation.Result{moderation.CategoryHate: 2}, result)
+}
+
+func writeFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
@@ -0,0 +1,109 @@
+package azure
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMaxRetries is the number of times a throttled or failed request is
+	// retried when the configuration does not set a value
+	DefaultMaxRetries = 3
+
+	// defaultRetryBackoff is the wait before the first retry, doubling after
+	// every further failure up to maxRetryBackoff
+	defaultRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = 8 * time.Second
+
+	// maxRetryAfter caps the wait requested by a Retry-After header, so that
+	// a single response cannot pause every request for hours
+	maxRetryAfter = time.Minute
+)
+
+// statusError is returned when the API responds with a non-successful status
+type statusError struct {
+	statusCode int
+	body       string
+
+	// retryAfter is the wait requested by the Retry-After header, or zero
+	// when the response did not include one
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return "Azure API returned status " + strconv.Itoa(e.statusCode) + ": " + e.body
+}
+
+// retryable reports whether the request may succeed when sent again
+func (e *statusError) retryable() bool {
+	return e.statusCode == http.StatusTooManyRequests || e.statusCode >= http.StatusInternalServerError
+}
+
+// withRetry calls send until it succeeds, fails with an error that is not
+// retryable, or runs out of retries. Waits between attempts back off
+// exponentially with jitter, honoring Retry-After when the API sends it. No
+// retry is attempted when the wait would pass the context deadline, so the
+// total time spent never exceeds the caller's moderation timeout.
+func (m *Moderator) withRetry(ctx context.Context, send func() error) error {
+	backoff := m.retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := send()
+
+		var statusErr *statusError
+		if err == nil || !errors.As(err, &statusErr) || !statusErr.retryable() || attempt >= m.maxRetries {
+			return err
+		}
+
+		wait := statusErr.retryAfter
+		if wait == 0 {
+			wait = jitter(backoff)
+			backoff = min(2*backoff, maxRetryBackoff)
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// jitter returns a random duration between half of and the full backoff, so
+// that concurrent requests throttled together do not retry in lockstep
+func jitter(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return 0
+	}
+	half := backoff / 2
+	return half + rand.N(backoff-half+1)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as
+// an HTTP date, returning zero when it is missing or invalid. Waits longer
+// than maxRetryAfter are capped.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return min(max(time.Duration(seconds)*time.Second, 0), maxRetryAfter)
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return min(max(date.Sub(now), 0), maxRetryAfter)
+	}
+
+	return 0
+}
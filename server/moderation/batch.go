@@ -0,0 +1,61 @@
+package moderation
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// BatchModerator is implemented by moderators that can check several texts
+// in a single request
+type BatchModerator interface {
+	// ModerateTexts checks each text, returning their results in the same
+	// order as the texts
+	ModerateTexts(ctx context.Context, texts []string) ([]Result, error)
+
+	// MaxBatchSize returns the maximum number of texts per request, or 0 when
+	// texts are sent to the provider one at a time
+	MaxBatchSize() int
+}
+
+// ModerateTexts moderates the texts in as few requests as the moderator
+// allows, returning their results in the same order as the texts. Moderators
+// that cannot moderate several texts per request are sent one text at a time.
+func ModerateTexts(ctx context.Context, moderator Moderator, texts []string) ([]Result, error) {
+	batchSize := MaxBatchSize(moderator)
+	if batchSize <= 0 {
+		results := make([]Result, 0, len(texts))
+		for _, text := range texts {
+			result, err := moderator.ModerateText(ctx, text)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+		return results, nil
+	}
+
+	batcher := moderator.(BatchModerator)
+	results := make([]Result, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		batch := texts[start:min(start+batchSize, len(texts))]
+		batchResults, err := batcher.ModerateTexts(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		if len(batchResults) != len(batch) {
+			return nil, errors.Errorf("moderator returned %d results for %d texts", len(batchResults), len(batch))
+		}
+		results = append(results, batchResults...)
+	}
+	return results, nil
+}
+
+// MaxBatchSize returns the maximum number of texts the moderator checks per
+// request, or 0 when it sends texts to the provider one at a time
+func MaxBatchSize(moderator Moderator) int {
+	if batcher, ok := moderator.(BatchModerator); ok {
+		return batcher.MaxBatchSize()
+	}
+	return 0
+}
@@ -0,0 +1,124 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lengthModerator reports a Hate severity equal to the length of the text,
+// capped at MaxSeverity
+type lengthModerator struct {
+	textCalls int
+}
+
+func (m *lengthModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	m.textCalls++
+	return Result{"hate": min(len(text), MaxSeverity)}, nil
+}
+
+func (m *lengthModerator) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// batchLengthModerator moderates texts like lengthModerator, several at a
+// time, and records the batches it received
+type batchLengthModerator struct {
+	lengthModerator
+	batchSize int
+	batches   [][]string
+	err       error
+}
+
+func (m *batchLengthModerator) ModerateTexts(ctx context.Context, texts []string) ([]Result, error) {
+	m.batches = append(m.batches, texts)
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	results := make([]Result, 0, len(texts))
+	for _, text := range texts {
+		results = append(results, Result{"hate": min(len(text), MaxSeverity)})
+	}
+	return results, nil
+}
+
+func (m *batchLengthModerator) MaxBatchSize() int {
+	return m.batchSize
+}
+
+func TestModerateTexts(t *testing.T) {
+	texts := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+
+	t.Run("Batches match moderating each text", func(t *testing.T) {
+		looped := &lengthModerator{}
+		expected, err := ModerateTexts(context.Background(), looped, texts)
+		require.NoError(t, err)
+		assert.Equal(t, len(texts), looped.textCalls)
+
+		batched := &batchLengthModerator{batchSize: 2}
+		results, err := ModerateTexts(context.Background(), batched, texts)
+		require.NoError(t, err)
+		assert.Equal(t, expected, results)
+		assert.Equal(t, [][]string{{"a", "bb"}, {"ccc", "dddd"}, {"eeeee"}}, batched.batches)
+		assert.Zero(t, batched.textCalls)
+	})
+
+	t.Run("Moderators without a batch size moderate each text", func(t *testing.T) {
+		moderator := &batchLengthModerator{}
+		results, err := ModerateTexts(context.Background(), moderator, texts)
+		require.NoError(t, err)
+		assert.Len(t, results, len(texts))
+		assert.Empty(t, moderator.batches)
+		assert.Equal(t, len(texts), moderator.textCalls)
+	})
+
+	t.Run("Errors are returned", func(t *testing.T) {
+		moderator := &batchLengthModerator{batchSize: 2, err: errors.New("unavailable")}
+		_, err := ModerateTexts(context.Background(), moderator, texts)
+		assert.EqualError(t, err, "unavailable")
+		assert.Len(t, moderator.batches, 1)
+	})
+
+	t.Run("Wrappers keep batches", func(t *testing.T) {
+		allowlist, err := NewAllowlist([]string{"safe"})
+		require.NoError(t, err)
+
+		inner := &batchLengthModerator{batchSize: 10}
+		var moderator Moderator = inner
+		moderator = WithTimeout(moderator, time.Second)
+		moderator = WithAllowlist(moderator, allowlist)
+		moderator = Breaker(moderator, 3, time.Minute)
+		moderator = Cached(moderator, 10, time.Minute)
+		assert.Equal(t, 10, MaxBatchSize(moderator))
+
+		results, err := ModerateTexts(context.Background(), moderator, []string{"a", "safe", "bb safe"})
+		require.NoError(t, err)
+		assert.Equal(t, []Result{{"hate": 1}, {}, {"hate": 2}}, results)
+		assert.Equal(t, [][]string{{"a", "bb"}}, inner.batches)
+
+		// Cached texts are not sent again
+		results, err = ModerateTexts(context.Background(), moderator, []string{"bb safe", "ccc"})
+		require.NoError(t, err)
+		assert.Equal(t, []Result{{"hate": 2}, {"hate": 3}}, results)
+		assert.Equal(t, [][]string{{"a", "bb"}, {"ccc"}}, inner.batches)
+		assert.Zero(t, inner.textCalls)
+	})
+
+	t.Run("Chains moderate each text", func(t *testing.T) {
+		inner := &batchLengthModerator{batchSize: 10}
+		chain, err := NewChain([]Moderator{inner, &lengthModerator{}}, false)
+		require.NoError(t, err)
+		assert.Zero(t, MaxBatchSize(chain))
+
+		results, err := ModerateTexts(context.Background(), chain, []string{"a", strings.Repeat("b", 8)})
+		require.NoError(t, err)
+		assert.Equal(t, []Result{{"hate": 1}, {"hate": 6}}, results)
+		assert.Equal(t, 2, inner.textCalls)
+	})
+}
@@ -0,0 +1,232 @@
+package blocklist
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+// CategoryBlocklist is the category reported when a blocked term matches
+const CategoryBlocklist = "blocklist"
+
+const (
+	// AggregationMax reports the highest severity of the matched terms
+	AggregationMax = "max"
+
+	// AggregationSum adds up the severity of every match, capped at the
+	// maximum severity
+	AggregationSum = "sum"
+)
+
+// wordBoundary matches any character that cannot be part of a word. It is used
+// instead of \b so that terms starting or ending with punctuation still match.
+const wordBoundary = `[^\p{L}\p{N}_]`
+
+var wordBoundaryPattern = regexp.MustCompile("^" + wordBoundary + "$")
+
+// Ensure Moderator implements the moderation.Moderator interface
+var _ moderation.Moderator = (*Moderator)(nil)
+
+// Term is a banned word or phrase and the severity reported when it matches
+type Term struct {
+	Text     string
+	Severity int
+}
+
+// Config defines the configuration for the blocklist moderator
+type Config struct {
+	// Terms is the list of banned words or phrases
+	Terms []Term
+
+	// WholeWord only matches terms that are not part of a longer word
+	WholeWord bool
+
+	// CaseSensitive matches terms with the exact case they were configured with
+	CaseSensitive bool
+
+	// Aggregation combines the severities of the matches, defaulting to
+	// AggregationMax
+	Aggregation string
+
+	// EscalationCount, when positive, reports the maximum severity once the
+	// text contains at least this many matches, so that many low-severity
+	// terms together are flagged
+	EscalationCount int
+}
+
+// severityPattern matches any of the terms configured with one severity
+type severityPattern struct {
+	severity int
+	pattern  *regexp.Regexp
+}
+
+// Moderator flags text containing any configured term without calling an
+// external service
+type Moderator struct {
+	// patterns match the configured terms, one per severity from the highest
+	patterns []severityPattern
+
+	wholeWord       bool
+	aggregation     string
+	escalationCount int
+}
+
+// ParseTerms parses blocklist entries written as "term" or "term=severity".
+// Terms without a severity are reported at the maximum severity. Only a
+// trailing "=" followed by a number is read as a severity, so terms may
+// contain "=" themselves.
+func ParseTerms(entries []string) ([]Term, error) {
+	terms := make([]Term, 0, len(entries))
+	for _, entry := range entries {
+		term := Term{Text: strings.TrimSpace(entry), Severity: moderation.MaxSeverity}
+		if i := strings.LastIndex(entry, "="); i >= 0 {
+			if severity, err := strconv.Atoi(strings.TrimSpace(entry[i+1:])); err == nil {
+				term = Term{Text: strings.TrimSpace(entry[:i]), Severity: severity}
+			}
+		}
+		if term.Severity < 1 || term.Severity > moderation.MaxSeverity {
+			return nil, errors.Errorf("blocklist term '%s' has severity %d outside the range 1-%d", term.Text, term.Severity, moderation.MaxSeverity)
+		}
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// New creates a new blocklist moderator
+func New(config *Config) (*Moderator, error) {
+	aggregation := config.Aggregation
+	switch aggregation {
+	case "":
+		aggregation = AggregationMax
+	case AggregationMax, AggregationSum:
+	default:
+		return nil, errors.Errorf("unknown blocklist aggregation '%s'", aggregation)
+	}
+
+	alternatives := make(map[int][]string)
+	for _, term := range config.Terms {
+		words := strings.Fields(term.Text)
+		if len(words) == 0 {
+			continue
+		}
+		if term.Severity < 1 || term.Severity > moderation.MaxSeverity {
+			return nil, errors.Errorf("blocklist term '%s' has severity %d outside the range 1-%d", term.Text, term.Severity, moderation.MaxSeverity)
+		}
+		for i, word := range words {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		// Phrases match regardless of the amount of whitespace between words
+		alternatives[term.Severity] = append(alternatives[term.Severity], strings.Join(words, `\s+`))
+	}
+
+	if len(alternatives) == 0 {
+		return nil, errors.New("at least one blocklist term is required")
+	}
+
+	severities := make([]int, 0, len(alternatives))
+	for severity := range alternatives {
+		severities = append(severities, severity)
+	}
+	slices.Sort(severities)
+	slices.Reverse(severities)
+
+	patterns := make([]severityPattern, 0, len(severities))
+	for _, severity := range severities {
+		// The term is captured so that whole-word matches can be counted
+		// without the boundaries around them
+		expr := "(" + strings.Join(alternatives[severity], "|") + ")"
+		if config.WholeWord {
+			expr = "(?:^|" + wordBoundary + ")" + expr + "(?:" + wordBoundary + "|$)"
+		}
+		if !config.CaseSensitive {
+			expr = "(?i)" + expr
+		}
+
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile blocklist terms")
+		}
+		patterns = append(patterns, severityPattern{severity: severity, pattern: pattern})
+	}
+
+	return &Moderator{
+		patterns:        patterns,
+		wholeWord:       config.WholeWord,
+		aggregation:     aggregation,
+		escalationCount: config.EscalationCount,
+	}, nil
+}
+
+// HealthCheck always succeeds since the blocklist has no external dependencies
+func (m *Moderator) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// ModerateText reports the severity of the blocked terms in the text,
+// combined according to the aggregation and escalated when the text contains
+// many matches
+func (m *Moderator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	severity, matches := 0, 0
+	for _, p := range m.patterns {
+		// Counting is only needed when more than the highest match matters
+		if m.aggregation == AggregationMax && m.escalationCount <= 0 {
+			if p.pattern.MatchString(text) {
+				severity = p.severity
+				break
+			}
+			continue
+		}
+
+		count := m.countMatches(p.pattern, text)
+		matches += count
+		switch m.aggregation {
+		case AggregationSum:
+			severity += count * p.severity
+		default:
+			if count > 0 {
+				severity = max(severity, p.severity)
+			}
+		}
+	}
+
+	if m.escalationCount > 0 && matches >= m.escalationCount {
+		severity = moderation.MaxSeverity
+	}
+	return moderation.Result{CategoryBlocklist: min(severity, moderation.MaxSeverity)}, nil
+}
+
+// countMatches counts the terms the pattern matches in the text. Each search
+// resumes right after the previous term rather than after its trailing
+// boundary, so that whole-word terms separated by a single character are
+// all counted.
+func (m *Moderator) countMatches(pattern *regexp.Regexp, text string) int {
+	count := 0
+	for offset := 0; offset < len(text); {
+		loc := pattern.FindStringSubmatchIndex(text[offset:])
+		if loc == nil {
+			break
+		}
+		start, end := offset+loc[2], offset+loc[3]
+
+		// The start of the remaining text is not the start of the text, so a
+		// term there needs a boundary before it
+		if m.wholeWord && start == offset && offset > 0 {
+			previous, _ := utf8.DecodeLastRuneInString(text[:offset])
+			if !wordBoundaryPattern.MatchString(string(previous)) {
+				_, size := utf8.DecodeRuneInString(text[start:])
+				offset = start + size
+				continue
+			}
+		}
+
+		count++
+		offset = end
+	}
+	return count
+}
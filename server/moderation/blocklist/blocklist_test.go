@@ -0,0 +1,184 @@
+package blocklist
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// terms returns the terms at the maximum severity
+func terms(texts ...string) []Term {
+	result := make([]Term, 0, len(texts))
+	for _, text := range texts {
+		result = append(result, Term{Text: text, Severity: moderation.MaxSeverity})
+	}
+	return result
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(&Config{Terms: terms("", "  ")})
+	assert.Error(t, err)
+
+	_, err = New(&Config{Terms: []Term{{Text: "badword", Severity: 7}}})
+	assert.Error(t, err)
+
+	_, err = New(&Config{Terms: terms("badword"), Aggregation: "average"})
+	assert.Error(t, err)
+}
+
+func TestParseTerms(t *testing.T) {
+	parsed, err := ParseTerms([]string{"badword", "meh = 2", "a=b", "x=y=4"})
+	require.NoError(t, err)
+	assert.Equal(t, []Term{
+		{Text: "badword", Severity: moderation.MaxSeverity},
+		{Text: "meh", Severity: 2},
+		{Text: "a=b", Severity: moderation.MaxSeverity},
+		{Text: "x=y", Severity: 4},
+	}, parsed)
+
+	_, err = ParseTerms([]string{"badword=0"})
+	assert.Error(t, err)
+	_, err = ParseTerms([]string{"badword=9"})
+	assert.Error(t, err)
+}
+
+func TestModerateText(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		text     string
+		expected int
+	}{
+		{
+			name:     "No match",
+			config:   Config{Terms: terms("badword")},
+			text:     "a perfectly fine message",
+			expected: 0,
+		},
+		{
+			name:     "Case-insensitive match",
+			config:   Config{Terms: terms("badword")},
+			text:     "this has a BadWord in it",
+			expected: moderation.MaxSeverity,
+		},
+		{
+			name:     "Case-sensitive miss",
+			config:   Config{Terms: terms("badword"), CaseSensitive: true},
+			text:     "this has a BadWord in it",
+			expected: 0,
+		},
+		{
+			name:     "Substring match without whole-word",
+			config:   Config{Terms: terms("cunt")},
+			text:     "I live in Scunthorpe",
+			expected: moderation.MaxSeverity,
+		},
+		{
+			name:     "Substring ignored with whole-word",
+			config:   Config{Terms: terms("cunt"), WholeWord: true},
+			text:     "I live in Scunthorpe",
+			expected: 0,
+		},
+		{
+			name:     "Whole-word match next to punctuation",
+			config:   Config{Terms: terms("badword"), WholeWord: true},
+			text:     "what a badword!",
+			expected: moderation.MaxSeverity,
+		},
+		{
+			name:     "Phrase match across whitespace",
+			config:   Config{Terms: terms("very bad phrase"), WholeWord: true},
+			text:     "that was a Very  bad\nphrase indeed",
+			expected: moderation.MaxSeverity,
+		},
+		{
+			name:     "Regex characters are literal",
+			config:   Config{Terms: terms("a.b")},
+			text:     "axb",
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mod, err := New(&tt.config)
+			require.NoError(t, err)
+
+			result, err := mod.ModerateText(context.Background(), tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, moderation.Result{CategoryBlocklist: tt.expected}, result)
+		})
+	}
+}
+
+func TestModerateTextSeverities(t *testing.T) {
+	severityTerms := []Term{
+		{Text: "slur", Severity: moderation.MaxSeverity},
+		{Text: "darn", Severity: 1},
+		{Text: "heck", Severity: 2},
+	}
+
+	tests := []struct {
+		name     string
+		config   Config
+		text     string
+		expected int
+	}{
+		{
+			name:     "Single high-severity term",
+			config:   Config{Terms: severityTerms, WholeWord: true},
+			text:     "what a slur",
+			expected: moderation.MaxSeverity,
+		},
+		{
+			name:     "Highest severity of the matched terms",
+			config:   Config{Terms: severityTerms, WholeWord: true},
+			text:     "darn, heck, darn and darn",
+			expected: 2,
+		},
+		{
+			name:     "Sum of many low-severity matches",
+			config:   Config{Terms: severityTerms, WholeWord: true, Aggregation: AggregationSum},
+			text:     "darn, heck, darn and darn",
+			expected: 5,
+		},
+		{
+			name:     "Sum is capped at the maximum severity",
+			config:   Config{Terms: severityTerms, WholeWord: true, Aggregation: AggregationSum},
+			text:     "slur heck",
+			expected: moderation.MaxSeverity,
+		},
+		{
+			name:     "Many low-severity matches escalate",
+			config:   Config{Terms: severityTerms, WholeWord: true, EscalationCount: 4},
+			text:     "darn darn darn heck",
+			expected: moderation.MaxSeverity,
+		},
+		{
+			name:     "Fewer matches than the escalation count",
+			config:   Config{Terms: severityTerms, WholeWord: true, EscalationCount: 4},
+			text:     "darn darn heck darnit",
+			expected: 2,
+		},
+		{
+			name:     "Substring matches count without whole-word",
+			config:   Config{Terms: severityTerms, Aggregation: AggregationSum},
+			text:     "darndarn",
+			expected: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mod, err := New(&tt.config)
+			require.NoError(t, err)
+
+			result, err := mod.ModerateText(context.Background(), tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, moderation.Result{CategoryBlocklist: tt.expected}, result)
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package moderation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned instead of calling a provider that has failed
+// repeatedly, until the circuit breaker lets a request through again
+var ErrCircuitOpen = errors.New("moderation provider circuit breaker is open")
+
+// Ensure BreakerModerator implements the Moderator, TextLengthLimiter,
+// RateLimitReporter, CircuitReporter and BatchModerator interfaces
+var (
+	_ Moderator         = (*BreakerModerator)(nil)
+	_ TextLengthLimiter = (*BreakerModerator)(nil)
+	_ RateLimitReporter = (*BreakerModerator)(nil)
+	_ CircuitReporter   = (*BreakerModerator)(nil)
+	_ BatchModerator    = (*BreakerModerator)(nil)
+	_ ImageModerator    = (*breakerImageModerator)(nil)
+)
+
+// CircuitReporter is implemented by moderators that stop calling a failing
+// provider, so that callers can skip retries while the circuit is open
+type CircuitReporter interface {
+	// CircuitOpen reports whether requests are currently rejected without
+	// reaching the provider
+	CircuitOpen() bool
+}
+
+// circuitState is the state of a circuit breaker
+type circuitState int
+
+const (
+	// circuitClosed passes every request to the provider
+	circuitClosed circuitState = iota
+
+	// circuitOpen rejects every request until the cooldown has passed
+	circuitOpen
+
+	// circuitHalfOpen lets a single trial request through to test whether the
+	// provider has recovered
+	circuitHalfOpen
+)
+
+// BreakerModerator stops sending requests to another moderator once it fails
+// a number of times in a row, so that an unavailable provider does not hold
+// up every post until its requests time out. After a cooldown, one trial
+// request is let through: the circuit closes again when it succeeds and stays
+// open for another cooldown when it fails.
+type BreakerModerator struct {
+	inner            Moderator
+	failureThreshold int
+	cooldown         time.Duration
+
+	// now returns the current time and is replaced in tests
+	now func() time.Time
+
+	mu       sync.Mutex
+	state    circuitState
+	failures int
+	openedAt time.Time
+}
+
+// breakerImageModerator is returned for moderators that also moderate images.
+// Text and image requests share the circuit.
+type breakerImageModerator struct {
+	*BreakerModerator
+	imageModerator ImageModerator
+}
+
+// Breaker wraps the moderator with a circuit breaker that opens after
+// failureThreshold consecutive failures and lets a trial request through
+// after each cooldown. The returned moderator implements ImageModerator when
+// inner does.
+func Breaker(inner Moderator, failureThreshold int, cooldown time.Duration) Moderator {
+	breaker := &BreakerModerator{
+		inner:            inner,
+		failureThreshold: failureThreshold,
+		cooldown:         cooldown,
+		now:              time.Now,
+	}
+	if imageModerator, ok := inner.(ImageModerator); ok {
+		return &breakerImageModerator{BreakerModerator: breaker, imageModerator: imageModerator}
+	}
+	return breaker
+}
+
+// ModerateText moderates the text with the wrapped moderator, or returns
+// ErrCircuitOpen without calling it while the circuit is open
+func (b *BreakerModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	if !b.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	result, err := b.inner.ModerateText(ctx, text)
+	b.record(err)
+	return result, err
+}
+
+// ModerateTexts moderates the texts with the wrapped moderator, or returns
+// ErrCircuitOpen without calling it while the circuit is open. The texts
+// count as a single request towards the circuit.
+func (b *BreakerModerator) ModerateTexts(ctx context.Context, texts []string) ([]Result, error) {
+	if !b.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	results, err := ModerateTexts(ctx, b.inner, texts)
+	b.record(err)
+	return results, err
+}
+
+// HealthCheck checks the wrapped moderator regardless of the circuit. A
+// passing health check closes the circuit, so that posts are moderated as
+// soon as the provider is known to have recovered.
+func (b *BreakerModerator) HealthCheck(ctx context.Context) error {
+	err := b.inner.HealthCheck(ctx)
+	if err == nil {
+		b.record(nil)
+	}
+	return err
+}
+
+// CircuitOpen reports whether requests are rejected without reaching the
+// wrapped moderator. A half-open circuit counts as open, since only its
+// trial request is let through.
+func (b *BreakerModerator) CircuitOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != circuitClosed
+}
+
+// allow reports whether a request may be sent to the wrapped moderator,
+// moving an open circuit to half-open once the cooldown has passed
+func (b *BreakerModerator) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = circuitHalfOpen
+		return true
+	case circuitHalfOpen:
+		// The trial request is still in flight
+		return false
+	default:
+		return true
+	}
+}
+
+// record updates the circuit with the outcome of a request
+func (b *BreakerModerator) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		b.state = circuitClosed
+		b.failures = 0
+		return
+	}
+
+	// A provider throttling requests is still up, so throttling does not count
+	// towards opening the circuit. A throttled trial request keeps a half-open
+	// circuit open for another cooldown.
+	if kind, _ := KindOf(err); kind == ErrorRateLimit && b.state != circuitHalfOpen {
+		return
+	}
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.failureThreshold {
+		b.state = circuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// MaxTextLength returns the text length limit of the wrapped moderator, or 0
+// when it has none
+func (b *BreakerModerator) MaxTextLength() int {
+	if limiter, ok := b.inner.(TextLengthLimiter); ok {
+		return limiter.MaxTextLength()
+	}
+	return 0
+}
+
+// RateLimit returns the rate limit of the wrapped moderator, or an unknown
+// rate limit when it does not report one
+func (b *BreakerModerator) RateLimit() RateLimit {
+	if reporter, ok := b.inner.(RateLimitReporter); ok {
+		return reporter.RateLimit()
+	}
+	return UnknownRateLimit()
+}
+
+// MaxBatchSize returns the batch size of the wrapped moderator, or 0 when it
+// does not moderate texts in batches
+func (b *BreakerModerator) MaxBatchSize() int {
+	return MaxBatchSize(b.inner)
+}
+
+// ModerateImage moderates the image with the wrapped moderator, or returns
+// ErrCircuitOpen without calling it while the circuit is open
+func (b *breakerImageModerator) ModerateImage(ctx context.Context, data []byte) (Result, error) {
+	if !b.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	result, err := b.imageModerator.ModerateImage(ctx, data)
+	b.record(err)
+	return result, err
+}
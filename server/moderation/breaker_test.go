@@ -0,0 +1,200 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flappingModerator fails while failing is set, like a provider going up and
+// down, and counts the requests that reach it. Requests are rejected as rate
+// limited while throttled is set.
+type flappingModerator struct {
+	failing   bool
+	throttled bool
+	calls     int
+}
+
+func (m *flappingModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	m.calls++
+	if m.throttled {
+		return nil, NewError(ErrorRateLimit, errors.New("too many requests"))
+	}
+	if m.failing {
+		return nil, errors.New("service unavailable")
+	}
+	return Result{"hate": 0}, nil
+}
+
+func (m *flappingModerator) HealthCheck(ctx context.Context) error {
+	if m.failing {
+		return errors.New("service unavailable")
+	}
+	return nil
+}
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+
+	newBreaker := func(inner Moderator) (*BreakerModerator, *time.Time) {
+		now := time.Now()
+		breaker := Breaker(inner, 3, time.Minute).(*BreakerModerator)
+		breaker.now = func() time.Time { return now }
+		return breaker, &now
+	}
+
+	t.Run("Opens after consecutive failures", func(t *testing.T) {
+		inner := &flappingModerator{failing: true}
+		breaker, _ := newBreaker(inner)
+
+		for range 3 {
+			assert.False(t, breaker.CircuitOpen())
+			_, err := breaker.ModerateText(ctx, "text")
+			assert.EqualError(t, err, "service unavailable")
+		}
+		assert.True(t, breaker.CircuitOpen())
+
+		_, err := breaker.ModerateText(ctx, "text")
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.Equal(t, 3, inner.calls, "requests are not sent while the circuit is open")
+	})
+
+	t.Run("Success resets the failure count", func(t *testing.T) {
+		inner := &flappingModerator{}
+		breaker, _ := newBreaker(inner)
+
+		for _, failing := range []bool{true, true, false, true, true} {
+			inner.failing = failing
+			_, _ = breaker.ModerateText(ctx, "text")
+		}
+		assert.False(t, breaker.CircuitOpen())
+	})
+
+	t.Run("Half-open trial closes the circuit on success", func(t *testing.T) {
+		inner := &flappingModerator{failing: true}
+		breaker, now := newBreaker(inner)
+		for range 3 {
+			_, _ = breaker.ModerateText(ctx, "text")
+		}
+
+		*now = now.Add(time.Minute)
+		inner.failing = false
+		result, err := breaker.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"hate": 0}, result)
+		assert.False(t, breaker.CircuitOpen())
+		assert.Equal(t, 4, inner.calls)
+	})
+
+	t.Run("Half-open trial reopens the circuit on failure", func(t *testing.T) {
+		inner := &flappingModerator{failing: true}
+		breaker, now := newBreaker(inner)
+		for range 3 {
+			_, _ = breaker.ModerateText(ctx, "text")
+		}
+
+		// A single failed trial opens the circuit for another cooldown
+		*now = now.Add(time.Minute)
+		_, err := breaker.ModerateText(ctx, "text")
+		assert.EqualError(t, err, "service unavailable")
+		assert.True(t, breaker.CircuitOpen())
+
+		*now = now.Add(time.Minute / 2)
+		_, err = breaker.ModerateText(ctx, "text")
+		assert.ErrorIs(t, err, ErrCircuitOpen)
+		assert.Equal(t, 4, inner.calls)
+	})
+
+	t.Run("Throttling does not open the circuit", func(t *testing.T) {
+		inner := &flappingModerator{throttled: true}
+		breaker, _ := newBreaker(inner)
+
+		for range 5 {
+			_, err := breaker.ModerateText(ctx, "text")
+			assert.EqualError(t, err, "too many requests")
+		}
+		assert.False(t, breaker.CircuitOpen())
+		assert.Equal(t, 5, inner.calls)
+	})
+
+	t.Run("Throttled trial reopens the circuit", func(t *testing.T) {
+		inner := &flappingModerator{failing: true}
+		breaker, now := newBreaker(inner)
+		for range 3 {
+			_, _ = breaker.ModerateText(ctx, "text")
+		}
+
+		*now = now.Add(time.Minute)
+		inner.throttled = true
+		_, _ = breaker.ModerateText(ctx, "text")
+		assert.True(t, breaker.CircuitOpen())
+		assert.False(t, breaker.allow(), "the circuit waits for another cooldown")
+	})
+
+	t.Run("Only one trial request is let through", func(t *testing.T) {
+		breaker, now := newBreaker(&flappingModerator{failing: true})
+		for range 3 {
+			_, _ = breaker.ModerateText(ctx, "text")
+		}
+
+		*now = now.Add(time.Minute)
+		require.True(t, breaker.allow())
+		assert.False(t, breaker.allow())
+	})
+
+	t.Run("Passing health check closes the circuit", func(t *testing.T) {
+		inner := &flappingModerator{failing: true}
+		breaker, _ := newBreaker(inner)
+		for range 3 {
+			_, _ = breaker.ModerateText(ctx, "text")
+		}
+
+		assert.Error(t, breaker.HealthCheck(ctx))
+		assert.True(t, breaker.CircuitOpen())
+
+		inner.failing = false
+		require.NoError(t, breaker.HealthCheck(ctx))
+		assert.False(t, breaker.CircuitOpen())
+	})
+
+	t.Run("Image support is preserved", func(t *testing.T) {
+		_, ok := Breaker(&staticModerator{}, 3, time.Minute).(ImageModerator)
+		assert.False(t, ok)
+
+		imageModerator, ok := Breaker(&imageStaticModerator{staticModerator{result: Result{"hate": 4}}}, 3, time.Minute).(ImageModerator)
+		require.True(t, ok)
+
+		result, err := imageModerator.ModerateImage(ctx, []byte("image"))
+		require.NoError(t, err)
+		assert.Equal(t, Result{"hate": 4}, result)
+	})
+
+	t.Run("Cache reports the circuit of the wrapped moderator", func(t *testing.T) {
+		inner := &flappingModerator{failing: true}
+		breaker, _ := newBreaker(inner)
+		cached := Cached(breaker, 10, time.Hour).(CircuitReporter)
+
+		assert.False(t, cached.CircuitOpen())
+		for range 3 {
+			_, _ = breaker.ModerateText(ctx, "text")
+		}
+		assert.True(t, cached.CircuitOpen())
+	})
+	t.Run("Fallback reports the circuit of the primary moderator", func(t *testing.T) {
+		inner := &flappingModerator{failing: true}
+		breaker, _ := newBreaker(inner)
+		moderator := Fallback(Cached(breaker, 10, time.Hour), &staticModerator{result: Result{"blocklist": 0}})
+		reporter, ok := moderator.(CircuitReporter)
+		require.True(t, ok)
+
+		assert.False(t, reporter.CircuitOpen())
+		for range 3 {
+			_, _ = breaker.ModerateText(ctx, "text")
+		}
+		assert.True(t, reporter.CircuitOpen())
+	})
+}
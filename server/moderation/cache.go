@@ -0,0 +1,211 @@
+package moderation
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ensure CachedModerator implements the Moderator, TextLengthLimiter,
+// RateLimitReporter, CircuitReporter and BatchModerator interfaces
+var (
+	_ Moderator         = (*CachedModerator)(nil)
+	_ TextLengthLimiter = (*CachedModerator)(nil)
+	_ RateLimitReporter = (*CachedModerator)(nil)
+	_ CircuitReporter   = (*CachedModerator)(nil)
+	_ BatchModerator    = (*CachedModerator)(nil)
+	_ ImageModerator    = (*cachedImageModerator)(nil)
+)
+
+// CachedModerator caches the text moderation results of another moderator in
+// a size-limited LRU cache, so that repeated messages are only sent to the
+// provider once per TTL. Errors are never cached.
+type CachedModerator struct {
+	inner Moderator
+	size  int
+	ttl   time.Duration
+
+	// now returns the current time and is replaced in tests
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	key     [sha256.Size]byte
+	result  Result
+	expires time.Time
+}
+
+// cachedImageModerator is returned for moderators that also moderate images,
+// which are passed through without caching
+type cachedImageModerator struct {
+	*CachedModerator
+	imageModerator ImageModerator
+}
+
+// Cached wraps the moderator with a cache holding up to size results for the
+// given TTL. The returned moderator implements ImageModerator when inner does.
+func Cached(inner Moderator, size int, ttl time.Duration) Moderator {
+	cache := &CachedModerator{
+		inner:   inner,
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[[sha256.Size]byte]*list.Element),
+		order:   list.New(),
+	}
+
+	if imageModerator, ok := inner.(ImageModerator); ok {
+		return &cachedImageModerator{CachedModerator: cache, imageModerator: imageModerator}
+	}
+	return cache
+}
+
+// ModerateText returns the cached result for the text when there is one, and
+// otherwise moderates the text and caches the result
+func (c *CachedModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	key := cacheKey(text)
+	if result, ok := c.get(key); ok {
+		return result, nil
+	}
+
+	// Cached results are reused for posts held to other thresholds, so a
+	// chain must not stop before every moderator has seen the text
+	result, err := c.inner.ModerateText(StopWhen(ctx, nil), text)
+	if err != nil {
+		return nil, err
+	}
+
+	c.add(key, result)
+	return copyResult(result), nil
+}
+
+// ModerateTexts returns the cached results for the texts that have one, and
+// moderates the others together, caching their results
+func (c *CachedModerator) ModerateTexts(ctx context.Context, texts []string) ([]Result, error) {
+	results := make([]Result, len(texts))
+	keys := make([][sha256.Size]byte, len(texts))
+	missed := make([]string, 0, len(texts))
+	indexes := make([]int, 0, len(texts))
+	for i, text := range texts {
+		keys[i] = cacheKey(text)
+		if result, ok := c.get(keys[i]); ok {
+			results[i] = result
+			continue
+		}
+		missed = append(missed, text)
+		indexes = append(indexes, i)
+	}
+
+	moderated, err := ModerateTexts(StopWhen(ctx, nil), c.inner, missed)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		c.add(keys[i], moderated[j])
+		results[i] = copyResult(moderated[j])
+	}
+	return results, nil
+}
+
+// HealthCheck checks the wrapped moderator
+func (c *CachedModerator) HealthCheck(ctx context.Context) error {
+	return c.inner.HealthCheck(ctx)
+}
+
+// MaxTextLength returns the text length limit of the wrapped moderator, or 0
+// when it has none
+func (c *CachedModerator) MaxTextLength() int {
+	if limiter, ok := c.inner.(TextLengthLimiter); ok {
+		return limiter.MaxTextLength()
+	}
+	return 0
+}
+
+// RateLimit returns the rate limit of the wrapped moderator, or an unknown
+// rate limit when it does not report one
+func (c *CachedModerator) RateLimit() RateLimit {
+	if reporter, ok := c.inner.(RateLimitReporter); ok {
+		return reporter.RateLimit()
+	}
+	return UnknownRateLimit()
+}
+
+// CircuitOpen reports whether the wrapped moderator is rejecting requests
+// because of a circuit breaker. Cached results are still returned meanwhile.
+func (c *CachedModerator) CircuitOpen() bool {
+	if reporter, ok := c.inner.(CircuitReporter); ok {
+		return reporter.CircuitOpen()
+	}
+	return false
+}
+
+// MaxBatchSize returns the batch size of the wrapped moderator, or 0 when it
+// does not moderate texts in batches
+func (c *CachedModerator) MaxBatchSize() int {
+	return MaxBatchSize(c.inner)
+}
+
+// ModerateImage moderates the image with the wrapped moderator
+func (c *cachedImageModerator) ModerateImage(ctx context.Context, data []byte) (Result, error) {
+	return c.imageModerator.ModerateImage(ctx, data)
+}
+
+func (c *CachedModerator) get(key [sha256.Size]byte) (Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if c.now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return copyResult(entry.result), true
+}
+
+func (c *CachedModerator) add(key [sha256.Size]byte, result Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{key: key, result: copyResult(result), expires: c.now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheKey hashes the text with its whitespace normalized, so that messages
+// differing only in spacing share a result
+func cacheKey(text string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join(strings.Fields(text), " ")))
+}
+
+func copyResult(result Result) Result {
+	copied := make(Result, len(result))
+	for category, severity := range result {
+		copied[category] = severity
+	}
+	return copied
+}
@@ -0,0 +1,118 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type imageStaticModerator struct {
+	staticModerator
+}
+
+func (m *imageStaticModerator) ModerateImage(ctx context.Context, data []byte) (Result, error) {
+	return m.result, m.err
+}
+
+func TestCachedModerateText(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Identical inputs call the inner moderator once", func(t *testing.T) {
+		inner := &staticModerator{result: Result{"hate": 2}}
+		cached := Cached(inner, 10, time.Hour)
+
+		first, err := cached.ModerateText(ctx, "buy cheap stuff")
+		require.NoError(t, err)
+		second, err := cached.ModerateText(ctx, "  buy cheap\nstuff ")
+		require.NoError(t, err)
+
+		assert.Equal(t, Result{"hate": 2}, first)
+		assert.Equal(t, Result{"hate": 2}, second)
+		assert.Equal(t, 1, inner.calls)
+	})
+
+	t.Run("Cached results cannot be modified by callers", func(t *testing.T) {
+		inner := &staticModerator{result: Result{"hate": 2}}
+		cached := Cached(inner, 10, time.Hour)
+
+		first, err := cached.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		first["hate"] = 6
+
+		second, err := cached.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"hate": 2}, second)
+	})
+
+	t.Run("Cached chain results are complete", func(t *testing.T) {
+		second := &staticModerator{result: Result{"hate": 6}}
+		chain, err := NewChain([]Moderator{&staticModerator{result: Result{"blocklist": 6}}, second}, false)
+		require.NoError(t, err)
+		cached := Cached(chain, 10, time.Hour)
+
+		stopCtx := StopWhen(ctx, func(result Result) bool { return result["blocklist"] >= 4 })
+		result, err := cached.ModerateText(stopCtx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"blocklist": 6, "hate": 6}, result)
+		assert.Equal(t, 1, second.calls)
+	})
+
+	t.Run("Errors are not cached", func(t *testing.T) {
+		inner := &staticModerator{err: errors.New("unavailable")}
+		cached := Cached(inner, 10, time.Hour)
+
+		_, err := cached.ModerateText(ctx, "text")
+		assert.Error(t, err)
+		_, err = cached.ModerateText(ctx, "text")
+		assert.Error(t, err)
+		assert.Equal(t, 2, inner.calls)
+	})
+
+	t.Run("Entries expire after the TTL", func(t *testing.T) {
+		inner := &staticModerator{result: Result{"hate": 0}}
+		cached := Cached(inner, 10, time.Minute).(*CachedModerator)
+
+		now := time.Now()
+		cached.now = func() time.Time { return now }
+
+		_, err := cached.ModerateText(ctx, "text")
+		require.NoError(t, err)
+
+		now = now.Add(2 * time.Minute)
+		_, err = cached.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, 2, inner.calls)
+	})
+
+	t.Run("Least recently used entry is evicted", func(t *testing.T) {
+		inner := &staticModerator{result: Result{"hate": 0}}
+		cached := Cached(inner, 2, time.Hour)
+
+		for _, text := range []string{"one", "two", "one", "three", "one"} {
+			_, err := cached.ModerateText(ctx, text)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 3, inner.calls)
+
+		// "two" was evicted when "three" was added
+		_, err := cached.ModerateText(ctx, "two")
+		require.NoError(t, err)
+		assert.Equal(t, 4, inner.calls)
+	})
+}
+
+func TestCachedImageSupport(t *testing.T) {
+	_, ok := Cached(&staticModerator{}, 10, time.Hour).(ImageModerator)
+	assert.False(t, ok)
+
+	cached, ok := Cached(&imageStaticModerator{staticModerator{result: Result{"hate": 4}}}, 10, time.Hour).(ImageModerator)
+	require.True(t, ok)
+
+	result, err := cached.ModerateImage(context.Background(), []byte("image"))
+	require.NoError(t, err)
+	assert.Equal(t, Result{"hate": 4}, result)
+}
@@ -0,0 +1,61 @@
+package moderation
+
+import (
+	"strings"
+)
+
+// These constants define the canonical categories that providers backed by a
+// model report, so that thresholds, logs and audit records use the same names
+// regardless of the provider
+const (
+	CategoryHate       = "hate"
+	CategoryHarassment = "harassment"
+	CategorySexual     = "sexual"
+	CategoryViolence   = "violence"
+	CategorySelfHarm   = "self_harm"
+	CategoryOther      = "other"
+)
+
+// CanonicalCategories lists every canonical category
+var CanonicalCategories = []string{
+	CategoryHate,
+	CategoryHarassment,
+	CategorySexual,
+	CategoryViolence,
+	CategorySelfHarm,
+	CategoryOther,
+}
+
+// CategoryMapping maps the categories reported by a provider onto the
+// canonical categories. It is keyed by the provider category in lowercase.
+type CategoryMapping map[string]string
+
+// Lookup returns the canonical category of a provider category regardless of
+// case, or false when the mapping does not know the category
+func (m CategoryMapping) Lookup(category string) (string, bool) {
+	canonical, ok := m[strings.ToLower(strings.TrimSpace(category))]
+	return canonical, ok
+}
+
+// Canonical returns the canonical category of a provider category, or
+// CategoryOther when the mapping does not know the category
+func (m CategoryMapping) Canonical(category string) string {
+	if canonical, ok := m.Lookup(category); ok {
+		return canonical
+	}
+	return CategoryOther
+}
+
+// Normalize returns the result with every category renamed to its canonical
+// category. When several provider categories map to the same canonical
+// category, the highest severity is kept.
+func (m CategoryMapping) Normalize(result Result) Result {
+	normalized := make(Result, len(result))
+	for category, severity := range result {
+		canonical := m.Canonical(category)
+		if existing, ok := normalized[canonical]; !ok || severity > existing {
+			normalized[canonical] = severity
+		}
+	}
+	return normalized
+}
@@ -0,0 +1,31 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCategoryMapping(t *testing.T) {
+	mapping := CategoryMapping{
+		"selfharm": CategorySelfHarm,
+		"insult":   CategoryHarassment,
+		"threat":   CategoryViolence,
+	}
+
+	category, ok := mapping.Lookup(" SelfHarm")
+	assert.True(t, ok)
+	assert.Equal(t, CategorySelfHarm, category)
+	_, ok = mapping.Lookup("spam")
+	assert.False(t, ok)
+
+	assert.Equal(t, CategoryViolence, mapping.Canonical("THREAT"))
+	assert.Equal(t, CategoryOther, mapping.Canonical("spam"))
+
+	assert.Equal(t, Result{
+		CategorySelfHarm:   2,
+		CategoryHarassment: 0,
+		CategoryOther:      5,
+	}, mapping.Normalize(Result{"SelfHarm": 2, "INSULT": 0, "spam": 3, "FLIRTATION": 5}))
+	assert.Empty(t, mapping.Normalize(nil))
+}
@@ -0,0 +1,193 @@
+package moderation
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// Ensure Chain implements the Moderator, TextLengthLimiter and
+// RateLimitReporter interfaces
+var (
+	_ Moderator         = (*Chain)(nil)
+	_ TextLengthLimiter = (*Chain)(nil)
+	_ RateLimitReporter = (*Chain)(nil)
+	_ ImageModerator    = (*chainImageModerator)(nil)
+)
+
+// Chain runs an ordered list of moderators, merging their results and
+// stopping as soon as the merged result is flagged, when the request context
+// carries a condition set by StopWhen
+type Chain struct {
+	// moderators are called in order
+	moderators []Moderator
+
+	// continueOnError skips failing moderators instead of aborting the chain
+	continueOnError bool
+}
+
+// chainImageModerator is returned for chains with at least one moderator
+// that moderates images. Only those moderators are sent images.
+type chainImageModerator struct {
+	*Chain
+}
+
+// stopWhenKey is the context key of the condition on which a chain stops
+// calling its moderators
+type stopWhenKey struct{}
+
+// NewChain creates a new Chain of moderators. The returned moderator
+// implements ImageModerator when any of the moderators does.
+func NewChain(moderators []Moderator, continueOnError bool) (Moderator, error) {
+	if len(moderators) == 0 {
+		return nil, errors.New("at least one moderator is required")
+	}
+
+	chain := &Chain{
+		moderators:      moderators,
+		continueOnError: continueOnError,
+	}
+	for _, moderator := range moderators {
+		if _, ok := moderator.(ImageModerator); ok {
+			return &chainImageModerator{Chain: chain}, nil
+		}
+	}
+	return chain, nil
+}
+
+// StopWhen returns a context under which a chain stops calling its moderators
+// once flagged reports that the merged result is flagged. Further moderators
+// can only raise severities, so the decision stays the same as long as
+// flagged never unflags a result whose severities rose. Without a condition
+// every moderator in the chain is called.
+func StopWhen(ctx context.Context, flagged func(Result) bool) context.Context {
+	return context.WithValue(ctx, stopWhenKey{}, flagged)
+}
+
+// stopCondition returns the condition set by StopWhen, or nil when the
+// context carries none
+func stopCondition(ctx context.Context) func(Result) bool {
+	flagged, _ := ctx.Value(stopWhenKey{}).(func(Result) bool)
+	return flagged
+}
+
+// HealthCheck checks every moderator in the chain and returns the first failure
+func (c *Chain) HealthCheck(ctx context.Context) error {
+	for i, moderator := range c.moderators {
+		if err := moderator.HealthCheck(ctx); err != nil {
+			return errors.Wrapf(err, "moderator %d in chain failed health check", i+1)
+		}
+	}
+	return nil
+}
+
+// MaxTextLength returns the smallest text length limit of the moderators in
+// the chain, or 0 when none of them has a limit
+func (c *Chain) MaxTextLength() int {
+	maxLength := 0
+	for _, moderator := range c.moderators {
+		limiter, ok := moderator.(TextLengthLimiter)
+		if !ok {
+			continue
+		}
+		if limit := limiter.MaxTextLength(); limit > 0 && (maxLength == 0 || limit < maxLength) {
+			maxLength = limit
+		}
+	}
+	return maxLength
+}
+
+// RateLimit combines the rate limits of the moderators in the chain. It
+// reports the quota of the moderator with the fewest remaining requests and
+// the latest time any moderator resumes after throttling, since a throttled
+// moderator holds up the whole chain.
+func (c *Chain) RateLimit() RateLimit {
+	combined := UnknownRateLimit()
+	for _, moderator := range c.moderators {
+		reporter, ok := moderator.(RateLimitReporter)
+		if !ok {
+			continue
+		}
+
+		rateLimit := reporter.RateLimit()
+		if rateLimit.Remaining >= 0 && (combined.Remaining < 0 || rateLimit.Remaining < combined.Remaining) {
+			combined.Limit = rateLimit.Limit
+			combined.Remaining = rateLimit.Remaining
+		}
+		if rateLimit.ResumeAt.After(combined.ResumeAt) {
+			combined.ResumeAt = rateLimit.ResumeAt
+		}
+	}
+	return combined
+}
+
+// ModerateText calls each moderator in sequence and returns the maximum
+// severity seen for each category
+func (c *Chain) ModerateText(ctx context.Context, text string) (Result, error) {
+	flagged := stopCondition(ctx)
+	merged := make(Result)
+	var lastErr error
+	succeeded := 0
+
+	for i, moderator := range c.moderators {
+		result, err := moderator.ModerateText(ctx, text)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "moderator %d in chain failed", i+1)
+			if c.continueOnError {
+				continue
+			}
+			return nil, lastErr
+		}
+		succeeded++
+		merged.Merge(result)
+
+		if flagged != nil && flagged(merged) {
+			break
+		}
+	}
+
+	// With continue-on-error the chain only fails if no moderator produced a result
+	if succeeded == 0 {
+		return nil, lastErr
+	}
+
+	return merged, nil
+}
+
+// ModerateImage calls each moderator that supports images in sequence and
+// returns the maximum severity seen for each category. With continue-on-error
+// it only fails when none of them produced a result, so an image is never
+// passed without being moderated.
+func (c *chainImageModerator) ModerateImage(ctx context.Context, data []byte) (Result, error) {
+	flagged := stopCondition(ctx)
+	merged := make(Result)
+	var lastErr error
+	succeeded := 0
+
+	for i, moderator := range c.moderators {
+		imageModerator, ok := moderator.(ImageModerator)
+		if !ok {
+			continue
+		}
+
+		result, err := imageModerator.ModerateImage(ctx, data)
+		if err != nil {
+			lastErr = errors.Wrapf(err, "moderator %d in chain failed", i+1)
+			if c.continueOnError {
+				continue
+			}
+			return nil, lastErr
+		}
+		succeeded++
+
+		merged.Merge(result)
+		if flagged != nil && flagged(merged) {
+			break
+		}
+	}
+
+	if succeeded == 0 {
+		return nil, lastErr
+	}
+	return merged, nil
+}
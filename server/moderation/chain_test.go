@@ -0,0 +1,211 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticModerator struct {
+	result Result
+	err    error
+	calls  int
+}
+
+func (m *staticModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	m.calls++
+	return m.result, m.err
+}
+
+func (m *staticModerator) HealthCheck(ctx context.Context) error {
+	return m.err
+}
+
+func TestChainModerateText(t *testing.T) {
+	t.Run("Merges results taking the max severity", func(t *testing.T) {
+		first := &staticModerator{result: Result{"hate": 2, "blocklist": 0}}
+		second := &staticModerator{result: Result{"hate": 0, "violence": 2}}
+
+		chain, err := NewChain([]Moderator{first, second}, false)
+		require.NoError(t, err)
+
+		result, err := chain.ModerateText(context.Background(), "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"hate": 2, "blocklist": 0, "violence": 2}, result)
+		assert.Equal(t, 1, second.calls)
+	})
+
+	t.Run("Short-circuits once the result is flagged", func(t *testing.T) {
+		first := &staticModerator{result: Result{"blocklist": 6}}
+		second := &staticModerator{result: Result{"hate": 0}}
+
+		chain, err := NewChain([]Moderator{first, second}, false)
+		require.NoError(t, err)
+
+		ctx := StopWhen(context.Background(), func(result Result) bool { return result["blocklist"] >= 4 })
+		result, err := chain.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"blocklist": 6}, result)
+		assert.Equal(t, 0, second.calls)
+	})
+
+	t.Run("Keeps going while the condition does not flag the result", func(t *testing.T) {
+		// A severity the policy ignores, such as a disabled category, must not
+		// keep the next moderator from seeing the text
+		first := &staticModerator{result: Result{"sexual": 6}}
+		second := &staticModerator{result: Result{"hate": 6}}
+
+		chain, err := NewChain([]Moderator{first, second}, false)
+		require.NoError(t, err)
+
+		ctx := StopWhen(context.Background(), func(result Result) bool { return result["hate"] >= 4 })
+		result, err := chain.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"sexual": 6, "hate": 6}, result)
+		assert.Equal(t, 1, second.calls)
+	})
+
+	t.Run("Calls every moderator without a condition", func(t *testing.T) {
+		first := &staticModerator{result: Result{"blocklist": 6}}
+		second := &staticModerator{result: Result{"hate": 0}}
+
+		chain, err := NewChain([]Moderator{first, second}, false)
+		require.NoError(t, err)
+
+		_, err = chain.ModerateText(context.Background(), "text")
+		require.NoError(t, err)
+		assert.Equal(t, 1, second.calls)
+	})
+
+	t.Run("Propagates member errors", func(t *testing.T) {
+		first := &staticModerator{err: errors.New("unavailable")}
+		second := &staticModerator{result: Result{"hate": 0}}
+
+		chain, err := NewChain([]Moderator{first, second}, false)
+		require.NoError(t, err)
+
+		_, err = chain.ModerateText(context.Background(), "text")
+		assert.ErrorContains(t, err, "unavailable")
+		assert.Equal(t, 0, second.calls)
+	})
+
+	t.Run("Continues past errors when configured", func(t *testing.T) {
+		first := &staticModerator{err: errors.New("unavailable")}
+		second := &staticModerator{result: Result{"hate": 2}}
+
+		chain, err := NewChain([]Moderator{first, second}, true)
+		require.NoError(t, err)
+
+		result, err := chain.ModerateText(context.Background(), "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"hate": 2}, result)
+	})
+
+	t.Run("Fails when every member fails", func(t *testing.T) {
+		first := &staticModerator{err: errors.New("first unavailable")}
+		second := &staticModerator{err: errors.New("second unavailable")}
+
+		chain, err := NewChain([]Moderator{first, second}, true)
+		require.NoError(t, err)
+
+		_, err = chain.ModerateText(context.Background(), "text")
+		assert.ErrorContains(t, err, "second unavailable")
+	})
+}
+
+type limitedModerator struct {
+	staticModerator
+	maxLength int
+}
+
+func (m *limitedModerator) MaxTextLength() int {
+	return m.maxLength
+}
+
+func TestChainMaxTextLength(t *testing.T) {
+	chain, err := NewChain([]Moderator{&staticModerator{}}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 0, chain.(TextLengthLimiter).MaxTextLength())
+
+	chain, err = NewChain([]Moderator{
+		&limitedModerator{maxLength: 10000},
+		&staticModerator{},
+		&limitedModerator{maxLength: 3000},
+	}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3000, chain.(TextLengthLimiter).MaxTextLength())
+}
+
+type rateLimitedModerator struct {
+	staticModerator
+	rateLimit RateLimit
+}
+
+func (m *rateLimitedModerator) RateLimit() RateLimit {
+	return m.rateLimit
+}
+
+func TestChainRateLimit(t *testing.T) {
+	resumeAt := time.Now().Add(time.Minute)
+	chain, err := NewChain([]Moderator{
+		&staticModerator{},
+		&rateLimitedModerator{rateLimit: RateLimit{Limit: 100, Remaining: 50}},
+		&rateLimitedModerator{rateLimit: RateLimit{Limit: 1000, Remaining: 10, ResumeAt: resumeAt}},
+		&rateLimitedModerator{rateLimit: UnknownRateLimit()},
+	}, false)
+	require.NoError(t, err)
+
+	assert.Equal(t, RateLimit{Limit: 1000, Remaining: 10, ResumeAt: resumeAt}, chain.(RateLimitReporter).RateLimit())
+
+	chain, err = NewChain([]Moderator{&staticModerator{}}, false)
+	require.NoError(t, err)
+	assert.Equal(t, UnknownRateLimit(), chain.(RateLimitReporter).RateLimit())
+}
+
+func TestChainModerateImage(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Only exposed when a member moderates images", func(t *testing.T) {
+		chain, err := NewChain([]Moderator{&staticModerator{}, &staticModerator{}}, false)
+		require.NoError(t, err)
+		_, ok := chain.(ImageModerator)
+		assert.False(t, ok)
+
+		chain, err = NewChain([]Moderator{&staticModerator{}, &imageStaticModerator{staticModerator{result: Result{"sexual": 4}}}}, false)
+		require.NoError(t, err)
+		imageModerator, ok := chain.(ImageModerator)
+		require.True(t, ok)
+
+		result, err := imageModerator.ModerateImage(ctx, []byte("image"))
+		require.NoError(t, err)
+		assert.Equal(t, Result{"sexual": 4}, result)
+	})
+
+	t.Run("Fails when every image moderator fails", func(t *testing.T) {
+		chain, err := NewChain([]Moderator{
+			&imageStaticModerator{staticModerator{err: errors.New("first unavailable")}},
+			&staticModerator{result: Result{"hate": 0}},
+			&imageStaticModerator{staticModerator{err: errors.New("second unavailable")}},
+		}, true)
+		require.NoError(t, err)
+
+		_, err = chain.(ImageModerator).ModerateImage(ctx, []byte("image"))
+		assert.ErrorContains(t, err, "second unavailable")
+	})
+
+	t.Run("Continues past failing image moderators when configured", func(t *testing.T) {
+		chain, err := NewChain([]Moderator{
+			&imageStaticModerator{staticModerator{err: errors.New("unavailable")}},
+			&imageStaticModerator{staticModerator{result: Result{"violence": 2}}},
+		}, true)
+		require.NoError(t, err)
+
+		result, err := chain.(ImageModerator).ModerateImage(ctx, []byte("image"))
+		require.NoError(t, err)
+		assert.Equal(t, Result{"violence": 2}, result)
+	})
+}
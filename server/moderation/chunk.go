@@ -0,0 +1,57 @@
+package moderation
+
+import (
+	"context"
+	"unicode"
+)
+
+// TextLengthLimiter is implemented by moderators that accept a limited
+// number of characters per request
+type TextLengthLimiter interface {
+	// MaxTextLength returns the maximum number of characters per request
+	MaxTextLength() int
+}
+
+// ChunkText splits text into chunks of at most maxLength characters. Chunks
+// end at whitespace when there is some in the second half of the chunk, so
+// that words are rarely split. A maxLength that is not positive returns the
+// text as a single chunk.
+func ChunkText(text string, maxLength int) []string {
+	runes := []rune(text)
+	if maxLength <= 0 || len(runes) <= maxLength {
+		return []string{text}
+	}
+
+	var chunks []string
+	for len(runes) > maxLength {
+		end := maxLength
+		for i := maxLength; i > maxLength/2; i-- {
+			if unicode.IsSpace(runes[i]) {
+				end = i
+				break
+			}
+		}
+
+		chunks = append(chunks, string(runes[:end]))
+		runes = runes[end:]
+	}
+
+	if len(runes) > 0 {
+		chunks = append(chunks, string(runes))
+	}
+	return chunks
+}
+
+// ModerateChunks moderates text in chunks of at most maxLength characters and
+// merges the results, keeping the highest severity seen for each category
+func ModerateChunks(ctx context.Context, text string, maxLength int, moderate func(context.Context, string) (Result, error)) (Result, error) {
+	merged := make(Result)
+	for _, chunk := range ChunkText(text, maxLength) {
+		result, err := moderate(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		merged.Merge(result)
+	}
+	return merged, nil
+}
@@ -0,0 +1,94 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		maxLength int
+		expected  []string
+	}{
+		{
+			name:      "No limit",
+			text:      "some text",
+			maxLength: 0,
+			expected:  []string{"some text"},
+		},
+		{
+			name:      "Shorter than limit",
+			text:      "some text",
+			maxLength: 20,
+			expected:  []string{"some text"},
+		},
+		{
+			name:      "Splits at whitespace",
+			text:      "one two three four",
+			maxLength: 10,
+			expected:  []string{"one two", " three", " four"},
+		},
+		{
+			name:      "Splits long words",
+			text:      "abcdefghijkl",
+			maxLength: 5,
+			expected:  []string{"abcde", "fghij", "kl"},
+		},
+		{
+			name:      "Counts characters rather than bytes",
+			text:      "ééééé",
+			maxLength: 2,
+			expected:  []string{"éé", "éé", "é"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ChunkText(tt.text, tt.maxLength))
+		})
+	}
+}
+
+func TestModerateChunks(t *testing.T) {
+	t.Run("Every chunk of a long message is moderated", func(t *testing.T) {
+		const maxLength = 10000
+		text := strings.Repeat("harmless words ", 3333) + "offensive"
+		require.Greater(t, utf8.RuneCountInString(text), 50000)
+
+		var chunks []string
+		result, err := ModerateChunks(context.Background(), text, maxLength, func(_ context.Context, chunk string) (Result, error) {
+			chunks = append(chunks, chunk)
+			if strings.Contains(chunk, "offensive") {
+				return Result{"Hate": 6, "Violence": 0}, nil
+			}
+			return Result{"Hate": 0, "Violence": 2}, nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, Result{"Hate": 6, "Violence": 2}, result)
+		assert.Len(t, chunks, 6)
+		for _, chunk := range chunks {
+			assert.LessOrEqual(t, utf8.RuneCountInString(chunk), maxLength)
+		}
+		assert.Equal(t, text, strings.Join(chunks, ""))
+	})
+
+	t.Run("Error stops moderation", func(t *testing.T) {
+		calls := 0
+		_, err := ModerateChunks(context.Background(), "one two three four", 10, func(context.Context, string) (Result, error) {
+			calls++
+			return nil, errors.New("API error")
+		})
+
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
@@ -0,0 +1,38 @@
+package moderation
+
+import (
+	"strings"
+)
+
+// blocklistCategory is the category reported for blocklist matches, both by
+// the local blocklist and, capitalized, by blocklists managed by a provider
+const blocklistCategory = "blocklist"
+
+// Decision is a moderation result along with how it was reached. It embeds
+// the severities of the result, so that it can be read like a Result.
+type Decision struct {
+	Result
+
+	// Providers lists the moderator types that checked the content, in the
+	// order they ran
+	Providers []string
+
+	// Language is the detected language the text was moderated as, or empty
+	// when no language was detected
+	Language string
+
+	// Degraded reports that the configured providers failed and a fallback
+	// provider checked the text instead, with reduced coverage
+	Degraded bool
+}
+
+// BlocklistMatched reports whether a blocklist term, rather than a provider
+// model or rule, caught the content
+func (d Decision) BlocklistMatched() bool {
+	for category, severity := range d.Result {
+		if severity > 0 && strings.EqualFold(category, blocklistCategory) {
+			return true
+		}
+	}
+	return false
+}
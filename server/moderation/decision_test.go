@@ -0,0 +1,22 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecision(t *testing.T) {
+	decision := Decision{Result: Result{"Hate": 4, "Violence": 0}, Providers: []string{"azure"}, Language: "fr"}
+
+	// The severities read like a Result
+	assert.Equal(t, 4, decision.Highest())
+	assert.Equal(t, 4, decision.Result["Hate"])
+	assert.Equal(t, "Hate: 4, Violence: 0", decision.String())
+	assert.False(t, decision.BlocklistMatched())
+
+	assert.True(t, Decision{Result: Result{"blocklist": 6}}.BlocklistMatched())
+	assert.True(t, Decision{Result: Result{"Blocklist": 6, "Hate": 0}}.BlocklistMatched())
+	assert.False(t, Decision{Result: Result{"Blocklist": 0}}.BlocklistMatched())
+	assert.False(t, Decision{}.BlocklistMatched())
+}
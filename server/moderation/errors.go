@@ -0,0 +1,100 @@
+package moderation
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies why a request to a moderation provider failed, so that
+// callers can decide whether retrying is worthwhile
+type ErrorKind string
+
+const (
+	// ErrorTimeout means the provider did not respond in time
+	ErrorTimeout ErrorKind = "timeout"
+
+	// ErrorAuth means the provider rejected the credentials, which does not
+	// resolve itself until the configuration changes
+	ErrorAuth ErrorKind = "auth"
+
+	// ErrorRateLimit means the provider throttled the request
+	ErrorRateLimit ErrorKind = "ratelimit"
+
+	// ErrorTransport means the provider could not be reached or failed to
+	// handle the request
+	ErrorTransport ErrorKind = "transport"
+
+	// ErrorDecode means the provider responded with a body that could not be
+	// understood
+	ErrorDecode ErrorKind = "decode"
+)
+
+// Error is returned by providers when a moderation request fails. The
+// underlying error is kept, so errors.Is and errors.As still see it.
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+// NewError classifies err as kind, returning nil when err is nil
+func NewError(kind ErrorKind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// RequestError classifies an error returned while sending an HTTP request:
+// requests that ran out of time are timeouts and any other failure is a
+// transport error
+func RequestError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return NewError(ErrorTimeout, err)
+	}
+	return NewError(ErrorTransport, err)
+}
+
+// StatusErrorKind returns the kind of failure reported by a non-successful
+// HTTP status code
+func StatusErrorKind(statusCode int) ErrorKind {
+	switch statusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrorAuth
+	case http.StatusTooManyRequests:
+		return ErrorRateLimit
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return ErrorTimeout
+	default:
+		return ErrorTransport
+	}
+}
+
+// KindOf returns the kind of a moderation failure. Errors that were not
+// classified by a provider are timeouts when their context deadline passed,
+// and otherwise have no kind.
+func KindOf(err error) (ErrorKind, bool) {
+	var moderationErr *Error
+	if errors.As(err, &moderationErr) {
+		return moderationErr.Kind, true
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTimeout, true
+	}
+	return "", false
+}
@@ -0,0 +1,66 @@
+package moderation
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusErrorKind(t *testing.T) {
+	tests := []struct {
+		status int
+		kind   ErrorKind
+	}{
+		{http.StatusUnauthorized, ErrorAuth},
+		{http.StatusForbidden, ErrorAuth},
+		{http.StatusTooManyRequests, ErrorRateLimit},
+		{http.StatusRequestTimeout, ErrorTimeout},
+		{http.StatusGatewayTimeout, ErrorTimeout},
+		{http.StatusInternalServerError, ErrorTransport},
+		{http.StatusBadGateway, ErrorTransport},
+		{http.StatusServiceUnavailable, ErrorTransport},
+		{http.StatusBadRequest, ErrorTransport},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.kind, StatusErrorKind(tt.status), tt.status)
+	}
+}
+
+func TestRequestError(t *testing.T) {
+	assert.NoError(t, RequestError(nil))
+
+	kind, ok := KindOf(RequestError(errors.Wrap(context.DeadlineExceeded, "request failed")))
+	assert.True(t, ok)
+	assert.Equal(t, ErrorTimeout, kind)
+
+	kind, _ = KindOf(RequestError(&net.DNSError{Err: "i/o timeout", IsTimeout: true}))
+	assert.Equal(t, ErrorTimeout, kind)
+
+	kind, _ = KindOf(RequestError(&net.OpError{Op: "dial", Err: errors.New("connection refused")}))
+	assert.Equal(t, ErrorTransport, kind)
+}
+
+func TestKindOf(t *testing.T) {
+	cause := errors.New("OpenAI API returned status 401: invalid key")
+	err := errors.Wrap(NewError(ErrorAuth, cause), "failed to moderate text content")
+
+	kind, ok := KindOf(err)
+	assert.True(t, ok)
+	assert.Equal(t, ErrorAuth, kind)
+	assert.ErrorIs(t, err, cause, "the underlying error is kept")
+	assert.EqualError(t, err, "failed to moderate text content: OpenAI API returned status 401: invalid key")
+
+	kind, ok = KindOf(errors.Wrap(context.DeadlineExceeded, "moderation timed out"))
+	assert.True(t, ok)
+	assert.Equal(t, ErrorTimeout, kind)
+
+	_, ok = KindOf(errors.New("blocklist failed to load"))
+	assert.False(t, ok)
+
+	assert.NoError(t, NewError(ErrorDecode, nil))
+}
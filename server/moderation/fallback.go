@@ -0,0 +1,157 @@
+package moderation
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// primaryShare is the part of the time left for a request that the primary
+// moderator may use. The rest is kept for the secondary moderator, so that a
+// primary moderator hanging until the deadline still leaves time to fall back.
+const primaryShare = 0.8
+
+// Ensure FallbackModerator implements the Moderator, TextLengthLimiter,
+// RateLimitReporter, CircuitReporter and BatchModerator interfaces
+var (
+	_ Moderator         = (*FallbackModerator)(nil)
+	_ TextLengthLimiter = (*FallbackModerator)(nil)
+	_ RateLimitReporter = (*FallbackModerator)(nil)
+	_ CircuitReporter   = (*FallbackModerator)(nil)
+	_ BatchModerator    = (*FallbackModerator)(nil)
+	_ ImageModerator    = (*fallbackImageModerator)(nil)
+)
+
+// FallbackModerator moderates text with a primary moderator and, when it
+// fails, with a secondary moderator, typically a local provider such as the
+// blocklist standing in for a remote one. Moderation then degrades to the
+// coverage of the secondary moderator rather than failing altogether.
+type FallbackModerator struct {
+	primary   Moderator
+	secondary Moderator
+}
+
+// fallbackImageModerator is returned for primary moderators that also
+// moderate images. Images are only moderated by the primary moderator.
+type fallbackImageModerator struct {
+	*FallbackModerator
+	imageModerator ImageModerator
+}
+
+// fallbackReportKey is the context key of the flag recording that a request
+// fell back to the secondary moderator
+type fallbackReportKey struct{}
+
+// Fallback wraps the primary moderator so that text it fails to moderate is
+// moderated by the secondary moderator instead. The returned moderator
+// implements ImageModerator when primary does.
+func Fallback(primary, secondary Moderator) Moderator {
+	moderator := &FallbackModerator{primary: primary, secondary: secondary}
+	if imageModerator, ok := primary.(ImageModerator); ok {
+		return &fallbackImageModerator{FallbackModerator: moderator, imageModerator: imageModerator}
+	}
+	return moderator
+}
+
+// ReportFallback returns a context that records whether a request made with
+// it fell back to a secondary moderator, which FellBack then reports
+func ReportFallback(ctx context.Context) context.Context {
+	return context.WithValue(ctx, fallbackReportKey{}, new(atomic.Bool))
+}
+
+// FellBack reports whether a request made with a context returned by
+// ReportFallback was moderated by a secondary moderator, in which case its
+// result has reduced coverage
+func FellBack(ctx context.Context) bool {
+	fellBack, ok := ctx.Value(fallbackReportKey{}).(*atomic.Bool)
+	return ok && fellBack.Load()
+}
+
+// ModerateText moderates the text with the primary moderator, or with the
+// secondary moderator when the primary one fails or runs out of its share of
+// the time. The error of the secondary moderator is returned when both fail.
+func (f *FallbackModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	primaryCtx, cancel := primaryContext(ctx)
+	result, err := f.primary.ModerateText(primaryCtx, text)
+	cancel()
+	if err == nil {
+		return result, nil
+	}
+
+	// A request that was canceled, such as on deactivation, is not moderated
+	// any further
+	if ctx.Err() != nil {
+		return nil, err
+	}
+
+	result, err = f.secondary.ModerateText(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+	if fellBack, ok := ctx.Value(fallbackReportKey{}).(*atomic.Bool); ok {
+		fellBack.Store(true)
+	}
+	return result, nil
+}
+
+// primaryContext returns the context of a request to the primary moderator,
+// whose deadline leaves part of the time left to the secondary moderator
+func primaryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(float64(time.Until(deadline))*primaryShare))
+}
+
+// ModerateTexts moderates the texts with the primary moderator only. Batches
+// are sent ahead of time to save requests, so a failing batch is left to be
+// moderated one text at a time, with the fallback.
+func (f *FallbackModerator) ModerateTexts(ctx context.Context, texts []string) ([]Result, error) {
+	return ModerateTexts(ctx, f.primary, texts)
+}
+
+// MaxBatchSize returns the batch size of the primary moderator, or 0 when it
+// does not moderate texts in batches
+func (f *FallbackModerator) MaxBatchSize() int {
+	return MaxBatchSize(f.primary)
+}
+
+// HealthCheck checks the primary moderator, so that its failures are still
+// reported while the secondary moderator stands in for it
+func (f *FallbackModerator) HealthCheck(ctx context.Context) error {
+	return f.primary.HealthCheck(ctx)
+}
+
+// MaxTextLength returns the text length limit of the primary moderator, or 0
+// when it has none
+func (f *FallbackModerator) MaxTextLength() int {
+	if limiter, ok := f.primary.(TextLengthLimiter); ok {
+		return limiter.MaxTextLength()
+	}
+	return 0
+}
+
+// RateLimit returns the rate limit of the primary moderator, or an unknown
+// rate limit when it does not report one
+func (f *FallbackModerator) RateLimit() RateLimit {
+	if reporter, ok := f.primary.(RateLimitReporter); ok {
+		return reporter.RateLimit()
+	}
+	return UnknownRateLimit()
+}
+
+// CircuitOpen reports whether the primary moderator is rejecting requests
+// because of a circuit breaker. The secondary moderator stands in for it
+// meanwhile.
+func (f *FallbackModerator) CircuitOpen() bool {
+	if reporter, ok := f.primary.(CircuitReporter); ok {
+		return reporter.CircuitOpen()
+	}
+	return false
+}
+
+// ModerateImage moderates the image with the primary moderator
+func (f *fallbackImageModerator) ModerateImage(ctx context.Context, data []byte) (Result, error) {
+	return f.imageModerator.ModerateImage(ctx, data)
+}
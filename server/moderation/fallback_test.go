@@ -0,0 +1,93 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFallback(t *testing.T) {
+	t.Run("Primary result is used while it succeeds", func(t *testing.T) {
+		primary := &staticModerator{result: Result{"hate": 2}}
+		secondary := &staticModerator{result: Result{"blocklist": 6}}
+		moderator := Fallback(primary, secondary)
+
+		ctx := ReportFallback(context.Background())
+		result, err := moderator.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"hate": 2}, result)
+		assert.False(t, FellBack(ctx))
+		assert.Zero(t, secondary.calls)
+	})
+
+	t.Run("Secondary moderates when the primary fails", func(t *testing.T) {
+		primary := &staticModerator{err: errors.New("service unavailable")}
+		secondary := &staticModerator{result: Result{"blocklist": 6}}
+		moderator := Fallback(primary, secondary)
+
+		ctx := ReportFallback(context.Background())
+		result, err := moderator.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"blocklist": 6}, result)
+		assert.True(t, FellBack(ctx))
+
+		// The health check still reports the failing primary
+		assert.Error(t, moderator.HealthCheck(context.Background()))
+
+		// Requests without a report still fall back
+		result, err = moderator.ModerateText(context.Background(), "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"blocklist": 6}, result)
+	})
+
+	t.Run("Both failing returns the secondary error", func(t *testing.T) {
+		moderator := Fallback(&staticModerator{err: errors.New("primary")}, &staticModerator{err: errors.New("secondary")})
+
+		ctx := ReportFallback(context.Background())
+		_, err := moderator.ModerateText(ctx, "text")
+		assert.EqualError(t, err, "secondary")
+		assert.False(t, FellBack(ctx))
+	})
+
+	t.Run("Hanging primary leaves time for the secondary", func(t *testing.T) {
+		secondary := &staticModerator{result: Result{"blocklist": 6}}
+		moderator := Fallback(&slowModerator{}, secondary)
+
+		ctx, cancel := context.WithTimeout(ReportFallback(context.Background()), 50*time.Millisecond)
+		defer cancel()
+		result, err := moderator.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"blocklist": 6}, result)
+		assert.True(t, FellBack(ctx))
+		assert.NoError(t, ctx.Err(), "the secondary answered before the request deadline")
+	})
+
+	t.Run("Canceled requests do not fall back", func(t *testing.T) {
+		secondary := &staticModerator{result: Result{"blocklist": 0}}
+		moderator := Fallback(&slowModerator{}, secondary)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(10*time.Millisecond, cancel)
+		_, err := moderator.ModerateText(ctx, "text")
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Zero(t, secondary.calls)
+	})
+
+	t.Run("Batches only use the primary", func(t *testing.T) {
+		secondary := &staticModerator{result: Result{"blocklist": 0}}
+		moderator := Fallback(&staticModerator{err: errors.New("service unavailable")}, secondary)
+
+		_, err := moderator.(BatchModerator).ModerateTexts(context.Background(), []string{"first", "second"})
+		assert.Error(t, err)
+		assert.Zero(t, secondary.calls)
+	})
+
+	t.Run("Limits come from the primary", func(t *testing.T) {
+		moderator := Fallback(&limitedModerator{maxLength: 100}, &staticModerator{})
+		assert.Equal(t, 100, moderator.(TextLengthLimiter).MaxTextLength())
+	})
+}
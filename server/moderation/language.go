@@ -0,0 +1,153 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+// LanguageDetector detects the language of text before it is moderated
+type LanguageDetector interface {
+	// DetectLanguage returns the ISO 639-1 code of the language of the text,
+	// or false when the language could not be determined
+	DetectLanguage(text string) (string, bool)
+}
+
+type languageKey struct{}
+
+// WithLanguage returns a context carrying the detected language of the text
+// being moderated, which providers may pass along as a hint
+func WithLanguage(ctx context.Context, language string) context.Context {
+	return context.WithValue(ctx, languageKey{}, language)
+}
+
+// LanguageFromContext returns the language hint set by WithLanguage, or an
+// empty string when there is none
+func LanguageFromContext(ctx context.Context) string {
+	language, _ := ctx.Value(languageKey{}).(string)
+	return language
+}
+
+// minStopwordMatches is the number of stopwords a text written in a Latin
+// script must contain before its language is reported
+const minStopwordMatches = 2
+
+// scriptLanguages maps scripts used mostly by a single language to it.
+// Japanese is checked before Han since Japanese text mixes in Han characters.
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Hangul, "ko"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Greek, "el"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// stopwords lists common words of languages written in the Latin script
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "you", "that", "this", "with", "for", "not", "have", "was", "what", "it", "of"},
+	"fr": {"le", "la", "les", "et", "est", "une", "des", "pas", "je", "vous", "que", "qui", "dans", "pour", "avec", "ce"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "du", "ein", "eine", "mit", "auf", "sie", "es", "zu", "den"},
+	"es": {"el", "los", "las", "y", "es", "que", "una", "por", "para", "con", "no", "del", "pero", "muy", "como"},
+	"it": {"il", "lo", "gli", "che", "non", "sono", "una", "per", "con", "della", "di", "è", "questo", "ma"},
+	"pt": {"o", "os", "as", "não", "uma", "com", "para", "que", "do", "da", "em", "é", "você", "muito"},
+	"nl": {"de", "het", "een", "en", "van", "ik", "je", "niet", "dat", "is", "op", "met", "zijn", "voor"},
+}
+
+// StopwordDetector is a lightweight LanguageDetector. Text mostly written in
+// a script used by a single language is reported as that language, and text
+// in the Latin script is matched against lists of common words.
+type StopwordDetector struct {
+	stopwords map[string]map[string]struct{}
+}
+
+// NewStopwordDetector creates a detector for the built-in stopword lists
+func NewStopwordDetector() *StopwordDetector {
+	detector := &StopwordDetector{stopwords: make(map[string]map[string]struct{}, len(stopwords))}
+	for language, words := range stopwords {
+		set := make(map[string]struct{}, len(words))
+		for _, word := range words {
+			set[word] = struct{}{}
+		}
+		detector.stopwords[language] = set
+	}
+	return detector
+}
+
+// DetectLanguage returns the language of the text, or false when the text is
+// too short or ambiguous to tell
+func (d *StopwordDetector) DetectLanguage(text string) (string, bool) {
+	if language, ok := detectScriptLanguage(text); ok {
+		return language, true
+	}
+	return d.detectStopwordLanguage(text)
+}
+
+// detectScriptLanguage returns the language of the script used by most
+// letters of the text, unless that script is Latin or shared by many languages
+func detectScriptLanguage(text string) (string, bool) {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.script, r) {
+				counts[s.language]++
+				break
+			}
+		}
+	}
+
+	// Han characters in text that also has kana are Japanese
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		delete(counts, "zh")
+	}
+
+	for language, count := range counts {
+		if count*2 > letters {
+			return language, true
+		}
+	}
+	return "", false
+}
+
+// detectStopwordLanguage returns the language with the most stopwords in the
+// text, when it has enough of them and no other language has as many
+func (d *StopwordDetector) detectStopwordLanguage(text string) (string, bool) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	best, bestCount, tied := "", 0, false
+	for language, set := range d.stopwords {
+		count := 0
+		for _, word := range words {
+			if _, ok := set[word]; ok {
+				count++
+			}
+		}
+
+		switch {
+		case count > bestCount:
+			best, bestCount, tied = language, count, false
+		case count == bestCount:
+			tied = true
+		}
+	}
+
+	if bestCount < minStopwordMatches || tied {
+		return "", false
+	}
+	return best, true
+}
@@ -0,0 +1,47 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopwordDetector(t *testing.T) {
+	detector := NewStopwordDetector()
+
+	for _, tc := range []struct {
+		text     string
+		language string
+	}{
+		{"What is the plan for this week and who is coming?", "en"},
+		{"Je ne sais pas si vous êtes dans le bureau avec les autres.", "fr"},
+		{"Ich weiß nicht, ob das auf der Liste ist.", "de"},
+		{"No sé si los niños están en el parque con las abuelas.", "es"},
+		{"Non sono sicuro che questo sia il posto giusto.", "it"},
+		{"Não sei se você vai para a festa com os amigos.", "pt"},
+		{"Ik weet niet of het voor de vergadering van morgen is.", "nl"},
+		{"Привет, как дела?", "ru"},
+		{"今日はいい天気ですね", "ja"},
+		{"今天天气很好", "zh"},
+		{"안녕하세요 반갑습니다", "ko"},
+	} {
+		t.Run(tc.language, func(t *testing.T) {
+			language, ok := detector.DetectLanguage(tc.text)
+			assert.True(t, ok)
+			assert.Equal(t, tc.language, language)
+		})
+	}
+
+	for _, text := range []string{"", "hello", "12345 !!!", "lol ok"} {
+		t.Run("Undetected "+text, func(t *testing.T) {
+			_, ok := detector.DetectLanguage(text)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestLanguageFromContext(t *testing.T) {
+	assert.Equal(t, "", LanguageFromContext(context.Background()))
+	assert.Equal(t, "fr", LanguageFromContext(WithLanguage(context.Background(), "fr")))
+}
@@ -0,0 +1,41 @@
+package moderation
+
+import (
+	"regexp"
+	"strings"
+)
+
+// markdownReplacements are applied in order, so that code is unwrapped
+// before emphasis and images before links
+var markdownReplacements = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Code fences, including any language tag
+	{regexp.MustCompile("(?m)^[ \t]*(```|~~~).*\n?"), ""},
+	{regexp.MustCompile("`+([^`]*)`+"), "$1"},
+	// Images and links keep their text but drop the URL
+	{regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`), "$1"},
+	{regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`), "$1"},
+	{regexp.MustCompile(`\[([^\]]*)\]\[[^\]]*\]`), "$1"},
+	{regexp.MustCompile(`\*\*(.+?)\*\*`), "$1"},
+	{regexp.MustCompile(`__(.+?)__`), "$1"},
+	{regexp.MustCompile(`~~(.+?)~~`), "$1"},
+	{regexp.MustCompile(`\*([^*\n]+)\*`), "$1"},
+	// Underscores inside words, as in snake_case, are not emphasis
+	{regexp.MustCompile(`(^|\W)_([^_\n]+)_(\W|$)`), "$1$2$3"},
+	{regexp.MustCompile(`(?m)^[ \t]*#{1,6}[ \t]+`), ""},
+	{regexp.MustCompile(`(?m)^[ \t]*>[ \t]?`), ""},
+}
+
+var blankLines = regexp.MustCompile(`\n{3,}`)
+
+// StripMarkdown removes Markdown syntax from text while keeping the text a
+// reader would see, so that formatting neither hides content from moderation
+// nor is mistaken for it
+func StripMarkdown(text string) string {
+	for _, r := range markdownReplacements {
+		text = r.pattern.ReplaceAllString(text, r.replacement)
+	}
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n"))
+}
@@ -0,0 +1,67 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "Plain text",
+			text:     "Nothing to strip here",
+			expected: "Nothing to strip here",
+		},
+		{
+			name:     "Fenced code",
+			text:     "Look at this:\n```go\nfmt.Println(\"hidden words\")\n```\nDone",
+			expected: "Look at this:\nfmt.Println(\"hidden words\")\nDone",
+		},
+		{
+			name:     "Inline code",
+			text:     "Run `rm -rf` carefully",
+			expected: "Run rm -rf carefully",
+		},
+		{
+			name:     "Markdown link keeps text and drops URL",
+			text:     "Read [the docs](https://example.com/some-path) first",
+			expected: "Read the docs first",
+		},
+		{
+			name:     "Image keeps alt text",
+			text:     "![a cat](https://example.com/cat.png)",
+			expected: "a cat",
+		},
+		{
+			name:     "Emphasis",
+			text:     "This is **bold**, *italic*, _also italic_ and ~~struck~~",
+			expected: "This is bold, italic, also italic and struck",
+		},
+		{
+			name:     "Underscores inside words are kept",
+			text:     "Set snake_case_name to true",
+			expected: "Set snake_case_name to true",
+		},
+		{
+			name:     "Headings and quotes",
+			text:     "## Title\n> quoted text",
+			expected: "Title\nquoted text",
+		},
+		{
+			name:     "Raw URLs are kept",
+			text:     "See https://example.com/page",
+			expected: "See https://example.com/page",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, StripMarkdown(tt.text))
+		})
+	}
+}
@@ -2,15 +2,97 @@ package moderation
 
 import (
 	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
 )
 
+// MaxSeverity is the highest severity a moderator reports. It matches the 0-6
+// range used by Azure AI Content Safety so that a single threshold applies to
+// every provider.
+const MaxSeverity = 6
+
+// Named severity levels matching the levels reported by Azure AI Content
+// Safety. Every provider reports severities on the same 0-MaxSeverity scale,
+// so the levels apply to every provider.
+const (
+	SeveritySafe   = 0
+	SeverityLow    = 2
+	SeverityMedium = 4
+	SeverityHigh   = MaxSeverity
+)
+
+// severityLevels maps the lowercase names of the severity levels to their values
+var severityLevels = map[string]int{
+	"safe":   SeveritySafe,
+	"low":    SeverityLow,
+	"medium": SeverityMedium,
+	"high":   SeverityHigh,
+}
+
+// ParseSeverityLevel returns the severity of a named level such as "Low" or
+// "high", or false when the name is not a known level
+func ParseSeverityLevel(name string) (int, bool) {
+	severity, ok := severityLevels[strings.ToLower(strings.TrimSpace(name))]
+	return severity, ok
+}
+
 // Result contains the resulting severities from a moderation check
 type Result map[string]int
 
+// Highest returns the highest severity across all categories, or -1 when
+// the result is empty
+func (r Result) Highest() int {
+	maxSeverity := -1
+	for _, severity := range r {
+		if severity > maxSeverity {
+			maxSeverity = severity
+		}
+	}
+	return maxSeverity
+}
+
+// String lists every category with its severity in a stable order, such as
+// "Hate: 4, Violence: 3"
+func (r Result) String() string {
+	names := make([]string, 0, len(r))
+	for category := range r {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+
+	formatted := make([]string, 0, len(names))
+	for _, name := range names {
+		formatted = append(formatted, fmt.Sprintf("%s: %d", name, r[name]))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// Merge raises each category in r to the severity in other when other is higher
+func (r Result) Merge(other Result) {
+	for category, severity := range other {
+		if existing, ok := r[category]; !ok || severity > existing {
+			r[category] = severity
+		}
+	}
+}
+
 // Moderator defines the interface for content moderation services
 type Moderator interface {
 	// ModerateText checks if text content violates moderation rules
 	ModerateText(ctx context.Context, text string) (Result, error)
+
+	// HealthCheck verifies that the moderator is able to serve requests.
+	// Moderators that cannot be checked return nil.
+	HealthCheck(ctx context.Context) error
+}
+
+// ImageModerator is implemented by moderators that can also moderate images
+type ImageModerator interface {
+	// ModerateImage checks if image content violates moderation rules
+	ModerateImage(ctx context.Context, data []byte) (Result, error)
 }
 
 // Config defines a common configuration for moderators
@@ -20,4 +102,63 @@ type Config struct {
 
 	// APIKey is the authentication key
 	APIKey string
+
+	// Model is the provider model used for moderation, if the provider supports choosing one
+	Model string
+
+	// Organization is the provider organization ID, if the provider requires one
+	Organization string
+
+	// APIVersion pins the provider API version, if the provider supports
+	// choosing one. Empty uses the provider default.
+	APIVersion string
+
+	// AuthMode selects how to authenticate, if the provider supports more
+	// than the API key. Empty uses the API key.
+	AuthMode string
+
+	// TenantID, ClientID and ClientSecret are the directory application
+	// credentials, if the provider authenticates with bearer tokens
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+
+	// Categories restricts the categories or attributes requested from the provider
+	Categories []string
+
+	// Blocklists names the blocklists managed by the provider that text is
+	// checked against, if the provider supports them
+	Blocklists []string
+
+	// Languages lists the languages of the moderated content, leaving detection
+	// to the provider when empty
+	Languages []string
+
+	// MaxRetries is the number of times a throttled or failed request is
+	// retried, if the provider supports retrying. Zero uses the provider
+	// default and a negative value disables retries.
+	MaxRetries int
+
+	// ProxyURL sends requests through an HTTP proxy, if the provider supports
+	// configuring its HTTP client. Empty uses the proxy set in the environment.
+	ProxyURL string
+
+	// CACertFile is the path of a PEM file of certificate authorities trusted
+	// in addition to the system ones, such as the CA of a TLS-intercepting
+	// proxy
+	CACertFile string
+
+	// InsecureSkipVerify disables the verification of TLS certificates. It is
+	// only meant for testing.
+	InsecureSkipVerify bool
+
+	// ConnectTimeout bounds establishing a connection, including the TLS
+	// handshake. Zero uses the provider default.
+	ConnectTimeout time.Duration
+}
+
+// ScaleScore converts a probability score in the range 0.0-1.0 into an integer
+// severity in the range 0-MaxSeverity
+func ScaleScore(score float64) int {
+	return int(math.Round(math.Max(0, math.Min(1, score)) * MaxSeverity))
 }
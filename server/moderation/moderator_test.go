@@ -0,0 +1,12 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResultString(t *testing.T) {
+	assert.Equal(t, "Hate: 4, SelfHarm: 0, Violence: 3", Result{"Violence": 3, "Hate": 4, "SelfHarm": 0}.String())
+	assert.Equal(t, "", Result{}.String())
+}
@@ -0,0 +1,271 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultEndpoint is the OpenAI API base URL used when no endpoint is configured
+	DefaultEndpoint = "https://api.openai.com"
+
+	// ModerationsEndpoint is the OpenAI moderation API path
+	ModerationsEndpoint = "/v1/moderations"
+
+	// ModelsEndpoint is the OpenAI model lookup API path, used for health checks
+	ModelsEndpoint = "/v1/models/"
+
+	// DefaultModel is the moderation model used when no model is configured
+	DefaultModel = "omni-moderation-latest"
+
+	// MaxBatchSize is the number of texts sent per moderation request, kept
+	// small so that a batch stays well within the request size limit
+	MaxBatchSize = 32
+)
+
+// These constants define the OpenAI categories reported by the moderator.
+// Subcategories such as "hate/threatening" are folded into their parent.
+const (
+	CategoryHate       = "hate"
+	CategoryHarassment = "harassment"
+	CategorySexual     = "sexual"
+	CategoryViolence   = "violence"
+	CategorySelfHarm   = "self-harm"
+)
+
+// CategoryMapping maps the OpenAI categories reported by the moderator onto
+// the canonical categories. Other categories returned by the API are ignored.
+var CategoryMapping = moderation.CategoryMapping{
+	CategoryHate:       moderation.CategoryHate,
+	CategoryHarassment: moderation.CategoryHarassment,
+	CategorySexual:     moderation.CategorySexual,
+	CategoryViolence:   moderation.CategoryViolence,
+	CategorySelfHarm:   moderation.CategorySelfHarm,
+}
+
+// Ensure Moderator implements the moderation.Moderator and
+// moderation.BatchModerator interfaces
+var (
+	_ moderation.Moderator      = (*Moderator)(nil)
+	_ moderation.BatchModerator = (*Moderator)(nil)
+)
+
+// Moderator implements the OpenAI Moderation API for text moderation
+type Moderator struct {
+	// client is the HTTP client for API requests
+	client *http.Client
+
+	// config holds the OpenAI moderator configuration
+	config *moderation.Config
+}
+
+// ModerationRequest represents the request structure for the OpenAI moderation API
+type ModerationRequest struct {
+	Input string `json:"input"`
+	Model string `json:"model,omitempty"`
+}
+
+// BatchModerationRequest represents a request moderating several texts at
+// once. The API returns one result per text, in the same order.
+type BatchModerationRequest struct {
+	Input []string `json:"input"`
+	Model string   `json:"model,omitempty"`
+}
+
+// ModerationResponse represents the response from the OpenAI moderation API
+type ModerationResponse struct {
+	Results []struct {
+		Flagged        bool               `json:"flagged"`
+		CategoryScores map[string]float64 `json:"category_scores"`
+	} `json:"results"`
+}
+
+// New creates a new OpenAI moderator
+func New(config *moderation.Config) (*Moderator, error) {
+	if config.APIKey == "" {
+		return nil, errors.New("API key is required")
+	}
+
+	resolved := *config
+	if resolved.Endpoint == "" {
+		resolved.Endpoint = DefaultEndpoint
+	}
+
+	if resolved.Model == "" {
+		resolved.Model = DefaultModel
+	}
+
+	return &Moderator{
+		client: &http.Client{},
+		config: &resolved,
+	}, nil
+}
+
+// ModerateText analyzes text content using the OpenAI moderation API
+func (m *Moderator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	req, err := makeModerationRequest(ctx, m.config, text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create moderation request")
+	}
+
+	moderationResp, err := sendRequest(m.client, m.config, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to moderate text content")
+	}
+
+	return convertToModerationResult(moderationResp), nil
+}
+
+// ModerateTexts analyzes several texts in a single request to the OpenAI
+// moderation API
+func (m *Moderator) ModerateTexts(ctx context.Context, texts []string) ([]moderation.Result, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	req, err := newRequest(ctx, m.config, BatchModerationRequest{Input: texts, Model: m.config.Model})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create moderation request")
+	}
+
+	moderationResp, err := sendRequest(m.client, m.config, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to moderate text content")
+	}
+	if len(moderationResp.Results) != len(texts) {
+		return nil, moderation.NewError(moderation.ErrorDecode, errors.Errorf("OpenAI API returned %d results for %d texts", len(moderationResp.Results), len(texts)))
+	}
+
+	results := make([]moderation.Result, 0, len(texts))
+	for _, item := range moderationResp.Results {
+		result := make(moderation.Result)
+		mergeCategoryScores(result, item.CategoryScores)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// MaxBatchSize returns the number of texts sent per moderation request
+func (m *Moderator) MaxBatchSize() int {
+	return MaxBatchSize
+}
+
+// HealthCheck validates the endpoint, API key and model by looking up the
+// configured model, which does not consume moderation quota
+func (m *Moderator) HealthCheck(ctx context.Context) error {
+	endpoint := strings.TrimSuffix(m.config.Endpoint, "/") + ModelsEndpoint + url.PathEscape(m.config.Model)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return errors.Wrap(err, "error creating health check request")
+	}
+	addRequestHeaders(req, m.config)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return moderation.RequestError(errors.Wrap(err, "OpenAI health check failed"))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return moderation.NewError(moderation.StatusErrorKind(resp.StatusCode), errors.Errorf("OpenAI health check returned status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	return nil
+}
+
+func makeModerationRequest(ctx context.Context, config *moderation.Config, text string) (*http.Request, error) {
+	return newRequest(ctx, config, ModerationRequest{
+		Input: text,
+		Model: config.Model,
+	})
+}
+
+// newRequest creates a moderation request with the body encoded as JSON
+func newRequest(ctx context.Context, config *moderation.Config, reqBody any) (*http.Request, error) {
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling request")
+	}
+
+	endpoint := strings.TrimSuffix(config.Endpoint, "/") + ModerationsEndpoint
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+
+	return req, nil
+}
+
+// addRequestHeaders adds the required headers to the request
+func addRequestHeaders(req *http.Request, config *moderation.Config) {
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+config.APIKey)
+	if config.Organization != "" {
+		req.Header.Set("OpenAI-Organization", config.Organization)
+	}
+}
+
+// parseResponseBody parses the response body into a structured ModerationResponse
+func parseResponseBody(responseBody io.Reader) (*ModerationResponse, error) {
+	var moderationResp ModerationResponse
+	if err := json.NewDecoder(responseBody).Decode(&moderationResp); err != nil {
+		return nil, moderation.NewError(moderation.ErrorDecode, errors.Wrap(err, "error decoding API response"))
+	}
+	return &moderationResp, nil
+}
+
+// convertToModerationResult converts API response to moderation.Result,
+// keeping the highest severity seen for each parent category
+func convertToModerationResult(resp *ModerationResponse) moderation.Result {
+	result := make(moderation.Result)
+	for _, item := range resp.Results {
+		mergeCategoryScores(result, item.CategoryScores)
+	}
+	return result
+}
+
+// mergeCategoryScores adds the severities of the category scores to the
+// result under the canonical category of their parent, keeping the highest
+// severity seen for each
+func mergeCategoryScores(result moderation.Result, scores map[string]float64) {
+	for category, score := range scores {
+		parent, _, _ := strings.Cut(category, "/")
+		canonical, ok := CategoryMapping.Lookup(parent)
+		if !ok {
+			continue
+		}
+		if severity := moderation.ScaleScore(score); severity >= result[canonical] {
+			result[canonical] = severity
+		}
+	}
+}
+
+// sendRequest sends a request to the OpenAI API and parses the response
+func sendRequest(client *http.Client, config *moderation.Config, req *http.Request) (*ModerationResponse, error) {
+	addRequestHeaders(req, config)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, moderation.RequestError(errors.Wrap(err, "error calling OpenAI moderation API"))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, e := io.ReadAll(resp.Body)
+		if e != nil {
+			return nil, moderation.RequestError(errors.Wrapf(e, "failed to read error response body (status code: %d)", resp.StatusCode))
+		}
+		return nil, moderation.NewError(moderation.StatusErrorKind(resp.StatusCode), errors.Errorf("OpenAI API returned status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	return parseResponseBody(resp.Body)
+}
@@ -0,0 +1,221 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("Missing API key", func(t *testing.T) {
+		mod, err := New(&moderation.Config{})
+		assert.Error(t, err)
+		assert.Nil(t, mod)
+	})
+
+	t.Run("Defaults applied", func(t *testing.T) {
+		mod, err := New(&moderation.Config{APIKey: "key"})
+		require.NoError(t, err)
+		assert.Equal(t, DefaultEndpoint, mod.config.Endpoint)
+		assert.Equal(t, DefaultModel, mod.config.Model)
+	})
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Run("Model is available", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, http.MethodGet, r.Method)
+			assert.Equal(t, ModelsEndpoint+DefaultModel, r.URL.Path)
+			assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"id":"omni-moderation-latest","object":"model"}`))
+		}))
+		defer server.Close()
+
+		mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+		require.NoError(t, err)
+		assert.NoError(t, mod.HealthCheck(context.Background()))
+	})
+
+	t.Run("Invalid API key", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":"invalid_api_key"}}`))
+		}))
+		defer server.Close()
+
+		mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+		require.NoError(t, err)
+
+		err = mod.HealthCheck(context.Background())
+		assert.ErrorContains(t, err, "status 401")
+		kind, ok := moderation.KindOf(err)
+		require.True(t, ok)
+		assert.Equal(t, moderation.ErrorAuth, kind)
+	})
+}
+
+func TestModerateText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, ModerationsEndpoint, r.URL.Path)
+		assert.Equal(t, "Bearer key", r.Header.Get("Authorization"))
+		assert.Equal(t, "org", r.Header.Get("OpenAI-Organization"))
+
+		var req ModerationRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "some text", req.Input)
+
+		_, _ = w.Write([]byte(`{"results":[{"flagged":true,"category_scores":{
+			"hate":0.1,"hate/threatening":0.7,"harassment":0.0,"sexual":0.02,
+			"violence":1.0,"self-harm":0.5,"illicit":0.9}}]}`))
+	}))
+	defer server.Close()
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key", Organization: "org"})
+	require.NoError(t, err)
+
+	result, err := mod.ModerateText(context.Background(), "some text")
+	require.NoError(t, err)
+	// Subcategories are folded into their parent, every category is reported
+	// under its canonical name, and categories without one are ignored
+	assert.Equal(t, moderation.Result{
+		moderation.CategoryHate:       4,
+		moderation.CategoryHarassment: 0,
+		moderation.CategorySexual:     0,
+		moderation.CategoryViolence:   6,
+		moderation.CategorySelfHarm:   3,
+	}, result)
+}
+
+func TestModerateTextErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+	require.NoError(t, err)
+
+	_, err = mod.ModerateText(context.Background(), "some text")
+	assert.ErrorContains(t, err, "status 429")
+}
+
+func TestModerateTextErrorKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		kind     moderation.ErrorKind
+	}{
+		{"Invalid API key", http.StatusUnauthorized, "invalid key", moderation.ErrorAuth},
+		{"Forbidden", http.StatusForbidden, "forbidden", moderation.ErrorAuth},
+		{"Rate limited", http.StatusTooManyRequests, "rate limited", moderation.ErrorRateLimit},
+		{"Gateway timeout", http.StatusGatewayTimeout, "timeout", moderation.ErrorTimeout},
+		{"Server error", http.StatusInternalServerError, "internal error", moderation.ErrorTransport},
+		{"Malformed response", http.StatusOK, "{not json", moderation.ErrorDecode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+			require.NoError(t, err)
+
+			_, err = mod.ModerateText(context.Background(), "some text")
+			kind, ok := moderation.KindOf(err)
+			require.True(t, ok, err)
+			assert.Equal(t, tt.kind, kind)
+		})
+	}
+
+	t.Run("Unreachable endpoint", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+
+		mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+		require.NoError(t, err)
+
+		_, err = mod.ModerateText(context.Background(), "some text")
+		kind, _ := moderation.KindOf(err)
+		assert.Equal(t, moderation.ErrorTransport, kind)
+	})
+}
+
+func TestModerateTexts(t *testing.T) {
+	scores := map[string]string{
+		"hateful":  `{"flagged":true,"category_scores":{"hate":0.9,"violence":0.1}}`,
+		"violent":  `{"flagged":true,"category_scores":{"hate":0.0,"violence/graphic":0.8}}`,
+		"harmless": `{"flagged":false,"category_scores":{"hate":0.0,"violence":0.0}}`,
+	}
+
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		// A single text is sent as a string and a batch as an array
+		var req struct {
+			Input json.RawMessage `json:"input"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		var texts []string
+		if err := json.Unmarshal(req.Input, &texts); err != nil {
+			var text string
+			require.NoError(t, json.Unmarshal(req.Input, &text))
+			texts = []string{text}
+		}
+
+		results := make([]string, 0, len(texts))
+		for _, text := range texts {
+			results = append(results, scores[text])
+		}
+		_, _ = w.Write([]byte(`{"results":[` + strings.Join(results, ",") + `]}`))
+	}))
+	defer server.Close()
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+	require.NoError(t, err)
+
+	texts := []string{"hateful", "harmless", "violent"}
+	results, err := mod.ModerateTexts(context.Background(), texts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+	assert.Equal(t, []moderation.Result{
+		{moderation.CategoryHate: 5, moderation.CategoryViolence: 1},
+		{moderation.CategoryHate: 0, moderation.CategoryViolence: 0},
+		{moderation.CategoryHate: 0, moderation.CategoryViolence: 5},
+	}, results)
+
+	// The batch gives the same results as moderating each text on its own
+	for i, text := range texts {
+		result, err := mod.ModerateText(context.Background(), text)
+		require.NoError(t, err)
+		assert.Equal(t, results[i], result, text)
+	}
+}
+
+func TestModerateTextsMissingResults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"results":[{"flagged":false,"category_scores":{"hate":0.0}}]}`))
+	}))
+	defer server.Close()
+
+	mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+	require.NoError(t, err)
+
+	_, err = mod.ModerateTexts(context.Background(), []string{"one", "two"})
+	assert.EqualError(t, err, "OpenAI API returned 1 results for 2 texts")
+	kind, _ := moderation.KindOf(err)
+	assert.Equal(t, moderation.ErrorDecode, kind)
+}
@@ -0,0 +1,212 @@
+package perspective
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultEndpoint is the Perspective API base URL used when no endpoint is configured
+	DefaultEndpoint = "https://commentanalyzer.googleapis.com"
+
+	// CommentsAnalyzeEndpoint is the Perspective comment analysis API path
+	CommentsAnalyzeEndpoint = "/v1alpha1/comments:analyze"
+
+	// healthCheckText is the text analyzed to verify the API key
+	healthCheckText = "health check"
+)
+
+// These constants define the Perspective attributes most relevant to moderation
+const (
+	AttributeToxicity       = "TOXICITY"
+	AttributeSevereToxicity = "SEVERE_TOXICITY"
+	AttributeInsult         = "INSULT"
+	AttributeIdentityAttack = "IDENTITY_ATTACK"
+	AttributeProfanity      = "PROFANITY"
+	AttributeThreat         = "THREAT"
+
+	// AttributeSexuallyExplicit is experimental and only available in English
+	AttributeSexuallyExplicit = "SEXUALLY_EXPLICIT"
+)
+
+// AttributeMapping maps the Perspective attributes onto the canonical
+// categories reported by the moderator. Attributes measuring general
+// toxicity rather than a specific kind of harm are reported as
+// moderation.CategoryOther, like any attribute the mapping does not know.
+var AttributeMapping = moderation.CategoryMapping{
+	"toxicity":          moderation.CategoryOther,
+	"severe_toxicity":   moderation.CategoryOther,
+	"profanity":         moderation.CategoryOther,
+	"insult":            moderation.CategoryHarassment,
+	"identity_attack":   moderation.CategoryHate,
+	"threat":            moderation.CategoryViolence,
+	"sexually_explicit": moderation.CategorySexual,
+}
+
+// DefaultAttributes are requested when no attributes are configured
+var DefaultAttributes = []string{AttributeToxicity, AttributeSevereToxicity, AttributeInsult}
+
+// Ensure Moderator implements the moderation.Moderator interface
+var _ moderation.Moderator = (*Moderator)(nil)
+
+// Moderator implements the Google Perspective API for text moderation
+type Moderator struct {
+	// client is the HTTP client for API requests
+	client *http.Client
+
+	// config holds the Perspective moderator configuration
+	config *moderation.Config
+}
+
+// AnalyzeRequest represents the request structure for Perspective comment analysis
+type AnalyzeRequest struct {
+	Comment struct {
+		Text string `json:"text"`
+	} `json:"comment"`
+	Languages           []string            `json:"languages,omitempty"`
+	RequestedAttributes map[string]struct{} `json:"requestedAttributes"`
+	DoNotStore          bool                `json:"doNotStore"`
+}
+
+// AnalyzeResponse represents the response from the Perspective API
+type AnalyzeResponse struct {
+	AttributeScores map[string]struct {
+		SummaryScore struct {
+			Value float64 `json:"value"`
+		} `json:"summaryScore"`
+	} `json:"attributeScores"`
+}
+
+// New creates a new Perspective API moderator
+func New(config *moderation.Config) (*Moderator, error) {
+	if config.APIKey == "" {
+		return nil, errors.New("API key is required")
+	}
+
+	resolved := *config
+	if resolved.Endpoint == "" {
+		resolved.Endpoint = DefaultEndpoint
+	}
+
+	if len(resolved.Categories) == 0 {
+		resolved.Categories = DefaultAttributes
+	}
+
+	return &Moderator{
+		client: &http.Client{},
+		config: &resolved,
+	}, nil
+}
+
+// ModerateText analyzes text content using the Perspective API
+func (m *Moderator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	req, err := makeAnalyzeRequest(ctx, m.config, text)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create moderation request")
+	}
+
+	result, err := sendRequest(m.client, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to moderate text content")
+	}
+
+	return result, nil
+}
+
+// HealthCheck validates the API key by analyzing a short text
+func (m *Moderator) HealthCheck(ctx context.Context) error {
+	if _, err := m.ModerateText(ctx, healthCheckText); err != nil {
+		return errors.Wrap(err, "Perspective API health check failed")
+	}
+	return nil
+}
+
+func makeAnalyzeRequest(ctx context.Context, config *moderation.Config, text string) (*http.Request, error) {
+	// Leaving languages unset asks Perspective to auto-detect the language
+	reqBody := AnalyzeRequest{
+		Languages:           config.Languages,
+		RequestedAttributes: make(map[string]struct{}, len(config.Categories)),
+		DoNotStore:          true,
+	}
+	reqBody.Comment.Text = text
+	for _, attribute := range config.Categories {
+		reqBody.RequestedAttributes[strings.ToUpper(attribute)] = struct{}{}
+	}
+
+	jsonBody, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling request")
+	}
+
+	endpoint := strings.TrimSuffix(config.Endpoint, "/") + CommentsAnalyzeEndpoint
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+
+	// Pass the key as a header rather than a query parameter so it never
+	// appears in logged request URLs
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goog-Api-Key", config.APIKey)
+
+	return req, nil
+}
+
+// parseResponseBody parses the response body into a structured AnalyzeResponse
+func parseResponseBody(responseBody io.Reader) (*AnalyzeResponse, error) {
+	var analyzeResp AnalyzeResponse
+	if err := json.NewDecoder(responseBody).Decode(&analyzeResp); err != nil {
+		return nil, moderation.NewError(moderation.ErrorDecode, errors.Wrap(err, "error decoding API response"))
+	}
+	return &analyzeResp, nil
+}
+
+// convertToModerationResult converts API response to moderation.Result,
+// reporting each attribute under its canonical category
+func convertToModerationResult(resp *AnalyzeResponse) moderation.Result {
+	result := make(moderation.Result)
+	for attribute, score := range resp.AttributeScores {
+		result[attribute] = moderation.ScaleScore(score.SummaryScore.Value)
+	}
+	return AttributeMapping.Normalize(result)
+}
+
+// statusErrorKind returns the kind of failure reported by a non-successful
+// response. Google APIs reject an invalid key with a 400 rather than a 401.
+func statusErrorKind(statusCode int, body string) moderation.ErrorKind {
+	if statusCode == http.StatusBadRequest && strings.Contains(body, "API_KEY_INVALID") {
+		return moderation.ErrorAuth
+	}
+	return moderation.StatusErrorKind(statusCode)
+}
+
+// sendRequest sends a request to the Perspective API and processes the response
+func sendRequest(client *http.Client, req *http.Request) (moderation.Result, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, moderation.RequestError(errors.Wrap(err, "error calling Perspective API"))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, e := io.ReadAll(resp.Body)
+		if e != nil {
+			return nil, moderation.RequestError(errors.Wrapf(e, "failed to read error response body (status code: %d)", resp.StatusCode))
+		}
+		return nil, moderation.NewError(statusErrorKind(resp.StatusCode, string(body)), errors.Errorf("Perspective API returned status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	analyzeResp, err := parseResponseBody(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return convertToModerationResult(analyzeResp), nil
+}
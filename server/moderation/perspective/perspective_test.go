@@ -0,0 +1,160 @@
+package perspective
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModerateText(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    moderation.Config
+		languages []string
+		requested []string
+	}{
+		{
+			name:      "Default attributes with language auto-detection",
+			config:    moderation.Config{APIKey: "key"},
+			languages: nil,
+			requested: DefaultAttributes,
+		},
+		{
+			name: "Configured attributes and languages",
+			config: moderation.Config{
+				APIKey:     "key",
+				Categories: []string{"threat"},
+				Languages:  []string{"en", "de"},
+			},
+			languages: []string{"en", "de"},
+			requested: []string{AttributeThreat},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, CommentsAnalyzeEndpoint, r.URL.Path)
+				assert.Equal(t, "key", r.Header.Get("X-Goog-Api-Key"))
+
+				var req AnalyzeRequest
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, "some text", req.Comment.Text)
+				assert.Equal(t, tt.languages, req.Languages)
+				assert.Len(t, req.RequestedAttributes, len(tt.requested))
+				for _, attribute := range tt.requested {
+					assert.Contains(t, req.RequestedAttributes, attribute)
+				}
+
+				_, _ = w.Write([]byte(`{"attributeScores":{"TOXICITY":{"summaryScore":{"value":0.84}}}}`))
+			}))
+			defer server.Close()
+
+			config := tt.config
+			config.Endpoint = server.URL
+			mod, err := New(&config)
+			require.NoError(t, err)
+
+			result, err := mod.ModerateText(context.Background(), "some text")
+			require.NoError(t, err)
+			assert.Equal(t, moderation.Result{moderation.CategoryOther: 5}, result)
+		})
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Run("Provider responds", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, CommentsAnalyzeEndpoint, r.URL.Path)
+			assert.Equal(t, "key", r.Header.Get("X-Goog-Api-Key"))
+			_, _ = w.Write([]byte(`{"attributeScores":{"TOXICITY":{"summaryScore":{"value":0.01}}}}`))
+		}))
+		defer server.Close()
+
+		mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+		require.NoError(t, err)
+		assert.NoError(t, mod.HealthCheck(context.Background()))
+	})
+
+	t.Run("Permission denied", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte("permission denied"))
+		}))
+		defer server.Close()
+
+		mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+		require.NoError(t, err)
+
+		err = mod.HealthCheck(context.Background())
+		assert.ErrorContains(t, err, "Perspective API health check failed")
+		kind, ok := moderation.KindOf(err)
+		require.True(t, ok)
+		assert.Equal(t, moderation.ErrorAuth, kind)
+	})
+}
+
+func TestModerateTextErrorKinds(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		kind     moderation.ErrorKind
+	}{
+		{"Invalid API key", http.StatusBadRequest, `{"error":{"code":400,"details":[{"reason":"API_KEY_INVALID"}]}}`, moderation.ErrorAuth},
+		{"Unsupported language", http.StatusBadRequest, `{"error":{"code":400,"message":"language not supported"}}`, moderation.ErrorTransport},
+		{"Permission denied", http.StatusForbidden, "permission denied", moderation.ErrorAuth},
+		{"Quota exceeded", http.StatusTooManyRequests, "quota exceeded", moderation.ErrorRateLimit},
+		{"Gateway timeout", http.StatusGatewayTimeout, "timeout", moderation.ErrorTimeout},
+		{"Service unavailable", http.StatusServiceUnavailable, "unavailable", moderation.ErrorTransport},
+		{"Malformed response", http.StatusOK, "{not json", moderation.ErrorDecode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			mod, err := New(&moderation.Config{Endpoint: server.URL, APIKey: "key"})
+			require.NoError(t, err)
+
+			_, err = mod.ModerateText(context.Background(), "some text")
+			kind, ok := moderation.KindOf(err)
+			require.True(t, ok, err)
+			assert.Equal(t, tt.kind, kind)
+		})
+	}
+}
+
+func TestConvertToModerationResult(t *testing.T) {
+	var resp AnalyzeResponse
+	require.NoError(t, json.Unmarshal([]byte(`{"attributeScores":{
+		"TOXICITY":{"summaryScore":{"value":0.5}},
+		"SEVERE_TOXICITY":{"summaryScore":{"value":0.2}},
+		"PROFANITY":{"summaryScore":{"value":0.9}},
+		"INSULT":{"summaryScore":{"value":0.7}},
+		"IDENTITY_ATTACK":{"summaryScore":{"value":0.84}},
+		"THREAT":{"summaryScore":{"value":0.0}},
+		"SEXUALLY_EXPLICIT":{"summaryScore":{"value":0.34}},
+		"FLIRTATION":{"summaryScore":{"value":1.0}}
+	}}`), &resp))
+
+	// Attributes mapping to the same category keep the highest severity, and
+	// attributes without a mapping are reported as other
+	assert.Equal(t, moderation.Result{
+		moderation.CategoryOther:      6,
+		moderation.CategoryHarassment: 4,
+		moderation.CategoryHate:       5,
+		moderation.CategoryViolence:   0,
+		moderation.CategorySexual:     2,
+	}, convertToModerationResult(&resp))
+}
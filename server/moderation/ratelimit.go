@@ -0,0 +1,32 @@
+package moderation
+
+import "time"
+
+// RateLimit describes the request quota a provider reported in its most
+// recent response
+type RateLimit struct {
+	// Limit is the number of requests allowed in the current window, or -1
+	// when the provider did not report it
+	Limit int
+
+	// Remaining is the number of requests left in the current window, or -1
+	// when the provider did not report it
+	Remaining int
+
+	// ResumeAt is when the provider accepts requests again after throttling.
+	// It is zero when the provider has not throttled any request.
+	ResumeAt time.Time
+}
+
+// UnknownRateLimit returns a RateLimit for a provider that has not reported
+// its quota
+func UnknownRateLimit() RateLimit {
+	return RateLimit{Limit: -1, Remaining: -1}
+}
+
+// RateLimitReporter is implemented by moderators that track the rate limits
+// reported by their provider
+type RateLimitReporter interface {
+	// RateLimit returns the latest rate limit reported by the provider
+	RateLimit() RateLimit
+}
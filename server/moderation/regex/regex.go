@@ -0,0 +1,129 @@
+package regex
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidRule is returned when a rule cannot be parsed or compiled
+var ErrInvalidRule = errors.New("invalid regex moderation rule")
+
+// Ensure Moderator implements the moderation.Moderator interface
+var _ moderation.Moderator = (*Moderator)(nil)
+
+// Rule defines a single pattern and the severity reported when it matches
+type Rule struct {
+	// Category is the result category reported for a match
+	Category string
+
+	// Severity is the severity reported for a match
+	Severity int
+
+	// Pattern is the regular expression to match against the text
+	Pattern string
+}
+
+// Config defines the configuration for the regex moderator
+type Config struct {
+	// Rules is the list of rules evaluated against every message
+	Rules []Rule
+}
+
+type compiledRule struct {
+	category string
+	severity int
+	pattern  *regexp.Regexp
+}
+
+// Moderator flags text matching admin-defined regular expressions
+type Moderator struct {
+	// rules holds the compiled moderation rules
+	rules []compiledRule
+}
+
+// New creates a new regex moderator, rejecting any rule that does not compile
+func New(config *Config) (*Moderator, error) {
+	if len(config.Rules) == 0 {
+		return nil, errors.Wrap(ErrInvalidRule, "at least one rule is required")
+	}
+
+	rules := make([]compiledRule, 0, len(config.Rules))
+	for i, rule := range config.Rules {
+		if rule.Category == "" {
+			return nil, errors.Wrapf(ErrInvalidRule, "rule %d is missing a category", i+1)
+		}
+		if rule.Severity < 0 || rule.Severity > moderation.MaxSeverity {
+			return nil, errors.Wrapf(ErrInvalidRule, "rule %d severity %d is outside the range 0-%d", i+1, rule.Severity, moderation.MaxSeverity)
+		}
+
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidRule, "rule %d pattern '%s' does not compile: %s", i+1, rule.Pattern, err.Error())
+		}
+
+		rules = append(rules, compiledRule{
+			category: rule.Category,
+			severity: rule.Severity,
+			pattern:  pattern,
+		})
+	}
+
+	return &Moderator{
+		rules: rules,
+	}, nil
+}
+
+// ParseRules parses rules written one per line as "category,severity,pattern".
+// The pattern is everything after the second comma, so it may contain commas.
+// Blank lines are ignored.
+func ParseRules(value string) ([]Rule, error) {
+	var rules []Rule
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, ",", 3)
+		if len(parts) != 3 {
+			return nil, errors.Wrapf(ErrInvalidRule, "line %d must have the form category,severity,pattern", i+1)
+		}
+
+		severity, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, errors.Wrapf(ErrInvalidRule, "line %d has an invalid severity '%s'", i+1, parts[1])
+		}
+
+		rules = append(rules, Rule{
+			Category: strings.TrimSpace(parts[0]),
+			Severity: severity,
+			Pattern:  strings.TrimSpace(parts[2]),
+		})
+	}
+	return rules, nil
+}
+
+// HealthCheck always succeeds since the rules have no external dependencies
+func (m *Moderator) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// ModerateText runs every rule against the text and reports the highest
+// matched severity for each category
+func (m *Moderator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	result := make(moderation.Result)
+	for _, rule := range m.rules {
+		if _, ok := result[rule.category]; !ok {
+			result[rule.category] = 0
+		}
+		if rule.severity > result[rule.category] && rule.pattern.MatchString(text) {
+			result[rule.category] = rule.severity
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package regex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+	}{
+		{
+			name:  "No rules",
+			rules: nil,
+		},
+		{
+			name:  "Invalid pattern",
+			rules: []Rule{{Category: "pii", Severity: 6, Pattern: "(unclosed"}},
+		},
+		{
+			name:  "Missing category",
+			rules: []Rule{{Severity: 6, Pattern: "ssn"}},
+		},
+		{
+			name:  "Severity out of range",
+			rules: []Rule{{Category: "pii", Severity: 7, Pattern: "ssn"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mod, err := New(&Config{Rules: tt.rules})
+			assert.True(t, errors.Is(err, ErrInvalidRule))
+			assert.Nil(t, mod)
+		})
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("pii,6,(?i)\\bssn\\b\n\n  spam, 2 ,buy (now|today), cheap\n")
+	require.NoError(t, err)
+	assert.Equal(t, []Rule{
+		{Category: "pii", Severity: 6, Pattern: `(?i)\bssn\b`},
+		{Category: "spam", Severity: 2, Pattern: "buy (now|today), cheap"},
+	}, rules)
+
+	_, err = ParseRules("pii,high,ssn")
+	assert.True(t, errors.Is(err, ErrInvalidRule))
+
+	_, err = ParseRules("pii")
+	assert.True(t, errors.Is(err, ErrInvalidRule))
+}
+
+func TestModerateText(t *testing.T) {
+	mod, err := New(&Config{Rules: []Rule{
+		{Category: "pii", Severity: 6, Pattern: `(?i)\bssn\b`},
+		{Category: "spam", Severity: 2, Pattern: `(?i)buy now`},
+		{Category: "spam", Severity: 4, Pattern: `(?i)limited offer`},
+	}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		text     string
+		expected moderation.Result
+	}{
+		{
+			name:     "No match",
+			text:     "a lesson on classification",
+			expected: moderation.Result{"pii": 0, "spam": 0},
+		},
+		{
+			name:     "SSN flagged",
+			text:     "my SSN is in the doc",
+			expected: moderation.Result{"pii": 6, "spam": 0},
+		},
+		{
+			name:     "Max severity per category",
+			text:     "buy now, limited offer",
+			expected: moderation.Result{"pii": 0, "spam": 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := mod.ModerateText(context.Background(), tt.text)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
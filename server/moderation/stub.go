@@ -0,0 +1,74 @@
+package moderation
+
+import (
+	"context"
+	"sync"
+)
+
+// Ensure Func and Stub implement the Moderator interface
+var (
+	_ Moderator = Func(nil)
+	_ Moderator = (*Stub)(nil)
+)
+
+// Func adapts a function to the Moderator interface, so that a moderator can
+// be written inline without a provider. Its health check always succeeds.
+type Func func(ctx context.Context, text string) (Result, error)
+
+// ModerateText calls the function
+func (f Func) ModerateText(ctx context.Context, text string) (Result, error) {
+	return f(ctx, text)
+}
+
+// HealthCheck always succeeds
+func (f Func) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// Stub is a moderator returning canned results, for testing moderation
+// without a provider. It is safe for concurrent use.
+type Stub struct {
+	// Results maps texts to the result returned for them
+	Results map[string]Result
+
+	// Default is returned for texts missing from Results
+	Default Result
+
+	// Err, when set, is returned for every text instead of a result
+	Err error
+
+	// HealthErr is returned by the health check
+	HealthErr error
+
+	mu    sync.Mutex
+	texts []string
+}
+
+// ModerateText records the text and returns its canned result, or Err when
+// it is set
+func (s *Stub) ModerateText(ctx context.Context, text string) (Result, error) {
+	s.mu.Lock()
+	s.texts = append(s.texts, text)
+	s.mu.Unlock()
+
+	if s.Err != nil {
+		return nil, s.Err
+	}
+	if result, ok := s.Results[text]; ok {
+		return result, nil
+	}
+	return s.Default, nil
+}
+
+// HealthCheck returns HealthErr
+func (s *Stub) HealthCheck(ctx context.Context) error {
+	return s.HealthErr
+}
+
+// Texts returns the texts moderated so far, in the order they were received
+func (s *Stub) Texts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.texts...)
+}
@@ -0,0 +1,70 @@
+package moderation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunc(t *testing.T) {
+	moderator := Func(func(ctx context.Context, text string) (Result, error) {
+		if strings.Contains(text, "insult") {
+			return Result{CategoryHarassment: 4}, nil
+		}
+		return Result{CategoryHarassment: 0}, nil
+	})
+
+	result, err := moderator.ModerateText(context.Background(), "an insult")
+	require.NoError(t, err)
+	assert.Equal(t, Result{CategoryHarassment: 4}, result)
+	assert.NoError(t, moderator.HealthCheck(context.Background()))
+
+	// Decorators wrap it like any provider
+	chain, err := NewChain([]Moderator{moderator, &Stub{Default: Result{CategoryHate: 2}}}, false)
+	require.NoError(t, err)
+	result, err = chain.ModerateText(context.Background(), "hello")
+	require.NoError(t, err)
+	assert.Equal(t, Result{CategoryHarassment: 0, CategoryHate: 2}, result)
+}
+
+func TestStub(t *testing.T) {
+	t.Run("Canned results", func(t *testing.T) {
+		stub := &Stub{
+			Results: map[string]Result{"flagged": {CategoryViolence: 6}},
+			Default: Result{CategoryViolence: 0},
+		}
+
+		result, err := stub.ModerateText(context.Background(), "flagged")
+		require.NoError(t, err)
+		assert.Equal(t, Result{CategoryViolence: 6}, result)
+
+		result, err = stub.ModerateText(context.Background(), "anything else")
+		require.NoError(t, err)
+		assert.Equal(t, Result{CategoryViolence: 0}, result)
+
+		assert.Equal(t, []string{"flagged", "anything else"}, stub.Texts())
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		stub := &Stub{Err: errors.New("service unavailable"), HealthErr: errors.New("unauthorized")}
+
+		_, err := stub.ModerateText(context.Background(), "text")
+		assert.EqualError(t, err, "service unavailable")
+		assert.EqualError(t, stub.HealthCheck(context.Background()), "unauthorized")
+		assert.Equal(t, []string{"text"}, stub.Texts())
+	})
+
+	t.Run("Fallback to a stub", func(t *testing.T) {
+		moderator := Fallback(&Stub{Err: errors.New("service unavailable")}, &Stub{Default: Result{"blocklist": 6}})
+
+		ctx := ReportFallback(context.Background())
+		result, err := moderator.ModerateText(ctx, "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"blocklist": 6}, result)
+		assert.True(t, FellBack(ctx))
+	})
+}
@@ -0,0 +1,92 @@
+package moderation
+
+import (
+	"context"
+	"time"
+)
+
+// Ensure TimeoutModerator implements the Moderator, TextLengthLimiter,
+// RateLimitReporter and BatchModerator interfaces
+var (
+	_ Moderator         = (*TimeoutModerator)(nil)
+	_ TextLengthLimiter = (*TimeoutModerator)(nil)
+	_ RateLimitReporter = (*TimeoutModerator)(nil)
+	_ BatchModerator    = (*TimeoutModerator)(nil)
+	_ ImageModerator    = (*timeoutImageModerator)(nil)
+)
+
+// TimeoutModerator bounds every request to another moderator by a timeout,
+// so that one slow provider cannot use up the time allowed for a post
+type TimeoutModerator struct {
+	inner   Moderator
+	timeout time.Duration
+}
+
+// timeoutImageModerator is returned for moderators that also moderate images
+type timeoutImageModerator struct {
+	*TimeoutModerator
+	imageModerator ImageModerator
+}
+
+// WithTimeout wraps the moderator so that each request is canceled after the
+// timeout. The returned moderator implements ImageModerator when inner does.
+func WithTimeout(inner Moderator, timeout time.Duration) Moderator {
+	moderator := &TimeoutModerator{inner: inner, timeout: timeout}
+	if imageModerator, ok := inner.(ImageModerator); ok {
+		return &timeoutImageModerator{TimeoutModerator: moderator, imageModerator: imageModerator}
+	}
+	return moderator
+}
+
+// ModerateText moderates the text with the wrapped moderator within the timeout
+func (t *TimeoutModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.inner.ModerateText(ctx, text)
+}
+
+// ModerateTexts moderates the texts with the wrapped moderator. The timeout
+// covers every request needed for the texts.
+func (t *TimeoutModerator) ModerateTexts(ctx context.Context, texts []string) ([]Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return ModerateTexts(ctx, t.inner, texts)
+}
+
+// HealthCheck checks the wrapped moderator within the timeout
+func (t *TimeoutModerator) HealthCheck(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.inner.HealthCheck(ctx)
+}
+
+// MaxTextLength returns the text length limit of the wrapped moderator, or 0
+// when it has none
+func (t *TimeoutModerator) MaxTextLength() int {
+	if limiter, ok := t.inner.(TextLengthLimiter); ok {
+		return limiter.MaxTextLength()
+	}
+	return 0
+}
+
+// RateLimit returns the rate limit of the wrapped moderator, or an unknown
+// rate limit when it does not report one
+func (t *TimeoutModerator) RateLimit() RateLimit {
+	if reporter, ok := t.inner.(RateLimitReporter); ok {
+		return reporter.RateLimit()
+	}
+	return UnknownRateLimit()
+}
+
+// MaxBatchSize returns the batch size of the wrapped moderator, or 0 when it
+// does not moderate texts in batches
+func (t *TimeoutModerator) MaxBatchSize() int {
+	return MaxBatchSize(t.inner)
+}
+
+// ModerateImage moderates the image with the wrapped moderator within the timeout
+func (t *timeoutImageModerator) ModerateImage(ctx context.Context, data []byte) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return t.imageModerator.ModerateImage(ctx, data)
+}
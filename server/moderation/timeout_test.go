@@ -0,0 +1,65 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slowModerator blocks until its context is canceled
+type slowModerator struct{}
+
+func (m *slowModerator) ModerateText(ctx context.Context, text string) (Result, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (m *slowModerator) HealthCheck(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestWithTimeout(t *testing.T) {
+	t.Run("Requests are canceled at the timeout", func(t *testing.T) {
+		moderator := WithTimeout(&slowModerator{}, 50*time.Millisecond)
+
+		start := time.Now()
+		_, err := moderator.ModerateText(context.Background(), "text")
+		elapsed := time.Since(start)
+
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.GreaterOrEqual(t, elapsed, 50*time.Millisecond)
+		assert.Less(t, elapsed, time.Second)
+
+		assert.ErrorIs(t, moderator.HealthCheck(context.Background()), context.DeadlineExceeded)
+	})
+
+	t.Run("A shorter caller deadline still applies", func(t *testing.T) {
+		moderator := WithTimeout(&slowModerator{}, time.Hour)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		_, err := moderator.ModerateText(ctx, "text")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("Fast requests are not affected", func(t *testing.T) {
+		moderator := WithTimeout(&staticModerator{result: Result{"hate": 2}}, time.Second)
+
+		result, err := moderator.ModerateText(context.Background(), "text")
+		require.NoError(t, err)
+		assert.Equal(t, Result{"hate": 2}, result)
+	})
+
+	t.Run("Image support is preserved", func(t *testing.T) {
+		_, ok := WithTimeout(&staticModerator{}, time.Second).(ImageModerator)
+		assert.False(t, ok)
+
+		_, ok = WithTimeout(&imageStaticModerator{}, time.Second).(ImageModerator)
+		assert.True(t, ok)
+	})
+}
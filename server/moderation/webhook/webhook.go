@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/pkg/errors"
+)
+
+// DefaultCategoriesPath is the response path used when no path is configured
+const DefaultCategoriesPath = "categories"
+
+// maxErrorBodySize limits how much of an error response is included in errors
+const maxErrorBodySize = 1024
+
+// Ensure Moderator implements the moderation.Moderator interface
+var _ moderation.Moderator = (*Moderator)(nil)
+
+// Config defines the configuration for the webhook moderator
+type Config struct {
+	// URL is the endpoint that receives moderation requests
+	URL string
+
+	// Token is an optional bearer token sent with every request
+	Token string
+
+	// CategoriesPath is the dot-separated path to the object in the response
+	// that maps category names to severities, for example "result.scores"
+	CategoriesPath string
+}
+
+// Moderator sends text to a custom HTTP service for moderation
+type Moderator struct {
+	// client is the HTTP client for API requests
+	client *http.Client
+
+	// config holds the webhook moderator configuration
+	config *Config
+}
+
+// Request represents the request body sent to the webhook
+type Request struct {
+	Text string `json:"text"`
+}
+
+// New creates a new webhook moderator
+func New(config *Config) (*Moderator, error) {
+	if config.URL == "" {
+		return nil, errors.New("webhook URL is required")
+	}
+
+	parsed, err := url.Parse(config.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, errors.Errorf("webhook URL '%s' must be an absolute http or https URL", config.URL)
+	}
+
+	resolved := *config
+	if resolved.CategoriesPath == "" {
+		resolved.CategoriesPath = DefaultCategoriesPath
+	}
+
+	return &Moderator{
+		client: &http.Client{},
+		config: &resolved,
+	}, nil
+}
+
+// ModerateText sends the text to the webhook and parses the returned severities
+func (m *Moderator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	jsonBody, err := json.Marshal(Request{Text: text})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.config.URL, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create moderation request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.config.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.config.Token)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, moderation.RequestError(errors.Wrap(err, "error calling moderation webhook"))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		body, e := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		if e != nil {
+			return nil, moderation.RequestError(errors.Wrapf(e, "failed to read error response body (status code: %d)", resp.StatusCode))
+		}
+		return nil, moderation.NewError(moderation.StatusErrorKind(resp.StatusCode), errors.Errorf("moderation webhook returned status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	var body any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, moderation.NewError(moderation.ErrorDecode, errors.Wrap(err, "error decoding webhook response"))
+	}
+
+	result, err := extractResult(body, m.config.CategoriesPath)
+	if err != nil {
+		return nil, moderation.NewError(moderation.ErrorDecode, err)
+	}
+	return result, nil
+}
+
+// HealthCheck always succeeds since custom services have no standard way of
+// being checked without moderating real content
+func (m *Moderator) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// extractResult walks the categories path and converts the object found there
+// into a moderation.Result
+func extractResult(body any, path string) (moderation.Result, error) {
+	current := body
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil, errors.Errorf("webhook response has no object at '%s'", path)
+		}
+		if current, ok = object[key]; !ok {
+			return nil, errors.Errorf("webhook response is missing '%s'", path)
+		}
+	}
+
+	categories, ok := current.(map[string]any)
+	if !ok {
+		return nil, errors.Errorf("webhook response '%s' is not an object", path)
+	}
+
+	result := make(moderation.Result, len(categories))
+	for category, value := range categories {
+		severity, ok := value.(float64)
+		if !ok {
+			return nil, errors.Errorf("webhook response severity for '%s' is not a number", category)
+		}
+		result[category] = int(math.Round(severity))
+	}
+	return result, nil
+}
@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(&Config{})
+	assert.Error(t, err)
+
+	_, err = New(&Config{URL: "not a url"})
+	assert.Error(t, err)
+
+	mod, err := New(&Config{URL: "https://moderation.example.com/check"})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultCategoriesPath, mod.config.CategoriesPath)
+}
+
+func TestModerateText(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		status       int
+		response     string
+		expected     moderation.Result
+		errorMessage string
+		kind         moderation.ErrorKind
+	}{
+		{
+			name:     "Default path",
+			status:   http.StatusOK,
+			response: `{"categories":{"toxic":4,"spam":0}}`,
+			expected: moderation.Result{"toxic": 4, "spam": 0},
+		},
+		{
+			name:     "Nested path",
+			path:     "result.scores",
+			status:   http.StatusOK,
+			response: `{"result":{"scores":{"toxic":5.6}}}`,
+			expected: moderation.Result{"toxic": 6},
+		},
+		{
+			name:         "Missing path",
+			status:       http.StatusOK,
+			response:     `{"scores":{"toxic":4}}`,
+			errorMessage: "missing 'categories'",
+			kind:         moderation.ErrorDecode,
+		},
+		{
+			name:         "Non-numeric severity",
+			status:       http.StatusOK,
+			response:     `{"categories":{"toxic":"high"}}`,
+			errorMessage: "not a number",
+			kind:         moderation.ErrorDecode,
+		},
+		{
+			name:         "Non-2xx response",
+			status:       http.StatusServiceUnavailable,
+			response:     `down for maintenance`,
+			errorMessage: "status 503",
+			kind:         moderation.ErrorTransport,
+		},
+		{
+			name:         "Rejected token",
+			status:       http.StatusUnauthorized,
+			response:     `invalid token`,
+			errorMessage: "status 401",
+			kind:         moderation.ErrorAuth,
+		},
+		{
+			name:         "Throttled",
+			status:       http.StatusTooManyRequests,
+			response:     `slow down`,
+			errorMessage: "status 429",
+			kind:         moderation.ErrorRateLimit,
+		},
+		{
+			name:         "Malformed response",
+			status:       http.StatusOK,
+			response:     `{not json`,
+			errorMessage: "error decoding webhook response",
+			kind:         moderation.ErrorDecode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+				var req Request
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				assert.Equal(t, "some text", req.Text)
+
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			mod, err := New(&Config{URL: server.URL, Token: "secret", CategoriesPath: tt.path})
+			require.NoError(t, err)
+
+			result, err := mod.ModerateText(context.Background(), "some text")
+			if tt.errorMessage != "" {
+				assert.ErrorContains(t, err, tt.errorMessage)
+				kind, _ := moderation.KindOf(err)
+				assert.Equal(t, tt.kind, kind)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestModerateTextHonorsContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(500 * time.Millisecond):
+		}
+	}))
+	defer server.Close()
+
+	mod, err := New(&Config{URL: server.URL})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = mod.ModerateText(ctx, "some text")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	kind, _ := moderation.KindOf(err)
+	assert.Equal(t, moderation.ErrorTimeout, kind)
+}
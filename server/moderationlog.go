@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const moderationLogTitle = "#### Content moderation event"
+
+// logModerationEvent posts a summary of the moderation event to the
+// moderation log channel, when one is configured. Failures are logged so that
+// they never prevent the other notifications.
+func (p *PostProcessor) logModerationEvent(api plugin.API, post *model.Post, categories moderation.Result, decision moderation.Decision) {
+	if p.notifications.logChannelID == "" {
+		return
+	}
+
+	if _, appErr := api.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: p.notifications.logChannelID,
+		Message:   p.moderationLogMessage(api, post, categories, decision, time.Now()),
+	}); appErr != nil {
+		api.LogError("Failed to post to the moderation log channel", append(p.policy.loggedIDs("post_id", post.Id), "err", errors.Wrap(appErr, "failed to create post"))...)
+	}
+}
+
+// moderationLogMessage formats the moderation event as a Markdown table. The
+// severity of every category in the result is included when the severity
+// breakdown is enabled, along with how the decision was reached when it is
+// known.
+func (p *PostProcessor) moderationLogMessage(api plugin.API, post *model.Post, categories moderation.Result, decision moderation.Decision, at time.Time) string {
+	user := fmt.Sprintf("`%s`", post.UserId)
+	if u, appErr := api.GetUser(post.UserId); appErr == nil {
+		user = fmt.Sprintf("@%s (`%s`)", u.Username, post.UserId)
+	}
+
+	channel := fmt.Sprintf("`%s`", post.ChannelId)
+	if c, appErr := api.GetChannel(post.ChannelId); appErr == nil {
+		channel = fmt.Sprintf("~%s (`%s`)", c.Name, post.ChannelId)
+	}
+
+	action := p.action.action
+	if p.action.monitorOnly {
+		action = fmt.Sprintf("none, monitor only (would %s)", p.action.action)
+	}
+
+	rows := [][2]string{
+		{"User", user},
+		{"Channel", channel},
+		{"Action", action},
+		{"Categories", categories.String()},
+	}
+	if len(decision.Result) > 0 && p.notifications.logSeverityBreakdown {
+		rows = append(rows, [2]string{"Severity breakdown", decision.String()})
+	}
+	if len(decision.Providers) > 0 {
+		rows = append(rows, [2]string{"Providers", strings.Join(decision.Providers, ", ")})
+	}
+	if decision.Language != "" {
+		rows = append(rows, [2]string{"Language", decision.Language})
+	}
+	if decision.BlocklistMatched() {
+		rows = append(rows, [2]string{"Blocklist match", "yes"})
+	}
+	if decision.Degraded {
+		rows = append(rows, [2]string{"Coverage", "reduced, the fallback provider checked the post while the configured providers failed"})
+	}
+	rows = append(rows, [2]string{"Time", at.UTC().Format(time.RFC3339)})
+
+	// Deleted posts can no longer be opened, so only link to posts that remain
+	if p.action.monitorOnly || p.action.action != moderationActionDelete {
+		rows = append(rows, [2]string{"Post", postPermalink(api, post.Id)})
+	}
+
+	var b strings.Builder
+	b.WriteString(moderationLogTitle + "\n\n| Field | Value |\n|:--|:--|\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "| %s | %s |\n", row[0], row[1])
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestModerationLogMessage(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+	categories := moderation.Result{"Violence": 4, "Hate": 6}
+	at := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	t.Run("Delete", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+		api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+
+		processor := &PostProcessor{action: &flaggedPostAction{action: moderationActionDelete}}
+
+		expected := "#### Content moderation event\n\n" +
+			"| Field | Value |\n" +
+			"|:--|:--|\n" +
+			"| User | @alice (`user1`) |\n" +
+			"| Channel | ~town-square (`channel1`) |\n" +
+			"| Action | delete |\n" +
+			"| Categories | Hate: 6, Violence: 4 |\n" +
+			"| Time | 2025-03-14T15:09:26Z |"
+		assert.Equal(t, expected, processor.moderationLogMessage(api, post, categories, moderation.Decision{}, at))
+	})
+
+	t.Run("Flag links to the post and falls back to IDs", func(t *testing.T) {
+		siteURL := "https://chat.example.com"
+		notFound := model.NewAppError("GetUser", "app.user.missing", nil, "", http.StatusNotFound)
+
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(nil, notFound)
+		api.On("GetChannel", "channel1").Return(nil, notFound)
+		api.On("GetConfig").Return(&model.Config{ServiceSettings: model.ServiceSettings{SiteURL: &siteURL}})
+
+		processor := &PostProcessor{action: &flaggedPostAction{action: moderationActionFlag}}
+
+		message := processor.moderationLogMessage(api, post, categories, moderation.Decision{}, at)
+		assert.Contains(t, message, "| User | `user1` |")
+		assert.Contains(t, message, "| Channel | `channel1` |")
+		assert.Contains(t, message, "| Action | flag |")
+		assert.Contains(t, message, "| Post | https://chat.example.com/_redirect/pl/post1 |")
+	})
+
+	t.Run("Severity breakdown includes categories below the threshold", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+		api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+
+		processor := &PostProcessor{
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{logSeverityBreakdown: true},
+		}
+
+		decision := moderation.Decision{Result: moderation.Result{"Violence": 4, "Hate": 6, "Sexual": 3, "SelfHarm": 0}}
+		message := processor.moderationLogMessage(api, post, categories, decision, at)
+		assert.Contains(t, message, "| Categories | Hate: 6, Violence: 4 |\n"+
+			"| Severity breakdown | Hate: 6, SelfHarm: 0, Sexual: 3, Violence: 4 |\n"+
+			"| Time | 2025-03-14T15:09:26Z |")
+
+		processor.notifications.logSeverityBreakdown = false
+		assert.NotContains(t, processor.moderationLogMessage(api, post, categories, decision, at), "Severity breakdown")
+	})
+
+	t.Run("How the decision was reached", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+		api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+
+		processor := &PostProcessor{
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{},
+		}
+
+		decision := moderation.Decision{Result: moderation.Result{"blocklist": 6, "Hate": 0}, Providers: []string{"blocklist", "azure"}, Language: "fr"}
+		assert.Contains(t, processor.moderationLogMessage(api, post, moderation.Result{"blocklist": 6}, decision, at),
+			"| Categories | blocklist: 6 |\n"+
+				"| Providers | blocklist, azure |\n"+
+				"| Language | fr |\n"+
+				"| Blocklist match | yes |\n"+
+				"| Time | 2025-03-14T15:09:26Z |")
+	})
+}
+
+func TestLogModerationEvent(t *testing.T) {
+	logChannelID := model.NewId()
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+	t.Run("Skipped without a log channel", func(t *testing.T) {
+		api := &plugintest.API{}
+
+		processor := &PostProcessor{botID: "bot", notifications: &notificationSettings{}}
+		processor.logModerationEvent(api, post, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("Failure does not prevent other notifications", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+		api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == logChannelID && strings.HasPrefix(p.Message, moderationLogTitle)
+		})).Return(nil, model.NewAppError("CreatePost", "app.post.save.app_error", nil, "", http.StatusInternalServerError))
+		api.On("LogError", "Failed to post to the moderation log channel", "post_id", "post1", "err", mock.Anything).Return()
+		api.On("DeletePost", "post1").Return(nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1"
+		})).Return(&model.Post{}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm"
+		})).Return(&model.Post{}, nil)
+
+		processor := &PostProcessor{
+			botID:         "bot",
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{dmContentMode: dmContentCategories, logChannelID: logChannelID},
+		}
+		processor.handleFlaggedPost(api, post, moderation.Result{"Hate": 4}, moderation.Decision{})
+
+		api.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// notificationCooldown limits the notifications about a user's flagged posts
+// to one channel notice and one DM per cooldown window, so that a burst of
+// flagged posts does not flood the channel and the user's DMs. The posts are
+// still moderated as usual. Suppressed notifications are counted and the
+// count is included in the user's next DM. The cooldown is kept in memory, so
+// each server in a cluster applies it separately. All methods are safe to
+// call on a nil cooldown, which never suppresses notifications.
+type notificationCooldown struct {
+	window time.Duration
+
+	// now returns the current time and is replaced in tests
+	now func() time.Time
+
+	mu        sync.Mutex
+	users     map[string]*userCooldown
+	lastSweep time.Time
+}
+
+// userCooldown tracks the notifications of a user
+type userCooldown struct {
+	notifiedAt time.Time
+	suppressed int
+}
+
+// newNotificationCooldown returns a cooldown of the given window, or nil when
+// the window is not positive
+func newNotificationCooldown(window time.Duration) *notificationCooldown {
+	if window <= 0 {
+		return nil
+	}
+
+	return &notificationCooldown{
+		window: window,
+		now:    time.Now,
+		users:  make(map[string]*userCooldown),
+	}
+}
+
+// notify reports whether the user may be notified about another flagged post.
+// When they may, it also returns the number of notifications suppressed since
+// the user was last notified.
+func (c *notificationCooldown) notify(userID string) (bool, int) {
+	if c == nil {
+		return true, 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.sweep(now)
+
+	user, ok := c.users[userID]
+	if !ok {
+		c.users[userID] = &userCooldown{notifiedAt: now}
+		return true, 0
+	}
+
+	if now.Sub(user.notifiedAt) < c.window {
+		user.suppressed++
+		return false, 0
+	}
+
+	suppressed := user.suppressed
+	user.notifiedAt = now
+	user.suppressed = 0
+	return true, suppressed
+}
+
+// sweep forgets the users whose cooldown has ended without suppressing
+// anything, at most once per window
+func (c *notificationCooldown) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.window {
+		return
+	}
+	c.lastSweep = now
+
+	for userID, user := range c.users {
+		if user.suppressed == 0 && now.Sub(user.notifiedAt) >= c.window {
+			delete(c.users, userID)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestNotificationCooldown(t *testing.T) {
+	now := time.Date(2025, 3, 14, 15, 0, 0, 0, time.UTC)
+	cooldown := newNotificationCooldown(time.Minute)
+	cooldown.now = func() time.Time { return now }
+
+	notify := func(userID string) []any {
+		allowed, suppressed := cooldown.notify(userID)
+		return []any{allowed, suppressed}
+	}
+
+	assert.Equal(t, []any{true, 0}, notify("user1"))
+	assert.Equal(t, []any{false, 0}, notify("user1"))
+	assert.Equal(t, []any{true, 0}, notify("user2"), "each user has their own cooldown")
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, []any{false, 0}, notify("user1"))
+
+	// The first notification after the cooldown counts the suppressed ones
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, []any{true, 2}, notify("user1"))
+	assert.Equal(t, []any{false, 0}, notify("user1"))
+
+	// Users without suppressed notifications are forgotten once their cooldown ends
+	now = now.Add(time.Minute)
+	notify("user3")
+	assert.NotContains(t, cooldown.users, "user2")
+	assert.Contains(t, cooldown.users, "user1")
+
+	var unset *notificationCooldown
+	allowed, suppressed := unset.notify("user1")
+	assert.True(t, allowed)
+	assert.Zero(t, suppressed)
+	assert.Nil(t, newNotificationCooldown(0))
+}
+
+func TestFlaggedPostBurstNotifications(t *testing.T) {
+	now := time.Date(2025, 3, 14, 15, 0, 0, 0, time.UTC)
+	cooldown := newNotificationCooldown(time.Minute)
+	cooldown.now = func() time.Time { return now }
+
+	api := &plugintest.API{}
+	api.On("GetConfig").Return(&model.Config{})
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+	api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("DeletePost", mock.Anything).Return(nil)
+	api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+	api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+	processor := &PostProcessor{
+		botID:         "bot",
+		action:        &flaggedPostAction{action: moderationActionDelete},
+		notifications: &notificationSettings{dmContentMode: dmContentNone, cooldown: cooldown},
+	}
+
+	flag := func(i int) {
+		post := &model.Post{Id: fmt.Sprintf("post%d", i), UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+		processor.handleFlaggedPost(api, post, moderation.Result{"Hate": 4}, moderation.Decision{})
+	}
+
+	createdIn := func(channelID string) []string {
+		var messages []string
+		for _, call := range api.Calls {
+			if call.Method != "CreatePost" {
+				continue
+			}
+			if post := call.Arguments.Get(0).(*model.Post); post.ChannelId == channelID {
+				messages = append(messages, post.Message)
+			}
+		}
+		return messages
+	}
+
+	// Every post of the burst is deleted, but only one notice and DM are sent
+	for i := range 5 {
+		flag(i)
+	}
+	api.AssertNumberOfCalls(t, "DeletePost", 5)
+	assert.Len(t, createdIn("channel1"), 1)
+	assert.Equal(t, []string{"_Your post was flagged and removed._"}, createdIn("dm"))
+
+	// The next DM after the cooldown counts the skipped notifications
+	now = now.Add(time.Minute)
+	flag(5)
+	assert.Len(t, createdIn("channel1"), 2)
+	dms := createdIn("dm")
+	assert.Len(t, dms, 2)
+	assert.True(t, strings.HasSuffix(dms[1], "_4 more of your posts were flagged since your last notification._"), dms[1])
+}
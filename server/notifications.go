@@ -0,0 +1,399 @@
+package main
+
+import (
+	stderrors "errors"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// contentPlaceholder marks where DM templates include the flagged content
+const contentPlaceholder = "%s"
+
+const defaultLocale = "en"
+
+// How much of a flagged post is echoed back to its author in the DM
+const (
+	dmContentFull       = "full"
+	dmContentPreview    = "preview"
+	dmContentCategories = "categories"
+	dmContentNone       = "none"
+)
+
+const defaultDMPreviewLength = 50
+
+// notificationMessages holds the notifications sent for flagged posts in one
+// language. The DM messages other than the WithoutContent variants contain a
+// placeholder for the flagged content, categories a placeholder for the list
+// of flagged categories, and suppressed a placeholder for the number of
+// notifications suppressed by the cooldown.
+type notificationMessages struct {
+	channel                  string
+	dm                       string
+	dmRedacted               string
+	dmWithoutContent         string
+	dmRedactedWithoutContent string
+	dmReaction               string
+	dmProfile                string
+	pendingDeletion          string
+	dmWarning                string
+	dmWarningWithoutContent  string
+	dmUnavailable            string
+	policyNotice             string
+	acknowledgePolicy        string
+	policyAcknowledged       string
+	policyOutdated           string
+	categories               string
+	suppressed               string
+}
+
+// notificationTranslations maps Mattermost locales to their notifications
+var notificationTranslations = map[string]notificationMessages{
+	"en": {
+		channel:                  "_A post with potentially offensive content was flagged and removed._",
+		dm:                       "_Your post with the following content was flagged and removed:_\n\n%s",
+		dmRedacted:               "_Your post with the following content was flagged and redacted:_\n\n%s",
+		dmWithoutContent:         "_Your post was flagged and removed._",
+		dmRedactedWithoutContent: "_Your post was flagged and redacted._",
+		dmReaction:               "_Your reaction was flagged and removed._",
+		dmProfile:                "_Your username or nickname was flagged and changed back._",
+		pendingDeletion:          "_Your post was flagged and will be removed shortly unless a moderator keeps it._",
+		dmWarning:                "_Your post with the following content may be inappropriate. It was not removed, but please consider editing it:_\n\n%s",
+		dmWarningWithoutContent:  "_Your post may be inappropriate. It was not removed, but please consider editing it._",
+		dmUnavailable:            "_Your post could not be checked by content moderation and was removed. Please try posting it again later._",
+		policyNotice:             "_Please read the content moderation policy below and acknowledge it._",
+		acknowledgePolicy:        "I acknowledge",
+		policyAcknowledged:       "_You acknowledged the moderation policy below._",
+		policyOutdated:           "This moderation policy was replaced by a newer version, which you will be asked to acknowledge instead.",
+		categories:               "Flagged categories: %s",
+		suppressed:               "_%s more of your posts were flagged since your last notification._",
+	},
+	"de": {
+		channel:                  "_Ein Beitrag mit potenziell anstößigem Inhalt wurde markiert und entfernt._",
+		dm:                       "_Dein Beitrag mit folgendem Inhalt wurde markiert und entfernt:_\n\n%s",
+		dmRedacted:               "_Dein Beitrag mit folgendem Inhalt wurde markiert und geschwärzt:_\n\n%s",
+		dmWithoutContent:         "_Dein Beitrag wurde markiert und entfernt._",
+		dmRedactedWithoutContent: "_Dein Beitrag wurde markiert und geschwärzt._",
+		dmReaction:               "_Deine Reaktion wurde markiert und entfernt._",
+		dmProfile:                "_Dein Benutzername oder Spitzname wurde markiert und zurückgesetzt._",
+		pendingDeletion:          "_Dein Beitrag wurde markiert und wird in Kürze entfernt, sofern ihn kein Moderator behält._",
+		dmWarning:                "_Dein Beitrag mit folgendem Inhalt ist möglicherweise unangemessen. Er wurde nicht entfernt, aber bitte überlege, ihn zu bearbeiten:_\n\n%s",
+		dmWarningWithoutContent:  "_Dein Beitrag ist möglicherweise unangemessen. Er wurde nicht entfernt, aber bitte überlege, ihn zu bearbeiten._",
+		dmUnavailable:            "_Dein Beitrag konnte von der Inhaltsmoderation nicht geprüft werden und wurde entfernt. Bitte versuche es später erneut._",
+		policyNotice:             "_Bitte lies die folgenden Richtlinien zur Inhaltsmoderation und bestätige sie._",
+		acknowledgePolicy:        "Bestätigen",
+		policyAcknowledged:       "_Du hast die folgenden Richtlinien zur Inhaltsmoderation bestätigt._",
+		policyOutdated:           "Diese Richtlinien wurden durch eine neuere Version ersetzt, die du stattdessen bestätigen sollst.",
+		categories:               "Markierte Kategorien: %s",
+		suppressed:               "_Seit deiner letzten Benachrichtigung wurden %s weitere deiner Beiträge markiert._",
+	},
+	"es": {
+		channel:                  "_Se marcó y eliminó una publicación con contenido potencialmente ofensivo._",
+		dm:                       "_Tu publicación con el siguiente contenido fue marcada y eliminada:_\n\n%s",
+		dmRedacted:               "_Tu publicación con el siguiente contenido fue marcada y ocultada:_\n\n%s",
+		dmWithoutContent:         "_Tu publicación fue marcada y eliminada._",
+		dmRedactedWithoutContent: "_Tu publicación fue marcada y ocultada._",
+		dmReaction:               "_Tu reacción fue marcada y eliminada._",
+		dmProfile:                "_Tu nombre de usuario o apodo fue marcado y restablecido._",
+		pendingDeletion:          "_Tu publicación fue marcada y se eliminará en breve, a menos que un moderador la conserve._",
+		dmWarning:                "_Tu publicación con el siguiente contenido podría ser inapropiada. No fue eliminada, pero considera editarla:_\n\n%s",
+		dmWarningWithoutContent:  "_Tu publicación podría ser inapropiada. No fue eliminada, pero considera editarla._",
+		dmUnavailable:            "_Tu publicación no pudo ser revisada por la moderación de contenido y fue eliminada. Inténtalo de nuevo más tarde._",
+		policyNotice:             "_Lee la política de moderación de contenido a continuación y confirma que la has leído._",
+		acknowledgePolicy:        "Confirmo",
+		policyAcknowledged:       "_Confirmaste la política de moderación a continuación._",
+		policyOutdated:           "Esta política de moderación fue reemplazada por una versión más reciente, que se te pedirá confirmar en su lugar.",
+		categories:               "Categorías marcadas: %s",
+		suppressed:               "_Desde tu última notificación se marcaron %s publicaciones más tuyas._",
+	},
+	"fr": {
+		channel:                  "_Une publication au contenu potentiellement offensant a été signalée et supprimée._",
+		dm:                       "_Votre publication avec le contenu suivant a été signalée et supprimée :_\n\n%s",
+		dmRedacted:               "_Votre publication avec le contenu suivant a été signalée et masquée :_\n\n%s",
+		dmWithoutContent:         "_Votre publication a été signalée et supprimée._",
+		dmRedactedWithoutContent: "_Votre publication a été signalée et masquée._",
+		dmReaction:               "_Votre réaction a été signalée et supprimée._",
+		dmProfile:                "_Votre nom d'utilisateur ou pseudo a été signalé et rétabli._",
+		pendingDeletion:          "_Votre message a été signalé et sera bientôt supprimé, sauf si un modérateur le conserve._",
+		dmWarning:                "_Votre publication avec le contenu suivant pourrait être inappropriée. Elle n'a pas été supprimée, mais pensez à la modifier :_\n\n%s",
+		dmWarningWithoutContent:  "_Votre publication pourrait être inappropriée. Elle n'a pas été supprimée, mais pensez à la modifier._",
+		dmUnavailable:            "_Votre publication n'a pas pu être vérifiée par la modération de contenu et a été supprimée. Veuillez réessayer plus tard._",
+		policyNotice:             "_Veuillez lire la politique de modération de contenu ci-dessous et en accuser réception._",
+		acknowledgePolicy:        "J'ai pris connaissance",
+		policyAcknowledged:       "_Vous avez accusé réception de la politique de modération ci-dessous._",
+		policyOutdated:           "Cette politique de modération a été remplacée par une version plus récente, dont il vous sera demandé d'accuser réception à la place.",
+		categories:               "Catégories signalées : %s",
+		suppressed:               "_%s autres de vos publications ont été signalées depuis votre dernière notification._",
+	},
+}
+
+// messagesForLocale returns the notifications for the locale, falling back to
+// the locale's language without its region and then to English
+func messagesForLocale(locale string) notificationMessages {
+	if messages, ok := notificationTranslations[locale]; ok {
+		return messages
+	}
+	if language, _, found := strings.Cut(locale, "-"); found {
+		if messages, ok := notificationTranslations[language]; ok {
+			return messages
+		}
+	}
+	return notificationTranslations[defaultLocale]
+}
+
+// notificationSettings holds the notification templates configured by the
+// admin. Empty templates fall back to the translated defaults.
+type notificationSettings struct {
+	channelTemplate string
+	dmTemplate      string
+	dmContentMode   string
+	dmPreviewLength int
+
+	// dmOnly notifies authors by direct message only, without posting a
+	// notice in the channel of the flagged post
+	dmOnly bool
+
+	// dmSeverities adds the severity of each flagged category to the
+	// categories listed in author notifications
+	dmSeverities bool
+
+	// logChannelID receives a summary of every moderation event when set
+	logChannelID string
+
+	// logSeverityBreakdown adds the severity of every category, including
+	// those below their thresholds, to the moderation log summaries
+	logSeverityBreakdown bool
+
+	// cooldown limits the notifications about each user's flagged posts, if set
+	cooldown *notificationCooldown
+
+	// policy is sent to authors along with their first notification, if set
+	policy *policyNotice
+}
+
+func newNotificationSettings(channelTemplate, dmTemplate, dmContentMode string, dmPreviewLength int, dmSeverities bool, logChannelID string, logSeverityBreakdown bool) (*notificationSettings, error) {
+	channelTemplate = strings.TrimSpace(channelTemplate)
+	dmTemplate = strings.TrimSpace(dmTemplate)
+
+	switch dmContentMode {
+	case "":
+		dmContentMode = dmContentPreview
+	case dmContentFull, dmContentPreview, dmContentCategories, dmContentNone:
+	default:
+		return nil, errors.Errorf("unknown DM content mode %q", dmContentMode)
+	}
+
+	// Without content there is nothing to substitute, so the placeholder is optional
+	if dmTemplate != "" && dmContentMode != dmContentNone && !strings.Contains(dmTemplate, contentPlaceholder) {
+		return nil, errors.Errorf("DM notification template must contain %s for the flagged content", contentPlaceholder)
+	}
+
+	if dmPreviewLength <= 0 {
+		dmPreviewLength = defaultDMPreviewLength
+	}
+
+	logChannelID = strings.TrimSpace(logChannelID)
+	if logChannelID != "" && !model.IsValidId(logChannelID) {
+		return nil, errors.Errorf("invalid moderation log channel ID %q", logChannelID)
+	}
+
+	return &notificationSettings{
+		channelTemplate: channelTemplate,
+		dmTemplate:      dmTemplate,
+		dmContentMode:   dmContentMode,
+		dmPreviewLength: dmPreviewLength,
+		dmSeverities:    dmSeverities,
+		logChannelID:    logChannelID,
+
+		logSeverityBreakdown: logSeverityBreakdown,
+	}, nil
+}
+
+// flaggedContent describes the flagged post for its author according to the
+// DM content mode
+func (n *notificationSettings) flaggedContent(messages notificationMessages, message string, categories moderation.Result) string {
+	switch n.dmContentMode {
+	case dmContentFull:
+		return message
+	case dmContentNone:
+		return ""
+	}
+
+	var parts []string
+	if len(categories) > 0 {
+		parts = append(parts, fillTemplate(messages.categories, n.categoryList(categories)))
+	}
+
+	if n.dmContentMode == dmContentPreview && message != "" {
+		parts = append(parts, "> "+truncate(strings.Join(strings.Fields(message), " "), n.dmPreviewLength))
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// categoryList lists the flagged categories, with their severities when
+// dmSeverities is set
+func (n *notificationSettings) categoryList(categories moderation.Result) string {
+	if n.dmSeverities {
+		return categories.String()
+	}
+
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, category)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// truncate shortens text to at most maxLength characters, marking the cut
+// with an ellipsis
+func truncate(text string, maxLength int) string {
+	if utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+	return string([]rune(text)[:maxLength]) + "…"
+}
+
+// fillTemplate replaces the content placeholder in the template. Unlike
+// fmt.Sprintf, any other % characters in admin templates are left intact.
+func fillTemplate(template, content string) string {
+	return strings.Replace(template, contentPlaceholder, content, 1)
+}
+
+// userLocale returns the locale of the user, or an empty string when the user
+// cannot be loaded
+func userLocale(api plugin.API, userID string) string {
+	user, appErr := api.GetUser(userID)
+	if appErr != nil {
+		api.LogWarn("Failed to get user locale for moderation notification", "user_id", userID, "err", appErr)
+		return ""
+	}
+	return user.Locale
+}
+
+// serverLocale returns the default locale of the server
+func serverLocale(api plugin.API) string {
+	if config := api.GetConfig(); config != nil && config.LocalizationSettings.DefaultServerLocale != nil {
+		return *config.LocalizationSettings.DefaultServerLocale
+	}
+	return ""
+}
+
+// reportModerationEvent notifies the channel that a post was removed, in the
+// server's default locale, unless only DMs are sent, and sends its author a
+// DM in the author's locale. Nothing is sent while the author's notification
+// cooldown is active. Each notification is attempted even when another one
+// fails, and the failures are returned together.
+func (p *PostProcessor) reportModerationEvent(api plugin.API, post *model.Post, categories moderation.Result) error {
+	notify, suppressed := p.notificationAllowed(api, post)
+	if !notify {
+		return nil
+	}
+
+	var errs []error
+
+	if !p.notifications.dmOnly {
+		channelMessage := p.notifications.channelTemplate
+		if channelMessage == "" {
+			channelMessage = messagesForLocale(serverLocale(api)).channel
+		}
+
+		if _, err := api.CreatePost(&model.Post{
+			UserId:    p.botID,
+			ChannelId: post.ChannelId,
+			RootId:    post.RootId,
+			Message:   channelMessage,
+		}); err != nil {
+			errs = append(errs, errors.Wrap(err, "failed to post channel notification"))
+		}
+	}
+
+	// Posts without an author, such as some made by integrations, have no one
+	// to send a DM to
+	if post.UserId == "" {
+		return stderrors.Join(errs...)
+	}
+
+	messages := messagesForLocale(userLocale(api, post.UserId))
+	dmTemplate := p.notifications.dmTemplate
+	if dmTemplate == "" {
+		dmTemplate = messages.dm
+		if p.notifications.dmContentMode == dmContentNone {
+			dmTemplate = messages.dmWithoutContent
+		}
+	}
+
+	if err := p.notifyAuthor(api, post, dmTemplate, messages, categories, suppressed); err != nil {
+		errs = append(errs, err)
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// warnAuthor sends the author of a post allowed with a warning a DM in the
+// author's locale. Authors are not warned in monitor-only mode or while their
+// notification cooldown is active.
+func (p *PostProcessor) warnAuthor(api plugin.API, post *model.Post, categories moderation.Result) {
+	if p.action.monitorOnly {
+		return
+	}
+
+	notify, suppressed := p.notificationAllowed(api, post)
+	if !notify {
+		return
+	}
+
+	messages := messagesForLocale(userLocale(api, post.UserId))
+	template := messages.dmWarning
+	if p.notifications.dmContentMode == dmContentNone {
+		template = messages.dmWarningWithoutContent
+	}
+
+	if err := p.notifyAuthor(api, post, template, messages, categories, suppressed); err != nil {
+		api.LogError("Failed to warn author of post", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+	}
+}
+
+// notificationAllowed reports whether the author of the flagged post may be
+// notified, along with the number of notifications suppressed since the
+// author was last notified
+func (p *PostProcessor) notificationAllowed(api plugin.API, post *model.Post) (bool, int) {
+	notify, suppressed := p.notifications.cooldown.notify(post.UserId)
+	if !notify {
+		api.LogDebug("Skipping notifications during the author's notification cooldown", p.policy.loggedIDs("post_id", post.Id, "user_id", post.UserId)...)
+	}
+	return notify, suppressed
+}
+
+// notifyAuthor sends the author of a flagged post a DM describing its content
+// as allowed by the DM content mode, along with the number of notifications
+// suppressed by the cooldown since the author was last notified. Authors who
+// were not sent the moderation policy yet receive it next.
+func (p *PostProcessor) notifyAuthor(api plugin.API, post *model.Post, template string, messages notificationMessages, categories moderation.Result, suppressed int) error {
+	dmChannel, err := api.GetDirectChannel(p.botID, post.UserId)
+	if err != nil {
+		return errors.Wrap(err, "failed to create DM channel")
+	}
+
+	message := strings.TrimSpace(fillTemplate(template, p.notifications.flaggedContent(messages, post.Message, categories)))
+	if suppressed > 0 {
+		message += "\n\n" + fillTemplate(messages.suppressed, strconv.Itoa(suppressed))
+	}
+
+	if _, err := api.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: dmChannel.Id,
+		Message:   message,
+	}); err != nil {
+		return errors.Wrap(err, "failed to send DM notification")
+	}
+
+	return p.notifications.policy.send(api, p.botID, post.UserId, dmChannel.Id, messages)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewNotificationSettings(t *testing.T) {
+	t.Run("Empty templates use translated defaults", func(t *testing.T) {
+		settings, err := newNotificationSettings("", "  ", "", 0, false, "", false)
+		require.NoError(t, err)
+		assert.Empty(t, settings.channelTemplate)
+		assert.Empty(t, settings.dmTemplate)
+		assert.Equal(t, dmContentPreview, settings.dmContentMode)
+		assert.Equal(t, defaultDMPreviewLength, settings.dmPreviewLength)
+		assert.False(t, settings.dmSeverities)
+	})
+
+	t.Run("Custom templates", func(t *testing.T) {
+		settings, err := newNotificationSettings("Post removed.", "Removed: %s", dmContentFull, 20, true, "", false)
+		require.NoError(t, err)
+		assert.Equal(t, "Post removed.", settings.channelTemplate)
+		assert.Equal(t, "Removed: %s", settings.dmTemplate)
+		assert.Equal(t, 20, settings.dmPreviewLength)
+		assert.True(t, settings.dmSeverities)
+	})
+
+	t.Run("DM template without placeholder is rejected", func(t *testing.T) {
+		_, err := newNotificationSettings("", "Your post was removed.", dmContentPreview, 0, false, "", false)
+		assert.Error(t, err)
+	})
+
+	t.Run("DM template without placeholder is allowed without content", func(t *testing.T) {
+		_, err := newNotificationSettings("", "Your post was removed.", dmContentNone, 0, false, "", false)
+		assert.NoError(t, err)
+	})
+
+	t.Run("Unknown DM content mode is rejected", func(t *testing.T) {
+		_, err := newNotificationSettings("", "", "verbatim", 0, false, "", false)
+		assert.Error(t, err)
+	})
+
+	t.Run("Invalid log channel is rejected", func(t *testing.T) {
+		_, err := newNotificationSettings("", "", "", 0, false, "town-square", false)
+		assert.Error(t, err)
+	})
+}
+
+func TestMessagesForLocale(t *testing.T) {
+	assert.Equal(t, notificationTranslations["fr"], messagesForLocale("fr"))
+	assert.Equal(t, notificationTranslations["es"], messagesForLocale("es-ES"))
+	assert.Equal(t, notificationTranslations["en"], messagesForLocale("ja"))
+	assert.Equal(t, notificationTranslations["en"], messagesForLocale(""))
+}
+
+func TestFillTemplate(t *testing.T) {
+	assert.Equal(t, "100% removed: bad words", fillTemplate("100% removed: %s", "bad words"))
+}
+
+func TestReportModerationEvent(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+	t.Run("French user receives translated DM", func(t *testing.T) {
+		serverLocale := "en"
+
+		api := &plugintest.API{}
+		api.On("GetConfig").Return(&model.Config{LocalizationSettings: model.LocalizationSettings{DefaultServerLocale: &serverLocale}})
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Locale: "fr"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1" &&
+				p.Message == "_A post with potentially offensive content was flagged and removed._"
+		})).Return(&model.Post{}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm" &&
+				p.Message == "_Votre publication avec le contenu suivant a été signalée et supprimée :_\n\nOffensive message"
+		})).Return(&model.Post{}, nil)
+
+		processor := &PostProcessor{botID: "bot", notifications: &notificationSettings{dmContentMode: dmContentFull}}
+		assert.NoError(t, processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4}))
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Configured templates override translations", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1" && p.Message == "Post removed."
+		})).Return(&model.Post{}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm" && p.Message == "Removed: Offensive message"
+		})).Return(&model.Post{}, nil)
+
+		processor := &PostProcessor{
+			botID:         "bot",
+			notifications: &notificationSettings{channelTemplate: "Post removed.", dmTemplate: "Removed: %s", dmContentMode: dmContentFull},
+		}
+		assert.NoError(t, processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4}))
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Channel notice is posted when the DM channel cannot be created", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(nil, model.NewAppError("GetDirectChannel", "app.channel.create_direct_channel.internal_error", nil, "", http.StatusInternalServerError))
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1" && p.Message == "Post removed."
+		})).Return(&model.Post{}, nil).Once()
+
+		processor := &PostProcessor{botID: "bot", notifications: &notificationSettings{channelTemplate: "Post removed."}}
+		err := processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4})
+
+		assert.ErrorContains(t, err, "failed to create DM channel")
+		api.AssertExpectations(t)
+	})
+
+	t.Run("DM is sent when the channel notice fails", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1"
+		})).Return(nil, model.NewAppError("CreatePost", "app.post.save.app_error", nil, "", http.StatusForbidden)).Once()
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm"
+		})).Return(nil, model.NewAppError("CreatePost", "app.post.save.app_error", nil, "", http.StatusInternalServerError)).Once()
+
+		processor := &PostProcessor{botID: "bot", notifications: &notificationSettings{channelTemplate: "Post removed.", dmTemplate: "Removed."}}
+		err := processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4})
+
+		assert.ErrorContains(t, err, "failed to post channel notification")
+		assert.ErrorContains(t, err, "failed to send DM notification")
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Direct message only mode skips the channel notice", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm" && p.Message == "Removed."
+		})).Return(&model.Post{}, nil).Once()
+
+		processor := &PostProcessor{botID: "bot", notifications: &notificationSettings{channelTemplate: "Post removed.", dmTemplate: "Removed.", dmOnly: true}}
+		assert.NoError(t, processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4}))
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Posts without an author only notify the channel", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1"
+		})).Return(&model.Post{}, nil).Once()
+
+		processor := &PostProcessor{botID: "bot", notifications: &notificationSettings{channelTemplate: "Post removed."}}
+		anonymous := &model.Post{Id: "post2", ChannelId: "channel1", Message: "Offensive message"}
+		assert.NoError(t, processor.reportModerationEvent(api, anonymous, moderation.Result{"Hate": 4}))
+
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "GetDirectChannel", mock.Anything, mock.Anything)
+	})
+}
+
+func TestFlaggedContent(t *testing.T) {
+	messages := notificationTranslations["en"]
+	message := "This   message\nis far too long to be echoed back in full"
+	categories := moderation.Result{"Violence": 4, "Hate": 6}
+
+	tests := []struct {
+		name       string
+		mode       string
+		severities bool
+		expected   string
+	}{
+		{name: "full", mode: dmContentFull, expected: message},
+		{name: "preview", mode: dmContentPreview, expected: "Flagged categories: Hate, Violence\n\n> This message is far…"},
+		{name: "categories", mode: dmContentCategories, expected: "Flagged categories: Hate, Violence"},
+		{name: "none", mode: dmContentNone, expected: ""},
+		{name: "preview with severities", mode: dmContentPreview, severities: true, expected: "Flagged categories: Hate: 6, Violence: 4\n\n> This message is far…"},
+		{name: "categories with severities", mode: dmContentCategories, severities: true, expected: "Flagged categories: Hate: 6, Violence: 4"},
+		{name: "none with severities", mode: dmContentNone, severities: true, expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := &notificationSettings{dmContentMode: tt.mode, dmPreviewLength: 19, dmSeverities: tt.severities}
+			assert.Equal(t, tt.expected, settings.flaggedContent(messages, message, categories))
+		})
+	}
+}
+
+func TestNotifyAuthorWithoutContent(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+	api := &plugintest.API{}
+	api.On("GetConfig").Return(&model.Config{})
+	api.On("GetUser", "user1").Return(&model.User{Id: "user1", Locale: "de"}, nil)
+	api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+	api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+		return p.ChannelId == "channel1"
+	})).Return(&model.Post{}, nil)
+	api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+		return p.ChannelId == "dm" && p.Message == "_Dein Beitrag wurde markiert und entfernt._"
+	})).Return(&model.Post{}, nil)
+
+	processor := &PostProcessor{botID: "bot", notifications: &notificationSettings{dmContentMode: dmContentNone}}
+	assert.NoError(t, processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4}))
+
+	api.AssertExpectations(t)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// pendingDeletionKeyPrefix prefixes the KV keys of flagged posts waiting
+	// for their grace period to end before they are deleted
+	pendingDeletionKeyPrefix = "pending_delete_"
+
+	// pendingDeletionEmoji is the reaction the bot adds to flagged posts
+	// during their grace period
+	pendingDeletionEmoji = "hourglass_flowing_sand"
+
+	// keepPostEmoji keeps a flagged post when a system admin reacts with it
+	// during the grace period
+	keepPostEmoji = "white_check_mark"
+)
+
+// pendingDeletion is a flagged post waiting for its grace period to end. It is
+// persisted so that the deletion survives a restart of the plugin.
+type pendingDeletion struct {
+	DeleteAt   int64             `json:"delete_at"`
+	Categories moderation.Result `json:"categories"`
+}
+
+// schedulePostDeletion marks the flagged post as pending deletion and deletes
+// it once the grace period ends, unless a moderator keeps it in between
+func (p *PostProcessor) schedulePostDeletion(api plugin.API, post *model.Post, categories moderation.Result) {
+	// A post edited during its grace period is flagged again, but keeps its
+	// original deadline
+	if _, found := p.loadPendingDeletion(api, post.Id); found {
+		return
+	}
+
+	deletion := pendingDeletion{
+		DeleteAt:   model.GetMillisForTime(time.Now().Add(p.deletionGracePeriod)),
+		Categories: categories,
+	}
+	if err := savePendingDeletion(api, post.Id, deletion); err != nil {
+		// Without a record the deletion would not survive a restart, so the
+		// post is deleted right away instead
+		api.LogError("Failed to persist pending deletion, deleting flagged post now", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+		p.deleteFlaggedPost(api, post, categories)
+		return
+	}
+
+	if err := p.markPendingDeletion(api, post); err != nil {
+		api.LogError("Failed to mark post as pending deletion", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+	}
+
+	api.LogInfo("Flagged post will be deleted once its grace period ends", append(p.policy.loggedIDs("post_id", post.Id), "grace_period", p.deletionGracePeriod.String())...)
+	p.startDeletionTimer(api, post.Id, p.deletionGracePeriod)
+}
+
+// markPendingDeletion adds the pending deletion reaction to the post, warns
+// its author and, when a review channel is configured, lets the moderators
+// know how to keep the post
+func (p *PostProcessor) markPendingDeletion(api plugin.API, post *model.Post) error {
+	if _, err := api.AddReaction(&model.Reaction{
+		UserId:    p.botID,
+		PostId:    post.Id,
+		EmojiName: pendingDeletionEmoji,
+		ChannelId: post.ChannelId,
+	}); err != nil {
+		return errors.Wrap(err, "failed to add pending deletion reaction")
+	}
+
+	api.SendEphemeralPost(post.UserId, &model.Post{
+		UserId:    p.botID,
+		ChannelId: post.ChannelId,
+		RootId:    post.RootId,
+		Message:   messagesForLocale(userLocale(api, post.UserId)).pendingDeletion,
+	})
+
+	if p.action.reviewChannelID == "" {
+		return nil
+	}
+	if _, err := api.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: p.action.reviewChannelID,
+		Message:   fmt.Sprintf(pendingDeletionNotificationTemplate, p.deletionGracePeriod, postPermalink(api, post.Id), post.Id),
+	}); err != nil {
+		return errors.Wrap(err, "failed to notify review channel")
+	}
+
+	return nil
+}
+
+// startDeletionTimer deletes the post once the delay passes. Timers are not
+// started once the processor is stopped, since the next processor resumes
+// every persisted deletion.
+func (p *PostProcessor) startDeletionTimer(api plugin.API, postID string, delay time.Duration) {
+	p.deletionsMu.Lock()
+	defer p.deletionsMu.Unlock()
+
+	if p.deletionsStopped {
+		return
+	}
+	if p.deletionTimers == nil {
+		p.deletionTimers = make(map[string]*time.Timer)
+	}
+	if timer, ok := p.deletionTimers[postID]; ok {
+		timer.Stop()
+	}
+
+	p.deletionTimers[postID] = time.AfterFunc(delay, func() {
+		p.deletionsMu.Lock()
+		delete(p.deletionTimers, postID)
+		stopped := p.deletionsStopped
+		p.deletionsMu.Unlock()
+
+		if !stopped {
+			p.deletePendingPost(api, postID)
+		}
+	})
+}
+
+// stopDeletionTimers stops the timers of every pending deletion, leaving the
+// persisted records for the next processor
+func (p *PostProcessor) stopDeletionTimers() {
+	p.deletionsMu.Lock()
+	defer p.deletionsMu.Unlock()
+
+	p.deletionsStopped = true
+	for postID, timer := range p.deletionTimers {
+		timer.Stop()
+		delete(p.deletionTimers, postID)
+	}
+}
+
+// deletePendingPost deletes a post whose grace period ended, unless its
+// deletion was canceled or the post was already deleted
+func (p *PostProcessor) deletePendingPost(api plugin.API, postID string) {
+	deletion, found := p.loadPendingDeletion(api, postID)
+	if !found {
+		return
+	}
+	p.removePendingDeletion(api, postID)
+
+	post, appErr := api.GetPost(postID)
+	if appErr != nil || post.DeleteAt != 0 {
+		return
+	}
+
+	p.deleteFlaggedPost(api, post, deletion.Categories)
+}
+
+// deleteFlaggedPost deletes the flagged post and notifies its channel and
+// author
+func (p *PostProcessor) deleteFlaggedPost(api plugin.API, post *model.Post, categories moderation.Result) {
+	if err := api.DeletePost(post.Id); err != nil {
+		api.LogError("Failed to delete post flagged by content moderation", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+	}
+
+	if err := p.reportModerationEvent(api, post, categories); err != nil {
+		api.LogError("Failed to report content moderation event", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+	}
+}
+
+// cancelPostDeletion keeps a post waiting for its grace period to end, and
+// reports whether a deletion was pending
+func (p *PostProcessor) cancelPostDeletion(api plugin.API, postID, userID string) bool {
+	if _, found := p.loadPendingDeletion(api, postID); !found {
+		return false
+	}
+	p.removePendingDeletion(api, postID)
+
+	p.deletionsMu.Lock()
+	if timer, ok := p.deletionTimers[postID]; ok {
+		timer.Stop()
+		delete(p.deletionTimers, postID)
+	}
+	p.deletionsMu.Unlock()
+
+	if appErr := api.RemoveReaction(&model.Reaction{
+		UserId:    p.botID,
+		PostId:    postID,
+		EmojiName: pendingDeletionEmoji,
+	}); appErr != nil {
+		api.LogError("Failed to remove pending deletion reaction", append(p.policy.loggedIDs("post_id", postID), "err", appErr)...)
+	}
+
+	api.LogInfo("Deletion of flagged post was canceled", p.policy.loggedIDs("post_id", postID, "user_id", userID)...)
+	return true
+}
+
+// keepPostByReaction cancels the deletion of a post when a system admin
+// reacts to it with the keep emoji during its grace period
+func (p *PostProcessor) keepPostByReaction(api plugin.API, reaction *model.Reaction) {
+	if reaction.EmojiName != keepPostEmoji || reaction.UserId == p.botID {
+		return
+	}
+	if !api.HasPermissionTo(reaction.UserId, model.PermissionManageSystem) {
+		return
+	}
+
+	p.cancelPostDeletion(api, reaction.PostId, reaction.UserId)
+}
+
+// resumePendingDeletions restarts the timers of the deletions left pending by
+// the previous processor or before the plugin restarted. Posts whose grace
+// period already ended are deleted right away.
+func (p *Plugin) resumePendingDeletions() {
+	processor := p.getProcessor()
+	if processor == nil {
+		return
+	}
+
+	postIDs, err := listPostIDsWithPrefix(p.API, pendingDeletionKeyPrefix)
+	if err != nil {
+		p.API.LogError("Failed to load pending deletions", "err", err)
+		return
+	}
+
+	now := time.Now()
+	for _, postID := range postIDs {
+		deletion, found := processor.loadPendingDeletion(p.API, postID)
+		if !found {
+			continue
+		}
+		processor.startDeletionTimer(p.API, postID, max(model.GetTimeForMillis(deletion.DeleteAt).Sub(now), 0))
+	}
+
+	if len(postIDs) > 0 {
+		p.API.LogInfo("Resumed pending deletions of flagged posts", "count", len(postIDs))
+	}
+}
+
+// loadPendingDeletion returns the pending deletion of the post, if any
+func (p *PostProcessor) loadPendingDeletion(api plugin.API, postID string) (pendingDeletion, bool) {
+	var deletion pendingDeletion
+
+	data, appErr := api.KVGet(pendingDeletionKeyPrefix + postID)
+	if appErr != nil {
+		api.LogError("Failed to load pending deletion", append(p.policy.loggedIDs("post_id", postID), "err", appErr)...)
+		return deletion, false
+	}
+	if data == nil {
+		return deletion, false
+	}
+	if err := json.Unmarshal(data, &deletion); err != nil {
+		api.LogError("Failed to decode pending deletion", append(p.policy.loggedIDs("post_id", postID), "err", err)...)
+		return deletion, false
+	}
+	return deletion, true
+}
+
+// savePendingDeletion persists the pending deletion of the post
+func savePendingDeletion(api plugin.API, postID string, deletion pendingDeletion) error {
+	data, err := json.Marshal(deletion)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode pending deletion")
+	}
+	if appErr := api.KVSet(pendingDeletionKeyPrefix+postID, data); appErr != nil {
+		return errors.Wrap(appErr, "failed to save pending deletion")
+	}
+	return nil
+}
+
+// removePendingDeletion removes the record of a pending deletion
+func (p *PostProcessor) removePendingDeletion(api plugin.API, postID string) {
+	if appErr := api.KVDelete(pendingDeletionKeyPrefix + postID); appErr != nil {
+		api.LogError("Failed to remove pending deletion", append(p.policy.loggedIDs("post_id", postID), "err", appErr)...)
+	}
+}
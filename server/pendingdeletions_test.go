@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPendingDeletion(t *testing.T) {
+	const (
+		postID          = "pppppppppppppppppppppppppp"
+		reviewChannelID = "rrrrrrrrrrrrrrrrrrrrrrrrrr"
+		key             = pendingDeletionKeyPrefix + postID
+	)
+	post := &model.Post{Id: postID, UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+	categories := moderation.Result{"Hate": 4}
+
+	newProcessor := func(gracePeriod time.Duration) *PostProcessor {
+		return &PostProcessor{
+			botID:               "bot",
+			action:              &flaggedPostAction{action: moderationActionDelete, reviewChannelID: reviewChannelID},
+			notifications:       &notificationSettings{dmContentMode: dmContentFull},
+			deletionGracePeriod: gracePeriod,
+		}
+	}
+
+	record := func(deleteAt time.Time) []byte {
+		data, err := json.Marshal(pendingDeletion{DeleteAt: model.GetMillisForTime(deleteAt), Categories: categories})
+		require.NoError(t, err)
+		return data
+	}
+
+	// expectMarked sets up the reaction, warning and review channel notice of
+	// a post entering its grace period
+	expectMarked := func(api *plugintest.API) {
+		api.On("KVGet", key).Return(nil, nil).Once()
+		api.On("KVSet", key, mock.Anything).Return(nil)
+		api.On("AddReaction", &model.Reaction{
+			UserId:    "bot",
+			PostId:    postID,
+			EmojiName: pendingDeletionEmoji,
+			ChannelId: "channel1",
+		}).Return(&model.Reaction{}, nil)
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Locale: "fr"}, nil)
+		api.On("SendEphemeralPost", "user1", &model.Post{
+			UserId:    "bot",
+			ChannelId: "channel1",
+			Message:   notificationTranslations["fr"].pendingDeletion,
+		}).Return(&model.Post{})
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == reviewChannelID
+		})).Return(&model.Post{}, nil)
+		api.On("LogInfo", "Flagged post will be deleted once its grace period ends", "post_id", postID, "grace_period", mock.Anything).Return()
+	}
+
+	// expectDeleted sets up the deletion of the post and its notifications,
+	// and returns a channel closed once its author is notified
+	expectDeleted := func(api *plugintest.API) <-chan struct{} {
+		notified := make(chan struct{})
+		api.On("KVDelete", key).Return(nil)
+		api.On("GetPost", postID).Return(post, nil)
+		api.On("DeletePost", postID).Return(nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1"
+		})).Return(&model.Post{}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "dm"
+		})).Run(func(mock.Arguments) { close(notified) }).Return(&model.Post{}, nil)
+		return notified
+	}
+
+	t.Run("Post is deleted once the grace period ends", func(t *testing.T) {
+		api := &plugintest.API{}
+		expectMarked(api)
+		api.On("KVGet", key).Return(record(time.Now()), nil)
+		deleted := expectDeleted(api)
+
+		newProcessor(100*time.Millisecond).handleFlaggedPost(api, post, categories, moderation.Decision{})
+		api.AssertNotCalled(t, "DeletePost", postID)
+
+		select {
+		case <-deleted:
+		case <-time.After(time.Second):
+			require.Fail(t, "flagged post was not deleted")
+		}
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Admin reaction cancels the deletion", func(t *testing.T) {
+		api := &plugintest.API{}
+		expectMarked(api)
+		api.On("KVGet", key).Return(record(time.Now().Add(time.Hour)), nil)
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("HasPermissionTo", "user2", model.PermissionManageSystem).Return(false)
+		api.On("KVDelete", key).Return(nil)
+		api.On("RemoveReaction", &model.Reaction{UserId: "bot", PostId: postID, EmojiName: pendingDeletionEmoji}).Return(nil)
+		api.On("LogInfo", "Deletion of flagged post was canceled", "post_id", postID, "user_id", "admin").Return()
+
+		processor := newProcessor(time.Hour)
+		processor.handleFlaggedPost(api, post, categories, moderation.Decision{})
+
+		// Other emoji and users without permission do not keep the post
+		processor.keepPostByReaction(api, &model.Reaction{UserId: "admin", PostId: postID, EmojiName: "thumbsup"})
+		processor.keepPostByReaction(api, &model.Reaction{UserId: "user2", PostId: postID, EmojiName: keepPostEmoji})
+		api.AssertNotCalled(t, "KVDelete", key)
+
+		processor.keepPostByReaction(api, &model.Reaction{UserId: "admin", PostId: postID, EmojiName: keepPostEmoji})
+		api.AssertCalled(t, "RemoveReaction", mock.Anything)
+		assert.Empty(t, processor.deletionTimers)
+		api.AssertNotCalled(t, "DeletePost", postID)
+	})
+
+	t.Run("Command cancels the deletion", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("KVGet", key).Return(record(time.Now().Add(time.Hour)), nil).Once()
+		api.On("KVGet", key).Return(nil, nil)
+		api.On("KVDelete", key).Return(nil)
+		api.On("RemoveReaction", mock.Anything).Return(nil)
+		api.On("LogInfo", "Deletion of flagged post was canceled", "post_id", postID, "user_id", "admin").Return()
+
+		processor := newProcessor(time.Hour)
+		processor.startDeletionTimer(api, postID, time.Hour)
+		p := &Plugin{processor: processor}
+		p.SetAPI(api)
+
+		run := func(command string) string {
+			resp, appErr := p.ExecuteCommand(nil, &model.CommandArgs{UserId: "admin", Command: command})
+			require.Nil(t, appErr)
+			return resp.Text
+		}
+
+		assert.Equal(t, "Post `"+postID+"` will not be deleted.", run("/moderation cancel-deletion https://chat.example.com/team/pl/"+postID))
+		assert.Empty(t, processor.deletionTimers)
+		assert.Equal(t, "No deletion is pending for post `"+postID+"`.", run("/moderation cancel-deletion "+postID))
+		assert.Equal(t, "post1 is not a post ID or link.", run("/moderation cancel-deletion post1"))
+	})
+
+	t.Run("Pending deletions resume after a restart", func(t *testing.T) {
+		const laterID = "llllllllllllllllllllllllll"
+
+		api := &plugintest.API{}
+		api.On("KVList", 0, kvListPageSize).Return([]string{key, pendingDeletionKeyPrefix + laterID, queuedPostKeyPrefix + "post2"}, nil)
+		api.On("KVGet", key).Return(record(time.Now().Add(-time.Minute)), nil)
+		api.On("KVGet", pendingDeletionKeyPrefix+laterID).Return(record(time.Now().Add(time.Hour)), nil)
+		api.On("LogInfo", "Resumed pending deletions of flagged posts", "count", 2).Return()
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetConfig").Return(&model.Config{})
+		deleted := expectDeleted(api)
+
+		processor := newProcessor(time.Hour)
+		p := &Plugin{processor: processor}
+		p.SetAPI(api)
+		p.resumePendingDeletions()
+
+		// The post whose grace period ended while stopped is deleted right
+		// away, and the other one waits for its deadline
+		assert.Eventually(t, func() bool {
+			processor.deletionsMu.Lock()
+			defer processor.deletionsMu.Unlock()
+			return len(processor.deletionTimers) == 1
+		}, time.Second, 5*time.Millisecond)
+		select {
+		case <-deleted:
+		case <-time.After(time.Second):
+			require.Fail(t, "flagged post was not deleted")
+		}
+		api.AssertNotCalled(t, "GetPost", laterID)
+
+		// Stopping the processor leaves the remaining deletion for the next one
+		processor.stopDeletionTimers()
+		assert.Empty(t, processor.deletionTimers)
+	})
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -11,6 +14,11 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
 	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/azure"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/blocklist"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/openai"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/perspective"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/regex"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/webhook"
 	"github.com/mattermost/mattermost-plugin-content-moderation/server/store/sqlstore"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin"
@@ -18,7 +26,17 @@ import (
 	"github.com/pkg/errors"
 )
 
-const moderationTimeout = 10 * time.Second
+const (
+	defaultModerationTimeout      = 10 * time.Second
+	minModerationTimeout          = 100 * time.Millisecond
+	defaultResultCacheTTL         = time.Hour
+	defaultCircuitBreakerFailures = 5
+	defaultCircuitBreakerCooldown = 30 * time.Second
+
+	// defaultFallbackThreshold replaces a threshold that cannot be parsed when
+	// no fallback threshold is configured
+	defaultFallbackThreshold = moderation.SeverityLow
+)
 
 type Plugin struct {
 	plugin.MattermostPlugin
@@ -26,8 +44,34 @@ type Plugin struct {
 	configurationLock sync.RWMutex
 	configuration     *configuration
 
-	sqlStore  *sqlstore.SQLStore
+	sqlStore   *sqlstore.SQLStore
+	eventStore moderationEventStore
+	auditStore auditStore
+	metrics    *metrics
+
+	// moderatorFactory builds the moderator of each processor. It defaults to
+	// initModerator and is replaced in tests to inject a moderator, such as a
+	// moderation.Stub, in place of the configured providers.
+	moderatorFactory func(ctx context.Context, api plugin.API, config *configuration) (moderation.Moderator, error)
+
+	// processor is replaced when the configuration changes, under the
+	// configurationLock. active is set, under the same lock, while the plugin
+	// is activated, since the configuration is first loaded before OnActivate.
 	processor *PostProcessor
+	active    bool
+
+	// ctx is the context every moderation request derives from. It is
+	// replaced, under the configurationLock, when the plugin is activated and
+	// canceled by OnDeactivate, so that no provider request outlives the
+	// plugin.
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	// scanLock guards the cancel function and completion channel of the
+	// running scan of channel history
+	scanLock   sync.Mutex
+	scanCancel context.CancelCauseFunc
+	scanDone   chan struct{}
 }
 
 func (p *Plugin) OnActivate() error {
@@ -46,61 +90,626 @@ func (p *Plugin) OnActivate() error {
 	}
 	p.sqlStore = SQLStore
 
+	if err := SQLStore.Migrate(); err != nil {
+		p.API.LogError("Cannot migrate the database", "err", err)
+		return err
+	}
+	p.eventStore = SQLStore
+	p.auditStore = SQLStore
+	p.metrics = newMetrics()
+
+	if err := p.registerCommands(); err != nil {
+		p.API.LogError("Cannot register slash commands", "err", err)
+		return err
+	}
+
+	p.setActive(true)
+
 	config := p.getConfiguration()
 	if err := p.initialize(config); err != nil {
 		p.API.LogError("Cannot initialize plugin", "err", err)
+		// Refuse to activate rather than silently running without the admin's rules
+		if errors.Is(err, regex.ErrInvalidRule) {
+			return err
+		}
 		return nil
 	}
 
+	if p.getProcessor() != nil {
+		p.requeuePersistedPosts()
+		p.resumeScan()
+	}
+
 	return nil
 }
 
+// OnDeactivate stops accepting posts and gives the processor a bounded time
+// to moderate the posts already queued. Provider requests still running
+// after that are canceled, and their posts are moderated after the plugin
+// restarts.
+func (p *Plugin) OnDeactivate() error {
+	p.setActive(false)
+	p.stopScan(errPluginDeactivated)
+	defer p.cancelRequests(errPluginDeactivated)
+
+	processor := p.getProcessor()
+	if processor == nil {
+		return nil
+	}
+
+	if !processor.drain(queueDrainTimeout) {
+		p.API.LogWarn("Timed out moderating queued posts, the remaining posts are moderated after the plugin restarts",
+			"remaining", processor.queueDepth())
+	}
+	p.setProcessor(nil)
+
+	return nil
+}
+
+// initialize builds the processor for the configuration and replaces the
+// running one. The new processor is built before the running one is touched,
+// so a configuration that fails to load leaves the running processor in
+// place. The running processor stops accepting posts and moderates the posts
+// it already queued before the new one starts, and the posts deferred in
+// between are then queued on the new processor.
 func (p *Plugin) initialize(config *configuration) error {
-	if p.processor != nil {
-		p.processor.stop()
-		p.processor = nil
+	processor, err := p.buildProcessor(config)
+	if err != nil {
+		return err
 	}
 
-	if !config.Enabled {
-		p.API.LogInfo("Content moderation is disabled")
+	previous := p.getProcessor()
+	if previous != nil && !previous.drain(queueDrainTimeout) {
+		p.API.LogWarn("Timed out moderating queued posts before applying the new configuration, the remaining posts may be moderated twice",
+			"remaining", previous.queueDepth())
+	}
+
+	p.setProcessor(processor)
+	if processor == nil {
 		return nil
 	}
+	processor.start(p.API)
+
+	p.resumePendingDeletions()
+	if previous != nil {
+		p.requeuePersistedPosts()
+	}
+
+	return nil
+}
+
+// getProcessor returns the running processor, or nil when moderation is not
+// running
+func (p *Plugin) getProcessor() *PostProcessor {
+	p.configurationLock.RLock()
+	defer p.configurationLock.RUnlock()
+
+	return p.processor
+}
+
+// setProcessor replaces the running processor under lock
+func (p *Plugin) setProcessor(processor *PostProcessor) {
+	p.configurationLock.Lock()
+	defer p.configurationLock.Unlock()
 
-	moderator, err := initModerator(p.API, config)
+	p.processor = processor
+}
+
+// isActive reports whether the plugin is activated
+func (p *Plugin) isActive() bool {
+	p.configurationLock.RLock()
+	defer p.configurationLock.RUnlock()
+
+	return p.active
+}
+
+// setActive records whether the plugin is activated. Activating the plugin
+// creates the context of the moderation requests made until it is
+// deactivated.
+func (p *Plugin) setActive(active bool) {
+	p.configurationLock.Lock()
+	defer p.configurationLock.Unlock()
+
+	p.active = active
+	if active {
+		p.ctx, p.cancel = context.WithCancelCause(context.Background())
+	}
+}
+
+// requestContext returns the context moderation requests derive from
+func (p *Plugin) requestContext() context.Context {
+	p.configurationLock.RLock()
+	defer p.configurationLock.RUnlock()
+
+	if p.ctx == nil {
+		return context.Background()
+	}
+	return p.ctx
+}
+
+// cancelRequests cancels every moderation request made since the plugin was
+// activated
+func (p *Plugin) cancelRequests(cause error) {
+	p.configurationLock.RLock()
+	defer p.configurationLock.RUnlock()
+
+	if p.cancel != nil {
+		p.cancel(cause)
+	}
+}
+
+// buildProcessor returns a processor, not yet started, that moderates posts
+// with the configuration, or nil when moderation is disabled
+func (p *Plugin) buildProcessor(config *configuration) (*PostProcessor, error) {
+	// A threshold that cannot be parsed must not leave the server without
+	// moderation, so the fallback threshold replaces it until it is fixed
+	thresholdFallback := false
+	if _, thresholdErr := config.ThresholdValue(); thresholdErr != nil {
+		fallbackConfig, err := config.withFallbackThreshold()
+		if err != nil {
+			return nil, errors.Wrap(thresholdErr, "failed to load moderation threshold")
+		}
+		p.API.LogError("Moderation threshold could not be parsed, moderating with the fallback threshold until it is fixed",
+			"err", thresholdErr, "fallback_threshold", fallbackConfig.Threshold, "monitor_only", fallbackConfig.MonitorOnly)
+		config, thresholdFallback = fallbackConfig, true
+	}
+
+	teamOverrides, err := config.TeamModerationMap()
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize moderator")
+		return nil, errors.Wrap(err, "failed to load team overrides")
+	}
+	for teamID := range teamOverrides {
+		if !model.IsValidId(teamID) {
+			p.API.LogWarn("Ignoring team override with invalid team ID", "team_id", teamID)
+			delete(teamOverrides, teamID)
+		}
+	}
+
+	if config.MonitorOnly {
+		p.API.LogInfo("Content moderation is in monitor-only mode, flagged posts are logged but left in place")
+	}
+
+	// Moderation still runs while globally disabled when a team enables it
+	teams := newTeamSettings(config.Enabled, teamOverrides)
+	if !teams.anyEnabled() {
+		p.API.LogInfo("Content moderation is disabled")
+		return nil, nil
 	}
 
-	excludedUsers := config.ExcludedUserSet()
+	factory := initModerator
+	if p.moderatorFactory != nil {
+		factory = p.moderatorFactory
+	}
+
+	degraded := false
+	moderator, err := factory(p.requestContext(), p.API, config)
+	if errors.Is(err, ErrModeratorUnhealthy) {
+		keyPairs := []any{"err", err}
+		if kind, ok := moderation.KindOf(err); ok {
+			keyPairs = append(keyPairs, "kind", string(kind))
+		}
+		p.API.LogError("Moderation provider failed its health check, moderation is degraded until the provider responds", keyPairs...)
+		degraded = true
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to initialize moderator")
+	}
+
+	excludedUsers, unresolvedUsers := resolveExcludedUsers(p.API, config.ExcludedUserSet())
 	excludedChannels := config.ExcludedChannelSet()
+	includedChannels := config.IncludedChannelSet()
 
 	thresholdValue, err := config.ThresholdValue()
 	if err != nil {
-		return errors.Wrap(err, "failed to load moderation threshold")
+		return nil, errors.Wrap(err, "failed to load moderation threshold")
+	}
+
+	categoryThresholds, err := config.CategoryThresholdMap()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load category thresholds")
+	}
+
+	channelThresholds, err := config.ChannelThresholdMap()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load channel thresholds")
+	}
+	for channelID := range channelThresholds {
+		if !model.IsValidId(channelID) {
+			p.API.LogWarn("Ignoring channel threshold override with invalid channel ID", "channel_id", channelID)
+			delete(channelThresholds, channelID)
+		}
+	}
+
+	warnThreshold, err := config.WarnThresholdValue()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load warn threshold")
+	}
+	if warnThreshold != noWarnThreshold && warnThreshold >= thresholdValue {
+		return nil, errors.Errorf("warn threshold %d must be below the moderation threshold %d", warnThreshold, thresholdValue)
+	}
+
+	replyThreshold, hasReplyThreshold, err := config.ReplyThresholdValue()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load reply threshold")
+	}
+
+	offHoursThreshold, err := config.OffHoursThresholdValue()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load off-hours threshold")
+	}
+
+	schedule, err := newModerationSchedule(config.ModerationSchedule, config.ModerationScheduleTimezone, offHoursThreshold)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load moderation schedule")
+	}
+
+	disabledCategories, err := config.DisabledCategorySet()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load Azure categories")
+	}
+
+	directMessages, err := newDirectMessageSettings(strings.TrimSpace(config.DirectMessageModeration))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load direct message settings")
+	}
+
+	var logHashSalt []byte
+	if config.LogIDMode == logIDsHash {
+		if logHashSalt, err = loadLogHashSalt(p.API); err != nil {
+			return nil, errors.Wrap(err, "failed to load log redaction settings")
+		}
+	}
+	logRedaction, err := newLogRedaction(config.LogIDMode, logHashSalt)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load log redaction settings")
+	}
+
+	categoryWeights, err := config.CategoryWeightMap()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load category weights")
+	}
+	aggregation, err := newSeverityAggregation(config.SeverityAggregation, config.SeverityAggregationThreshold, categoryWeights)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load severity aggregation")
+	}
+
+	policy := newModerationPolicy(thresholdValue, categoryThresholds, channelThresholds, disabledCategories, schedule)
+	policy.aggregation = aggregation
+	policy.thresholdFallback = thresholdFallback
+	policy.warnThreshold = warnThreshold
+	if hasReplyThreshold {
+		policy.replyThreshold = &replyThreshold
+	}
+	policy.directMessages = directMessages
+	policy.logRedaction = logRedaction
+
+	retry, err := newRetryPolicy(config.MaxModerationAttempts, config.DeadLetterAction, config.DeadLetterChannel, config.ModerationFailurePolicy)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load retry settings")
+	}
+
+	action, err := newFlaggedPostAction(config.ModerationAction, config.ReviewChannel, config.MonitorOnly)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load moderation action")
+	}
+
+	images, err := newImageSettings(config.MaxImageSizeMB, config.HoldOversizedImages, config.ReviewChannel)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load image settings")
+	}
+
+	notifications, err := newNotificationSettings(
+		config.ChannelNotificationTemplate, config.DMNotificationTemplate, config.DMContentMode, config.DMPreviewLength, config.DMCategorySeverities, config.ModerationLogChannelID,
+		config.ModerationLogSeverityBreakdown)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load notification templates")
+	}
+	notifications.dmOnly = config.DMOnlyNotifications
+	notifications.cooldown = newNotificationCooldown(time.Duration(config.NotificationCooldownSeconds) * time.Second)
+
+	notifications.policy, err = newPolicyNotice(config.PolicyAcknowledgement, config.PolicyText)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load moderation policy")
+	}
+
+	audit, err := newAuditSettings(config.AuditLevel, config.AuditRedactMessage)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load audit settings")
+	}
+
+	compliance, err := newComplianceSettings(config.ComplianceChannelID, config.AuditRedactMessage)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load compliance settings")
+	}
+
+	var detector moderation.LanguageDetector
+	if config.LanguageDetection {
+		detector = moderation.NewStopwordDetector()
+	}
+	languages, err := newLanguageSettings(detector, config.SupportedLanguageList(), config.UnsupportedLanguageAction)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load language settings")
+	}
+
+	integrations := newIntegrationSettings(config.SkipBotPosts, config.SkipWebhookPosts)
+	integrations.logRedaction = logRedaction
+
+	eventWebhooks, err := newEventWebhooks(config.EventWebhookURLList(), config.EventWebhookSecret)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load event webhooks")
+	}
+	if eventWebhooks != nil {
+		eventWebhooks.logRedaction = logRedaction
+	}
+
+	postsPerMinuteLimit, err := config.PostsPerMinuteLimitValue()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load rate limit settings")
+	}
+
+	maxQueueSize, err := config.MaxQueueSizeValue()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load queue settings")
+	}
+
+	dispatchJitter, err := config.DispatchJitterValue()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load dispatch jitter")
+	}
+
+	timeout, err := config.ModerationTimeoutValue()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load moderation timeout")
 	}
 
 	botID, err := p.API.EnsureBotUser(&model.Bot{Username: config.BotUsername})
 	if err != nil {
-		return errors.Wrap(err, "could not initialize bot user")
+		return nil, errors.Wrap(err, "could not initialize bot user")
 	}
 
-	processor, err := newPostProcessor(
-		botID, moderator, thresholdValue, excludedUsers, excludedChannels)
+	inline, err := newInlineModerationLimiter(config.MaxConcurrentInlineModerations)
 	if err != nil {
-		return errors.Wrap(err, "failed to create post processor")
+		return nil, errors.Wrap(err, "failed to load inline moderation limit")
 	}
-	p.processor = processor
-	p.processor.start(p.API)
 
-	return nil
+	var reactionModerator moderation.Moderator
+	if config.ModerateReactions {
+		reactionModerator, err = buildReactionModerator(p.API, config)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize reaction moderator")
+		}
+	}
+
+	var shortMessages *shortMessageSettings
+	if config.MinMessageCharacters > 0 || config.MinMessageWords > 0 {
+		shortMessageBlocklist, err := buildShortMessageBlocklist(p.API, config)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to initialize short message blocklist")
+		}
+		shortMessages = newShortMessageSettings(config.MinMessageCharacters, config.MinMessageWords, shortMessageBlocklist)
+	}
+
+	textLimit, err := newTextLimitSettings(config.MaxModeratedCharacters, config.OverLimitAction, config.ReviewChannel)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load maximum moderated length")
+	}
+
+	processor, err := newPostProcessor(processorSettings{
+		botID:                   botID,
+		moderator:               moderator,
+		policy:                  policy,
+		excludedUsers:           excludedUsers,
+		unresolvedExcludedUsers: unresolvedUsers,
+		excludedChannels:        excludedChannels,
+		includedChannels:        includedChannels,
+		priorityChannels:        config.PriorityChannelSet(),
+		moderateFilenames:       config.ModerateFilenames,
+		moderateImages:          config.ModerateImages,
+		stripMarkdown:           config.StripMarkdown,
+		moderateAttachments:     config.ModerateAttachments,
+		moderateProfiles:        config.ModerateProfiles,
+		postsPerMinuteLimit:     postsPerMinuteLimit,
+		dispatchJitter:          dispatchJitter,
+		workerCount:             config.WorkerCount,
+		maxQueueSize:            maxQueueSize,
+		queueHighWaterMark:      config.QueueHighWaterMark,
+		queueLowWaterMark:       config.QueueLowWaterMark,
+		timeout:                 timeout,
+		deletionGracePeriod:     time.Duration(config.DeletionGracePeriodSeconds) * time.Second,
+		retry:                   retry,
+		action:                  action,
+		notifications:           notifications,
+		audit:                   audit,
+		teams:                   teams,
+		languages:               languages,
+		integrations:            integrations,
+		images:                  images,
+		textFiles:               newTextFileSettings(config.TextFileExtensionList(), config.MaxTextFileSizeKB),
+		textLimit:               textLimit,
+		shortMessages:           shortMessages,
+		edits:                   newEditDeltas(config.ModerateEditDelta),
+		inline:                  inline,
+		reactionModerator:       reactionModerator,
+		providers:               config.TypeList(),
+		events:                  p.eventStore,
+		metrics:                 p.metrics,
+		auditStore:              p.auditStore,
+		compliance:              compliance,
+		eventWebhooks:           eventWebhooks,
+		degraded:                degraded,
+		ctx:                     p.requestContext(),
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create post processor")
+	}
+
+	return processor, nil
+}
+
+// initModerator builds the configured moderator and checks that it can serve
+// requests, within the moderation timeout and until ctx is canceled. A
+// moderator that fails its health check is still returned, along with an
+// error wrapping ErrModeratorUnhealthy.
+func initModerator(ctx context.Context, api plugin.API, config *configuration) (moderation.Moderator, error) {
+	timeout, err := config.ModerationTimeoutValue()
+	if err != nil {
+		return nil, err
+	}
+
+	mod, err := buildModerator(api, config)
+	if err != nil {
+		return nil, err
+	}
+
+	// The breaker sits inside the cache, so cached results are still served
+	// while the provider is unavailable
+	if failures := config.CircuitBreakerFailuresValue(); failures > 0 {
+		mod = moderation.Breaker(mod, failures, config.CircuitBreakerCooldown())
+	}
+
+	if config.ResultCacheSize > 0 {
+		mod = moderation.Cached(mod, config.ResultCacheSize, config.ResultCacheTTL())
+	}
+
+	// The fallback sits outside the cache, so that results with reduced
+	// coverage are not served once the providers recover
+	fallbackType, err := config.FallbackProviderValue()
+	if err != nil {
+		return nil, err
+	}
+	if fallbackType != "" {
+		secondary, err := newModerator(api, config, fallbackType)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create fallback moderator")
+		}
+		mod = moderation.Fallback(mod, secondary)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if err := mod.HealthCheck(ctx); err != nil {
+		return mod, moderatorUnhealthy(err)
+	}
+
+	return mod, nil
+}
+
+func buildModerator(api plugin.API, config *configuration) (moderation.Moderator, error) {
+	types := config.TypeList()
+	if len(types) == 0 {
+		return nil, errors.New("no moderator type configured")
+	}
+
+	if len(types) == 1 {
+		return newModerator(api, config, types[0])
+	}
+
+	moderators := make([]moderation.Moderator, 0, len(types))
+	for _, moderatorType := range types {
+		mod, err := newModerator(api, config, moderatorType)
+		if err != nil {
+			return nil, err
+		}
+		moderators = append(moderators, mod)
+	}
+
+	chain, err := moderation.NewChain(moderators, config.ChainContinueOnError)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create moderator chain")
+	}
+
+	api.LogInfo("Moderator chain initialized", "types", strings.Join(types, ","))
+	return chain, nil
+}
+
+// buildReactionModerator builds a moderator from the configured providers
+// that can moderate reactions. It returns nil when none of them can.
+func buildReactionModerator(api plugin.API, config *configuration) (moderation.Moderator, error) {
+	var moderators []moderation.Moderator
+	for _, moderatorType := range config.TypeList() {
+		if _, ok := reactionModeratorTypes[moderatorType]; !ok {
+			continue
+		}
+		mod, err := newModerator(api, config, moderatorType)
+		if err != nil {
+			return nil, err
+		}
+		moderators = append(moderators, mod)
+	}
+
+	switch len(moderators) {
+	case 0:
+		api.LogWarn("Reaction moderation requires the blocklist or regex provider, reactions are not moderated")
+		return nil, nil
+	case 1:
+		return moderators[0], nil
+	}
+
+	return moderation.NewChain(moderators, config.ChainContinueOnError)
+}
+
+// buildShortMessageBlocklist builds the blocklist provider that still checks
+// messages too short to send to the other providers, or returns nil when the
+// blocklist provider is not configured
+func buildShortMessageBlocklist(api plugin.API, config *configuration) (moderation.Moderator, error) {
+	if !slices.Contains(config.TypeList(), "blocklist") {
+		return nil, nil
+	}
+	return newModerator(api, config, "blocklist")
+}
+
+// newModerator creates the moderator of the given type. Requests to it are
+// bounded by its provider timeout, when one is configured, and allowed terms
+// are removed from text before it reaches the provider.
+func newModerator(api plugin.API, config *configuration, moderatorType string) (moderation.Moderator, error) {
+	timeouts, err := config.ProviderTimeoutMap()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load provider timeouts")
+	}
+
+	allowlist, err := moderation.NewAllowlist(config.AllowedTermList())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load allowed terms")
+	}
+
+	mod, err := newProviderModerator(api, config, moderatorType)
+	if err != nil {
+		return nil, err
+	}
+
+	if timeout, ok := timeouts[moderatorType]; ok {
+		mod = moderation.WithTimeout(mod, timeout)
+	}
+	if allowlist != nil {
+		mod = moderation.WithAllowlist(mod, allowlist)
+	}
+	return mod, nil
 }
 
-func initModerator(api plugin.API, config *configuration) (moderation.Moderator, error) {
-	switch config.Type {
+func newProviderModerator(api plugin.API, config *configuration, moderatorType string) (moderation.Moderator, error) {
+	switch moderatorType {
 	case "azure":
+		categories, err := config.AzureCategoryList()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load Azure categories")
+		}
+
 		azureConfig := &moderation.Config{
-			Endpoint: config.Endpoint,
-			APIKey:   config.APIKey,
+			Endpoint:     config.Endpoint,
+			APIKey:       config.APIKey,
+			AuthMode:     config.AzureAuthMode,
+			TenantID:     strings.TrimSpace(config.AzureTenantID),
+			ClientID:     strings.TrimSpace(config.AzureClientID),
+			ClientSecret: config.AzureClientSecret,
+			Categories:   categories,
+			Blocklists:   config.AzureBlocklistList(),
+			MaxRetries:   config.AzureMaxRetries,
+			APIVersion:   config.AzureAPIVersion,
+
+			ProxyURL:           config.AzureProxyURL,
+			CACertFile:         config.AzureCACertFile,
+			InsecureSkipVerify: config.AzureInsecureSkipVerify,
+			ConnectTimeout:     time.Duration(config.AzureConnectTimeoutSeconds) * time.Second,
 		}
 
 		mod, err := azure.New(azureConfig)
@@ -108,10 +717,90 @@ func initModerator(api plugin.API, config *configuration) (moderation.Moderator,
 			return nil, errors.Wrap(err, "failed to create Azure moderator")
 		}
 
+		if config.AzureInsecureSkipVerify {
+			api.LogWarn("TLS certificate verification is disabled for Azure AI Content Safety, requests can be intercepted. Configure a CA certificate file instead outside of testing.")
+		}
 		api.LogInfo("Azure AI Content Safety moderator initialized")
 		return mod, nil
+	case "openai":
+		openaiConfig := &moderation.Config{
+			Endpoint:     config.OpenAIEndpoint,
+			APIKey:       config.OpenAIAPIKey,
+			Model:        config.OpenAIModel,
+			Organization: config.OpenAIOrganization,
+		}
+
+		mod, err := openai.New(openaiConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create OpenAI moderator")
+		}
+
+		api.LogInfo("OpenAI moderator initialized")
+		return mod, nil
+	case "perspective":
+		perspectiveConfig := &moderation.Config{
+			APIKey:     config.PerspectiveAPIKey,
+			Categories: config.PerspectiveAttributeList(),
+			Languages:  config.PerspectiveLanguageList(),
+		}
+
+		mod, err := perspective.New(perspectiveConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create Perspective moderator")
+		}
+
+		api.LogInfo("Perspective API moderator initialized")
+		return mod, nil
+	case "blocklist":
+		terms, err := blocklist.ParseTerms(config.BlocklistTermList())
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse blocklist terms")
+		}
+
+		blocklistConfig := &blocklist.Config{
+			Terms:           terms,
+			WholeWord:       config.BlocklistWholeWord,
+			CaseSensitive:   config.BlocklistCaseSensitive,
+			Aggregation:     config.BlocklistAggregation,
+			EscalationCount: config.BlocklistEscalationCount,
+		}
+
+		mod, err := blocklist.New(blocklistConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create blocklist moderator")
+		}
+
+		api.LogInfo("Blocklist moderator initialized")
+		return mod, nil
+	case "regex":
+		rules, err := regex.ParseRules(config.RegexRules)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse regex rules")
+		}
+
+		mod, err := regex.New(&regex.Config{Rules: rules})
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create regex moderator")
+		}
+
+		api.LogInfo("Regex moderator initialized", "rules", len(rules))
+		return mod, nil
+	case "webhook":
+		webhookConfig := &webhook.Config{
+			URL:            config.WebhookURL,
+			Token:          config.WebhookToken,
+			CategoriesPath: config.WebhookCategoriesPath,
+		}
+
+		mod, err := webhook.New(webhookConfig)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create webhook moderator")
+		}
+
+		api.LogInfo("Webhook moderator initialized")
+		return mod, nil
 	default:
-		return nil, errors.Errorf("unknown moderator type: %s", config.Type)
+		return nil, errors.Errorf("unknown moderator type: %s", moderatorType)
 	}
 }
 
@@ -124,7 +813,15 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	// All HTTP endpoints of this plugin require the user to be a System Admin
+	// Users acknowledge the moderation policy with a button in their DMs, so
+	// it is the only endpoint open to users who are not System Admins
+	if r.URL.Path == acknowledgePolicyPath && r.Method == http.MethodPost {
+		p.acknowledgePolicy(w, r)
+		return
+	}
+
+	// Every other HTTP endpoint of this plugin requires the user to be a
+	// System Admin
 	if !p.API.HasPermissionTo(userID, model.PermissionManageSystem) {
 		http.Error(w, "Not authorized", http.StatusUnauthorized)
 		return
@@ -132,6 +829,15 @@ func (p *Plugin) ServeHTTP(c *plugin.Context, w http.ResponseWriter, r *http.Req
 
 	router := mux.NewRouter()
 	router.HandleFunc("/api/v1/channels/search", p.searchChannels).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/queue/stats", p.getQueueStats).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/flagged", p.getFlaggedPosts).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/stats", p.getModerationStats).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/config", p.getEffectiveConfig).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/config/validate", p.validateConfig).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/scan", p.startScanRequest).Methods(http.MethodPost)
+	router.HandleFunc("/api/v1/scan", p.getScanStatus).Methods(http.MethodGet)
+	router.HandleFunc("/api/v1/scan", p.cancelScan).Methods(http.MethodDelete)
+	router.HandleFunc("/api/v1/posts/{post_id}/rescan", p.rescanPost).Methods(http.MethodPost)
 	router.ServeHTTP(w, r)
 }
 
@@ -155,3 +861,85 @@ func (p *Plugin) searchChannels(w http.ResponseWriter, r *http.Request) {
 		p.API.LogError("failed to write http response", "error", err.Error())
 	}
 }
+
+// queueStats reports how close the processing queue is to saturation
+type queueStats struct {
+	Depth    int   `json:"depth"`
+	Capacity int   `json:"capacity"`
+	Dropped  int64 `json:"dropped"`
+}
+
+// getQueueStats handles the processing queue statistics API endpoint
+func (p *Plugin) getQueueStats(w http.ResponseWriter, r *http.Request) {
+	processor := p.getProcessor()
+	if processor == nil {
+		http.Error(w, "content moderation is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	stats := queueStats{
+		Depth:    processor.queueDepth(),
+		Capacity: processor.queueCapacity(),
+		Dropped:  processor.droppedPostCount(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
+
+// getFlaggedPosts handles the recently flagged posts API endpoint. The limit
+// query parameter caps the number of events returned. since and before,
+// timestamps in milliseconds, only return events created after and before
+// them, so that clients can page back through older events.
+func (p *Plugin) getFlaggedPosts(w http.ResponseWriter, r *http.Request) {
+	if p.eventStore == nil {
+		http.Error(w, "moderation events are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+
+	limit := defaultFlaggedPostsLimit
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxFlaggedPostsLimit)
+	}
+
+	var since int64
+	if value := query.Get("since"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "since must be a timestamp in milliseconds", http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	var before int64
+	if value := query.Get("before"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "before must be a timestamp in milliseconds", http.StatusBadRequest)
+			return
+		}
+		before = parsed
+	}
+
+	events, err := p.eventStore.GetModerationEvents(since, before, limit)
+	if err != nil {
+		http.Error(w, "failed to get flagged posts", http.StatusInternalServerError)
+		p.API.LogError("failed to get flagged posts", "error", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
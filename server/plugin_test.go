@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/blocklist"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeHTTPRequiresSystemAdmin(t *testing.T) {
+	for _, path := range []string{"/api/v1/channels/search?prefix=town", "/api/v1/queue/stats", "/api/v1/flagged"} {
+		t.Run(path, func(t *testing.T) {
+			api := &plugintest.API{}
+			api.On("HasPermissionTo", "user1", model.PermissionManageSystem).Return(false)
+
+			// The handlers would read the store and the processor if they ran
+			store := &fakeEventStore{}
+			p := &Plugin{eventStore: store, processor: &PostProcessor{postsCh: make(chan *model.Post, 10)}}
+			p.SetAPI(api)
+
+			r := httptest.NewRequest(http.MethodGet, path, nil)
+			r.Header.Set("Mattermost-User-ID", "user1")
+			w := httptest.NewRecorder()
+			p.ServeHTTP(nil, w, r)
+
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.Equal(t, "Not authorized\n", w.Body.String())
+			assert.Zero(t, store.limit, "handler must not run for non-admins")
+			api.AssertExpectations(t)
+		})
+	}
+
+	t.Run("Anonymous request", func(t *testing.T) {
+		p := &Plugin{}
+		p.SetAPI(&plugintest.API{})
+
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, httptest.NewRequest(http.MethodGet, "/api/v1/queue/stats", nil))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestNewModeratorProviderTimeout(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogInfo", "Blocklist moderator initialized").Return()
+
+	config := &configuration{BlocklistTerms: "foo"}
+	mod, err := newModerator(api, config, "blocklist")
+	require.NoError(t, err)
+	assert.IsType(t, &blocklist.Moderator{}, mod)
+
+	config.ProviderTimeouts = "blocklist=200ms"
+	mod, err = newModerator(api, config, "blocklist")
+	require.NoError(t, err)
+	assert.IsType(t, &moderation.TimeoutModerator{}, mod)
+
+	config.ProviderTimeouts = "blocklist=1ms"
+	_, err = newModerator(api, config, "blocklist")
+	assert.Error(t, err)
+}
+
+func TestNewModeratorAllowedTerms(t *testing.T) {
+	api := &plugintest.API{}
+	api.On("LogInfo", "Blocklist moderator initialized").Return()
+
+	config := &configuration{BlocklistTerms: "breast", AllowedTerms: "breast cancer\nbreastfeeding"}
+	mod, err := newModerator(api, config, "blocklist")
+	require.NoError(t, err)
+	assert.IsType(t, &moderation.AllowlistModerator{}, mod)
+
+	result, err := mod.ModerateText(context.Background(), "Breast cancer screening is next week")
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Highest())
+
+	result, err = mod.ModerateText(context.Background(), "Breast cancer screening, then breast photos")
+	require.NoError(t, err)
+	assert.Equal(t, moderation.MaxSeverity, result.Highest())
+}
+
+func TestBuildProcessorUnhealthyModerator(t *testing.T) {
+	stub := &moderation.Stub{Default: moderation.Result{moderation.CategoryHarassment: 0}}
+	cause := moderation.NewError(moderation.ErrorAuth, errors.New("API returned status 401"))
+	p := &Plugin{moderatorFactory: func(context.Context, plugin.API, *configuration) (moderation.Moderator, error) {
+		return stub, moderatorUnhealthy(cause)
+	}}
+
+	api := &plugintest.API{}
+	api.On("EnsureBotUser", mock.Anything).Return("bot", nil)
+	api.On("LogError", "Moderation provider failed its health check, moderation is degraded until the provider responds",
+		"err", mock.MatchedBy(func(err error) bool { return errors.Is(err, cause) }), "kind", "auth").Return().Once()
+	p.SetAPI(api)
+
+	// The processor is still built, so that moderation resumes once the
+	// provider responds
+	processor, err := p.buildProcessor(&configuration{Enabled: true, Threshold: "medium"})
+	require.NoError(t, err)
+	require.NotNil(t, processor)
+	assert.True(t, processor.degraded.Load())
+	assert.Equal(t, stub, processor.moderator)
+	api.AssertExpectations(t)
+
+	t.Run("Other failures stop the build", func(t *testing.T) {
+		p := &Plugin{moderatorFactory: func(context.Context, plugin.API, *configuration) (moderation.Moderator, error) {
+			return nil, errors.New("unknown provider")
+		}}
+		p.SetAPI(&plugintest.API{})
+
+		processor, err := p.buildProcessor(&configuration{Enabled: true, Threshold: "medium"})
+		assert.ErrorContains(t, err, "failed to initialize moderator: unknown provider")
+		assert.Nil(t, processor)
+	})
+}
+
+func TestBuildProcessorModeratorContext(t *testing.T) {
+	var factoryCtx context.Context
+	p := &Plugin{moderatorFactory: func(ctx context.Context, _ plugin.API, _ *configuration) (moderation.Moderator, error) {
+		factoryCtx = ctx
+		return &moderation.Stub{}, nil
+	}}
+
+	api := &plugintest.API{}
+	api.On("EnsureBotUser", mock.Anything).Return("bot", nil)
+	p.SetAPI(api)
+	p.setActive(true)
+
+	_, err := p.buildProcessor(&configuration{Enabled: true, Threshold: "medium"})
+	require.NoError(t, err)
+	require.NotNil(t, factoryCtx)
+	require.NoError(t, factoryCtx.Err())
+
+	// Deactivating the plugin cancels the health check of the moderator
+	p.cancelRequests(errors.New("plugin deactivated"))
+	assert.Error(t, factoryCtx.Err())
+}
+
+func TestBuildProcessorInjectedModerator(t *testing.T) {
+	stub := &moderation.Stub{
+		Results: map[string]moderation.Result{"You are awful": {moderation.CategoryHarassment: 6}},
+		Default: moderation.Result{moderation.CategoryHarassment: 0},
+	}
+	p := &Plugin{moderatorFactory: func(context.Context, plugin.API, *configuration) (moderation.Moderator, error) {
+		return stub, nil
+	}}
+
+	api := &plugintest.API{}
+	api.On("EnsureBotUser", mock.Anything).Return("bot", nil)
+	api.On("LogInfo", mock.Anything).Return().Maybe()
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	api.On("LogWarn", mock.Anything).Return().Maybe()
+	p.SetAPI(api)
+
+	processor, err := p.buildProcessor(&configuration{Enabled: true, Threshold: "medium"})
+	require.NoError(t, err)
+	require.NotNil(t, processor)
+
+	flaggedAPI := &plugintest.API{}
+	flaggedAPI.On("LogInfo", "Content was flagged by moderation", "post_id", "post1", "severity_threshold", 4,
+		"computed_severity_harassment", 6, "severity_breakdown", "harassment: 6").Return()
+	err = processor.moderatePost(flaggedAPI, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "You are awful"})
+	assert.ErrorIs(t, err, ErrModerationRejection)
+
+	err = processor.moderatePost(&plugintest.API{}, &model.Post{Id: "post2", UserId: "user1", ChannelId: "channel1", Message: "Hello"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"You are awful", "Hello"}, stub.Texts())
+}
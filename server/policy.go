@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// noWarnThreshold disables warning the authors of allowed posts
+const noWarnThreshold = 0
+
+// moderationPolicy decides whether a moderation result should be flagged. It
+// holds every threshold setting so that all moderation paths share the same
+// evaluation and flagged-result logging.
+type moderationPolicy struct {
+	thresholdValue     int
+	categoryThresholds map[string]int
+	channelThresholds  map[string]int
+
+	// warnThreshold is the severity from which content that is not flagged
+	// still earns its author a warning, or noWarnThreshold to never warn
+	warnThreshold int
+
+	// replyThreshold replaces the global threshold for thread replies, or is
+	// nil to moderate replies like root posts
+	replyThreshold *int
+
+	// thresholdFallback is set when the configured threshold could not be
+	// parsed and thresholdValue is the fallback threshold
+	thresholdFallback bool
+
+	// disabledCategories are ignored when evaluating results, keyed by
+	// canonical category name
+	disabledCategories map[string]struct{}
+
+	// aggregation combines the category severities into a decision, or is
+	// nil to flag any category reaching its threshold
+	aggregation *severityAggregation
+
+	// schedule limits moderation to time windows, or is nil to always moderate
+	schedule *moderationSchedule
+
+	// directMessages skips direct and group messages or sets their threshold,
+	// or is nil to moderate them like channel posts
+	directMessages *directMessageSettings
+
+	// logRedaction hashes or omits post and user IDs in the logs of flagged
+	// content and moderation failures, or is nil to log them as they are
+	logRedaction *logRedaction
+}
+
+func newModerationPolicy(
+	thresholdValue int,
+	categoryThresholds map[string]int,
+	channelThresholds map[string]int,
+	disabledCategories map[string]struct{},
+	schedule *moderationSchedule,
+) *moderationPolicy {
+	return &moderationPolicy{
+		thresholdValue:     thresholdValue,
+		categoryThresholds: categoryThresholds,
+		channelThresholds:  channelThresholds,
+		disabledCategories: disabledCategories,
+		schedule:           schedule,
+	}
+}
+
+// moderating reports whether posts are currently moderated, which is always
+// the case without a schedule
+func (mp *moderationPolicy) moderating() bool {
+	return mp.schedule == nil || mp.schedule.moderating()
+}
+
+// flaggedContentError is returned for flagged content. It matches
+// ErrModerationRejection and holds the categories above their thresholds
+// along with the complete decision.
+type flaggedContentError struct {
+	categories moderation.Result
+	decision   moderation.Decision
+}
+
+func (e *flaggedContentError) Error() string {
+	return ErrModerationRejection.Error()
+}
+
+func (e *flaggedContentError) Is(target error) bool {
+	return target == ErrModerationRejection
+}
+
+// warnedContentError is returned for content that is allowed but reaches the
+// warn threshold. It does not match ErrModerationRejection, and holds the
+// categories at or above the warn threshold.
+type warnedContentError struct {
+	categories moderation.Result
+}
+
+func (e *warnedContentError) Error() string {
+	return "potentially inappropriate content allowed with a warning"
+}
+
+// checkResult returns an error matching ErrModerationRejection, after logging
+// the flagged categories, when the result of the decision is above the
+// threshold for the channel
+func (mp *moderationPolicy) checkResult(api plugin.API, postID, channelID string, decision moderation.Decision) error {
+	return mp.checkThreshold(api, postID, mp.channelThreshold(api, channelID), decision)
+}
+
+// checkPostResult is checkResult for a post, using the reply threshold when
+// the post is a thread reply
+func (mp *moderationPolicy) checkPostResult(api plugin.API, post *model.Post, decision moderation.Decision) error {
+	return mp.checkThreshold(api, post.Id, mp.postThreshold(api, post), decision)
+}
+
+// checkThreshold returns an error matching ErrModerationRejection, after
+// logging the flagged categories, when the result of the decision is above
+// the threshold
+func (mp *moderationPolicy) checkThreshold(api plugin.API, postID string, threshold int, decision moderation.Decision) error {
+	if !mp.resultSeverityAboveThreshold(decision.Result, threshold) {
+		return nil
+	}
+
+	mp.logFlaggedResult(api, postID, decision, threshold)
+	return &flaggedContentError{categories: mp.flaggedCategories(decision.Result, threshold), decision: decision}
+}
+
+// checkWarning returns a warnedContentError, after logging the categories,
+// when the result of an allowed decision reaches the warn threshold
+func (mp *moderationPolicy) checkWarning(api plugin.API, postID string, decision moderation.Decision) error {
+	categories := mp.warnedCategories(decision.Result)
+	if len(categories) == 0 {
+		return nil
+	}
+
+	api.LogInfo("Content is above the warn threshold", append(mp.loggedIDs("post_id", postID),
+		"warn_threshold", mp.warnThreshold, "categories", categories.String())...)
+	return &warnedContentError{categories: categories}
+}
+
+// skipChannel reports whether posts in the channel are exempt from moderation
+// because direct and group messages are not moderated
+func (mp *moderationPolicy) skipChannel(api plugin.API, channelID string) bool {
+	return mp.directMessages != nil && mp.directMessages.skipChannel(api, channelID)
+}
+
+// channelThreshold returns the threshold for a channel, falling back to the
+// direct message threshold for direct and group messages, and to the global
+// threshold otherwise. Outside the scheduled windows the off-hours threshold
+// replaces the global threshold.
+func (mp *moderationPolicy) channelThreshold(api plugin.API, channelID string) int {
+	if threshold, ok := mp.channelOverride(api, channelID); ok {
+		return threshold
+	}
+	if mp.schedule != nil {
+		return mp.schedule.threshold(mp.thresholdValue)
+	}
+	return mp.thresholdValue
+}
+
+// postThreshold returns the threshold for a post. Thread replies use the reply
+// threshold in place of the global and off-hours thresholds, while channel
+// and direct message thresholds still apply to them.
+func (mp *moderationPolicy) postThreshold(api plugin.API, post *model.Post) int {
+	if post.RootId == "" || mp.replyThreshold == nil {
+		return mp.channelThreshold(api, post.ChannelId)
+	}
+	if threshold, ok := mp.channelOverride(api, post.ChannelId); ok {
+		return threshold
+	}
+	return *mp.replyThreshold
+}
+
+// channelOverride returns the threshold set for the channel itself, or for
+// direct and group messages when it is one
+func (mp *moderationPolicy) channelOverride(api plugin.API, channelID string) (int, bool) {
+	if threshold, ok := mp.channelThresholds[channelID]; ok {
+		return threshold, true
+	}
+	if mp.directMessages != nil {
+		return mp.directMessages.thresholdForChannel(api, channelID)
+	}
+	return 0, false
+}
+
+// categoryThreshold returns the threshold for a category, falling back to the
+// given base threshold when the category has no override
+func (mp *moderationPolicy) categoryThreshold(category string, baseThreshold int) int {
+	if threshold, ok := mp.categoryThresholds[canonicalCategory(category)]; ok {
+		return threshold
+	}
+	return baseThreshold
+}
+
+// resultSeverityAboveThreshold reports whether the result is flagged by the
+// severity aggregation
+func (mp *moderationPolicy) resultSeverityAboveThreshold(result moderation.Result, baseThreshold int) bool {
+	return len(mp.flaggedCategories(result, baseThreshold)) > 0
+}
+
+// flaggedCategories returns the categories that flag the result according to
+// the severity aggregation, which are those above their thresholds unless the
+// severities are aggregated into a score
+func (mp *moderationPolicy) flaggedCategories(result moderation.Result, baseThreshold int) moderation.Result {
+	enabled := make(moderation.Result, len(result))
+	above := make(moderation.Result)
+	for category, severity := range result {
+		if _, disabled := mp.disabledCategories[canonicalCategory(category)]; disabled {
+			continue
+		}
+		enabled[category] = severity
+		if severity >= mp.categoryThreshold(category, baseThreshold) {
+			above[category] = severity
+		}
+	}
+	return mp.aggregation.flagged(enabled, above)
+}
+
+// warnedCategories returns the enabled categories at or above the warn
+// threshold. Each category is compared on its own, regardless of the severity
+// aggregation, since a warning only asks the author to reconsider the post.
+func (mp *moderationPolicy) warnedCategories(result moderation.Result) moderation.Result {
+	warned := make(moderation.Result)
+	if mp.warnThreshold == noWarnThreshold {
+		return warned
+	}
+	for category, severity := range result {
+		if _, disabled := mp.disabledCategories[canonicalCategory(category)]; disabled {
+			continue
+		}
+		if severity >= mp.warnThreshold {
+			warned[category] = severity
+		}
+	}
+	return warned
+}
+
+// logFlaggedResult logs the categories above their thresholds, followed by
+// the severity of every category so that thresholds can be tuned against
+// near misses, and how the decision was reached when it is known
+func (mp *moderationPolicy) logFlaggedResult(api plugin.API, postID string, decision moderation.Decision, baseThreshold int) {
+	keyPairs := append(mp.loggedIDs("post_id", postID), "severity_threshold", baseThreshold)
+
+	for category, severity := range mp.flaggedCategories(decision.Result, baseThreshold) {
+		keyPairs = append(keyPairs, fmt.Sprintf("computed_severity_%s", category))
+		keyPairs = append(keyPairs, severity)
+	}
+	if mp.aggregation != nil && mp.aggregation.strategy != aggregationAny {
+		keyPairs = append(keyPairs, "severity_aggregation", mp.aggregation.strategy)
+	}
+
+	keyPairs = append(keyPairs, "severity_breakdown", decision.String())
+
+	if len(decision.Providers) > 0 {
+		keyPairs = append(keyPairs, "providers", strings.Join(decision.Providers, ","))
+	}
+	if decision.Language != "" {
+		keyPairs = append(keyPairs, "language", decision.Language)
+	}
+	if decision.BlocklistMatched() {
+		keyPairs = append(keyPairs, "blocklist_match", true)
+	}
+	if decision.Degraded {
+		keyPairs = append(keyPairs, "degraded", true)
+	}
+
+	api.LogInfo("Content was flagged by moderation", keyPairs...)
+}
+
+// loggedIDs returns the key and ID pairs to log, redacted according to the
+// log redaction settings
+func (mp *moderationPolicy) loggedIDs(keyValuePairs ...string) []any {
+	if mp == nil {
+		return (*logRedaction)(nil).ids(keyValuePairs...)
+	}
+	return mp.logRedaction.ids(keyValuePairs...)
+}
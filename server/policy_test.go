@@ -0,0 +1,272 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultSeverityAboveThreshold(t *testing.T) {
+	tests := []struct {
+		name               string
+		result             moderation.Result
+		thresholdValue     int
+		categoryThresholds map[string]int
+		disabledCategories map[string]struct{}
+		expected           bool
+	}{
+		{
+			name: "All severities below threshold",
+			result: moderation.Result{
+				"hate":     20,
+				"sexual":   15,
+				"violence": 30,
+			},
+			thresholdValue: 50,
+			expected:       false,
+		},
+		{
+			name: "One severity above threshold",
+			result: moderation.Result{
+				"hate":     20,
+				"sexual":   75,
+				"violence": 30,
+			},
+			thresholdValue: 50,
+			expected:       true,
+		},
+		{
+			name: "Multiple severities above threshold",
+			result: moderation.Result{
+				"hate":     60,
+				"sexual":   75,
+				"violence": 80,
+			},
+			thresholdValue: 50,
+			expected:       true,
+		},
+		{
+			name: "Severity equal to threshold",
+			result: moderation.Result{
+				"hate":     20,
+				"sexual":   50,
+				"violence": 30,
+			},
+			thresholdValue: 50,
+			expected:       true,
+		},
+		{
+			name:           "Empty result",
+			result:         moderation.Result{},
+			thresholdValue: 50,
+			expected:       false,
+		},
+		{
+			name: "Zero threshold",
+			result: moderation.Result{
+				"hate": 1,
+			},
+			thresholdValue: 0,
+			expected:       true,
+		},
+		{
+			name: "Under category threshold but over global threshold",
+			result: moderation.Result{
+				"Violence": 4,
+			},
+			thresholdValue:     2,
+			categoryThresholds: map[string]int{"violence": 6},
+			expected:           false,
+		},
+		{
+			name: "Over category threshold but under global threshold",
+			result: moderation.Result{
+				"SelfHarm": 2,
+				"Violence": 4,
+			},
+			thresholdValue:     6,
+			categoryThresholds: map[string]int{"self_harm": 2},
+			expected:           true,
+		},
+		{
+			name: "Categories without override use global threshold",
+			result: moderation.Result{
+				"Hate":     4,
+				"Violence": 4,
+			},
+			thresholdValue:     4,
+			categoryThresholds: map[string]int{"violence": 6},
+			expected:           true,
+		},
+		{
+			name: "Disabled category above threshold is ignored",
+			result: moderation.Result{
+				"Hate":     6,
+				"Sexual":   2,
+				"SelfHarm": 0,
+			},
+			thresholdValue:     4,
+			disabledCategories: map[string]struct{}{"hate": {}, "violence": {}},
+			expected:           false,
+		},
+		{
+			name: "Enabled category above threshold is flagged",
+			result: moderation.Result{
+				"Hate":   6,
+				"Sexual": 4,
+			},
+			thresholdValue:     4,
+			disabledCategories: map[string]struct{}{"hate": {}, "violence": {}},
+			expected:           true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := &moderationPolicy{
+				thresholdValue:     tt.thresholdValue,
+				categoryThresholds: tt.categoryThresholds,
+				disabledCategories: tt.disabledCategories,
+			}
+
+			result := policy.resultSeverityAboveThreshold(tt.result, policy.thresholdValue)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestCheckResult(t *testing.T) {
+	policy := newModerationPolicy(4, map[string]int{"sexual": 2}, map[string]int{"support": 6}, map[string]struct{}{"violence": {}}, nil)
+
+	tests := []struct {
+		name      string
+		channelID string
+		result    moderation.Result
+		flagged   moderation.Result
+	}{
+		{
+			name:      "Below global threshold",
+			channelID: "town-square",
+			result:    moderation.Result{"Hate": 2},
+		},
+		{
+			name:      "At global threshold",
+			channelID: "town-square",
+			result:    moderation.Result{"Hate": 4, "Violence": 1},
+			flagged:   moderation.Result{"Hate": 4},
+		},
+		{
+			name:      "Below channel override",
+			channelID: "support",
+			result:    moderation.Result{"Hate": 4},
+		},
+		{
+			name:      "Category override applies within channel override",
+			channelID: "support",
+			result:    moderation.Result{"Sexual": 2},
+			flagged:   moderation.Result{"Sexual": 2},
+		},
+		{
+			name:      "Disabled category is not flagged",
+			channelID: "town-square",
+			result:    moderation.Result{"Violence": 6},
+		},
+		{
+			name:      "Disabled category is left out of flagged categories",
+			channelID: "town-square",
+			result:    moderation.Result{"Hate": 4, "Violence": 6},
+			flagged:   moderation.Result{"Hate": 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &plugintest.API{}
+			api.On("LogInfo", "Content was flagged by moderation", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+			err := policy.checkResult(api, "post1", tt.channelID, moderation.Decision{Result: tt.result})
+			if tt.flagged == nil {
+				assert.NoError(t, err)
+				api.AssertNotCalled(t, "LogInfo")
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrModerationRejection)
+			var flagged *flaggedContentError
+			if assert.ErrorAs(t, err, &flagged) {
+				assert.Equal(t, tt.flagged, flagged.categories)
+			}
+			api.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPostThreshold(t *testing.T) {
+	replyThreshold := 6
+	policy := newModerationPolicy(4, nil, map[string]int{"support": 2}, nil, nil)
+
+	root := &model.Post{Id: "root", ChannelId: "town-square"}
+	reply := &model.Post{Id: "reply", ChannelId: "town-square", RootId: "root"}
+	assert.Equal(t, 4, policy.postThreshold(nil, reply), "replies use the global threshold by default")
+
+	policy.replyThreshold = &replyThreshold
+	assert.Equal(t, 4, policy.postThreshold(nil, root))
+	assert.Equal(t, 6, policy.postThreshold(nil, reply))
+
+	// Channel thresholds take precedence over the reply threshold
+	assert.Equal(t, 2, policy.postThreshold(nil, &model.Post{Id: "reply", ChannelId: "support", RootId: "root"}))
+}
+
+func TestCheckWarning(t *testing.T) {
+	policy := newModerationPolicy(4, nil, nil, map[string]struct{}{"violence": {}}, nil)
+
+	api := &plugintest.API{}
+	assert.NoError(t, policy.checkWarning(api, "post1", moderation.Decision{Result: moderation.Result{"Hate": 3}}), "warnings are off by default")
+
+	policy.warnThreshold = 2
+	api.On("LogInfo", "Content is above the warn threshold", "post_id", "post1", "warn_threshold", 2, "categories", "Hate: 3").Return()
+
+	err := policy.checkWarning(api, "post1", moderation.Decision{Result: moderation.Result{"Hate": 3, "Sexual": 1, "Violence": 3}})
+	assert.NotErrorIs(t, err, ErrModerationRejection)
+	var warned *warnedContentError
+	if assert.ErrorAs(t, err, &warned) {
+		assert.Equal(t, moderation.Result{"Hate": 3}, warned.categories)
+	}
+	assert.NoError(t, policy.checkWarning(api, "post1", moderation.Decision{Result: moderation.Result{"Hate": 1, "Violence": 5}}))
+	api.AssertExpectations(t)
+}
+
+func TestLogFlaggedResult(t *testing.T) {
+	policy := newModerationPolicy(4, nil, nil, nil, nil)
+
+	t.Run("How the decision was reached is logged", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "post1", "severity_threshold", 4, "computed_severity_Blocklist", 6,
+			"severity_breakdown", "Blocklist: 6, Hate: 2",
+			"providers", "azure,blocklist", "language", "de", "blocklist_match", true).Return().Once()
+
+		decision := moderation.Decision{Result: moderation.Result{"Blocklist": 6, "Hate": 2}, Providers: []string{"azure", "blocklist"}, Language: "de"}
+		err := policy.checkResult(api, "post1", "town-square", decision)
+
+		var flagged *flaggedContentError
+		require.ErrorAs(t, err, &flagged)
+		assert.Equal(t, decision, flagged.decision)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Unknown details are left out", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "post1", "severity_threshold", 4, "computed_severity_Hate", 5,
+			"severity_breakdown", "Hate: 5").Return().Once()
+
+		policy.logFlaggedResult(api, "post1", moderation.Decision{Result: moderation.Result{"Hate": 5}}, 4)
+		api.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// pluginID is the id of the plugin in plugin.json, used to route the buttons
+// of interactive messages back to the plugin
+const pluginID = "com.mattermost.content-moderation"
+
+const (
+	// policyAcknowledgementKeyPrefix prefixes the KV keys recording which
+	// version of the moderation policy each user was sent and acknowledged
+	policyAcknowledgementKeyPrefix = "policy_ack_"
+
+	// acknowledgePolicyPath is the endpoint the acknowledge button calls
+	acknowledgePolicyPath = "/api/v1/policy/acknowledge"
+
+	acknowledgePolicyActionID = "acknowledgepolicy"
+)
+
+// policyNotice is the moderation policy sent to users the first time one of
+// their posts is moderated, with a button to acknowledge it. All methods are
+// safe to call on a nil notice, which sends nothing.
+type policyNotice struct {
+	text string
+
+	// version identifies the policy text, so that users are sent the policy
+	// again once it changes
+	version string
+}
+
+// newPolicyNotice returns the policy notice, or nil when users are not asked
+// to acknowledge the moderation policy
+func newPolicyNotice(enabled bool, text string) (*policyNotice, error) {
+	if !enabled {
+		return nil, nil
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, errors.New("moderation policy text is required when policy acknowledgement is enabled")
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	return &policyNotice{text: text, version: hex.EncodeToString(sum[:8])}, nil
+}
+
+// policyAcknowledgement records when a user was sent a version of the
+// moderation policy and when they acknowledged it
+type policyAcknowledgement struct {
+	Version        string `json:"version"`
+	SentAt         int64  `json:"sent_at"`
+	AcknowledgedAt int64  `json:"acknowledged_at,omitempty"`
+}
+
+// send sends the policy to the user in their DM channel with the bot, unless
+// the user was already sent this version of it
+func (n *policyNotice) send(api plugin.API, botID, userID, dmChannelID string, messages notificationMessages) error {
+	if n == nil {
+		return nil
+	}
+
+	record, found, err := loadPolicyAcknowledgement(api, userID)
+	if err != nil {
+		return err
+	}
+	if found && record.Version == n.version {
+		return nil
+	}
+
+	post := &model.Post{
+		UserId:    botID,
+		ChannelId: dmChannelID,
+		Message:   messages.policyNotice,
+	}
+	post.AddProp("attachments", []*model.SlackAttachment{{
+		Text: n.text,
+		Actions: []*model.PostAction{{
+			Id:    acknowledgePolicyActionID,
+			Type:  model.PostActionTypeButton,
+			Name:  messages.acknowledgePolicy,
+			Style: "primary",
+			Integration: &model.PostActionIntegration{
+				URL:     "/plugins/" + pluginID + acknowledgePolicyPath,
+				Context: map[string]any{"user_id": userID, "version": n.version},
+			},
+		}},
+	}})
+	if _, appErr := api.CreatePost(post); appErr != nil {
+		return errors.Wrap(appErr, "failed to send moderation policy")
+	}
+
+	return savePolicyAcknowledgement(api, userID, policyAcknowledgement{Version: n.version, SentAt: model.GetMillis()})
+}
+
+// acknowledgePolicy handles the acknowledge button of the moderation policy,
+// recording when the user acknowledged it and removing the button. The
+// request only names the policy message: the message must have been sent by
+// the bot to the user in their DM with it, and the version acknowledged is the
+// one recorded when the policy was sent.
+func (p *Plugin) acknowledgePolicy(w http.ResponseWriter, r *http.Request) {
+	userID := r.Header.Get("Mattermost-User-ID")
+
+	var request model.PostActionIntegrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	processor := p.getProcessor()
+	if processor == nil {
+		http.Error(w, "content moderation is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	post, appErr := p.API.GetPost(request.PostId)
+	if appErr != nil {
+		http.Error(w, "Not authorized", http.StatusForbidden)
+		return
+	}
+
+	dmChannel, appErr := p.API.GetDirectChannel(userID, processor.botID)
+	if appErr != nil {
+		http.Error(w, "failed to get direct channel", http.StatusInternalServerError)
+		p.API.LogError("failed to get direct channel", "user_id", userID, "error", appErr.Error())
+		return
+	}
+
+	// Only the user the policy was sent to can acknowledge it
+	sentVersion, ok := policyNoticeVersion(post, processor.botID, userID, dmChannel.Id)
+	if !ok {
+		http.Error(w, "Not authorized", http.StatusForbidden)
+		return
+	}
+
+	record, found, err := loadPolicyAcknowledgement(p.API, userID)
+	if err != nil {
+		http.Error(w, "failed to load policy acknowledgement", http.StatusInternalServerError)
+		p.API.LogError("failed to load policy acknowledgement", "user_id", userID, "error", err.Error())
+		return
+	}
+
+	messages := messagesForLocale(userLocale(p.API, userID))
+	var response model.PostActionIntegrationResponse
+
+	if !found || record.Version != sentVersion {
+		// The policy changed after this message was sent, and the user is
+		// sent the new version the next time one of their posts is moderated
+		response.EphemeralText = messages.policyOutdated
+	} else {
+		if record.AcknowledgedAt == 0 {
+			record.AcknowledgedAt = model.GetMillis()
+			if err := savePolicyAcknowledgement(p.API, userID, record); err != nil {
+				http.Error(w, "failed to save policy acknowledgement", http.StatusInternalServerError)
+				p.API.LogError("failed to save policy acknowledgement", "user_id", userID, "error", err.Error())
+				return
+			}
+			p.API.LogInfo("User acknowledged the moderation policy", "user_id", userID, "version", record.Version)
+		}
+		response.Update = acknowledgedPolicyPost(post, messages)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
+
+// policyNoticeVersion returns the policy version of a policy message sent by
+// the bot to the user in their DM channel with it, and whether the post is
+// such a message
+func policyNoticeVersion(post *model.Post, botID, userID, dmChannelID string) (string, bool) {
+	if post.UserId != botID || post.ChannelId != dmChannelID {
+		return "", false
+	}
+
+	for _, attachment := range post.Attachments() {
+		for _, action := range attachment.Actions {
+			if action == nil || action.Id != acknowledgePolicyActionID || action.Integration == nil {
+				continue
+			}
+			if recipient, _ := action.Integration.Context["user_id"].(string); recipient != userID {
+				continue
+			}
+			version, _ := action.Integration.Context["version"].(string)
+			return version, true
+		}
+	}
+	return "", false
+}
+
+// acknowledgedPolicyPost returns the policy message with its button replaced
+// by a confirmation
+func acknowledgedPolicyPost(post *model.Post, messages notificationMessages) *model.Post {
+	updated := post.Clone()
+	updated.Message = messages.policyAcknowledged
+	attachments := post.Attachments()
+	for i, attachment := range attachments {
+		cleared := *attachment
+		cleared.Actions = nil
+		attachments[i] = &cleared
+	}
+	updated.AddProp("attachments", attachments)
+	return updated
+}
+
+// loadPolicyAcknowledgement returns the policy acknowledgement record of the
+// user, if any
+func loadPolicyAcknowledgement(api plugin.API, userID string) (policyAcknowledgement, bool, error) {
+	var record policyAcknowledgement
+
+	data, appErr := api.KVGet(policyAcknowledgementKeyPrefix + userID)
+	if appErr != nil {
+		return record, false, errors.Wrap(appErr, "failed to load policy acknowledgement")
+	}
+	if data == nil {
+		return record, false, nil
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, false, errors.Wrap(err, "failed to decode policy acknowledgement")
+	}
+	return record, true, nil
+}
+
+// savePolicyAcknowledgement persists the policy acknowledgement record of the
+// user
+func savePolicyAcknowledgement(api plugin.API, userID string, record policyAcknowledgement) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode policy acknowledgement")
+	}
+	if appErr := api.KVSet(policyAcknowledgementKeyPrefix+userID, data); appErr != nil {
+		return errors.Wrap(appErr, "failed to save policy acknowledgement")
+	}
+	return nil
+}
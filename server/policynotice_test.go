@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPolicyNotice(t *testing.T) {
+	notice, err := newPolicyNotice(false, "Be kind.")
+	require.NoError(t, err)
+	assert.Nil(t, notice)
+
+	_, err = newPolicyNotice(true, " ")
+	assert.Error(t, err)
+
+	notice, err = newPolicyNotice(true, "Be kind.")
+	require.NoError(t, err)
+	changed, err := newPolicyNotice(true, "Be very kind.")
+	require.NoError(t, err)
+	assert.NotEqual(t, notice.version, changed.version)
+}
+
+func TestPolicyNotice(t *testing.T) {
+	const key = policyAcknowledgementKeyPrefix + "user1"
+
+	notice, err := newPolicyNotice(true, "Be kind.")
+	require.NoError(t, err)
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+	newAPI := func() *plugintest.API {
+		api := &plugintest.API{}
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Locale: "de"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(p *model.Post) bool {
+			return p.ChannelId == "channel1" || (p.ChannelId == "dm" && p.Message == "Removed.")
+		})).Return(&model.Post{}, nil)
+		return api
+	}
+
+	isPolicy := func(p *model.Post) bool {
+		return p.ChannelId == "dm" && p.Message == notificationTranslations["de"].policyNotice
+	}
+
+	processor := &PostProcessor{
+		botID:         "bot",
+		notifications: &notificationSettings{channelTemplate: "Post removed.", dmTemplate: "Removed.", dmContentMode: dmContentNone, policy: notice},
+	}
+
+	t.Run("First flag sends the policy", func(t *testing.T) {
+		api := newAPI()
+		api.On("KVGet", key).Return(nil, nil)
+		api.On("CreatePost", mock.MatchedBy(isPolicy)).Return(&model.Post{}, nil).Once()
+		api.On("KVSet", key, mock.MatchedBy(func(data []byte) bool {
+			var record policyAcknowledgement
+			return json.Unmarshal(data, &record) == nil && record.Version == notice.version && record.SentAt > 0 && record.AcknowledgedAt == 0
+		})).Return(nil).Once()
+
+		require.NoError(t, processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4}))
+
+		api.AssertExpectations(t)
+		for _, call := range api.Calls {
+			if sent := call.Arguments.Get(0); call.Method == "CreatePost" && isPolicy(sent.(*model.Post)) {
+				attachments := sent.(*model.Post).Attachments()
+				require.Len(t, attachments, 1)
+				assert.Equal(t, "Be kind.", attachments[0].Text)
+				require.Len(t, attachments[0].Actions, 1)
+				assert.Equal(t, notificationTranslations["de"].acknowledgePolicy, attachments[0].Actions[0].Name)
+				assert.Equal(t, "/plugins/"+pluginID+acknowledgePolicyPath, attachments[0].Actions[0].Integration.URL)
+			}
+		}
+	})
+
+	t.Run("Subsequent flags skip the policy", func(t *testing.T) {
+		data, err := json.Marshal(policyAcknowledgement{Version: notice.version, SentAt: 1})
+		require.NoError(t, err)
+
+		api := newAPI()
+		api.On("KVGet", key).Return(data, nil)
+
+		require.NoError(t, processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4}))
+
+		api.AssertNumberOfCalls(t, "CreatePost", 2)
+		api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Changed policy is sent again", func(t *testing.T) {
+		data, err := json.Marshal(policyAcknowledgement{Version: "previous", SentAt: 1, AcknowledgedAt: 2})
+		require.NoError(t, err)
+
+		api := newAPI()
+		api.On("KVGet", key).Return(data, nil)
+		api.On("CreatePost", mock.MatchedBy(isPolicy)).Return(&model.Post{}, nil).Once()
+		api.On("KVSet", key, mock.Anything).Return(nil).Once()
+
+		require.NoError(t, processor.reportModerationEvent(api, post, moderation.Result{"Hate": 4}))
+
+		api.AssertExpectations(t)
+	})
+}
+
+func TestAcknowledgePolicy(t *testing.T) {
+	const key = policyAcknowledgementKeyPrefix + "user1"
+
+	sent, err := json.Marshal(policyAcknowledgement{Version: "v1", SentAt: 1})
+	require.NoError(t, err)
+
+	policyPost := func(channelID, recipient, version string) *model.Post {
+		post := &model.Post{Id: "policypost", UserId: "bot", ChannelId: channelID, Message: notificationTranslations["en"].policyNotice}
+		post.AddProp("attachments", []*model.SlackAttachment{{
+			Text: "Be kind.",
+			Actions: []*model.PostAction{{
+				Id: acknowledgePolicyActionID,
+				Integration: &model.PostActionIntegration{
+					Context: map[string]any{"user_id": recipient, "version": version},
+				},
+			}},
+		}})
+		return post
+	}
+
+	// The request context is ignored: the recipient and version are taken
+	// from the stored policy message and acknowledgement record
+	acknowledge := func(api *plugintest.API, userID string) *httptest.ResponseRecorder {
+		p := &Plugin{processor: &PostProcessor{botID: "bot"}}
+		p.SetAPI(api)
+
+		body, err := json.Marshal(model.PostActionIntegrationRequest{
+			UserId:  userID,
+			PostId:  "policypost",
+			Context: map[string]any{"user_id": userID, "version": "forged"},
+		})
+		require.NoError(t, err)
+
+		r := httptest.NewRequest(http.MethodPost, acknowledgePolicyPath, strings.NewReader(string(body)))
+		r.Header.Set("Mattermost-User-ID", userID)
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("Acknowledgement is recorded and the message updated", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetPost", "policypost").Return(policyPost("dm", "user1", "v1"), nil)
+		api.On("GetDirectChannel", "user1", "bot").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("KVGet", key).Return(sent, nil)
+		api.On("KVSet", key, mock.MatchedBy(func(data []byte) bool {
+			var record policyAcknowledgement
+			return json.Unmarshal(data, &record) == nil && record.Version == "v1" && record.SentAt == 1 && record.AcknowledgedAt > 0
+		})).Return(nil).Once()
+		api.On("LogInfo", "User acknowledged the moderation policy", "user_id", "user1", "version", "v1").Return()
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+
+		w := acknowledge(api, "user1")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var response model.PostActionIntegrationResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		require.NotNil(t, response.Update)
+		assert.Equal(t, notificationTranslations["en"].policyAcknowledged, response.Update.Message)
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "HasPermissionTo", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Only the recipient can acknowledge the policy", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetPost", "policypost").Return(policyPost("dm2", "user1", "v1"), nil)
+		api.On("GetDirectChannel", "user2", "bot").Return(&model.Channel{Id: "dm2"}, nil)
+
+		w := acknowledge(api, "user2")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Posts other than policy messages are rejected", func(t *testing.T) {
+		for name, post := range map[string]*model.Post{
+			"post by another user":        {Id: "policypost", UserId: "user2", ChannelId: "dm"},
+			"bot post in another channel": policyPost("town-square", "user1", "v1"),
+			"bot post without the button": {Id: "policypost", UserId: "bot", ChannelId: "dm", Message: "secret"},
+		} {
+			t.Run(name, func(t *testing.T) {
+				api := &plugintest.API{}
+				api.On("GetPost", "policypost").Return(post, nil)
+				api.On("GetDirectChannel", "user1", "bot").Return(&model.Channel{Id: "dm"}, nil)
+
+				w := acknowledge(api, "user1")
+				assert.Equal(t, http.StatusForbidden, w.Code)
+				assert.NotContains(t, w.Body.String(), "secret")
+				api.AssertNotCalled(t, "KVGet", mock.Anything)
+				api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+			})
+		}
+	})
+
+	t.Run("Missing posts are rejected", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetPost", "policypost").Return(nil, model.NewAppError("GetPost", "not_found", nil, "", http.StatusNotFound))
+
+		w := acknowledge(api, "user1")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+	})
+
+	t.Run("Outdated policy is not acknowledged", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetPost", "policypost").Return(policyPost("dm", "user1", "v0"), nil)
+		api.On("GetDirectChannel", "user1", "bot").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("KVGet", key).Return(sent, nil)
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+
+		w := acknowledge(api, "user1")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response model.PostActionIntegrationResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.Equal(t, notificationTranslations["en"].policyOutdated, response.EphemeralText)
+		assert.Nil(t, response.Update)
+		api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+	})
+}
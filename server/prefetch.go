@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// prefetchResults moderates the texts of posts about to be queued in batches,
+// when the moderator checks several texts per request, so that scanning
+// channel history takes far fewer requests. Workers then use these results
+// instead of moderating each text again. Texts that workers moderate
+// differently, such as short messages, texts in a detected language and
+// texts split into chunks, are left to the workers.
+func (p *PostProcessor) prefetchResults(ctx context.Context, api plugin.API, posts []*model.Post) {
+	batchSize := moderation.MaxBatchSize(p.moderator)
+	if batchSize <= 0 || (p.languages != nil && p.languages.detector != nil) || !p.policy.moderating() {
+		return
+	}
+
+	maxLength := 0
+	if limiter, ok := p.moderator.(moderation.TextLengthLimiter); ok {
+		maxLength = limiter.MaxTextLength()
+	}
+
+	seen := make(map[string]struct{}, len(posts))
+	texts := make([]string, 0, len(posts))
+	for _, post := range posts {
+		if !p.shouldModerateUser(post.UserId) || !p.shouldModerateChannel(post.ChannelId) {
+			continue
+		}
+
+		text := moderatedText(post, p.moderateAttachments)
+		if text == "" || p.shortMessages.isShort(text) {
+			continue
+		}
+		if p.stripMarkdown {
+			text = moderation.StripMarkdown(text)
+		}
+		if p.textLimit.exceeds(text) {
+			if !p.textLimit.truncates() {
+				continue
+			}
+			text = p.textLimit.truncate(text)
+		}
+		if text == "" || (maxLength > 0 && utf8.RuneCountInString(text) > maxLength) {
+			continue
+		}
+
+		if _, ok := seen[text]; ok {
+			continue
+		}
+		seen[text] = struct{}{}
+		texts = append(texts, text)
+	}
+
+	for start := 0; start < len(texts); start += batchSize {
+		batch := texts[start:min(start+batchSize, len(texts))]
+
+		p.waitForRateLimit()
+		results, err := p.moderateTextBatch(ctx, batch)
+		if err != nil {
+			api.LogDebug("Failed to moderate texts in a batch, moderating each post on its own", "texts", len(batch), "err", err)
+			return
+		}
+		p.storePrefetched(batch, results)
+	}
+}
+
+// moderateTextBatch sends a single batch moderation request, recording its
+// latency and any failure
+func (p *PostProcessor) moderateTextBatch(ctx context.Context, texts []string) ([]moderation.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.moderationTimeout())
+	defer cancel()
+
+	start := time.Now()
+	results, err := moderation.ModerateTexts(ctx, p.moderator, texts)
+	p.metrics.observeLatency(time.Since(start))
+	if err != nil {
+		p.metrics.providerError()
+	}
+	return results, err
+}
+
+// storePrefetched keeps the results of the texts until workers take them.
+// Results of posts that are never moderated, such as posts deleted while
+// queued, would otherwise pile up, so the results are dropped once they
+// outnumber the posts the queues can hold.
+func (p *PostProcessor) storePrefetched(texts []string, results []moderation.Result) {
+	p.prefetchMu.Lock()
+	defer p.prefetchMu.Unlock()
+
+	if p.prefetched == nil || len(p.prefetched)+len(texts) > p.queueCapacity() {
+		p.prefetched = make(map[string]moderation.Result, len(texts))
+	}
+	for i, text := range texts {
+		p.prefetched[text] = results[i]
+	}
+}
+
+// takePrefetched returns and forgets the prefetched result of the text, if any
+func (p *PostProcessor) takePrefetched(text string) (moderation.Result, bool) {
+	p.prefetchMu.Lock()
+	defer p.prefetchMu.Unlock()
+
+	result, ok := p.prefetched[text]
+	if ok {
+		delete(p.prefetched, text)
+	}
+	return result, ok
+}
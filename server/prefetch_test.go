@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockBatchModerator is a MockModerator that also moderates texts in batches
+// of two
+type MockBatchModerator struct {
+	MockModerator
+}
+
+func (m *MockBatchModerator) ModerateTexts(ctx context.Context, texts []string) ([]moderation.Result, error) {
+	args := m.Called(ctx, texts)
+	results, _ := args.Get(0).([]moderation.Result)
+	return results, args.Error(1)
+}
+
+func (m *MockBatchModerator) MaxBatchSize() int {
+	return 2
+}
+
+func TestPrefetchResults(t *testing.T) {
+	channelID := model.NewId()
+
+	newProcessor := func(moderator moderation.Moderator) *PostProcessor {
+		return &PostProcessor{
+			botID:     "bot",
+			moderator: moderator,
+			policy:    newModerationPolicy(4, nil, nil, nil, nil),
+			postsCh:   make(chan *model.Post, 10),
+			retry:     &retryPolicy{maxAttempts: 1},
+		}
+	}
+
+	t.Run("Scanned texts are moderated in batches", func(t *testing.T) {
+		posts := []*model.Post{
+			{Id: "third", UserId: "user1", ChannelId: channelID, Message: "third message", CreateAt: 300},
+			{Id: "bot", UserId: "bot", ChannelId: channelID, Message: "bot message", CreateAt: 250},
+			{Id: "second", UserId: "user1", ChannelId: channelID, Message: "offensive message", CreateAt: 200},
+			{Id: "first", UserId: "user1", ChannelId: channelID, Message: "first message", CreateAt: 100},
+		}
+		list := &model.PostList{Posts: map[string]*model.Post{}}
+		for _, post := range posts {
+			list.Order = append(list.Order, post.Id)
+			list.Posts[post.Id] = post
+		}
+
+		api := &plugintest.API{}
+		api.On("GetPostsForChannel", channelID, 0, scanPageSize).Return(list, nil)
+		api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+		api.On("KVDelete", mock.AnythingOfType("string")).Return(nil)
+
+		// Anything matches missing arguments, so this matches every info log
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+		// The bot post is never queued nor moderated, so its text is not sent
+		moderator := &MockBatchModerator{}
+		moderator.On("ModerateTexts", mock.Anything, []string{"third message", "offensive message"}).
+			Return([]moderation.Result{{"hate": 0}, {"hate": 6}}, nil).Once()
+		moderator.On("ModerateTexts", mock.Anything, []string{"first message"}).
+			Return([]moderation.Result{{"hate": 0}}, nil).Once()
+
+		processor := newProcessor(moderator)
+		p := &Plugin{processor: processor}
+		p.SetAPI(api)
+
+		status := &scanStatus{ChannelID: channelID, Until: 350, State: scanStateRunning}
+		p.runScan(t.Context(), status)
+		require.Equal(t, 3, status.Queued)
+
+		// Workers use the batch results instead of moderating each text
+		flagged := map[string]bool{}
+		for len(processor.postsCh) > 0 {
+			post := <-processor.postsCh
+			flagged[post.Id] = errors.Is(processor.moderatePost(api, post), ErrModerationRejection)
+		}
+		assert.Equal(t, map[string]bool{"third": false, "second": true, "first": false}, flagged)
+		moderator.AssertExpectations(t)
+		moderator.AssertNotCalled(t, "ModerateText", mock.Anything, mock.Anything)
+		assert.Empty(t, processor.prefetched)
+	})
+
+	t.Run("Failed batches leave texts to the workers", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogDebug", "Failed to moderate texts in a batch, moderating each post on its own", "texts", 1, "err", mock.Anything).Return().Once()
+
+		moderator := &MockBatchModerator{}
+		moderator.On("ModerateTexts", mock.Anything, []string{"message"}).Return(nil, errors.New("unavailable")).Once()
+		moderator.On("ModerateText", mock.Anything, "message").Return(moderation.Result{"hate": 0}, nil).Once()
+
+		processor := newProcessor(moderator)
+		post := &model.Post{Id: "post1", UserId: "user1", ChannelId: channelID, Message: "message"}
+		processor.prefetchResults(t.Context(), api, []*model.Post{post})
+
+		require.NoError(t, processor.moderatePost(api, post))
+		moderator.AssertExpectations(t)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Moderators without batches are not called ahead of workers", func(t *testing.T) {
+		moderator := &MockModerator{}
+		processor := newProcessor(moderator)
+		processor.prefetchResults(t.Context(), &plugintest.API{}, []*model.Post{{Id: "post1", UserId: "user1", Message: "message"}})
+
+		moderator.AssertNotCalled(t, "ModerateText", mock.Anything, mock.Anything)
+		assert.Empty(t, processor.prefetched)
+	})
+
+	t.Run("Results are dropped once they outnumber the queue", func(t *testing.T) {
+		processor := &PostProcessor{postsCh: make(chan *model.Post, 2)}
+		processor.storePrefetched([]string{"one", "two"}, []moderation.Result{{}, {}})
+		processor.storePrefetched([]string{"three"}, []moderation.Result{{"hate": 2}})
+
+		assert.Equal(t, map[string]moderation.Result{"three": {"hate": 2}}, processor.prefetched)
+		result, ok := processor.takePrefetched("three")
+		assert.True(t, ok)
+		assert.Equal(t, moderation.Result{"hate": 2}, result)
+		_, ok = processor.takePrefetched("three")
+		assert.False(t, ok)
+	})
+}
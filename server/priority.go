@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// setPriorityChannels moderates the posts of the given channels before any
+// other queued post. Priority posts have their own queue of the same size as
+// the queue of other posts. It must be called before the processor is
+// started.
+func (p *PostProcessor) setPriorityChannels(channelIDs map[string]struct{}) {
+	if len(channelIDs) == 0 {
+		return
+	}
+
+	p.priorityChannels = channelIDs
+	p.priorityCh = make(chan *model.Post, cap(p.postsCh))
+}
+
+// queueFor returns the queue of posts in the channel
+func (p *PostProcessor) queueFor(channelID string) chan *model.Post {
+	if _, ok := p.priorityChannels[channelID]; ok {
+		return p.priorityCh
+	}
+	return p.postsCh
+}
+
+// nextPost waits for the next queued post, taking priority posts first. Each
+// queue is moderated in the order its posts were queued. It returns false
+// once every queue is closed and empty.
+func (p *PostProcessor) nextPost() (*model.Post, bool) {
+	select {
+	case post, ok := <-p.priorityCh:
+		if ok {
+			return post, true
+		}
+	default:
+	}
+
+	// Closed queues are set to nil, which is never ready, so that waiting
+	// continues on the queue still open
+	priorityCh, postsCh := p.priorityCh, p.postsCh
+	for priorityCh != nil || postsCh != nil {
+		select {
+		case post, ok := <-priorityCh:
+			if ok {
+				return post, true
+			}
+			priorityCh = nil
+		case post, ok := <-postsCh:
+			if ok {
+				return post, true
+			}
+			postsCh = nil
+		}
+	}
+	return nil, false
+}
+
+// queueCapacity returns the number of posts the queues can hold
+func (p *PostProcessor) queueCapacity() int {
+	return cap(p.postsCh) + cap(p.priorityCh)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// orderModerator records the order in which texts are moderated. The first
+// request blocks until released, so that a backlog builds up behind it.
+type orderModerator struct {
+	started chan struct{}
+	release chan struct{}
+
+	mu    sync.Mutex
+	texts []string
+}
+
+func (m *orderModerator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	m.mu.Lock()
+	m.texts = append(m.texts, text)
+	first := len(m.texts) == 1
+	m.mu.Unlock()
+
+	if first {
+		close(m.started)
+		<-m.release
+	}
+	return moderation.Result{}, nil
+}
+
+func (m *orderModerator) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+func TestPriorityChannels(t *testing.T) {
+	newProcessor := func(t *testing.T, moderator moderation.Moderator, workerCount int) *PostProcessor {
+		settings := testProcessorSettings(moderator)
+		settings.postsPerMinuteLimit = 60000
+		settings.workerCount = workerCount
+		settings.maxQueueSize = minQueueSize
+		settings.priorityChannels = map[string]struct{}{"urgent": {}}
+		processor, err := newPostProcessor(settings)
+		require.NoError(t, err)
+		return processor
+	}
+
+	newAPI := func() *plugintest.API {
+		api := &plugintest.API{}
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+		api.On("KVDelete", mock.Anything).Return(nil)
+		return api
+	}
+
+	queue := func(processor *PostProcessor, api *plugintest.API, id, channelID string) {
+		processor.queuePostForProcessing(api, &model.Post{Id: id, UserId: "user1", ChannelId: channelID, Message: id})
+	}
+
+	t.Run("Priority posts are taken first, in order", func(t *testing.T) {
+		api := newAPI()
+		processor := newProcessor(t, &MockModerator{}, 1)
+
+		queue(processor, api, "normal1", "town-square")
+		queue(processor, api, "normal2", "town-square")
+		queue(processor, api, "urgent1", "urgent")
+		queue(processor, api, "normal3", "town-square")
+		queue(processor, api, "urgent2", "urgent")
+		assert.Equal(t, 5, processor.queueDepth())
+		assert.Equal(t, 2*minQueueSize, processor.queueCapacity())
+
+		// Both queues are drained after stop
+		processor.stop()
+
+		var ids []string
+		for {
+			post, ok := processor.nextPost()
+			if !ok {
+				break
+			}
+			ids = append(ids, post.Id)
+		}
+		assert.Equal(t, []string{"urgent1", "urgent2", "normal1", "normal2", "normal3"}, ids)
+	})
+
+	t.Run("Priority post queued behind a backlog is moderated next", func(t *testing.T) {
+		api := newAPI()
+		moderator := &orderModerator{started: make(chan struct{}), release: make(chan struct{})}
+		processor := newProcessor(t, moderator, 1)
+		processor.start(api)
+
+		// The only worker is busy while a backlog builds up
+		queue(processor, api, "normal0", "town-square")
+		<-moderator.started
+		for _, id := range []string{"normal1", "normal2", "normal3"} {
+			queue(processor, api, id, "town-square")
+		}
+		queue(processor, api, "urgent1", "urgent")
+		close(moderator.release)
+
+		require.True(t, processor.drain(5*time.Second))
+		assert.Equal(t, []string{"normal0", "urgent1", "normal1", "normal2", "normal3"}, moderator.texts)
+	})
+
+	t.Run("Without priority channels every post shares one queue", func(t *testing.T) {
+		processor := &PostProcessor{postsCh: make(chan *model.Post, 10)}
+		processor.setPriorityChannels(map[string]struct{}{})
+
+		assert.Nil(t, processor.priorityCh)
+		assert.Equal(t, processor.postsCh, processor.queueFor("urgent"))
+		assert.Equal(t, 10, processor.queueCapacity())
+	})
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
@@ -12,197 +14,1142 @@ import (
 )
 
 // The current Azure rate limit is 1000 posts per minute.
-// Using half of that to give us some wiggle room:
+// Using half of that as the default to give us some wiggle room:
 // https://learn.microsoft.com/en-us/azure/ai-services/content-safety/faq
 const (
-	maxProcessingQueueSize = 10000
-	postsPerMinuteLimit    = 500
-	processingInterval     = 1 / postsPerMinuteLimit * time.Minute
+	defaultMaxQueueSize        = 10000
+	minQueueSize               = 100
+	defaultPostsPerMinuteLimit = 500
+	defaultWorkerCount         = 4
+
+	// maxPostsPerMinuteLimit keeps the processing interval at a millisecond
+	// or more, well above any provider's rate limit
+	maxPostsPerMinuteLimit = 60000
 )
 
-// Message templates for moderation notifications
+// queueDrainTimeout bounds how long deactivation waits for queued posts to be
+// moderated. Posts still queued afterwards stay persisted and are moderated
+// once the plugin is activated again.
+const queueDrainTimeout = 10 * time.Second
+
+// maxImageSize is the largest image accepted by Azure AI Content Safety.
+// Larger images are scaled down before they are moderated.
+const maxImageSize = 4 * 1024 * 1024
+
+// Message templates for moderation notifications that are not localized.
+// Notifications sent to users are in notifications.go.
 const (
-	channelNotificationTemplate = "_A post with potentially offensive content was flagged and removed._"
-	dmNotificationTemplate      = "_Your post with the following content was flagged and removed:_\n\n%s"
+	reviewNotificationTemplate         = "_A post with potentially offensive content was flagged for review:_ %s"
+	oversizedImageNotificationTemplate = "_A post with images too large to moderate was held for review:_ %s"
+	redactedMessage                    = "_This message was redacted by content moderation._"
+
+	pendingDeletionNotificationTemplate = "_A post with potentially offensive content will be removed in %s unless a moderator keeps it:_ %s\n" +
+		"React to it with :" + keepPostEmoji + ": or run `/moderation cancel-deletion %s` to keep it."
 )
 
 var (
 	ErrModerationRejection   = errors.New("potentially inappropriate content detected")
 	ErrModerationUnavailable = errors.New("moderation service is not available")
+	ErrModeratorUnhealthy    = errors.New("moderation provider failed its health check")
 )
 
+// unavailableError is returned when a provider failed to moderate a post. It
+// matches ErrModerationUnavailable while keeping the provider error, so that
+// callers can tell the kind of failure with moderation.KindOf.
+type unavailableError struct {
+	err error
+}
+
+// moderationUnavailable returns an error matching ErrModerationUnavailable
+// caused by the provider error
+func moderationUnavailable(err error) error {
+	if err == nil {
+		return ErrModerationUnavailable
+	}
+	if errors.Is(err, ErrModerationUnavailable) {
+		return err
+	}
+	return &unavailableError{err: err}
+}
+
+func (e *unavailableError) Error() string {
+	return ErrModerationUnavailable.Error() + ": " + e.err.Error()
+}
+
+func (e *unavailableError) Is(target error) bool {
+	return target == ErrModerationUnavailable
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+// unhealthyError is returned when a moderator failed its health check. It
+// matches ErrModeratorUnhealthy while keeping the provider error, like
+// unavailableError.
+type unhealthyError struct {
+	err error
+}
+
+// moderatorUnhealthy returns an error matching ErrModeratorUnhealthy caused by
+// the health check error
+func moderatorUnhealthy(err error) error {
+	if err == nil {
+		return ErrModeratorUnhealthy
+	}
+	return &unhealthyError{err: err}
+}
+
+func (e *unhealthyError) Error() string {
+	return ErrModeratorUnhealthy.Error() + ": " + e.err.Error()
+}
+
+func (e *unhealthyError) Is(target error) bool {
+	return target == ErrModeratorUnhealthy
+}
+
+func (e *unhealthyError) Unwrap() error {
+	return e.err
+}
+
 type PostProcessor struct {
 	botID     string
 	moderator moderation.Moderator
 
-	thresholdValue   int
-	excludedUsers    map[string]struct{}
-	excludedChannels map[string]struct{}
+	policy              *moderationPolicy
+	excludedUsers       map[string]struct{}
+	excludedChannels    map[string]struct{}
+	includedChannels    map[string]struct{}
+	moderateFilenames   bool
+	stripMarkdown       bool
+	moderateAttachments bool
+
+	// imageModerator is set when image moderation is enabled and supported
+	// by the moderator
+	imageModerator moderation.ImageModerator
+
+	// images controls the moderation of images too large for the provider
+	images *imageSettings
+
+	// textFiles controls the moderation of the contents of attached text
+	// files, if set
+	textFiles *textFileSettings
+
+	// edits holds the changed text of edited posts, when edits are moderated
+	// by their delta
+	edits *editDeltas
+
+	// unresolvedExcludedUsers lists the excluded user entries that matched no
+	// user, which are reported by the status command
+	unresolvedExcludedUsers []string
+
+	// reactionModerator moderates the emoji names of reactions, if set
+	reactionModerator moderation.Moderator
+
+	// moderateProfiles moderates usernames and nicknames when users are
+	// created and when they log in
+	moderateProfiles bool
+
+	// shortMessages limits the moderation of very short messages to the
+	// local blocklist, if set
+	shortMessages *shortMessageSettings
+
+	// textLimit caps the length of the text moderated, if set
+	textLimit *textLimitSettings
+
+	// providers lists the configured moderator types, recorded with each
+	// moderation decision
+	providers []string
+
+	postsCh            chan *model.Post
+	processingInterval time.Duration
+	workerCount        int
+
+	// priorityCh queues the posts of priorityChannels, which workers take
+	// before the posts in postsCh. It is nil without priority channels.
+	priorityCh       chan *model.Post
+	priorityChannels map[string]struct{}
+
+	// timeout bounds the moderation of each post, defaulting to
+	// defaultModerationTimeout when unset
+	timeout time.Duration
 
-	postsCh chan *model.Post
+	// ctx is canceled when the plugin is deactivated, aborting the moderation
+	// requests derived from it. Requests derive from context.Background when
+	// it is nil.
+	ctx context.Context
+
+	// queueMu guards closing postsCh and priorityCh, so that no post is sent
+	// to a queue once stop has closed it
+	queueMu sync.RWMutex
+	closed  bool
+
+	// pendingMu guards pending, inFlight and rerun. pending holds the latest
+	// version of every post waiting in a queue, so that repeated edits queue a
+	// post only once. inFlight holds the posts being moderated, and rerun the
+	// changed versions to queue once their moderation completes, so that a
+	// post is never moderated by two workers at a time.
+	pendingMu sync.Mutex
+	pending   map[string]*model.Post
+	inFlight  map[string]*model.Post
+	rerun     map[string]*model.Post
+
+	// workers counts the running workers, including those added while the
+	// queue is backed up
+	workers sync.WaitGroup
+
+	// workersDone is closed once every worker has exited, and is nil until
+	// the processor is started
+	workersDone chan struct{}
+
+	// backpressure adds workers while the queue is backed up, if set
+	backpressure *queueBackpressure
+
+	// prefetchMu guards prefetched, which holds the results of texts
+	// moderated in batches ahead of their posts, keyed by text
+	prefetchMu sync.Mutex
+	prefetched map[string]moderation.Result
+
+	// rescanInterval is how often held posts are retried, and disables the
+	// rescan loop when not positive
+	rescanInterval time.Duration
+
+	// rescanStop is closed by stop to end the rescan loop, and is nil until
+	// the processor is started
+	rescanStop chan struct{}
+
+	// deletionGracePeriod delays the deletion of flagged posts so that
+	// moderators can keep them. Posts are deleted right away when it is not
+	// positive.
+	deletionGracePeriod time.Duration
+
+	// deletionsMu guards deletionTimers, which holds the timers of the
+	// flagged posts waiting to be deleted, and deletionsStopped, which is set
+	// once stop has stopped them
+	deletionsMu      sync.Mutex
+	deletionTimers   map[string]*time.Timer
+	deletionsStopped bool
+
+	// redactions holds the IDs of the posts the bot is redacting, so that the
+	// edits it makes are not queued for moderation again
+	redactions sync.Map
+
+	// limiter is shared by every worker once the processor is started
+	limiter *dispatchLimiter
+
+	// dispatchJitter varies each interval between requests by up to this
+	// fraction of the processing interval either way, drawing from random,
+	// which is replaced in tests
+	dispatchJitter float64
+	random         func() float64
+
+	// inline caps the moderation requests made outside the workers, if set
+	inline *inlineModerationLimiter
+
+	// sleep pauses dispatch while the provider is throttling requests, until
+	// the context is done, and is replaced in tests
+	sleep func(context.Context, time.Duration)
+
+	retry         *retryPolicy
+	action        *flaggedPostAction
+	notifications *notificationSettings
+	audit         *auditSettings
+	teams         *teamSettings
+	languages     *languageSettings
+	integrations  *integrationSettings
+
+	// events stores moderation events for the flagged posts API, if set
+	events moderationEventStore
+
+	// metrics records moderation outcomes, if set
+	metrics *metrics
+
+	// eventWebhooks pushes flagged post events to external services, if set
+	eventWebhooks *eventWebhooks
+
+	// auditStore stores audited moderation decisions, if set
+	auditStore auditStore
+
+	// compliance posts compliance records of moderation actions, if set
+	compliance *complianceSettings
+
+	// degraded is set while the moderation provider is known to be failing
+	degraded atomic.Bool
+
+	// droppedCount counts posts dropped because the queue was full
+	droppedCount atomic.Int64
+
+	// queueFilled is set once the queue first reaches its maximum size
+	queueFilled atomic.Bool
+}
+
+// processorSettings holds everything a PostProcessor is built from. The
+// moderator and the settings without a default are required, and the rest
+// are optional.
+type processorSettings struct {
+	botID     string
+	moderator moderation.Moderator
+	policy    *moderationPolicy
+
+	excludedUsers           map[string]struct{}
+	unresolvedExcludedUsers []string
+	excludedChannels        map[string]struct{}
+	includedChannels        map[string]struct{}
+	priorityChannels        map[string]struct{}
+
+	moderateFilenames   bool
+	moderateImages      bool
+	stripMarkdown       bool
+	moderateAttachments bool
+	moderateProfiles    bool
+
+	postsPerMinuteLimit int
+	dispatchJitter      float64
+	workerCount         int
+	maxQueueSize        int
+	queueHighWaterMark  int
+	queueLowWaterMark   int
+	timeout             time.Duration
+	deletionGracePeriod time.Duration
+
+	retry         *retryPolicy
+	action        *flaggedPostAction
+	notifications *notificationSettings
+	audit         *auditSettings
+	teams         *teamSettings
+	languages     *languageSettings
+	integrations  *integrationSettings
+
+	images            *imageSettings
+	textFiles         *textFileSettings
+	textLimit         *textLimitSettings
+	shortMessages     *shortMessageSettings
+	edits             *editDeltas
+	inline            *inlineModerationLimiter
+	reactionModerator moderation.Moderator
+
+	providers     []string
+	events        moderationEventStore
+	metrics       *metrics
+	auditStore    auditStore
+	compliance    *complianceSettings
+	eventWebhooks *eventWebhooks
+
+	degraded bool
+	ctx      context.Context
 }
 
-func newPostProcessor(
-	botID string,
-	moderator moderation.Moderator,
-	thresholdValue int,
-	excludedUsers map[string]struct{},
-	excludedChannels map[string]struct{},
-) (*PostProcessor, error) {
-	if moderator == nil {
+func newPostProcessor(settings processorSettings) (*PostProcessor, error) {
+	if settings.moderator == nil {
 		return nil, ErrModerationUnavailable
 	}
-	return &PostProcessor{
-		botID:            botID,
-		moderator:        moderator,
-		thresholdValue:   thresholdValue,
-		excludedUsers:    excludedUsers,
-		excludedChannels: excludedChannels,
-		postsCh:          make(chan *model.Post, maxProcessingQueueSize),
-	}, nil
+
+	if settings.retry == nil {
+		return nil, errors.New("retry policy is required")
+	}
+
+	if settings.action == nil {
+		return nil, errors.New("flagged post action is required")
+	}
+
+	if settings.notifications == nil {
+		return nil, errors.New("notification settings are required")
+	}
+
+	if settings.audit == nil {
+		return nil, errors.New("audit settings are required")
+	}
+
+	if settings.teams == nil {
+		return nil, errors.New("team settings are required")
+	}
+
+	if settings.languages == nil {
+		return nil, errors.New("language settings are required")
+	}
+
+	if settings.integrations == nil {
+		return nil, errors.New("integration settings are required")
+	}
+
+	var imageModerator moderation.ImageModerator
+	if settings.moderateImages {
+		var ok bool
+		if imageModerator, ok = settings.moderator.(moderation.ImageModerator); !ok {
+			return nil, errors.New("image moderation is enabled but the moderator does not support images")
+		}
+	}
+
+	workerCount := settings.workerCount
+	if workerCount <= 0 {
+		workerCount = defaultWorkerCount
+	}
+
+	maxQueueSize := settings.maxQueueSize
+	if maxQueueSize <= 0 {
+		maxQueueSize = defaultMaxQueueSize
+	}
+
+	backpressure, err := newQueueBackpressure(settings.queueHighWaterMark, settings.queueLowWaterMark, maxQueueSize)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load queue backpressure settings")
+	}
+
+	processor := &PostProcessor{
+		botID:                   settings.botID,
+		moderator:               settings.moderator,
+		policy:                  settings.policy,
+		excludedUsers:           settings.excludedUsers,
+		unresolvedExcludedUsers: settings.unresolvedExcludedUsers,
+		excludedChannels:        settings.excludedChannels,
+		includedChannels:        settings.includedChannels,
+		moderateFilenames:       settings.moderateFilenames,
+		stripMarkdown:           settings.stripMarkdown,
+		moderateAttachments:     settings.moderateAttachments,
+		moderateProfiles:        settings.moderateProfiles,
+		imageModerator:          imageModerator,
+		postsCh:                 make(chan *model.Post, maxQueueSize),
+		processingInterval:      processingIntervalForLimit(settings.postsPerMinuteLimit),
+		dispatchJitter:          settings.dispatchJitter,
+		workerCount:             workerCount,
+		backpressure:            backpressure,
+		timeout:                 settings.timeout,
+		deletionGracePeriod:     settings.deletionGracePeriod,
+		rescanInterval:          defaultRescanInterval,
+		sleep:                   sleepContext,
+		random:                  rand.Float64,
+		retry:                   settings.retry,
+		action:                  settings.action,
+		notifications:           settings.notifications,
+		audit:                   settings.audit,
+		teams:                   settings.teams,
+		languages:               settings.languages,
+		integrations:            settings.integrations,
+		images:                  settings.images,
+		textFiles:               settings.textFiles,
+		textLimit:               settings.textLimit,
+		shortMessages:           settings.shortMessages,
+		edits:                   settings.edits,
+		inline:                  settings.inline,
+		reactionModerator:       settings.reactionModerator,
+		providers:               settings.providers,
+		events:                  settings.events,
+		metrics:                 settings.metrics,
+		auditStore:              settings.auditStore,
+		compliance:              settings.compliance,
+		eventWebhooks:           settings.eventWebhooks,
+		ctx:                     settings.ctx,
+	}
+	processor.setPriorityChannels(settings.priorityChannels)
+	processor.setDegraded(settings.degraded)
+
+	return processor, nil
+}
+
+// processingIntervalForLimit returns the delay between moderation requests
+// needed to stay within the given number of posts per minute. Limits that are
+// not positive fall back to the default limit, and limits above the maximum
+// are capped to it.
+func processingIntervalForLimit(postsPerMinuteLimit int) time.Duration {
+	if postsPerMinuteLimit <= 0 {
+		postsPerMinuteLimit = defaultPostsPerMinuteLimit
+	}
+	return time.Minute / time.Duration(min(postsPerMinuteLimit, maxPostsPerMinuteLimit))
 }
 
 func (p *PostProcessor) start(api plugin.API) {
+	// The interval governs real API spend, so always report the effective rate
+	api.LogInfo("Content moderation processor started",
+		"posts_per_minute", int(time.Minute/p.processingInterval),
+		"processing_interval", p.processingInterval.String(),
+		"workers", p.workerCount)
+
+	// The limiter acts as a token bucket shared by every worker, so the
+	// global rate limit holds regardless of the number of workers
+	limiter := newDispatchLimiter(p.dispatchInterval)
+	p.limiter = limiter
+	workersDone := make(chan struct{})
+	p.workersDone = workersDone
+
+	for range p.workerCount {
+		p.workers.Add(1)
+		go p.runWorker(api, false)
+	}
+
+	// Events of the posts moderated while draining the queue are still
+	// delivered, so the webhooks stop only once every worker has exited
+	p.eventWebhooks.start(api)
+
 	go func() {
-		for {
-			post, ok := <-p.postsCh
-			if !ok {
-				return
-			}
+		p.workers.Wait()
+		limiter.Stop()
+		p.eventWebhooks.stop()
+		close(workersDone)
+	}()
 
-			time.Sleep(processingInterval)
+	if p.rescanInterval > 0 {
+		p.rescanStop = make(chan struct{})
+		go p.rescanPendingPosts(api, p.rescanStop)
+	}
+}
 
-			err := p.moderatePost(api, post)
-			if err == nil {
-				continue
-			}
+// runWorker moderates queued posts until the queue is closed and empty.
+// Workers added while the queue is backed up also exit once it drains below
+// its low-water mark.
+func (p *PostProcessor) runWorker(api plugin.API, added bool) {
+	defer p.workers.Done()
 
-			if errors.Is(err, ErrModerationUnavailable) {
-				api.LogError("Content moderation error", "err", err, "post_id", post.Id, "user_id", post.UserId)
-				continue
-			}
+	// Workers keep draining queued posts after stop closes the channel
+	for {
+		post, ok := p.nextPost()
+		if !ok {
+			return
+		}
 
-			if err := api.DeletePost(post.Id); err != nil {
-				api.LogError("Failed to delete post flagged by content moderation", "post_id", post.Id, "err", err)
-			}
+		// Posts still queued once the plugin is deactivated stay persisted,
+		// and are moderated after it restarts
+		post = p.beginProcessing(post)
+		if !p.deactivated() {
+			p.waitForRateLimit()
+			p.processPost(api, post)
+		}
+		p.finishProcessing(api, post)
 
-			if err := p.reportModerationEvent(api, post); err != nil {
-				api.LogError("Failed report content moderation event", "post_id", post.Id, "err", err)
-			}
+		if added && p.backpressure.relieved(api, p.queueDepth()) {
+			return
 		}
-	}()
+	}
+}
+
+func (p *PostProcessor) processPost(api plugin.API, post *model.Post) {
+	err := p.moderatePostWithRetry(api, post)
+	if errors.Is(err, ErrModerationUnavailable) && p.deactivated() {
+		// The request was canceled rather than failed, so the post is neither
+		// retried nor dead-lettered
+		api.LogDebug("Moderation interrupted by plugin deactivation, the post is moderated after the plugin restarts", p.policy.loggedIDs("post_id", post.Id)...)
+		return
+	}
+	if errors.Is(err, ErrModerationUnavailable) {
+		if !p.degraded.Swap(true) {
+			api.LogWarn("Moderation provider is degraded")
+		}
+		api.LogError("Content moderation error", append(p.policy.loggedIDs("post_id", post.Id, "user_id", post.UserId), "err", err)...)
+		p.handleDeadLetter(api, post)
+
+		// Held posts are moderated again by the same delta once the provider
+		// recovers
+		if p.retry.deadLetterAction != deadLetterHold {
+			p.forgetEdit(post)
+		}
+		return
+	}
+
+	p.forgetEdit(post)
+	p.removeQueuedPost(api, post.Id)
+
+	if p.degraded.Swap(false) {
+		api.LogInfo("Moderation provider recovered")
+	}
+
+	if err == nil {
+		return
+	}
+
+	var warned *warnedContentError
+	if errors.As(err, &warned) {
+		p.warnAuthor(api, post, warned.categories)
+		return
+	}
+
+	var flagged *flaggedContentError
+	var categories moderation.Result
+	var decision moderation.Decision
+	if errors.As(err, &flagged) {
+		categories, decision = flagged.categories, flagged.decision
+	}
+
+	p.handleFlaggedPost(api, post, categories, decision)
 }
 
+// moderatePostWithRetry moderates the post, backing off and retrying while the
+// moderation provider is unavailable
+func (p *PostProcessor) moderatePostWithRetry(api plugin.API, post *model.Post) error {
+	for attempt := 1; ; attempt++ {
+		err := p.moderatePost(api, post)
+		if !errors.Is(err, ErrModerationUnavailable) || attempt >= p.retry.maxAttempts || p.deactivated() {
+			return err
+		}
+
+		// Retrying cannot succeed before the circuit breaker lets requests
+		// through again, so give up on the post right away
+		if p.circuitOpen() {
+			api.LogDebug("Moderation provider circuit breaker is open, not retrying", append(p.policy.loggedIDs("post_id", post.Id), "attempt", attempt)...)
+			return err
+		}
+
+		// Rejected credentials keep failing until the configuration changes
+		if kind, _ := moderation.KindOf(err); kind == moderation.ErrorAuth {
+			api.LogDebug("Moderation provider rejected its credentials, not retrying", append(p.policy.loggedIDs("post_id", post.Id), "attempt", attempt)...)
+			return err
+		}
+
+		backoff := p.retry.backoffFor(attempt)
+		api.LogDebug("Retrying content moderation", append(p.policy.loggedIDs("post_id", post.Id), "attempt", attempt, "backoff", backoff.String())...)
+		select {
+		case <-p.baseContext().Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// circuitOpen reports whether the moderator is rejecting requests because its
+// circuit breaker is open
+func (p *PostProcessor) circuitOpen() bool {
+	reporter, ok := p.moderator.(moderation.CircuitReporter)
+	return ok && reporter.CircuitOpen()
+}
+
+func (p *PostProcessor) setDegraded(degraded bool) {
+	p.degraded.Store(degraded)
+}
+
+// stop stops accepting posts. Workers keep moderating the posts already
+// queued and exit once the queue is empty.
 func (p *PostProcessor) stop() {
-	close(p.postsCh)
+	p.queueMu.Lock()
+	defer p.queueMu.Unlock()
+
+	if !p.closed {
+		p.closed = true
+		close(p.postsCh)
+		if p.priorityCh != nil {
+			close(p.priorityCh)
+		}
+		if p.rescanStop != nil {
+			close(p.rescanStop)
+		}
+	}
+
+	// The next processor resumes the pending deletions from their records
+	p.stopDeletionTimers()
+}
+
+// drain stops the processor and waits up to the timeout for the workers to
+// moderate every queued post. It returns false when the timeout passed first.
+func (p *PostProcessor) drain(timeout time.Duration) bool {
+	p.stop()
+
+	if p.workersDone == nil {
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-p.workersDone:
+		return true
+	case <-timer.C:
+		return false
+	}
 }
 
 func (p *PostProcessor) queuePostForProcessing(api plugin.API, post *model.Post) {
-	defer func() {
-		if r := recover(); r != nil {
-			api.LogDebug("Panic occurred while queueing post for processing", "post_id", post.Id, "panic", r)
+	// The bot's own notices are neither moderated nor persisted for
+	// moderation, whichever hook reports them
+	if p.isOwnPost(post) {
+		return
+	}
+
+	// Hold the lock until the post is queued, so that stop cannot close the
+	// channel in between
+	p.queueMu.RLock()
+	defer p.queueMu.RUnlock()
+
+	// Persist before queueing so the post is never in the queue without a
+	// record. Posts arriving after stop are only persisted, and are moderated
+	// once the plugin is activated again.
+	if p.closed {
+		p.persistQueuedPost(api, post.Id)
+		api.LogDebug("Content moderation processor is stopped, deferring post", p.policy.loggedIDs("post_id", post.Id)...)
+		return
+	}
+
+	// A post edited while waiting in the queue is moderated once, in its
+	// latest version. Sending under the lock keeps a worker from taking the
+	// post before it is recorded as pending.
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+	if _, ok := p.pending[post.Id]; ok {
+		p.pending[post.Id] = post
+		return
+	}
+	if current, ok := p.inFlight[post.Id]; ok {
+		// Moderate the post again once the current pass completes, unless
+		// the pass already covers its content
+		if postContentChanged(post, current) {
+			p.persistQueuedPost(api, post.Id)
+			p.rerun[post.Id] = post
+		} else {
+			delete(p.rerun, post.Id)
 		}
-	}()
+		return
+	}
 
+	p.persistQueuedPost(api, post.Id)
+	queue := p.queueFor(post.ChannelId)
 	select {
-	case p.postsCh <- post:
+	case queue <- post:
+		if p.pending == nil {
+			p.pending = make(map[string]*model.Post)
+		}
+		p.pending[post.Id] = post
+		if len(queue) == cap(queue) {
+			p.logQueueFilled(api)
+		}
+		p.checkBackpressure(api)
 	default:
-		api.LogError("Content moderation unable to analyze post: exceeded maximum post queue size", "post_id", post.Id)
+		p.logQueueFilled(api)
+		dropped := p.droppedCount.Add(1)
+		p.metrics.postDropped()
+		p.removeQueuedPost(api, post.Id)
+		api.LogError("Content moderation unable to analyze post: exceeded maximum post queue size", append(p.policy.loggedIDs("post_id", post.Id), "dropped_count", dropped)...)
 	}
 }
 
+// beginProcessing returns the latest version of a post taken from the queue
+// and records it as being moderated
+func (p *PostProcessor) beginProcessing(post *model.Post) *model.Post {
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+
+	if latest, ok := p.pending[post.Id]; ok {
+		delete(p.pending, post.Id)
+		post = latest
+	}
+
+	if p.inFlight == nil {
+		p.inFlight = make(map[string]*model.Post)
+		p.rerun = make(map[string]*model.Post)
+	}
+	p.inFlight[post.Id] = post
+	return post
+}
+
+// finishProcessing records that a post is no longer being moderated, and
+// queues it again if it changed in the meantime
+func (p *PostProcessor) finishProcessing(api plugin.API, post *model.Post) {
+	p.pendingMu.Lock()
+	delete(p.inFlight, post.Id)
+	next, ok := p.rerun[post.Id]
+	delete(p.rerun, post.Id)
+	p.pendingMu.Unlock()
+
+	if ok {
+		p.queuePostForProcessing(api, next)
+	}
+}
+
+// logQueueFilled warns the first time the queue reaches its maximum size, so
+// that operators can tune the size before many posts are dropped
+func (p *PostProcessor) logQueueFilled(api plugin.API) {
+	if !p.queueFilled.Swap(true) {
+		api.LogWarn("Content moderation queue reached its maximum size, further posts are dropped until it drains",
+			"max_queue_size", cap(p.postsCh))
+	}
+}
+
+// droppedPostCount returns the number of posts dropped because the queue was
+// full since the processor was created
+func (p *PostProcessor) droppedPostCount() int64 {
+	return p.droppedCount.Load()
+}
+
+// queueDepth returns the number of posts waiting for moderation
+func (p *PostProcessor) queueDepth() int {
+	return len(p.postsCh) + len(p.priorityCh)
+}
+
 func (p *PostProcessor) moderatePost(api plugin.API, post *model.Post) error {
+	_, err := p.evaluatePost(api, post)
+	return err
+}
+
+// evaluatePost moderates the post and returns the decision, along with an
+// error matching ErrModerationRejection when the post is flagged, or a
+// warnedContentError when it is allowed with a warning. The decision is
+// empty when the post is skipped.
+func (p *PostProcessor) evaluatePost(api plugin.API, post *model.Post) (decision moderation.Decision, err error) {
 	if !p.shouldModerateUser(post.UserId) {
-		return nil
+		p.metrics.postSkipped()
+		return decision, nil
+	}
+
+	if p.integrations != nil && p.integrations.skipPost(api, post) {
+		p.metrics.postSkipped()
+		return decision, nil
 	}
 
 	if !p.shouldModerateChannel(post.ChannelId) {
-		return nil
+		p.metrics.postSkipped()
+		return decision, nil
+	}
+
+	if p.teams != nil && !p.teams.enabledForChannel(api, post.ChannelId) {
+		p.metrics.postSkipped()
+		return decision, nil
+	}
+
+	text := moderatedText(post, p.moderateAttachments)
+	delta, edited := p.edits.get(post.Id, text)
+
+	moderateFiles := len(post.FileIds) > 0 && p.moderatesFiles()
+	short := p.shortMessages.isShort(text)
+	if (text == "" || (short && p.shortMessages.skipped())) && !moderateFiles {
+		p.metrics.postSkipped()
+		return decision, nil
+	}
+
+	if !p.policy.moderating() {
+		p.metrics.postSkipped()
+		return decision, nil
 	}
 
-	if post.Message == "" {
-		return nil
+	if p.policy.skipChannel(api, post.ChannelId) {
+		p.metrics.postSkipped()
+		return decision, nil
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), moderationTimeout)
+	result := make(moderation.Result)
+	decision = moderation.Decision{Result: result, Providers: p.providers}
+
+	// Only unavailable providers are retried, so every other outcome ends the
+	// moderation of the post
+	defer func() {
+		if errors.Is(err, ErrModerationUnavailable) {
+			return
+		}
+		p.metrics.postModerated()
+		p.auditDecision(api, post, result, errors.Is(err, ErrModerationRejection))
+	}()
+
+	// The timeout covers every moderation and file lookup made for the post
+	ctx, cancel := context.WithTimeout(p.baseContext(), p.moderationTimeout())
 	defer cancel()
 
-	result, err := p.moderator.ModerateText(ctx, post.Message)
-	if err != nil {
-		return ErrModerationUnavailable
+	// Every provider request for the post after the first one waits for the
+	// rate limiter
+	ctx = paceRequests(ctx)
+
+	// A chain of providers stops once the post is flagged under its own
+	// thresholds, rather than calling the providers left
+	ctx = moderation.StopWhen(ctx, func(result moderation.Result) bool {
+		return p.policy.resultSeverityAboveThreshold(result, p.policy.postThreshold(api, post))
+	})
+
+	var files []*model.FileInfo
+	if moderateFiles {
+		var err error
+		if files, err = p.getFileInfos(ctx, api, post); err != nil {
+			return decision, err
+		}
 	}
 
-	if p.resultSeverityAboveThreshold(result) {
-		p.logFlaggedResult(api, post.Id, result)
-		return ErrModerationRejection
+	if p.stripMarkdown {
+		text = moderation.StripMarkdown(text)
+		delta = moderation.StripMarkdown(delta)
 	}
 
-	return nil
+	// Small edits of long posts only send the text that changed
+	if edited && delta != "" {
+		text = delta
+	}
+
+	// Text over the maximum length is truncated, or held for review without
+	// reaching the provider
+	heldText := false
+	if p.textLimit.exceeds(text) {
+		if p.textLimit.truncates() {
+			api.LogDebug("Truncating post text longer than the maximum moderated length", append(p.policy.loggedIDs("post_id", post.Id), "max_characters", p.textLimit.maxCharacters)...)
+			text = p.textLimit.truncate(text)
+		} else {
+			text, heldText = "", true
+		}
+	}
+
+	if short {
+		// Short messages never reach the provider, but are still checked
+		// against the local blocklist
+		textResult, err := p.shortMessages.moderate(ctx, text)
+		if err != nil {
+			return decision, moderationUnavailable(err)
+		}
+		result.Merge(textResult)
+		if !moderateFiles {
+			decision.Providers = p.shortMessages.providers()
+		}
+	} else if text != "" {
+		textCtx, language, moderate := p.languages.apply(ctx, text)
+		if moderate {
+			textCtx = moderation.ReportFallback(textCtx)
+			textResult, err := p.moderateText(textCtx, text)
+			if err != nil {
+				return decision, moderationUnavailable(err)
+			}
+			result.Merge(textResult)
+			decision.Language = language
+			decision.Degraded = moderation.FellBack(textCtx)
+		} else {
+			api.LogDebug("Skipping moderation of text in an unsupported language", append(p.policy.loggedIDs("post_id", post.Id), "language", language)...)
+		}
+	}
+
+	skippedImages := 0
+	if p.imageModerator != nil {
+		if skippedImages, err = p.moderateImages(ctx, api, post.Id, files, result); err != nil {
+			return decision, err
+		}
+	}
+
+	if p.textFiles != nil {
+		heldFile, err := p.moderateTextFiles(ctx, api, post.Id, files, result)
+		if err != nil {
+			return decision, err
+		}
+		heldText = heldText || heldFile
+	}
+
+	if err := p.policy.checkPostResult(api, post, decision); err != nil {
+		return decision, err
+	}
+
+	if skippedImages > 0 {
+		p.holdForImageReview(api, post)
+	}
+	if heldText {
+		p.holdForTextReview(api, post)
+	}
+
+	if p.moderateFilenames {
+		if err := p.moderateFileNames(ctx, api, post, files); err != nil {
+			return decision, err
+		}
+	}
+
+	return decision, p.policy.checkWarning(api, post.Id, decision)
 }
 
-func (p *PostProcessor) shouldModerateUser(userID string) bool {
-	if userID == p.botID {
-		return false
+// baseContext returns the context moderation requests derive from
+func (p *PostProcessor) baseContext() context.Context {
+	if p.ctx == nil {
+		return context.Background()
 	}
-	if len(p.excludedUsers) == 0 {
-		return true
+	return p.ctx
+}
+
+// deactivated reports whether the plugin was deactivated, canceling the
+// moderation requests of the processor
+func (p *PostProcessor) deactivated() bool {
+	return p.ctx != nil && p.ctx.Err() != nil
+}
+
+// moderationTimeout returns the time allowed for moderating a post
+func (p *PostProcessor) moderationTimeout() time.Duration {
+	if p.timeout <= 0 {
+		return defaultModerationTimeout
 	}
-	_, excluded := p.excludedUsers[userID]
-	return !excluded
+	return p.timeout
 }
 
-func (p *PostProcessor) shouldModerateChannel(channelID string) bool {
-	if len(p.excludedChannels) == 0 {
-		return true
+// moderateText moderates the text in chunks no longer than the moderator
+// accepts, unless it was already moderated in a batch. Each chunk waits for
+// its turn, so the limit covers every request sent to the provider.
+func (p *PostProcessor) moderateText(ctx context.Context, text string) (moderation.Result, error) {
+	if result, ok := p.takePrefetched(text); ok {
+		return result, nil
+	}
+
+	maxLength := 0
+	if limiter, ok := p.moderator.(moderation.TextLengthLimiter); ok {
+		maxLength = limiter.MaxTextLength()
+	}
+
+	return moderation.ModerateChunks(ctx, text, maxLength, func(ctx context.Context, chunk string) (moderation.Result, error) {
+		p.waitForTurn(ctx)
+		return p.moderateTextRequest(ctx, chunk)
+	})
+}
+
+// moderateTextRequest sends a single text moderation request, recording its
+// latency and any failure
+func (p *PostProcessor) moderateTextRequest(ctx context.Context, text string) (moderation.Result, error) {
+	start := time.Now()
+	result, err := p.moderator.ModerateText(ctx, text)
+	p.metrics.observeLatency(time.Since(start))
+	if err != nil {
+		p.metrics.providerError()
+	}
+	return result, err
+}
+
+// waitForRateLimit blocks until the rate limiter allows another request.
+// While the provider is throttling requests every worker first waits until
+// the provider said it would accept requests again, so that throttling backs
+// off all workers at once. The limiter is skipped when the processor has not
+// been started.
+func (p *PostProcessor) waitForRateLimit() {
+	if reporter, ok := p.moderator.(moderation.RateLimitReporter); ok {
+		if wait := time.Until(reporter.RateLimit().ResumeAt); wait > 0 {
+			p.sleep(p.baseContext(), wait)
+		}
+	}
+
+	if p.limiter != nil {
+		select {
+		case <-p.limiter.C:
+		case <-p.baseContext().Done():
+		}
+	}
+}
+
+// sleepContext waits for the duration, returning early once the context is
+// done so that deactivation is not held up by a throttled provider
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
 	}
-	_, excluded := p.excludedChannels[channelID]
-	return !excluded
 }
 
-func (p *PostProcessor) resultSeverityAboveThreshold(result moderation.Result) bool {
-	for _, severity := range result {
-		if severity >= p.thresholdValue {
-			return true
+func (p *PostProcessor) getFileInfos(ctx context.Context, api plugin.API, post *model.Post) ([]*model.FileInfo, error) {
+	files := make([]*model.FileInfo, 0, len(post.FileIds))
+	for _, fileID := range post.FileIds {
+		if ctx.Err() != nil {
+			return nil, ErrModerationUnavailable
 		}
+
+		info, appErr := api.GetFileInfo(fileID)
+		if appErr != nil {
+			api.LogError("Failed to get file info for content moderation", append(p.policy.loggedIDs("post_id", post.Id), "file_id", fileID, "err", appErr)...)
+			return nil, ErrModerationUnavailable
+		}
+		files = append(files, info)
 	}
-	return false
+	return files, nil
 }
 
-func (p *PostProcessor) logFlaggedResult(api plugin.API, postID string, result moderation.Result) {
-	keyPairs := []any{"post_id", postID, "severity_threshold", p.thresholdValue}
+// moderateFileNames moderates the name of each file attached to the post
+func (p *PostProcessor) moderateFileNames(ctx context.Context, api plugin.API, post *model.Post, files []*model.FileInfo) error {
+	for _, info := range files {
+		p.waitForTurn(ctx)
+		result, err := p.moderateTextRequest(ctx, info.Name)
+		if err != nil {
+			return moderationUnavailable(err)
+		}
 
-	for category, severity := range result {
-		if severity >= p.thresholdValue {
-			keyPairs = append(keyPairs, fmt.Sprintf("computed_severity_%s", category))
-			keyPairs = append(keyPairs, severity)
+		if err := p.policy.checkPostResult(api, post, moderation.Decision{Result: result, Providers: p.providers}); err != nil {
+			api.LogInfo("Attachment filename was flagged by moderation", append(p.policy.loggedIDs("post_id", post.Id), "file_id", info.Id)...)
+			return err
 		}
 	}
 
-	api.LogInfo("Content was flagged by moderation", keyPairs...)
+	return nil
 }
 
-func (p *PostProcessor) reportModerationEvent(api plugin.API, post *model.Post) error {
-	if _, err := api.CreatePost(&model.Post{
-		UserId:    p.botID,
-		ChannelId: post.ChannelId,
-		RootId:    post.RootId,
-		Message:   channelNotificationTemplate,
-	}); err != nil {
-		return errors.Wrap(err, "failed to post channel notification")
+// moderateImages moderates each image attached to the post, merging the
+// severities into result, and returns the number of images that could not be
+// moderated. Images larger than the image settings allow are skipped without
+// being downloaded, and images larger than the provider accepts are scaled
+// down first. Non-image files are skipped.
+func (p *PostProcessor) moderateImages(ctx context.Context, api plugin.API, postID string, files []*model.FileInfo, result moderation.Result) (int, error) {
+	skipped := 0
+	for _, info := range files {
+		if !info.IsImage() {
+			continue
+		}
+
+		if info.Size > p.images.maxDownloadSize() {
+			api.LogWarn("Skipping moderation of image exceeding the maximum size", append(p.policy.loggedIDs("post_id", postID), "file_id", info.Id, "size", info.Size)...)
+			skipped++
+			continue
+		}
+
+		data, appErr := api.GetFile(info.Id)
+		if appErr != nil {
+			api.LogError("Failed to get image for content moderation", append(p.policy.loggedIDs("post_id", postID), "file_id", info.Id, "err", appErr)...)
+			return 0, ErrModerationUnavailable
+		}
+
+		if len(data) > maxImageSize {
+			resized, err := downscaleImage(data, maxImageSize)
+			if err != nil {
+				api.LogWarn("Skipping moderation of image that could not be resized", append(p.policy.loggedIDs("post_id", postID), "file_id", info.Id, "size", len(data), "err", err)...)
+				skipped++
+				continue
+			}
+			data = resized
+		}
+
+		p.waitForTurn(ctx)
+		imageResult, err := p.imageModerator.ModerateImage(ctx, data)
+		if err != nil {
+			p.metrics.providerError()
+			return 0, moderationUnavailable(err)
+		}
+		result.Merge(imageResult)
 	}
 
-	dmChannel, err := api.GetDirectChannel(p.botID, post.UserId)
-	if err != nil {
-		return errors.Wrap(err, "failed to create DM channel")
+	return skipped, nil
+}
+
+// holdForImageReview marks a post with images that could not be moderated as
+// pending review, when the image settings hold such posts
+func (p *PostProcessor) holdForImageReview(api plugin.API, post *model.Post) {
+	if !p.images.holdsOversized() || (p.action != nil && p.action.monitorOnly) {
+		return
 	}
 
-	if _, err := api.CreatePost(&model.Post{
-		UserId:    p.botID,
-		ChannelId: dmChannel.Id,
-		Message:   fmt.Sprintf(dmNotificationTemplate, post.Message),
-	}); err != nil {
-		return errors.Wrap(err, "failed to send DM notification")
+	if err := p.markPendingReview(api, post, p.images.reviewChannelID, oversizedImageNotificationTemplate); err != nil {
+		api.LogError("Failed to hold post with oversized images for review", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
 	}
+}
 
-	return nil
+// isOwnPost reports whether the post was made by the moderation bot
+func (p *PostProcessor) isOwnPost(post *model.Post) bool {
+	return p.botID != "" && post.UserId == p.botID
+}
+
+// moderatesFiles reports whether the files attached to posts are moderated,
+// by their names, images or text contents
+func (p *PostProcessor) moderatesFiles() bool {
+	return p.moderateFilenames || p.imageModerator != nil || p.textFiles != nil
+}
+
+func (p *PostProcessor) shouldModerateUser(userID string) bool {
+	if userID == p.botID {
+		return false
+	}
+	if len(p.excludedUsers) == 0 {
+		return true
+	}
+	_, excluded := p.excludedUsers[userID]
+	return !excluded
+}
+
+func (p *PostProcessor) shouldModerateChannel(channelID string) bool {
+	// A non-empty include list takes precedence, so a channel in both lists
+	// is moderated and channels outside the include list are skipped
+	if len(p.includedChannels) > 0 {
+		_, included := p.includedChannels[channelID]
+		return included
+	}
+
+	if len(p.excludedChannels) == 0 {
+		return true
+	}
+	_, excluded := p.excludedChannels[channelID]
+	return !excluded
 }
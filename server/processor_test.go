@@ -3,15 +3,23 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/azure"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/blocklist"
 	"github.com/mattermost/mattermost/server/public/model"
 	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockModerator is a mock implementation of the Moderator interface
@@ -24,78 +32,71 @@ func (m *MockModerator) ModerateText(ctx context.Context, text string) (moderati
 	return args.Get(0).(moderation.Result), args.Error(1)
 }
 
-func TestResultSeverityAboveThreshold(t *testing.T) {
-	tests := []struct {
-		name           string
-		result         moderation.Result
-		thresholdValue int
-		expected       bool
-	}{
-		{
-			name: "All severities below threshold",
-			result: moderation.Result{
-				"hate":     20,
-				"sexual":   15,
-				"violence": 30,
-			},
-			thresholdValue: 50,
-			expected:       false,
-		},
-		{
-			name: "One severity above threshold",
-			result: moderation.Result{
-				"hate":     20,
-				"sexual":   75,
-				"violence": 30,
-			},
-			thresholdValue: 50,
-			expected:       true,
-		},
-		{
-			name: "Multiple severities above threshold",
-			result: moderation.Result{
-				"hate":     60,
-				"sexual":   75,
-				"violence": 80,
-			},
-			thresholdValue: 50,
-			expected:       true,
-		},
-		{
-			name: "Severity equal to threshold",
-			result: moderation.Result{
-				"hate":     20,
-				"sexual":   50,
-				"violence": 30,
-			},
-			thresholdValue: 50,
-			expected:       true,
-		},
-		{
-			name:           "Empty result",
-			result:         moderation.Result{},
-			thresholdValue: 50,
-			expected:       false,
-		},
-		{
-			name: "Zero threshold",
-			result: moderation.Result{
-				"hate": 1,
-			},
-			thresholdValue: 0,
-			expected:       true,
-		},
+func (m *MockModerator) HealthCheck(ctx context.Context) error {
+	args := m.Called(ctx)
+	return args.Error(0)
+}
+
+// countingModerator counts calls to ModerateText and is safe for concurrent use
+type countingModerator struct {
+	calls atomic.Int32
+}
+
+func (m *countingModerator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	m.calls.Add(1)
+	return moderation.Result{}, nil
+}
+
+func (m *countingModerator) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// chunkingModerator records the text it moderates and accepts at most
+// maxLength characters per request
+type chunkingModerator struct {
+	countingModerator
+	maxLength int
+	texts     []string
+}
+
+func (m *chunkingModerator) ModerateText(ctx context.Context, text string) (moderation.Result, error) {
+	m.texts = append(m.texts, text)
+	if strings.Contains(text, "offensive") {
+		return moderation.Result{"hate": 6}, nil
 	}
+	return moderation.Result{"hate": 0}, nil
+}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			processor := &PostProcessor{
-				thresholdValue: tt.thresholdValue,
-			}
+func (m *chunkingModerator) MaxTextLength() int {
+	return m.maxLength
+}
 
-			result := processor.resultSeverityAboveThreshold(tt.result)
-			assert.Equal(t, tt.expected, result)
-		})
+// MockImageModerator is a mock implementation of the Moderator and ImageModerator interfaces
+type MockImageModerator struct {
+	MockModerator
+}
+
+func (m *MockImageModerator) ModerateImage(ctx context.Context, data []byte) (moderation.Result, error) {
+	args := m.Called(ctx, data)
+	return args.Get(0).(moderation.Result), args.Error(1)
+}
+
+// testProcessorSettings returns the settings of a processor that moderates
+// with the moderator and deletes flagged posts, for tests to adjust
+func testProcessorSettings(moderator moderation.Moderator) processorSettings {
+	return processorSettings{
+		botID:            "bot",
+		moderator:        moderator,
+		policy:           newModerationPolicy(4, nil, nil, nil, nil),
+		excludedUsers:    map[string]struct{}{},
+		excludedChannels: map[string]struct{}{},
+		retry:            &retryPolicy{maxAttempts: 1},
+		action:           &flaggedPostAction{action: moderationActionDelete},
+		notifications:    &notificationSettings{},
+		audit:            &auditSettings{level: auditLevelOff},
+		teams:            newTeamSettings(true, nil),
+		languages:        &languageSettings{},
+		integrations:     newIntegrationSettings(false, false),
 	}
 }
 
@@ -105,9 +106,11 @@ func TestQueuePostForProcessing(t *testing.T) {
 			postsCh: make(chan *model.Post, 10),
 		}
 		api := &plugintest.API{}
+		api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
 		post := &model.Post{Id: "post1", Message: "Test message"}
 
 		processor.queuePostForProcessing(api, post)
+		api.AssertExpectations(t)
 
 		// Verify post is in channel
 		select {
@@ -124,7 +127,11 @@ func TestQueuePostForProcessing(t *testing.T) {
 		}
 
 		api := &plugintest.API{}
-		api.On("LogError", "Content moderation unable to analyze post: exceeded maximum post queue size", "post_id", "post2").Return()
+		api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+		api.On("KVSet", queuedPostKeyPrefix+"post2", []byte{1}).Return(nil)
+		api.On("KVDelete", queuedPostKeyPrefix+"post2").Return(nil)
+		api.On("LogError", "Content moderation unable to analyze post: exceeded maximum post queue size", "post_id", "post2", "dropped_count", int64(1)).Return()
+		api.On("LogWarn", "Content moderation queue reached its maximum size, further posts are dropped until it drains", "max_queue_size", 1).Return().Once()
 
 		post1 := &model.Post{Id: "post1", Message: "First message"}
 		post2 := &model.Post{Id: "post2", Message: "Second message"}
@@ -134,6 +141,8 @@ func TestQueuePostForProcessing(t *testing.T) {
 
 		// This should fail and log error
 		processor.queuePostForProcessing(api, post2)
+		assert.Equal(t, int64(1), processor.droppedPostCount())
+		assert.Equal(t, 1, processor.queueDepth())
 
 		// Verify first post is still there
 		select {
@@ -146,36 +155,268 @@ func TestQueuePostForProcessing(t *testing.T) {
 		api.AssertExpectations(t)
 	})
 
+	t.Run("Bot posts are not queued", func(t *testing.T) {
+		processor := &PostProcessor{
+			botID:   "bot",
+			postsCh: make(chan *model.Post, 10),
+		}
+		api := &plugintest.API{}
+
+		processor.queuePostForProcessing(api, &model.Post{Id: "post1", UserId: "bot", Message: "_A post was flagged and removed._"})
+		assert.Equal(t, 0, processor.queueDepth())
+		api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+	})
+
 	t.Run("Queue post after shutdown", func(t *testing.T) {
 		processor := &PostProcessor{
 			postsCh: make(chan *model.Post, 10),
 		}
 
 		api := &plugintest.API{}
-		api.On("LogDebug", "Panic occurred while queueing post for processing",
-			"post_id", "post1", "panic", mock.MatchedBy(func(v interface{}) bool {
-				return strings.Contains(fmt.Sprintf("%v", v), "send on closed channel")
-			})).Return()
+		api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+		api.On("LogDebug", "Content moderation processor is stopped, deferring post", "post_id", "post1").Return()
 
 		post := &model.Post{Id: "post1", Message: "Test message"}
 
-		// Close the channel to simulate shutdown
-		close(processor.postsCh)
+		processor.stop()
 
 		// This should not panic even with closed channel
 		processor.queuePostForProcessing(api, post)
 
 		// Verify no post was queued (channel is closed)
-		select {
-		case _, ok := <-processor.postsCh:
-			if ok {
-				t.Fatal("Should not be able to receive from closed channel")
+		_, ok := <-processor.postsCh
+		assert.False(t, ok)
+
+		api.AssertExpectations(t)
+	})
+}
+
+func TestQueuePostConcurrentWithStop(t *testing.T) {
+	processor := &PostProcessor{
+		postsCh: make(chan *model.Post, 10),
+	}
+
+	api := &plugintest.API{}
+	api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+	api.On("KVDelete", mock.Anything).Return(nil)
+	api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	var producers sync.WaitGroup
+	for i := range 50 {
+		producers.Add(1)
+		go func() {
+			defer producers.Done()
+			for j := range 20 {
+				processor.queuePostForProcessing(api, &model.Post{Id: fmt.Sprintf("post%d_%d", i, j)})
 			}
-		default:
-			// Expected - channel is closed and empty
+		}()
+	}
+
+	// Consume concurrently so producers do not only hit the full queue
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		for range processor.postsCh {
 		}
+	}()
 
-		api.AssertExpectations(t)
+	// A send on the closed channel would panic and fail the test
+	processor.stop()
+	producers.Wait()
+	<-consumed
+}
+
+func TestQueuePostAfterStop(t *testing.T) {
+	processor := &PostProcessor{
+		postsCh: make(chan *model.Post, 10),
+	}
+	processor.stop()
+
+	api := &plugintest.API{}
+	api.On("KVSet", queuedPostKeyPrefix+"post1", []byte{1}).Return(nil)
+	api.On("LogDebug", "Content moderation processor is stopped, deferring post", "post_id", "post1").Return()
+
+	processor.queuePostForProcessing(api, &model.Post{Id: "post1", Message: "Test message"})
+
+	// Stopping twice does not close the channel again
+	processor.stop()
+
+	api.AssertExpectations(t)
+}
+
+func TestDrain(t *testing.T) {
+	newProcessor := func(moderator moderation.Moderator) *PostProcessor {
+		settings := testProcessorSettings(moderator)
+		settings.postsPerMinuteLimit = 60000
+		processor, err := newPostProcessor(settings)
+		assert.NoError(t, err)
+		return processor
+	}
+
+	newAPI := func() *plugintest.API {
+		api := &plugintest.API{}
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+		api.On("KVDelete", mock.Anything).Return(nil)
+		return api
+	}
+
+	t.Run("Pending posts are moderated before shutdown completes", func(t *testing.T) {
+		moderator := &countingModerator{}
+		processor := newProcessor(moderator)
+		api := newAPI()
+
+		for i := range 20 {
+			processor.queuePostForProcessing(api, &model.Post{Id: fmt.Sprintf("post%d", i), UserId: "user1", Message: "text"})
+		}
+		processor.start(api)
+
+		assert.True(t, processor.drain(5*time.Second))
+		assert.Equal(t, int32(20), moderator.calls.Load())
+		assert.Equal(t, 0, processor.queueDepth())
+	})
+
+	t.Run("Draining gives up after the timeout", func(t *testing.T) {
+		release := make(chan time.Time)
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "text").
+			WaitUntil(release).
+			Return(moderation.Result{}, nil)
+		processor := newProcessor(moderator)
+		api := newAPI()
+
+		processor.queuePostForProcessing(api, &model.Post{Id: "post1", UserId: "user1", Message: "text"})
+		processor.start(api)
+
+		assert.False(t, processor.drain(50*time.Millisecond))
+		close(release)
+	})
+
+	t.Run("Processor that was never started", func(t *testing.T) {
+		assert.True(t, newProcessor(&countingModerator{}).drain(time.Second))
+	})
+}
+
+func TestQueueDeduplicatesPosts(t *testing.T) {
+	newProcessor := func(moderator moderation.Moderator) *PostProcessor {
+		settings := testProcessorSettings(moderator)
+		settings.postsPerMinuteLimit = 60000
+		settings.workerCount = 8
+		processor, err := newPostProcessor(settings)
+		assert.NoError(t, err)
+		return processor
+	}
+
+	newAPI := func() *plugintest.API {
+		api := &plugintest.API{}
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+		api.On("KVDelete", mock.Anything).Return(nil)
+		return api
+	}
+
+	t.Run("Same post queued concurrently is moderated once", func(t *testing.T) {
+		release := make(chan time.Time)
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "text").
+			WaitUntil(release).
+			Return(moderation.Result{}, nil)
+		processor := newProcessor(moderator)
+		api := newAPI()
+		processor.start(api)
+
+		// Every copy is queued while the first is still waiting in the queue
+		// or being moderated
+		var wg sync.WaitGroup
+		for range 50 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				processor.queuePostForProcessing(api, &model.Post{Id: "post1", UserId: "user1", Message: "text"})
+			}()
+		}
+		wg.Wait()
+		close(release)
+
+		assert.True(t, processor.drain(5*time.Second))
+		moderator.AssertNumberOfCalls(t, "ModerateText", 1)
+	})
+
+	t.Run("Post edited while being moderated is moderated again", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		edited := make(chan struct{})
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "text").
+			Run(func(mock.Arguments) {
+				close(started)
+				<-release
+			}).
+			Return(moderation.Result{}, nil).Once()
+		moderator.On("ModerateText", mock.Anything, "edited").
+			Run(func(mock.Arguments) { close(edited) }).
+			Return(moderation.Result{}, nil).Once()
+		processor := newProcessor(moderator)
+		api := newAPI()
+		processor.start(api)
+
+		processor.queuePostForProcessing(api, &model.Post{Id: "post1", UserId: "user1", Message: "text"})
+		<-started
+		processor.queuePostForProcessing(api, &model.Post{Id: "post1", UserId: "user1", Message: "edited"})
+		processor.queuePostForProcessing(api, &model.Post{Id: "post1", UserId: "user1", Message: "edited"})
+		assert.Equal(t, 0, processor.queueDepth(), "the edit waits for the current pass")
+		close(release)
+
+		// The edit is queued again once the first pass completes
+		select {
+		case <-edited:
+		case <-time.After(5 * time.Second):
+			t.Fatal("edited post was not moderated")
+		}
+		assert.True(t, processor.drain(5*time.Second))
+		moderator.AssertExpectations(t)
+	})
+
+	t.Run("Unchanged post queued while being moderated leaves no record", func(t *testing.T) {
+		post := &model.Post{Id: "post1", UserId: "user1", Message: "text"}
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "text").Return(moderation.Result{}, nil).Once()
+		processor := newProcessor(moderator)
+
+		// The post is queued again right after the worker removes its
+		// record, while it is still being moderated
+		var mu sync.Mutex
+		var requeue sync.Once
+		requeued := make(chan struct{})
+		records := map[string]bool{}
+		api := &plugintest.API{}
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("KVSet", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			mu.Lock()
+			defer mu.Unlock()
+			records[args.String(0)] = true
+		}).Return(nil)
+		api.On("KVDelete", mock.Anything).Run(func(args mock.Arguments) {
+			mu.Lock()
+			delete(records, args.String(0))
+			mu.Unlock()
+			requeue.Do(func() {
+				processor.queuePostForProcessing(api, post)
+				close(requeued)
+			})
+		}).Return(nil)
+		processor.start(api)
+
+		processor.queuePostForProcessing(api, post)
+		<-requeued
+
+		assert.True(t, processor.drain(5*time.Second))
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Empty(t, records)
+		moderator.AssertExpectations(t)
 	})
 }
 
@@ -228,6 +469,7 @@ func TestShouldModerateChannel(t *testing.T) {
 	tests := []struct {
 		name             string
 		excludedChannels map[string]struct{}
+		includedChannels map[string]struct{}
 		channelID        string
 		expected         bool
 	}{
@@ -255,12 +497,39 @@ func TestShouldModerateChannel(t *testing.T) {
 			channelID:        "any_channel",
 			expected:         true,
 		},
+		{
+			name:             "Empty included list moderates all but excluded channels",
+			excludedChannels: map[string]struct{}{"channel1": {}},
+			includedChannels: map[string]struct{}{},
+			channelID:        "channel2",
+			expected:         true,
+		},
+		{
+			name:             "Channel is included",
+			includedChannels: map[string]struct{}{"channel1": {}},
+			channelID:        "channel1",
+			expected:         true,
+		},
+		{
+			name:             "Channel not in included list",
+			includedChannels: map[string]struct{}{"channel1": {}},
+			channelID:        "channel2",
+			expected:         false,
+		},
+		{
+			name:             "Included list wins over excluded list",
+			excludedChannels: map[string]struct{}{"channel1": {}},
+			includedChannels: map[string]struct{}{"channel1": {}},
+			channelID:        "channel1",
+			expected:         true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			processor := &PostProcessor{
 				excludedChannels: tt.excludedChannels,
+				includedChannels: tt.includedChannels,
 			}
 
 			result := processor.shouldModerateChannel(tt.channelID)
@@ -329,15 +598,15 @@ func TestModeratePost(t *testing.T) {
 			Return(moderation.Result{}, errors.New("API error"))
 
 		processor := &PostProcessor{
-			moderator:      mockModerator,
-			excludedUsers:  map[string]struct{}{},
-			thresholdValue: 50,
+			moderator:     mockModerator,
+			excludedUsers: map[string]struct{}{},
+			policy:        &moderationPolicy{thresholdValue: 50},
 		}
 
 		post := &model.Post{UserId: "user1", Message: "Test message"}
 		err := processor.moderatePost(mockAPI, post)
 
-		assert.Equal(t, ErrModerationUnavailable, err)
+		assert.ErrorIs(t, err, ErrModerationUnavailable)
 		mockModerator.AssertExpectations(t)
 	})
 
@@ -349,9 +618,9 @@ func TestModeratePost(t *testing.T) {
 			Return(moderation.Result{"category": 10}, nil)
 
 		processor := &PostProcessor{
-			moderator:      mockModerator,
-			excludedUsers:  map[string]struct{}{},
-			thresholdValue: 50,
+			moderator:     mockModerator,
+			excludedUsers: map[string]struct{}{},
+			policy:        &moderationPolicy{thresholdValue: 50},
 		}
 
 		post := &model.Post{UserId: "user1", Message: "Test message"}
@@ -361,10 +630,49 @@ func TestModeratePost(t *testing.T) {
 		mockModerator.AssertExpectations(t)
 	})
 
+	t.Run("Markdown stripped before moderation when enabled", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+
+		mockModerator := &MockModerator{}
+		mockModerator.On("ModerateText", mock.Anything, "Read the docs and run rm").
+			Return(moderation.Result{"category": 0}, nil)
+
+		processor := &PostProcessor{
+			moderator:     mockModerator,
+			excludedUsers: map[string]struct{}{},
+			policy:        &moderationPolicy{thresholdValue: 4},
+			stripMarkdown: true,
+		}
+
+		post := &model.Post{UserId: "user1", Message: "Read [the docs](https://example.com) and run `rm`"}
+		err := processor.moderatePost(mockAPI, post)
+
+		assert.NoError(t, err)
+		mockModerator.AssertExpectations(t)
+	})
+
+	t.Run("Long message moderated in chunks", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		mockAPI.On("LogInfo", "Content was flagged by moderation", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+		moderator := &chunkingModerator{maxLength: 12}
+		processor := &PostProcessor{
+			moderator:     moderator,
+			excludedUsers: map[string]struct{}{},
+			policy:        &moderationPolicy{thresholdValue: 4},
+		}
+
+		post := &model.Post{UserId: "user1", Message: "harmless words then offensive"}
+		err := processor.moderatePost(mockAPI, post)
+
+		assert.ErrorIs(t, err, ErrModerationRejection)
+		assert.Equal(t, []string{"harmless", " words then", " offensive"}, moderator.texts)
+	})
+
 	t.Run("Content above threshold", func(t *testing.T) {
 		mockAPI := &plugintest.API{}
 		mockAPI.On("LogInfo", "Content was flagged by moderation",
-			"post_id", "", "severity_threshold", 50, "computed_severity_sexual", 80).Return()
+			"post_id", "", "severity_threshold", 50, "computed_severity_sexual", 80, "severity_breakdown", "hate: 10, sexual: 80, violence: 30").Return()
 
 		mockModerator := &MockModerator{}
 		mockModerator.On("ModerateText", mock.Anything, "Inappropriate content").
@@ -375,18 +683,129 @@ func TestModeratePost(t *testing.T) {
 			}, nil)
 
 		processor := &PostProcessor{
-			moderator:      mockModerator,
-			excludedUsers:  map[string]struct{}{},
-			thresholdValue: 50,
+			moderator:     mockModerator,
+			excludedUsers: map[string]struct{}{},
+			policy:        &moderationPolicy{thresholdValue: 50},
 		}
 
 		post := &model.Post{UserId: "user1", Message: "Inappropriate content"}
 		err := processor.moderatePost(mockAPI, post)
 
-		assert.Equal(t, ErrModerationRejection, err) // Should return rejection error
+		assert.ErrorIs(t, err, ErrModerationRejection) // Should return rejection error
+		mockModerator.AssertExpectations(t)
+		mockAPI.AssertExpectations(t)
+	})
+
+	t.Run("Channel threshold override", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		mockAPI.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "", "severity_threshold", 2, "computed_severity_hate", 4, "severity_breakdown", "hate: 4").Return()
+
+		mockModerator := &MockModerator{}
+		mockModerator.On("ModerateText", mock.Anything, "Borderline content").
+			Return(moderation.Result{"hate": 4}, nil)
+
+		processor := &PostProcessor{
+			moderator:     mockModerator,
+			excludedUsers: map[string]struct{}{},
+			policy: &moderationPolicy{
+				thresholdValue:    6,
+				channelThresholds: map[string]int{"strict_channel": 2},
+			},
+		}
+
+		post := &model.Post{UserId: "user1", ChannelId: "default_channel", Message: "Borderline content"}
+		err := processor.moderatePost(mockAPI, post)
+		assert.NoError(t, err)
+
+		post = &model.Post{UserId: "user1", ChannelId: "strict_channel", Message: "Borderline content"}
+		err = processor.moderatePost(mockAPI, post)
+		assert.ErrorIs(t, err, ErrModerationRejection)
+
 		mockModerator.AssertExpectations(t)
 		mockAPI.AssertExpectations(t)
 	})
+
+	t.Run("Attachment filenames ignored when disabled", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		mockModerator := &MockModerator{}
+
+		processor := &PostProcessor{
+			moderator:     mockModerator,
+			excludedUsers: map[string]struct{}{},
+		}
+
+		post := &model.Post{UserId: "user1", FileIds: []string{"file1"}}
+		err := processor.moderatePost(mockAPI, post)
+
+		assert.NoError(t, err)
+		mockModerator.AssertNotCalled(t, "ModerateText")
+		mockAPI.AssertNotCalled(t, "GetFileInfo")
+	})
+
+	t.Run("Attachment filename above threshold", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		mockAPI.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "report.pdf"}, nil)
+		mockAPI.On("GetFileInfo", "file2").Return(&model.FileInfo{Id: "file2", Name: "offensive.png"}, nil)
+		mockAPI.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "post1", "severity_threshold", 4, "computed_severity_hate", 6, "severity_breakdown", "hate: 6").Return()
+		mockAPI.On("LogInfo", "Attachment filename was flagged by moderation",
+			"post_id", "post1", "file_id", "file2").Return()
+
+		mockModerator := &MockModerator{}
+		mockModerator.On("ModerateText", mock.Anything, "Look at this").
+			Return(moderation.Result{"hate": 0}, nil)
+		mockModerator.On("ModerateText", mock.Anything, "report.pdf").
+			Return(moderation.Result{"hate": 0}, nil)
+		mockModerator.On("ModerateText", mock.Anything, "offensive.png").
+			Return(moderation.Result{"hate": 6}, nil)
+
+		processor := &PostProcessor{
+			moderator:         mockModerator,
+			excludedUsers:     map[string]struct{}{},
+			policy:            &moderationPolicy{thresholdValue: 4},
+			moderateFilenames: true,
+		}
+
+		post := &model.Post{Id: "post1", UserId: "user1", Message: "Look at this", FileIds: []string{"file1", "file2"}}
+		err := processor.moderatePost(mockAPI, post)
+
+		assert.ErrorIs(t, err, ErrModerationRejection)
+		mockModerator.AssertExpectations(t)
+		mockAPI.AssertExpectations(t)
+	})
+
+	t.Run("Image results merged with text result", func(t *testing.T) {
+		mockAPI := &plugintest.API{}
+		mockAPI.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "notes.txt", MimeType: "text/plain"}, nil)
+		mockAPI.On("GetFileInfo", "file2").Return(&model.FileInfo{Id: "file2", Name: "photo.png", MimeType: "image/png", Size: 3}, nil)
+		mockAPI.On("GetFileInfo", "file3").Return(&model.FileInfo{Id: "file3", Name: "huge.png", MimeType: "image/png", Size: defaultMaxImageSizeMB*1024*1024 + 1}, nil)
+		mockAPI.On("GetFile", "file2").Return([]byte("png"), nil)
+		mockAPI.On("LogWarn", "Skipping moderation of image exceeding the maximum size",
+			"post_id", "post1", "file_id", "file3", "size", int64(defaultMaxImageSizeMB*1024*1024+1)).Return()
+		mockAPI.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "post1", "severity_threshold", 4, "computed_severity_Violence", 6, "severity_breakdown", "Violence: 6").Return()
+
+		mockModerator := &MockImageModerator{}
+		mockModerator.On("ModerateText", mock.Anything, "Look at this").
+			Return(moderation.Result{"Violence": 2}, nil)
+		mockModerator.On("ModerateImage", mock.Anything, []byte("png")).
+			Return(moderation.Result{"Violence": 6}, nil)
+
+		settings := testProcessorSettings(mockModerator)
+		settings.moderateImages = true
+		processor, err := newPostProcessor(settings)
+		assert.NoError(t, err)
+
+		post := &model.Post{Id: "post1", UserId: "user1", Message: "Look at this", FileIds: []string{"file1", "file2", "file3"}}
+		err = processor.moderatePost(mockAPI, post)
+
+		assert.ErrorIs(t, err, ErrModerationRejection)
+		mockModerator.AssertExpectations(t)
+		mockAPI.AssertExpectations(t)
+		mockAPI.AssertNotCalled(t, "GetFile", "file1")
+		mockAPI.AssertNotCalled(t, "GetFile", "file3")
+	})
 }
 
 func TestNewPostProcessor(t *testing.T) {
@@ -459,7 +878,12 @@ func TestNewPostProcessor(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			processor, err := newPostProcessor(tt.botID, tt.moderator, tt.thresholdValue, tt.excludedUsers, tt.excludedChannels)
+			settings := testProcessorSettings(tt.moderator)
+			settings.botID = tt.botID
+			settings.policy = newModerationPolicy(tt.thresholdValue, nil, nil, nil, nil)
+			settings.excludedUsers = tt.excludedUsers
+			settings.excludedChannels = tt.excludedChannels
+			processor, err := newPostProcessor(settings)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -470,13 +894,454 @@ func TestNewPostProcessor(t *testing.T) {
 			} else {
 				assert.NoError(t, err)
 				assert.NotNil(t, processor)
+				assert.Nil(t, processor.imageModerator)
 				assert.Equal(t, tt.botID, processor.botID)
 				assert.Equal(t, tt.moderator, processor.moderator)
-				assert.Equal(t, tt.thresholdValue, processor.thresholdValue)
+				assert.Equal(t, tt.thresholdValue, processor.policy.thresholdValue)
 				assert.Equal(t, tt.excludedUsers, processor.excludedUsers)
 				assert.Equal(t, tt.excludedChannels, processor.excludedChannels)
 				assert.NotNil(t, processor.postsCh)
+				assert.Equal(t, defaultWorkerCount, processor.workerCount)
 			}
 		})
 	}
 }
+
+func TestProcessingIntervalForLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    int
+		expected time.Duration
+	}{
+		{
+			name:     "Default limit",
+			limit:    500,
+			expected: 120 * time.Millisecond,
+		},
+		{
+			name:     "Azure S0 tier limit",
+			limit:    1000,
+			expected: 60 * time.Millisecond,
+		},
+		{
+			name:     "Low limit",
+			limit:    60,
+			expected: time.Second,
+		},
+		{
+			name:     "Zero limit falls back to default",
+			limit:    0,
+			expected: time.Minute / defaultPostsPerMinuteLimit,
+		},
+		{
+			name:     "Negative limit falls back to default",
+			limit:    -10,
+			expected: time.Minute / defaultPostsPerMinuteLimit,
+		},
+		{
+			name:     "Huge limit is capped",
+			limit:    100000000000,
+			expected: time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, processingIntervalForLimit(tt.limit))
+		})
+	}
+}
+
+func TestNewPostProcessorQueueSize(t *testing.T) {
+	for _, tt := range []struct{ size, expected int }{
+		{0, defaultMaxQueueSize},
+		{500, 500},
+	} {
+		settings := testProcessorSettings(&MockModerator{})
+		settings.postsPerMinuteLimit = defaultPostsPerMinuteLimit
+		settings.maxQueueSize = tt.size
+		processor, err := newPostProcessor(settings)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, cap(processor.postsCh))
+	}
+}
+
+func TestModeratePostTimeout(t *testing.T) {
+	moderator := &MockModerator{}
+	var deadline time.Duration
+	moderator.On("ModerateText", mock.Anything, "text").
+		Run(func(args mock.Arguments) {
+			ctx := args.Get(0).(context.Context)
+			start := time.Now()
+			<-ctx.Done()
+			deadline = time.Since(start)
+		}).
+		Return(moderation.Result(nil), context.DeadlineExceeded)
+
+	processor := &PostProcessor{
+		moderator: moderator,
+		policy:    newModerationPolicy(4, nil, nil, nil, nil),
+		timeout:   50 * time.Millisecond,
+	}
+
+	err := processor.moderatePost(&plugintest.API{}, &model.Post{Id: "post1", UserId: "user1", Message: "text"})
+	assert.ErrorIs(t, err, ErrModerationUnavailable)
+	assert.GreaterOrEqual(t, deadline, 40*time.Millisecond)
+	assert.Less(t, deadline, time.Second)
+}
+
+func TestModeratePostCanceledOnDeactivation(t *testing.T) {
+	moderator := &MockModerator{}
+	moderator.On("ModerateText", mock.Anything, "text").
+		Run(func(args mock.Arguments) {
+			<-args.Get(0).(context.Context).Done()
+		}).
+		Return(moderation.Result(nil), context.Canceled)
+
+	p := &Plugin{}
+	p.setActive(true)
+
+	retry, err := newRetryPolicy(3, deadLetterDrop, "", failurePolicyClosed)
+	require.NoError(t, err)
+	processor := &PostProcessor{
+		moderator: moderator,
+		policy:    newModerationPolicy(4, nil, nil, nil, nil),
+		timeout:   time.Minute,
+		retry:     retry,
+		ctx:       p.requestContext(),
+	}
+
+	api := &plugintest.API{}
+	api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything).Return()
+
+	time.AfterFunc(50*time.Millisecond, func() { p.cancelRequests(errPluginDeactivated) })
+
+	// The post is neither retried nor dead-lettered, and stays persisted to
+	// be moderated after the plugin restarts
+	start := time.Now()
+	processor.processPost(api, &model.Post{Id: "post1", UserId: "user1", Message: "text"})
+	assert.Less(t, time.Since(start), time.Second)
+	moderator.AssertNumberOfCalls(t, "ModerateText", 1)
+	api.AssertNotCalled(t, "KVDelete", mock.Anything)
+	api.AssertNotCalled(t, "DeletePost", mock.Anything)
+	assert.True(t, processor.deactivated())
+}
+
+func TestStartLogsEffectiveRate(t *testing.T) {
+	settings := testProcessorSettings(&MockModerator{})
+	settings.postsPerMinuteLimit = defaultPostsPerMinuteLimit
+	processor, err := newPostProcessor(settings)
+	assert.NoError(t, err)
+	assert.Equal(t, 120*time.Millisecond, processor.processingInterval)
+
+	api := &plugintest.API{}
+	api.On("LogInfo", "Content moderation processor started",
+		"posts_per_minute", 500, "processing_interval", "120ms", "workers", defaultWorkerCount).Return()
+
+	processor.start(api)
+	processor.stop()
+
+	api.AssertExpectations(t)
+}
+
+func TestWorkersShareRateLimit(t *testing.T) {
+	const (
+		postsPerMinute = 6000 // one post every 10ms
+		workers        = 8
+		window         = 200 * time.Millisecond
+	)
+
+	moderator := &countingModerator{}
+	settings := testProcessorSettings(moderator)
+	settings.postsPerMinuteLimit = postsPerMinute
+	settings.workerCount = workers
+	processor, err := newPostProcessor(settings)
+	assert.NoError(t, err)
+
+	api := &plugintest.API{}
+	api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+	api.On("KVSet", mock.Anything, mock.Anything).Return(nil)
+	api.On("KVDelete", mock.Anything).Return(nil)
+
+	// Flood the queue well beyond what can be processed within the window
+	for i := range 100 {
+		processor.queuePostForProcessing(api, &model.Post{Id: fmt.Sprintf("post%d", i), UserId: "user1", Message: "text"})
+	}
+
+	processor.start(api)
+	time.Sleep(window)
+	calls := int(moderator.calls.Load())
+	processor.stop()
+
+	maxCalls := int(window/processingIntervalForLimit(postsPerMinute)) + 1
+	assert.LessOrEqual(t, calls, maxCalls)
+	assert.Positive(t, calls)
+}
+
+func TestWaitForRateLimitBacksOffWhileThrottled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "5")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	moderator, err := azure.New(&moderation.Config{Endpoint: server.URL, APIKey: "key", MaxRetries: -1})
+	assert.NoError(t, err)
+
+	settings := testProcessorSettings(moderator)
+	settings.postsPerMinuteLimit = defaultPostsPerMinuteLimit
+	processor, err := newPostProcessor(settings)
+	assert.NoError(t, err)
+
+	var waits []time.Duration
+	processor.sleep = func(_ context.Context, d time.Duration) { waits = append(waits, d) }
+
+	// Nothing has been throttled yet, so dispatch does not wait
+	processor.waitForRateLimit()
+	assert.Empty(t, waits)
+
+	_, err = moderator.ModerateText(context.Background(), "text")
+	assert.Error(t, err)
+
+	// The next dispatch waits for the Retry-After period
+	processor.waitForRateLimit()
+	if assert.Len(t, waits, 1) {
+		assert.InDelta(t, 5*time.Second, waits[0], float64(time.Second))
+	}
+}
+
+func TestSleepContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	// A long wait for a throttled provider ends when the plugin is deactivated
+	start := time.Now()
+	sleepContext(ctx, time.Hour)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestModeratePostReplyThreshold(t *testing.T) {
+	moderator := &MockModerator{}
+	moderator.On("ModerateText", mock.Anything, "Heated message").Return(moderation.Result{"harassment": 3}, nil)
+
+	replyThreshold := 2
+	policy := newModerationPolicy(6, nil, nil, nil, nil)
+	policy.replyThreshold = &replyThreshold
+	processor := &PostProcessor{moderator: moderator, policy: policy}
+
+	api := &plugintest.API{}
+	api.On("LogInfo", "Content was flagged by moderation", "post_id", "reply", "severity_threshold", 2,
+		"computed_severity_harassment", 3, "severity_breakdown", "harassment: 3").Return()
+
+	err := processor.moderatePost(api, &model.Post{Id: "root", UserId: "user1", ChannelId: "channel1", Message: "Heated message"})
+	assert.NoError(t, err, "root posts use the moderation threshold")
+
+	err = processor.moderatePost(api, &model.Post{Id: "reply", UserId: "user1", ChannelId: "channel1", RootId: "root", Message: "Heated message"})
+	assert.ErrorIs(t, err, ErrModerationRejection, "replies use the reply threshold")
+	api.AssertExpectations(t)
+}
+
+func TestModeratePostSkipsBotPosts(t *testing.T) {
+	stub := &moderation.Stub{Default: moderation.Result{"hate": 6}}
+	processor := &PostProcessor{
+		botID:     "bot",
+		moderator: stub,
+		policy:    newModerationPolicy(4, nil, nil, nil, nil),
+	}
+
+	// Rescans moderate posts directly rather than through the queue
+	decision, err := processor.evaluatePost(&plugintest.API{}, &model.Post{Id: "post1", UserId: "bot", ChannelId: "channel1", Message: "Quoted: offensive message"})
+	assert.NoError(t, err)
+	assert.Empty(t, decision.Result)
+	assert.Empty(t, stub.Texts())
+}
+
+func TestModeratePostFallback(t *testing.T) {
+	primary := &MockModerator{}
+	primary.On("ModerateText", mock.Anything, mock.Anything).Return(moderation.Result(nil), errors.New("service unavailable"))
+
+	secondary, err := blocklist.New(&blocklist.Config{Terms: []blocklist.Term{{Text: "slur", Severity: moderation.MaxSeverity}}, WholeWord: true})
+	require.NoError(t, err)
+
+	processor := &PostProcessor{
+		moderator:     moderation.Fallback(primary, secondary),
+		policy:        newModerationPolicy(4, nil, nil, nil, nil),
+		action:        &flaggedPostAction{action: moderationActionDelete},
+		notifications: &notificationSettings{},
+	}
+
+	t.Run("Blocklisted term is caught while the provider fails", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogInfo", "Content was flagged by moderation", "post_id", "post1", "severity_threshold", 4,
+			"computed_severity_blocklist", 6, "severity_breakdown", "blocklist: 6", "blocklist_match", true, "degraded", true).Return()
+
+		err := processor.moderatePost(api, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "You slur"})
+		var flagged *flaggedContentError
+		require.ErrorAs(t, err, &flagged)
+		assert.True(t, flagged.decision.Degraded)
+		api.AssertExpectations(t)
+
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Username: "alice"}, nil)
+		api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", Name: "town-square"}, nil)
+		message := processor.moderationLogMessage(api, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1"}, flagged.categories, flagged.decision, time.Now())
+		assert.Contains(t, message, "| Coverage | reduced, the fallback provider checked the post while the configured providers failed |")
+	})
+
+	t.Run("Other content is allowed while the provider fails", func(t *testing.T) {
+		err := processor.moderatePost(&plugintest.API{}, &model.Post{Id: "post2", UserId: "user1", ChannelId: "channel1", Message: "Hello there"})
+		assert.NoError(t, err)
+	})
+}
+
+func TestProcessPostWarnThreshold(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Borderline message"}
+
+	newProcessor := func(severity int) *PostProcessor {
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Borderline message").Return(moderation.Result{"hate": severity}, nil)
+
+		policy := newModerationPolicy(4, nil, nil, nil, nil)
+		policy.warnThreshold = 2
+		return &PostProcessor{
+			botID:         "bot",
+			moderator:     moderator,
+			policy:        policy,
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{dmContentMode: dmContentFull},
+		}
+	}
+
+	t.Run("Content below the warn threshold is allowed silently", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+
+		newProcessor(1).processPost(api, post)
+
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("Content in the warn zone is kept and its author warned", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+		api.On("LogInfo", "Content is above the warn threshold", "post_id", "post1", "warn_threshold", 2, "categories", "hate: 3").Return()
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Locale: "es"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", &model.Post{
+			UserId:    "bot",
+			ChannelId: "dm",
+			Message:   fmt.Sprintf(notificationTranslations["es"].dmWarning, "Borderline message"),
+		}).Return(&model.Post{}, nil)
+
+		newProcessor(3).processPost(api, post)
+
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+	})
+
+	t.Run("Authors are not warned in monitor-only mode", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+		api.On("LogInfo", "Content is above the warn threshold", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+
+		processor := newProcessor(3)
+		processor.action.monitorOnly = true
+		processor.processPost(api, post)
+
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "CreatePost", mock.Anything)
+	})
+
+	t.Run("Content at the threshold is removed", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVDelete", queuedPostKeyPrefix+"post1").Return(nil)
+		api.On("LogInfo", "Content was flagged by moderation", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("DeletePost", "post1").Return(nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+		newProcessor(4).processPost(api, post)
+
+		api.AssertCalled(t, "DeletePost", "post1")
+		api.AssertNotCalled(t, "LogInfo", "Content is above the warn threshold", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestModerationUnavailable(t *testing.T) {
+	assert.Equal(t, ErrModerationUnavailable, moderationUnavailable(nil))
+
+	cause := moderation.NewError(moderation.ErrorRateLimit, errors.New("API returned status 429"))
+	err := moderationUnavailable(cause)
+	assert.ErrorIs(t, err, ErrModerationUnavailable)
+	assert.ErrorIs(t, err, cause)
+	assert.EqualError(t, err, "moderation service is not available: API returned status 429")
+	assert.Equal(t, err, moderationUnavailable(err), "errors already matching are not wrapped again")
+
+	kind, ok := moderation.KindOf(err)
+	require.True(t, ok)
+	assert.Equal(t, moderation.ErrorRateLimit, kind)
+
+	t.Run("Provider failures keep their kind", func(t *testing.T) {
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Test message").
+			Return(moderation.Result(nil), errors.Wrap(context.DeadlineExceeded, "error calling moderation API"))
+		processor := &PostProcessor{moderator: moderator, policy: newModerationPolicy(4, nil, nil, nil, nil)}
+
+		err := processor.moderatePost(&plugintest.API{}, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Test message"})
+		assert.ErrorIs(t, err, ErrModerationUnavailable)
+		kind, _ := moderation.KindOf(err)
+		assert.Equal(t, moderation.ErrorTimeout, kind)
+	})
+}
+
+func TestModeratorUnhealthy(t *testing.T) {
+	assert.Equal(t, ErrModeratorUnhealthy, moderatorUnhealthy(nil))
+
+	cause := moderation.NewError(moderation.ErrorAuth, errors.New("API returned status 401"))
+	err := moderatorUnhealthy(errors.Wrap(cause, "health check failed"))
+	assert.ErrorIs(t, err, ErrModeratorUnhealthy)
+	assert.ErrorIs(t, err, cause)
+	assert.EqualError(t, err, "moderation provider failed its health check: health check failed: API returned status 401")
+
+	kind, ok := moderation.KindOf(err)
+	require.True(t, ok)
+	assert.Equal(t, moderation.ErrorAuth, kind)
+}
+
+func TestModeratePostChainFollowsPolicy(t *testing.T) {
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Test message"}
+
+	// The first provider scores a disabled category high, which must not keep
+	// the second provider from flagging the post
+	first := &moderation.Stub{Default: moderation.Result{"sexual": 6}}
+	second := &moderation.Stub{Default: moderation.Result{"hate": 6}}
+	chain, err := moderation.NewChain([]moderation.Moderator{first, second}, false)
+	require.NoError(t, err)
+
+	processor := &PostProcessor{
+		moderator: chain,
+		policy:    newModerationPolicy(4, nil, nil, map[string]struct{}{"sexual": {}}, nil),
+	}
+
+	api := &plugintest.API{}
+	api.On("LogInfo", "Content was flagged by moderation", "post_id", "post1", "severity_threshold", 4,
+		"computed_severity_hate", 6, "severity_breakdown", mock.Anything).Return()
+
+	err = processor.moderatePost(api, post)
+	assert.ErrorIs(t, err, ErrModerationRejection)
+	assert.Equal(t, []string{"Test message"}, second.Texts())
+
+	t.Run("Stops once the post is flagged", func(t *testing.T) {
+		first := &moderation.Stub{Default: moderation.Result{"hate": 6}}
+		second := &moderation.Stub{Default: moderation.Result{"violence": 0}}
+		chain, err := moderation.NewChain([]moderation.Moderator{first, second}, false)
+		require.NoError(t, err)
+		processor.moderator = chain
+
+		err = processor.moderatePost(api, post)
+		assert.ErrorIs(t, err, ErrModerationRejection)
+		assert.Empty(t, second.Texts())
+	})
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// approvedProfileKeyPrefix prefixes the KV keys of the last username and
+	// nickname of each user that passed moderation
+	approvedProfileKeyPrefix = "approved_profile_"
+
+	profileActionReverted = "reverted"
+	profileActionReview   = "flagged for review"
+)
+
+// profileSeparators split the words of usernames, which are joined with dots,
+// underscores or dashes
+var profileSeparators = strings.NewReplacer(".", " ", "_", " ", "-", " ")
+
+// approvedProfile is the username and nickname of a user that last passed
+// moderation
+type approvedProfile struct {
+	Username string `json:"username"`
+	Nickname string `json:"nickname"`
+}
+
+// profileText returns the text moderated for a profile. The username is also
+// checked with its words separated, as for emoji names.
+func profileText(profile approvedProfile) string {
+	lines := []string{profile.Username}
+	if words := profileSeparators.Replace(profile.Username); words != profile.Username {
+		lines = append(lines, words)
+	}
+	if profile.Nickname != "" {
+		lines = append(lines, profile.Nickname)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// moderateProfile moderates the username and nickname of the user when they
+// changed since they last passed moderation. Mattermost offers plugins no
+// hook for profile updates, so profiles are checked when users are created
+// and when they log in. A flagged profile is reported to the moderation log
+// channel and, when an earlier profile passed moderation, changed back to it.
+func (p *PostProcessor) moderateProfile(api plugin.API, user *model.User) {
+	if !p.moderateProfiles || user.IsBot || !p.shouldModerateUser(user.Id) {
+		return
+	}
+
+	profile := approvedProfile{Username: user.Username, Nickname: user.Nickname}
+	approved, found := loadApprovedProfile(api, user.Id)
+	if found && approved == profile {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(p.baseContext(), p.moderationTimeout())
+	defer cancel()
+
+	// A profile that cannot be moderated now is moderated again at the
+	// user's next login
+	release, err := p.inline.acquire(ctx)
+	if err != nil {
+		api.LogError("Failed to moderate user profile", append(p.policy.loggedIDs("user_id", user.Id), "err", err)...)
+		return
+	}
+	result, err := p.moderator.ModerateText(ctx, profileText(profile))
+	release()
+	if err != nil {
+		api.LogError("Failed to moderate user profile", append(p.policy.loggedIDs("user_id", user.Id), "err", err)...)
+		return
+	}
+
+	categories := p.policy.flaggedCategories(result, p.policy.thresholdValue)
+	if len(categories) == 0 {
+		saveApprovedProfile(api, user.Id, profile)
+		return
+	}
+
+	api.LogInfo("User profile was flagged by moderation", append(p.policy.loggedIDs("user_id", user.Id), "categories", categories.String())...)
+
+	if p.action.monitorOnly || !found {
+		// Without an approved profile to go back to, an admin decides what
+		// to do with the account
+		p.logFlaggedProfile(api, user, categories, profileActionReview)
+		return
+	}
+
+	user.Username = approved.Username
+	user.Nickname = approved.Nickname
+	if _, appErr := api.UpdateUser(user); appErr != nil {
+		api.LogError("Failed to revert user profile flagged by content moderation", append(p.policy.loggedIDs("user_id", user.Id), "err", appErr)...)
+		p.logFlaggedProfile(api, user, categories, profileActionReview)
+		return
+	}
+	p.logFlaggedProfile(api, user, categories, profileActionReverted)
+
+	if err := p.notifyProfileOwner(api, user); err != nil {
+		api.LogError("Failed to notify user of reverted profile", append(p.policy.loggedIDs("user_id", user.Id), "err", err)...)
+	}
+}
+
+// logFlaggedProfile posts a summary of the flagged profile to the moderation
+// log channel, when one is configured
+func (p *PostProcessor) logFlaggedProfile(api plugin.API, user *model.User, categories moderation.Result, action string) {
+	if p.notifications == nil || p.notifications.logChannelID == "" {
+		return
+	}
+
+	rows := [][2]string{
+		{"User", fmt.Sprintf("@%s (`%s`)", user.Username, user.Id)},
+		{"Content", "Username and nickname"},
+		{"Action", action},
+		{"Categories", categories.String()},
+	}
+
+	var b strings.Builder
+	b.WriteString(moderationLogTitle + "\n\n| Field | Value |\n|:--|:--|\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "| %s | %s |\n", row[0], row[1])
+	}
+
+	if _, appErr := api.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: p.notifications.logChannelID,
+		Message:   strings.TrimSuffix(b.String(), "\n"),
+	}); appErr != nil {
+		api.LogError("Failed to post to the moderation log channel", append(p.policy.loggedIDs("user_id", user.Id), "err", errors.Wrap(appErr, "failed to create post"))...)
+	}
+}
+
+// notifyProfileOwner lets the user know by DM that their profile was changed
+// back
+func (p *PostProcessor) notifyProfileOwner(api plugin.API, user *model.User) error {
+	dmChannel, err := api.GetDirectChannel(p.botID, user.Id)
+	if err != nil {
+		return errors.Wrap(err, "failed to create DM channel")
+	}
+
+	if _, err := api.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: dmChannel.Id,
+		Message:   messagesForLocale(user.Locale).dmProfile,
+	}); err != nil {
+		return errors.Wrap(err, "failed to send DM notification")
+	}
+
+	return nil
+}
+
+// loadApprovedProfile returns the last profile of the user that passed
+// moderation, if any
+func loadApprovedProfile(api plugin.API, userID string) (approvedProfile, bool) {
+	var profile approvedProfile
+
+	data, appErr := api.KVGet(approvedProfileKeyPrefix + userID)
+	if appErr != nil {
+		api.LogError("Failed to load approved user profile", "user_id", userID, "err", appErr)
+		return profile, false
+	}
+	if data == nil {
+		return profile, false
+	}
+	if err := json.Unmarshal(data, &profile); err != nil {
+		api.LogError("Failed to decode approved user profile", "user_id", userID, "err", err)
+		return profile, false
+	}
+	return profile, true
+}
+
+// saveApprovedProfile records the profile of the user as passing moderation
+func saveApprovedProfile(api plugin.API, userID string, profile approvedProfile) {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		api.LogError("Failed to encode approved user profile", "user_id", userID, "err", err)
+		return
+	}
+	if appErr := api.KVSet(approvedProfileKeyPrefix+userID, data); appErr != nil {
+		api.LogError("Failed to save approved user profile", "user_id", userID, "err", appErr)
+	}
+}
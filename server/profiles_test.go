@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/blocklist"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileText(t *testing.T) {
+	assert.Equal(t, "alice", profileText(approvedProfile{Username: "alice"}))
+	assert.Equal(t, "big.slur_fan\nbig slur fan\nAl", profileText(approvedProfile{Username: "big.slur_fan", Nickname: "Al"}))
+}
+
+func TestModerateProfile(t *testing.T) {
+	const approvedKey = approvedProfileKeyPrefix + "user1"
+
+	newProcessor := func(t *testing.T) *PostProcessor {
+		mod, err := blocklist.New(&blocklist.Config{Terms: []blocklist.Term{{Text: "slur", Severity: moderation.MaxSeverity}}, WholeWord: true})
+		require.NoError(t, err)
+
+		return &PostProcessor{
+			botID:            "bot",
+			moderator:        mod,
+			moderateProfiles: true,
+			policy:           newModerationPolicy(4, nil, nil, nil, nil),
+			action:           &flaggedPostAction{action: moderationActionDelete},
+			notifications:    &notificationSettings{logChannelID: "log"},
+		}
+	}
+
+	t.Run("Username with a blocklisted term is reverted", func(t *testing.T) {
+		user := &model.User{Id: "user1", Username: "big_slur_fan", Nickname: "Al", Locale: "de"}
+
+		api := &plugintest.API{}
+		api.On("KVGet", approvedKey).Return([]byte(`{"username":"alice","nickname":"Al"}`), nil)
+		api.On("LogInfo", "User profile was flagged by moderation", "user_id", "user1", "categories", "blocklist: 6").Return()
+		api.On("UpdateUser", mock.MatchedBy(func(updated *model.User) bool {
+			return updated.Id == "user1" && updated.Username == "alice" && updated.Nickname == "Al"
+		})).Return(&model.User{}, nil)
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == "log" && post.UserId == "bot"
+		})).Return(&model.Post{}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", &model.Post{
+			UserId:    "bot",
+			ChannelId: "dm",
+			Message:   notificationTranslations["de"].dmProfile,
+		}).Return(&model.Post{}, nil)
+
+		newProcessor(t).moderateProfile(api, user)
+
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "KVSet", mock.Anything, mock.Anything)
+		for _, call := range api.Calls {
+			if call.Method == "CreatePost" && call.Arguments.Get(0).(*model.Post).ChannelId == "log" {
+				assert.Contains(t, call.Arguments.Get(0).(*model.Post).Message, "| Action | reverted |")
+			}
+		}
+	})
+
+	t.Run("New account is flagged for review", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", approvedKey).Return(nil, nil)
+		api.On("LogInfo", "User profile was flagged by moderation", "user_id", "user1", "categories", "blocklist: 6").Return()
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == "log"
+		})).Return(&model.Post{}, nil)
+
+		newProcessor(t).moderateProfile(api, &model.User{Id: "user1", Username: "alice", Nickname: "slur"})
+
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "UpdateUser", mock.Anything)
+		message := api.Calls[len(api.Calls)-1].Arguments.Get(0).(*model.Post).Message
+		assert.Contains(t, message, "| User | @alice (`user1`) |")
+		assert.Contains(t, message, "| Action | flagged for review |")
+	})
+
+	t.Run("Clean profile is approved", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", approvedKey).Return([]byte(`{"username":"alice"}`), nil)
+		api.On("KVSet", approvedKey, []byte(`{"username":"alice2","nickname":"Al"}`)).Return(nil)
+
+		newProcessor(t).moderateProfile(api, &model.User{Id: "user1", Username: "alice2", Nickname: "Al"})
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Unchanged profile is not moderated again", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", approvedKey).Return([]byte(`{"username":"alice","nickname":"Al"}`), nil)
+
+		processor := newProcessor(t)
+		processor.moderator = nil
+		processor.moderateProfile(api, &model.User{Id: "user1", Username: "alice", Nickname: "Al"})
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Disabled, bots and excluded users are skipped", func(t *testing.T) {
+		api := &plugintest.API{}
+
+		processor := newProcessor(t)
+		processor.excludedUsers = map[string]struct{}{"user2": {}}
+		processor.moderateProfile(api, &model.User{Id: "user2", Username: "slur"})
+		processor.moderateProfile(api, &model.User{Id: "user3", Username: "slur", IsBot: true})
+		processor.moderateProfiles = false
+		processor.moderateProfile(api, &model.User{Id: "user1", Username: "slur"})
+
+		assert.Empty(t, api.Calls)
+	})
+}
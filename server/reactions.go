@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// reactionModeratorTypes are the providers used to moderate reactions. Emoji
+// names are short identifiers that only local term and pattern matching
+// handles well, and sending every reaction to a remote provider would spend
+// its quota on very little text.
+var reactionModeratorTypes = map[string]struct{}{
+	"blocklist": {},
+	"regex":     {},
+}
+
+// reactionText returns the text moderated for an emoji name. Custom emoji
+// names join words with underscores or dashes, so they are also checked with
+// the words separated.
+func reactionText(emojiName string) string {
+	words := strings.NewReplacer("_", " ", "-", " ").Replace(emojiName)
+	if words == emojiName {
+		return emojiName
+	}
+	return emojiName + "\n" + words
+}
+
+// moderateReaction moderates the emoji name of a reaction and removes the
+// reaction when it is flagged, letting its author know by DM. Reactions are
+// only moderated when a reaction moderator is set.
+func (p *PostProcessor) moderateReaction(api plugin.API, reaction *model.Reaction) {
+	if p.reactionModerator == nil {
+		return
+	}
+
+	if !p.shouldModerateUser(reaction.UserId) || !p.shouldModerateChannel(reaction.ChannelId) {
+		return
+	}
+
+	if p.teams != nil && !p.teams.enabledForChannel(api, reaction.ChannelId) {
+		return
+	}
+
+	if p.policy.skipChannel(api, reaction.ChannelId) {
+		return
+	}
+
+	if !p.policy.moderating() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(p.baseContext(), p.moderationTimeout())
+	defer cancel()
+
+	result, err := p.reactionModerator.ModerateText(ctx, reactionText(reaction.EmojiName))
+	if err != nil {
+		api.LogError("Failed to moderate reaction", append(p.policy.loggedIDs("post_id", reaction.PostId, "user_id", reaction.UserId), "emoji_name", reaction.EmojiName, "err", err)...)
+		return
+	}
+
+	if err := p.policy.checkResult(api, reaction.PostId, reaction.ChannelId, moderation.Decision{Result: result}); err == nil {
+		return
+	}
+
+	if p.action.monitorOnly {
+		api.LogInfo("Monitor-only mode, leaving flagged reaction in place", append(p.policy.loggedIDs("post_id", reaction.PostId), "emoji_name", reaction.EmojiName)...)
+		return
+	}
+
+	if appErr := api.RemoveReaction(reaction); appErr != nil {
+		api.LogError("Failed to remove reaction flagged by content moderation", append(p.policy.loggedIDs("post_id", reaction.PostId), "emoji_name", reaction.EmojiName, "err", appErr)...)
+		return
+	}
+
+	if err := p.notifyReactionAuthor(api, reaction); err != nil {
+		api.LogError("Failed to notify author of removed reaction", append(p.policy.loggedIDs("post_id", reaction.PostId), "err", err)...)
+	}
+}
+
+// notifyReactionAuthor lets the author of a removed reaction know by DM. The
+// emoji name is not repeated, since it is the flagged content.
+func (p *PostProcessor) notifyReactionAuthor(api plugin.API, reaction *model.Reaction) error {
+	dmChannel, err := api.GetDirectChannel(p.botID, reaction.UserId)
+	if err != nil {
+		return errors.Wrap(err, "failed to create DM channel")
+	}
+
+	if _, err := api.CreatePost(&model.Post{
+		UserId:    p.botID,
+		ChannelId: dmChannel.Id,
+		Message:   messagesForLocale(userLocale(api, reaction.UserId)).dmReaction,
+	}); err != nil {
+		return errors.Wrap(err, "failed to send DM notification")
+	}
+
+	return nil
+}
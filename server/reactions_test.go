@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/blocklist"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReactionText(t *testing.T) {
+	assert.Equal(t, "thumbsup", reactionText("thumbsup"))
+	assert.Equal(t, "party_parrot\nparty parrot", reactionText("party_parrot"))
+	assert.Equal(t, "big-slur-face\nbig slur face", reactionText("big-slur-face"))
+}
+
+func TestModerateReaction(t *testing.T) {
+	newProcessor := func(t *testing.T) *PostProcessor {
+		mod, err := blocklist.New(&blocklist.Config{Terms: []blocklist.Term{{Text: "slur", Severity: moderation.MaxSeverity}}, WholeWord: true})
+		require.NoError(t, err)
+
+		return &PostProcessor{
+			botID:             "bot",
+			reactionModerator: mod,
+			policy:            newModerationPolicy(4, nil, nil, nil, nil),
+			action:            &flaggedPostAction{action: moderationActionDelete},
+		}
+	}
+
+	t.Run("Reaction with a slur emoji name is removed", func(t *testing.T) {
+		reaction := &model.Reaction{UserId: "user1", PostId: "post1", ChannelId: "channel1", EmojiName: "big_slur_face"}
+
+		api := &plugintest.API{}
+		api.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "post1", "severity_threshold", 4, "computed_severity_blocklist", 6, "severity_breakdown", "blocklist: 6", "blocklist_match", true).Return()
+		api.On("RemoveReaction", reaction).Return(nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1", Locale: "fr"}, nil)
+		api.On("CreatePost", &model.Post{
+			UserId:    "bot",
+			ChannelId: "dm",
+			Message:   notificationTranslations["fr"].dmReaction,
+		}).Return(&model.Post{}, nil)
+
+		newProcessor(t).moderateReaction(api, reaction)
+
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Clean reaction is kept", func(t *testing.T) {
+		api := &plugintest.API{}
+
+		newProcessor(t).moderateReaction(api, &model.Reaction{UserId: "user1", PostId: "post1", ChannelId: "channel1", EmojiName: "thumbsup"})
+
+		api.AssertNotCalled(t, "RemoveReaction", mock.Anything)
+	})
+
+	t.Run("Monitor only leaves the reaction in place", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogInfo", "Content was flagged by moderation",
+			"post_id", "post1", "severity_threshold", 4, "computed_severity_blocklist", 6, "severity_breakdown", "blocklist: 6", "blocklist_match", true).Return()
+		api.On("LogInfo", "Monitor-only mode, leaving flagged reaction in place", "post_id", "post1", "emoji_name", "slur").Return()
+
+		processor := newProcessor(t)
+		processor.action.monitorOnly = true
+		processor.moderateReaction(api, &model.Reaction{UserId: "user1", PostId: "post1", ChannelId: "channel1", EmojiName: "slur"})
+
+		api.AssertNotCalled(t, "RemoveReaction", mock.Anything)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Reactions are not moderated without a reaction moderator", func(t *testing.T) {
+		api := &plugintest.API{}
+
+		processor := newProcessor(t)
+		processor.reactionModerator = nil
+		processor.moderateReaction(api, &model.Reaction{UserId: "user1", PostId: "post1", ChannelId: "channel1", EmojiName: "slur"})
+
+		api.AssertNotCalled(t, "RemoveReaction", mock.Anything)
+	})
+}
+
+func TestBuildReactionModerator(t *testing.T) {
+	t.Run("Remote providers are not used", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogWarn", "Reaction moderation requires the blocklist or regex provider, reactions are not moderated").Return()
+
+		mod, err := buildReactionModerator(api, &configuration{Type: "azure", Endpoint: "https://example.com", APIKey: "key"})
+		require.NoError(t, err)
+		assert.Nil(t, mod)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Local providers are used", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogInfo", "Blocklist moderator initialized").Return()
+
+		mod, err := buildReactionModerator(api, &configuration{Type: "azure,blocklist", BlocklistTerms: "slur", Threshold: "4"})
+		require.NoError(t, err)
+		assert.IsType(t, &blocklist.Moderator{}, mod)
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+const (
+	// defaultRescanInterval is how often the provider is checked while posts
+	// are waiting to be rescanned
+	defaultRescanInterval = time.Minute
+
+	// pendingRescanRetention bounds how old a held post may be and still be
+	// rescanned, so that a long outage does not act on posts long since read
+	pendingRescanRetention = 24 * time.Hour
+)
+
+// rescanPendingPosts periodically re-queues held posts once the moderation
+// provider is healthy again, until stop is closed
+func (p *PostProcessor) rescanPendingPosts(api plugin.API, stop <-chan struct{}) {
+	ticker := time.NewTicker(p.rescanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			p.rescanPending(api)
+		}
+	}
+}
+
+// rescanPending re-queues every held post when the moderation provider passes
+// its health check, and returns the number of posts re-queued. Posts that were
+// deleted or are older than the retention window are forgotten instead.
+func (p *PostProcessor) rescanPending(api plugin.API) int {
+	postIDs, err := listPendingRescanIDs(api)
+	if err != nil {
+		api.LogError("Failed to load posts pending rescan", "err", err)
+		return 0
+	}
+	if len(postIDs) == 0 {
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(p.baseContext(), p.moderationTimeout())
+	defer cancel()
+	if err := p.moderator.HealthCheck(ctx); err != nil {
+		api.LogDebug("Moderation provider is still unavailable, postponing rescan", "pending", len(postIDs), "err", err.Error())
+		return 0
+	}
+
+	oldest := model.GetMillisForTime(time.Now().Add(-pendingRescanRetention))
+	requeued := 0
+	var done []string
+	for _, postID := range postIDs {
+		post, appErr := api.GetPost(postID)
+		if appErr != nil && appErr.StatusCode != http.StatusNotFound {
+			api.LogError("Failed to get post pending rescan", append(p.policy.loggedIDs("post_id", postID), "err", appErr)...)
+			continue
+		}
+		done = append(done, postID)
+		if appErr != nil || post.DeleteAt != 0 {
+			continue
+		}
+		if post.CreateAt < oldest {
+			api.LogInfo("Skipping rescan of post older than the retention window", p.policy.loggedIDs("post_id", postID)...)
+			continue
+		}
+
+		p.queuePostForProcessing(api, post)
+		requeued++
+	}
+	p.removePendingRescans(api, done)
+
+	if requeued > 0 {
+		api.LogInfo("Re-queued posts held while the moderation provider was unavailable", "count", requeued)
+	}
+	return requeued
+}
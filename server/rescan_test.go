@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRescanPending(t *testing.T) {
+	newProcessor := func(moderator moderation.Moderator) *PostProcessor {
+		return &PostProcessor{
+			botID:         "bot",
+			moderator:     moderator,
+			policy:        &moderationPolicy{thresholdValue: 4},
+			postsCh:       make(chan *model.Post, 10),
+			retry:         &retryPolicy{maxAttempts: 1, deadLetterAction: deadLetterHold},
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{dmContentMode: dmContentNone},
+		}
+	}
+
+	t.Run("Outage then recovery removes the violating post", func(t *testing.T) {
+		post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Offensive message", CreateAt: model.GetMillisForTime(time.Now())}
+
+		api := &plugintest.API{}
+		api.On("LogWarn", mock.Anything).Return()
+		api.On("LogWarn", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogDebug", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+		api.On("LogInfo", "Moderation provider recovered").Return()
+		api.On("KVSet", mock.AnythingOfType("string"), []byte{1}).Return(nil)
+		api.On("KVDelete", mock.AnythingOfType("string")).Return(nil)
+		api.On("KVGet", pendingRescanKey).Return(nil, nil).Once()
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["post1"]`), model.PluginKVSetOptions{Atomic: true}).Return(true, nil).Once()
+		api.On("KVGet", pendingRescanKey).Return([]byte(`["post1"]`), nil)
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(nil), model.PluginKVSetOptions{Atomic: true, OldValue: []byte(`["post1"]`)}).Return(true, nil).Once()
+		api.On("GetPost", "post1").Return(post, nil)
+		api.On("DeletePost", "post1").Return(nil)
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Offensive message").
+			Return(moderation.Result{}, errors.New("API error")).Once()
+		moderator.On("ModerateText", mock.Anything, "Offensive message").
+			Return(moderation.Result{"hate": 6}, nil).Once()
+		moderator.On("HealthCheck", mock.Anything).Return(errors.New("API error")).Once()
+		moderator.On("HealthCheck", mock.Anything).Return(nil).Once()
+
+		processor := newProcessor(moderator)
+
+		// The provider is down, so the post is held for a rescan
+		processor.processPost(api, post)
+		assert.True(t, processor.degraded.Load())
+		api.AssertCalled(t, "KVSetWithOptions", pendingRescanKey, []byte(`["post1"]`), model.PluginKVSetOptions{Atomic: true})
+		api.AssertNotCalled(t, "DeletePost", "post1")
+
+		// The post stays held while the provider is still failing
+		assert.Equal(t, 0, processor.rescanPending(api))
+		assert.Empty(t, processor.postsCh)
+		api.AssertNumberOfCalls(t, "KVSetWithOptions", 1)
+
+		// Once the provider recovers the post is moderated again and removed
+		require.Equal(t, 1, processor.rescanPending(api))
+		api.AssertNumberOfCalls(t, "KVSetWithOptions", 2)
+		processor.processPost(api, <-processor.postsCh)
+
+		assert.False(t, processor.degraded.Load())
+		api.AssertCalled(t, "DeletePost", "post1")
+		moderator.AssertExpectations(t)
+	})
+
+	t.Run("Deleted and expired posts are forgotten", func(t *testing.T) {
+		expired := model.GetMillisForTime(time.Now().Add(-pendingRescanRetention - time.Hour))
+
+		pending := []byte(`["deleted","expired","missing","unavailable"]`)
+
+		api := &plugintest.API{}
+		api.On("KVGet", pendingRescanKey).Return(pending, nil)
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["unavailable"]`), model.PluginKVSetOptions{Atomic: true, OldValue: pending}).Return(true, nil).Once()
+		api.On("GetPost", "deleted").Return(&model.Post{Id: "deleted", DeleteAt: 1}, nil)
+		api.On("GetPost", "expired").Return(&model.Post{Id: "expired", CreateAt: expired}, nil)
+		api.On("GetPost", "missing").Return(nil, &model.AppError{Message: "not found", StatusCode: http.StatusNotFound})
+		api.On("LogInfo", "Skipping rescan of post older than the retention window", "post_id", "expired").Return()
+		api.On("GetPost", "unavailable").Return(nil, &model.AppError{Message: "database is down", StatusCode: http.StatusInternalServerError})
+		api.On("LogError", "Failed to get post pending rescan", "post_id", "unavailable", "err", mock.Anything).Return()
+
+		moderator := &MockModerator{}
+		moderator.On("HealthCheck", mock.Anything).Return(nil)
+
+		processor := newProcessor(moderator)
+		assert.Equal(t, 0, processor.rescanPending(api))
+		assert.Empty(t, processor.postsCh)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Provider is not checked without pending posts", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", pendingRescanKey).Return(nil, nil)
+
+		moderator := &MockModerator{}
+		assert.Equal(t, 0, newProcessor(moderator).rescanPending(api))
+		moderator.AssertNotCalled(t, "HealthCheck", mock.Anything)
+	})
+
+	t.Run("Holding retries when another server updates the pending posts", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", pendingRescanKey).Return([]byte(`["post1"]`), nil).Once()
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["post1","post2"]`), model.PluginKVSetOptions{Atomic: true, OldValue: []byte(`["post1"]`)}).Return(false, nil).Once()
+		api.On("KVGet", pendingRescanKey).Return([]byte(`["post1","post3"]`), nil).Once()
+		api.On("KVSetWithOptions", pendingRescanKey, []byte(`["post1","post3","post2"]`), model.PluginKVSetOptions{Atomic: true, OldValue: []byte(`["post1","post3"]`)}).Return(true, nil).Once()
+		api.On("KVDelete", queuedPostKeyPrefix+"post2").Return(nil)
+
+		newProcessor(&MockModerator{}).holdPostForRescan(api, "post2")
+		api.AssertExpectations(t)
+	})
+}
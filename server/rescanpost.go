@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/pkg/errors"
+)
+
+// postRescanRequest is the optional body of the request moderating a post
+// again
+type postRescanRequest struct {
+	// Enforce applies the moderation action to the post when it is flagged.
+	// Otherwise the post is only moderated and left as it is.
+	Enforce bool `json:"enforce"`
+}
+
+// postRescanResult reports the moderation of a post with the current
+// configuration
+type postRescanResult struct {
+	PostID string `json:"post_id"`
+
+	// Flagged reports whether the post would be flagged now, Warned whether
+	// it would be allowed with a warning to its author, and Enforced whether
+	// the moderation action was applied to it
+	Flagged  bool `json:"flagged"`
+	Warned   bool `json:"warned"`
+	Enforced bool `json:"enforced"`
+
+	// Result holds the severity of every category checked, and Categories
+	// only those above their threshold, or above the warn threshold when the
+	// post is warned about. Result is empty when the post is not moderated,
+	// for example because its author is excluded.
+	Result     moderation.Result `json:"result"`
+	Categories moderation.Result `json:"flagged_categories,omitempty"`
+
+	Providers []string `json:"providers,omitempty"`
+	Language  string   `json:"language,omitempty"`
+
+	// Degraded reports that the fallback provider checked the post because
+	// the configured providers failed
+	Degraded bool `json:"degraded,omitempty"`
+}
+
+// rescanPost handles the API endpoint moderating a single post again with the
+// current configuration, so that reviewers can check a post after tuning the
+// settings. The post is moderated as the workers would, without waiting in
+// the queue, and the moderation action is only applied when requested.
+func (p *Plugin) rescanPost(w http.ResponseWriter, r *http.Request) {
+	processor := p.getProcessor()
+	if processor == nil {
+		http.Error(w, "content moderation is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	var request postRescanRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid rescan request", http.StatusBadRequest)
+		return
+	}
+
+	postID := mux.Vars(r)["post_id"]
+	if !model.IsValidId(postID) {
+		http.Error(w, "invalid post ID", http.StatusBadRequest)
+		return
+	}
+
+	post, appErr := p.API.GetPost(postID)
+	if appErr != nil && appErr.StatusCode != http.StatusNotFound {
+		http.Error(w, "failed to get post", http.StatusInternalServerError)
+		p.API.LogError("failed to get post to rescan", "post_id", postID, "error", appErr.Error())
+		return
+	}
+	if appErr != nil || post.DeleteAt != 0 {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return
+	}
+
+	release, err := processor.inline.acquire(r.Context())
+	if err != nil {
+		http.Error(w, "too many moderation requests in progress", http.StatusServiceUnavailable)
+		return
+	}
+	decision, err := processor.evaluatePost(p.API, post)
+	release()
+	if errors.Is(err, ErrModerationUnavailable) {
+		http.Error(w, "moderation provider is unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	result := postRescanResult{
+		PostID:    post.Id,
+		Result:    decision.Result,
+		Providers: decision.Providers,
+		Language:  decision.Language,
+		Degraded:  decision.Degraded,
+	}
+
+	var warned *warnedContentError
+	if errors.As(err, &warned) {
+		result.Warned = true
+		result.Categories = warned.categories
+	}
+
+	var flagged *flaggedContentError
+	if errors.As(err, &flagged) {
+		result.Flagged = true
+		result.Categories = flagged.categories
+		result.Result = flagged.decision.Result
+		result.Providers = flagged.decision.Providers
+		result.Language = flagged.decision.Language
+		result.Degraded = flagged.decision.Degraded
+
+		if request.Enforce {
+			processor.handleFlaggedPost(p.API, post, flagged.categories, flagged.decision)
+			result.Enforced = true
+		}
+	}
+
+	p.API.LogInfo("Post moderated again on request", append(processor.policy.loggedIDs("post_id", post.Id),
+		"flagged", result.Flagged, "warned", result.Warned, "enforced", result.Enforced)...)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRescanPost(t *testing.T) {
+	postID := "pppppppppppppppppppppppppp"
+	post := &model.Post{Id: postID, UserId: "user1", ChannelId: "channel1", Message: "Offensive message"}
+
+	setup := func() (*Plugin, *plugintest.API, *MockModerator) {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("GetPost", postID).Return(post, nil)
+		api.On("LogInfo", "Content was flagged by moderation",
+			"post_id", postID, "severity_threshold", 4, "computed_severity_hate", 6, "severity_breakdown", "hate: 6, violence: 0", "providers", "azure").Return()
+
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, "Offensive message").Return(moderation.Result{"hate": 6, "violence": 0}, nil)
+
+		processor := &PostProcessor{
+			botID:         "bot",
+			moderator:     moderator,
+			policy:        newModerationPolicy(4, nil, nil, nil, nil),
+			postsCh:       make(chan *model.Post, 10),
+			action:        &flaggedPostAction{action: moderationActionDelete},
+			notifications: &notificationSettings{dmContentMode: dmContentNone},
+			providers:     []string{"azure"},
+		}
+
+		p := &Plugin{processor: processor}
+		p.SetAPI(api)
+		return p, api, moderator
+	}
+
+	rescan := func(p *Plugin, id, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/posts/"+id+"/rescan", strings.NewReader(body))
+		r.Header.Set("Mattermost-User-ID", "admin")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("Report only", func(t *testing.T) {
+		p, api, _ := setup()
+		api.On("LogInfo", "Post moderated again on request", "post_id", postID, "flagged", true, "warned", false, "enforced", false).Return().Once()
+
+		w := rescan(p, postID, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var result postRescanResult
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		assert.Equal(t, postRescanResult{
+			PostID:     postID,
+			Flagged:    true,
+			Result:     moderation.Result{"hate": 6, "violence": 0},
+			Categories: moderation.Result{"hate": 6},
+			Providers:  []string{"azure"},
+		}, result)
+
+		api.AssertExpectations(t)
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+	})
+
+	t.Run("Enforce", func(t *testing.T) {
+		p, api, _ := setup()
+		api.On("LogInfo", "Post moderated again on request", "post_id", postID, "flagged", true, "warned", false, "enforced", true).Return().Once()
+		api.On("DeletePost", postID).Return(nil).Once()
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("GetUser", "user1").Return(&model.User{Id: "user1"}, nil)
+		api.On("GetDirectChannel", "bot", "user1").Return(&model.Channel{Id: "dm"}, nil)
+		api.On("CreatePost", mock.Anything).Return(&model.Post{}, nil)
+
+		w := rescan(p, postID, `{"enforce":true}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var result postRescanResult
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		assert.True(t, result.Flagged)
+		assert.True(t, result.Enforced)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Posts that are not flagged are left alone", func(t *testing.T) {
+		p, api, moderator := setup()
+		moderator.ExpectedCalls = nil
+		moderator.On("ModerateText", mock.Anything, "Offensive message").Return(moderation.Result{"hate": 2}, nil)
+		api.On("LogInfo", "Post moderated again on request", "post_id", postID, "flagged", false, "warned", false, "enforced", false).Return().Once()
+
+		w := rescan(p, postID, `{"enforce":true}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var result postRescanResult
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		assert.False(t, result.Flagged)
+		assert.Equal(t, moderation.Result{"hate": 2}, result.Result)
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+	})
+
+	t.Run("Posts in the warn zone are reported as warned", func(t *testing.T) {
+		p, api, moderator := setup()
+		moderator.ExpectedCalls = nil
+		moderator.On("ModerateText", mock.Anything, "Offensive message").Return(moderation.Result{"hate": 2}, nil)
+		p.processor.policy.warnThreshold = 2
+		api.On("LogInfo", "Content is above the warn threshold", "post_id", postID, "warn_threshold", 2, "categories", "hate: 2").Return()
+		api.On("LogInfo", "Post moderated again on request", "post_id", postID, "flagged", false, "warned", true, "enforced", false).Return().Once()
+
+		w := rescan(p, postID, `{"enforce":true}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var result postRescanResult
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		assert.True(t, result.Warned)
+		assert.False(t, result.Flagged)
+		assert.Equal(t, moderation.Result{"hate": 2}, result.Categories)
+		api.AssertCalled(t, "LogInfo", "Post moderated again on request", "post_id", postID, "flagged", false, "warned", true, "enforced", false)
+		api.AssertNotCalled(t, "DeletePost", mock.Anything)
+	})
+
+	t.Run("Unknown post", func(t *testing.T) {
+		p, api, _ := setup()
+		missingID := "mmmmmmmmmmmmmmmmmmmmmmmmmm"
+		api.On("GetPost", missingID).Return(nil, model.NewAppError("GetPost", "app.post.get.app_error", nil, "", http.StatusNotFound))
+
+		w := rescan(p, missingID, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "post not found\n", w.Body.String())
+	})
+
+	t.Run("Invalid post ID", func(t *testing.T) {
+		p, _, _ := setup()
+
+		w := rescan(p, "not-an-id", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
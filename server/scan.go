@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+const (
+	// scanStatusKey is the KV key holding the progress of the current or last scan
+	scanStatusKey = "scan_status"
+
+	// scanPageSize is the number of posts fetched per page of channel history
+	scanPageSize = 100
+
+	// scanQueueShare is the share of the processing queue a scan may fill. The
+	// rest is left free so that new posts are still moderated promptly.
+	scanQueueShare = 0.5
+
+	// scanPollInterval is how often a scan waiting for queue capacity checks again
+	scanPollInterval = time.Second
+)
+
+const (
+	scanStateRunning   = "running"
+	scanStateCompleted = "completed"
+	scanStateCanceled  = "canceled"
+	scanStateFailed    = "failed"
+)
+
+var (
+	errScanCanceled      = errors.New("scan canceled")
+	errPluginDeactivated = errors.New("plugin deactivated")
+)
+
+// scanRequest is the body of the request starting a scan. Since and Until are
+// timestamps in milliseconds; Until defaults to the current time.
+type scanRequest struct {
+	ChannelID string `json:"channel_id"`
+	Since     int64  `json:"since"`
+	Until     int64  `json:"until"`
+
+	// Resume continues the last canceled or failed scan from where it stopped
+	// instead of starting a new one
+	Resume bool `json:"resume"`
+}
+
+// scanStatus is the persisted progress of a scan. Posts are read newest
+// first, so Cursor is the creation time of the oldest post queued so far.
+type scanStatus struct {
+	ChannelID string `json:"channel_id"`
+	Since     int64  `json:"since"`
+	Until     int64  `json:"until"`
+	State     string `json:"state"`
+	Error     string `json:"error,omitempty"`
+	Page      int    `json:"page"`
+	Cursor    int64  `json:"cursor"`
+	Scanned   int    `json:"scanned"`
+	Queued    int    `json:"queued"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+// loadScanStatus returns the persisted scan progress, or nil when no scan was started
+func loadScanStatus(api plugin.API) (*scanStatus, error) {
+	data, appErr := api.KVGet(scanStatusKey)
+	if appErr != nil {
+		return nil, errors.Wrap(appErr, "failed to load scan status")
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	status := &scanStatus{}
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, errors.Wrap(err, "failed to decode scan status")
+	}
+	return status, nil
+}
+
+// saveScanStatus persists the scan progress so that the scan can be resumed
+func saveScanStatus(api plugin.API, status *scanStatus) {
+	status.UpdatedAt = model.GetMillis()
+
+	data, err := json.Marshal(status)
+	if err != nil {
+		api.LogError("Failed to encode scan status", "err", err)
+		return
+	}
+
+	if appErr := api.KVSet(scanStatusKey, data); appErr != nil {
+		api.LogError("Failed to save scan status", "err", appErr)
+	}
+}
+
+// startScan runs the scan in the background. Only one scan runs at a time.
+func (p *Plugin) startScan(status *scanStatus) bool {
+	p.scanLock.Lock()
+	defer p.scanLock.Unlock()
+
+	if p.scanDone != nil {
+		return false
+	}
+
+	// Deactivating the plugin also cancels the moderation requests of the scan
+	ctx, cancel := context.WithCancelCause(p.requestContext())
+	done := make(chan struct{})
+	p.scanCancel = cancel
+	p.scanDone = done
+
+	go func() {
+		defer close(done)
+		defer func() {
+			p.scanLock.Lock()
+			p.scanCancel = nil
+			p.scanDone = nil
+			p.scanLock.Unlock()
+		}()
+
+		p.runScan(ctx, status)
+	}()
+
+	return true
+}
+
+// stopScan cancels the running scan, if any, and waits for it to stop
+func (p *Plugin) stopScan(cause error) bool {
+	p.scanLock.Lock()
+	cancel, done := p.scanCancel, p.scanDone
+	p.scanLock.Unlock()
+
+	if done == nil {
+		return false
+	}
+
+	cancel(cause)
+	<-done
+	return true
+}
+
+// resumeScan restarts a scan that was interrupted when the plugin was deactivated
+func (p *Plugin) resumeScan() {
+	status, err := loadScanStatus(p.API)
+	if err != nil {
+		p.API.LogError("Failed to resume scan", "err", err)
+		return
+	}
+
+	if status != nil && status.State == scanStateRunning {
+		p.API.LogInfo("Resuming scan of channel history", "channel_id", status.ChannelID, "queued", status.Queued)
+		p.startScan(status)
+	}
+}
+
+// runScan pages through the channel history, newest first, and queues every
+// post created within the scan range for moderation. The texts of each page
+// are moderated in batches when the moderator supports it. Progress is saved
+// after every page. When the plugin is deactivated the scan stays in the running
+// state, so that it is resumed on the next activation.
+func (p *Plugin) runScan(ctx context.Context, status *scanStatus) {
+	finish := func(state string, err error) {
+		status.State = state
+		if err != nil {
+			status.Error = err.Error()
+		}
+		saveScanStatus(p.API, status)
+	}
+
+	for {
+		if ctx.Err() != nil {
+			p.interruptScan(ctx, status)
+			return
+		}
+
+		list, appErr := p.API.GetPostsForChannel(status.ChannelID, status.Page, scanPageSize)
+		if appErr != nil {
+			p.API.LogError("Failed to get posts for scan", "channel_id", status.ChannelID, "page", status.Page, "err", appErr)
+			finish(scanStateFailed, appErr)
+			return
+		}
+
+		posts := list.ToSlice()
+		reachedStart := false
+		scanned := make([]*model.Post, 0, len(posts))
+		for _, post := range posts {
+			if post.CreateAt < status.Since {
+				reachedStart = true
+				break
+			}
+
+			// Skip posts newer than the range, and posts already queued
+			// before the scan was resumed
+			if post.CreateAt > status.Until || (status.Cursor != 0 && post.CreateAt >= status.Cursor) {
+				continue
+			}
+
+			status.Scanned++
+			if post.DeleteAt != 0 || post.IsSystemMessage() {
+				continue
+			}
+			scanned = append(scanned, post)
+		}
+
+		if processor := p.getProcessor(); processor != nil {
+			processor.prefetchResults(ctx, p.API, scanned)
+		}
+
+		for _, post := range scanned {
+			processor := p.waitForScanCapacity(ctx, status.ChannelID)
+			if processor == nil {
+				p.interruptScan(ctx, status)
+				return
+			}
+
+			if !processor.isOwnPost(post) {
+				processor.queuePostForProcessing(p.API, post)
+				status.Queued++
+			}
+			status.Cursor = post.CreateAt
+		}
+
+		status.Page++
+		if reachedStart || len(posts) < scanPageSize {
+			p.API.LogInfo("Finished scan of channel history", "channel_id", status.ChannelID, "queued", status.Queued)
+			finish(scanStateCompleted, nil)
+			return
+		}
+		saveScanStatus(p.API, status)
+	}
+}
+
+// interruptScan records why the scan stopped before reaching the start of the range
+func (p *Plugin) interruptScan(ctx context.Context, status *scanStatus) {
+	if errors.Is(context.Cause(ctx), errScanCanceled) {
+		status.State = scanStateCanceled
+		p.API.LogInfo("Canceled scan of channel history", "channel_id", status.ChannelID, "queued", status.Queued)
+	}
+	saveScanStatus(p.API, status)
+}
+
+// waitForScanCapacity blocks until the processing queue of the channel has
+// room for scanned posts, returning nil if the scan is stopped first. A scan
+// only fills part of the queue, so a large range cannot delay the moderation
+// of new posts.
+func (p *Plugin) waitForScanCapacity(ctx context.Context, channelID string) *PostProcessor {
+	for {
+		processor := p.getProcessor()
+		if processor != nil {
+			queue := processor.queueFor(channelID)
+			if float64(len(queue)) < float64(cap(queue))*scanQueueShare {
+				return processor
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(scanPollInterval):
+		}
+	}
+}
+
+// startScanRequest handles the API endpoint starting or resuming a scan
+func (p *Plugin) startScanRequest(w http.ResponseWriter, r *http.Request) {
+	if p.getProcessor() == nil {
+		http.Error(w, "content moderation is not running", http.StatusServiceUnavailable)
+		return
+	}
+
+	var request scanRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "invalid scan request", http.StatusBadRequest)
+		return
+	}
+
+	status, err := loadScanStatus(p.API)
+	if err != nil {
+		http.Error(w, "failed to load scan status", http.StatusInternalServerError)
+		p.API.LogError("failed to load scan status", "error", err.Error())
+		return
+	}
+
+	if request.Resume {
+		if status == nil || (status.State != scanStateCanceled && status.State != scanStateFailed) {
+			http.Error(w, "there is no canceled or failed scan to resume", http.StatusConflict)
+			return
+		}
+		status.State = scanStateRunning
+		status.Error = ""
+	} else {
+		if !model.IsValidId(request.ChannelID) {
+			http.Error(w, "channel_id must be a valid channel ID", http.StatusBadRequest)
+			return
+		}
+		if request.Until == 0 {
+			request.Until = model.GetMillis()
+		}
+		if request.Since < 0 || request.Until < request.Since {
+			http.Error(w, "since and until must be timestamps in milliseconds, with since before until", http.StatusBadRequest)
+			return
+		}
+		if _, appErr := p.API.GetChannel(request.ChannelID); appErr != nil {
+			http.Error(w, "channel not found", http.StatusNotFound)
+			return
+		}
+
+		status = &scanStatus{
+			ChannelID: request.ChannelID,
+			Since:     request.Since,
+			Until:     request.Until,
+			State:     scanStateRunning,
+		}
+	}
+
+	// The scan updates its status as it runs, so respond with a copy
+	response := *status
+	if !p.startScan(status) {
+		http.Error(w, "a scan is already running", http.StatusConflict)
+		return
+	}
+	p.API.LogInfo("Started scan of channel history", "channel_id", status.ChannelID, "since", status.Since, "until", status.Until)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
+
+// getScanStatus handles the API endpoint reporting the progress of the current or last scan
+func (p *Plugin) getScanStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := loadScanStatus(p.API)
+	if err != nil {
+		http.Error(w, "failed to load scan status", http.StatusInternalServerError)
+		p.API.LogError("failed to load scan status", "error", err.Error())
+		return
+	}
+	if status == nil {
+		http.Error(w, "no scan has been started", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
+
+// cancelScan handles the API endpoint canceling the running scan. Posts
+// already queued are still moderated.
+func (p *Plugin) cancelScan(w http.ResponseWriter, r *http.Request) {
+	if !p.stopScan(errScanCanceled) {
+		http.Error(w, "no scan is running", http.StatusNotFound)
+		return
+	}
+
+	p.getScanStatus(w, r)
+}
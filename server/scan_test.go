@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunScan(t *testing.T) {
+	channelID := model.NewId()
+
+	newAPI := func(posts ...*model.Post) *plugintest.API {
+		list := &model.PostList{Posts: map[string]*model.Post{}}
+		for _, post := range posts {
+			list.Order = append(list.Order, post.Id)
+			list.Posts[post.Id] = post
+		}
+
+		api := &plugintest.API{}
+		api.On("GetPostsForChannel", channelID, 0, scanPageSize).Return(list, nil)
+		api.On("KVSet", mock.AnythingOfType("string"), mock.Anything).Return(nil)
+		api.On("LogInfo", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+		return api
+	}
+
+	queuedIDs := func(processor *PostProcessor) []string {
+		var ids []string
+		for len(processor.postsCh) > 0 {
+			ids = append(ids, (<-processor.postsCh).Id)
+		}
+		return ids
+	}
+
+	t.Run("Posts within the range are queued", func(t *testing.T) {
+		api := newAPI(
+			&model.Post{Id: "newer", CreateAt: 400},
+			&model.Post{Id: "second", CreateAt: 300},
+			&model.Post{Id: "deleted", CreateAt: 250, DeleteAt: 260},
+			&model.Post{Id: "system", CreateAt: 220, Type: model.PostTypeJoinChannel},
+			&model.Post{Id: "first", CreateAt: 200},
+			&model.Post{Id: "older", CreateAt: 100},
+		)
+		processor := &PostProcessor{postsCh: make(chan *model.Post, 10)}
+		p := &Plugin{processor: processor}
+		p.SetAPI(api)
+
+		status := &scanStatus{ChannelID: channelID, Since: 150, Until: 350, State: scanStateRunning}
+		p.runScan(t.Context(), status)
+
+		assert.Equal(t, []string{"second", "first"}, queuedIDs(processor))
+		assert.Equal(t, scanStateCompleted, status.State)
+		assert.Equal(t, 4, status.Scanned)
+		assert.Equal(t, 2, status.Queued)
+		assert.Equal(t, int64(200), status.Cursor)
+		api.AssertCalled(t, "KVSet", queuedPostKeyPrefix+"second", []byte{1})
+		api.AssertCalled(t, "KVSet", scanStatusKey, mock.Anything)
+	})
+
+	t.Run("Resumed scan skips posts queued before", func(t *testing.T) {
+		api := newAPI(
+			&model.Post{Id: "second", CreateAt: 300},
+			&model.Post{Id: "first", CreateAt: 200},
+		)
+		processor := &PostProcessor{postsCh: make(chan *model.Post, 10)}
+		p := &Plugin{processor: processor}
+		p.SetAPI(api)
+
+		status := &scanStatus{ChannelID: channelID, Since: 0, Until: 350, State: scanStateRunning, Cursor: 300, Queued: 1}
+		p.runScan(t.Context(), status)
+
+		assert.Equal(t, []string{"first"}, queuedIDs(processor))
+		assert.Equal(t, 2, status.Queued)
+	})
+
+	t.Run("Scan waiting for queue capacity can be canceled", func(t *testing.T) {
+		api := newAPI(&model.Post{Id: "first", CreateAt: 200})
+		processor := &PostProcessor{postsCh: make(chan *model.Post, 2)}
+		processor.postsCh <- &model.Post{Id: "live"}
+		p := &Plugin{processor: processor}
+		p.SetAPI(api)
+
+		status := &scanStatus{ChannelID: channelID, Until: 350, State: scanStateRunning}
+		require.True(t, p.startScan(status))
+		assert.False(t, p.startScan(status), "only one scan may run at a time")
+		require.True(t, p.stopScan(errScanCanceled))
+
+		assert.Equal(t, scanStateCanceled, status.State)
+		assert.Equal(t, []string{"live"}, queuedIDs(processor))
+		assert.False(t, p.stopScan(errScanCanceled))
+	})
+
+	t.Run("Scan interrupted by deactivation stays running", func(t *testing.T) {
+		api := newAPI(&model.Post{Id: "first", CreateAt: 200})
+		processor := &PostProcessor{postsCh: make(chan *model.Post, 2)}
+		processor.postsCh <- &model.Post{Id: "live"}
+		p := &Plugin{processor: processor}
+		p.SetAPI(api)
+
+		status := &scanStatus{ChannelID: channelID, Until: 350, State: scanStateRunning}
+		require.True(t, p.startScan(status))
+		require.True(t, p.stopScan(errPluginDeactivated))
+
+		assert.Equal(t, scanStateRunning, status.State)
+	})
+}
+
+func TestScanAPI(t *testing.T) {
+	request := func(p *Plugin, api *plugintest.API, method, body string) *httptest.ResponseRecorder {
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		p.SetAPI(api)
+
+		r := httptest.NewRequest(method, "/api/v1/scan", strings.NewReader(body))
+		r.Header.Set("Mattermost-User-ID", "admin")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	t.Run("Invalid channel ID is rejected", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", scanStatusKey).Return(nil, nil)
+
+		w := request(&Plugin{processor: &PostProcessor{}}, api, http.MethodPost, `{"channel_id":"nope"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Range ending before it starts is rejected", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("KVGet", scanStatusKey).Return(nil, nil)
+
+		w := request(&Plugin{processor: &PostProcessor{}}, api, http.MethodPost,
+			`{"channel_id":"`+model.NewId()+`","since":200,"until":100}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Resume without an interrupted scan is rejected", func(t *testing.T) {
+		data, err := json.Marshal(&scanStatus{State: scanStateCompleted})
+		require.NoError(t, err)
+		api := &plugintest.API{}
+		api.On("KVGet", scanStatusKey).Return(data, nil)
+
+		w := request(&Plugin{processor: &PostProcessor{}}, api, http.MethodPost, `{"resume":true}`)
+		assert.Equal(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Progress is reported", func(t *testing.T) {
+		data, err := json.Marshal(&scanStatus{ChannelID: "channel1", State: scanStateRunning, Queued: 42})
+		require.NoError(t, err)
+		api := &plugintest.API{}
+		api.On("KVGet", scanStatusKey).Return(data, nil)
+
+		w := request(&Plugin{}, api, http.MethodGet, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var status scanStatus
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&status))
+		assert.Equal(t, 42, status.Queued)
+		assert.Equal(t, scanStateRunning, status.State)
+	})
+
+	t.Run("Canceling without a running scan is not found", func(t *testing.T) {
+		w := request(&Plugin{}, &plugintest.API{}, http.MethodDelete, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// noOffHoursThreshold disables moderation outside the scheduled windows
+const noOffHoursThreshold = -1
+
+// timeWindow is a daily window between two times of day, in minutes after
+// midnight. A window whose end is before its start crosses midnight.
+type timeWindow struct {
+	start int
+	end   int
+}
+
+// contains reports whether the minute of the day falls inside the window,
+// including its start and excluding its end
+func (w timeWindow) contains(minute int) bool {
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// moderationSchedule limits full moderation to daily time windows in a time
+// zone. Outside the windows posts are either not moderated or checked against
+// the off-hours threshold.
+type moderationSchedule struct {
+	windows  []timeWindow
+	location *time.Location
+
+	// offHoursThreshold replaces the global threshold outside the windows,
+	// or is noOffHoursThreshold to skip moderation outside the windows
+	offHoursThreshold int
+
+	// now returns the current time and is replaced in tests
+	now func() time.Time
+}
+
+// newModerationSchedule parses comma-separated windows such as
+// "09:00-17:00,22:00-06:00" in the named time zone, which defaults to UTC.
+// No windows means moderation always applies, and a nil schedule is returned.
+func newModerationSchedule(windows, timezone string, offHoursThreshold int) (*moderationSchedule, error) {
+	entries := splitList(windows)
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	location := time.UTC
+	if timezone = strings.TrimSpace(timezone); timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, errors.Wrapf(err, "unknown time zone '%s'", timezone)
+		}
+	}
+
+	schedule := &moderationSchedule{
+		location:          location,
+		offHoursThreshold: offHoursThreshold,
+		now:               time.Now,
+	}
+	for _, entry := range entries {
+		window, err := parseTimeWindow(entry)
+		if err != nil {
+			return nil, err
+		}
+		schedule.windows = append(schedule.windows, window)
+	}
+	return schedule, nil
+}
+
+func parseTimeWindow(entry string) (timeWindow, error) {
+	start, end, found := strings.Cut(entry, "-")
+	if !found {
+		return timeWindow{}, errors.Errorf("time window '%s' must have the form HH:MM-HH:MM", entry)
+	}
+
+	startMinute, err := parseTimeOfDay(start)
+	if err != nil {
+		return timeWindow{}, errors.Wrapf(err, "invalid start of time window '%s'", entry)
+	}
+	endMinute, err := parseTimeOfDay(end)
+	if err != nil {
+		return timeWindow{}, errors.Wrapf(err, "invalid end of time window '%s'", entry)
+	}
+	if startMinute == endMinute {
+		return timeWindow{}, errors.Errorf("time window '%s' is empty", entry)
+	}
+
+	return timeWindow{start: startMinute, end: endMinute}, nil
+}
+
+// parseTimeOfDay parses HH:MM into minutes after midnight. 24:00 is accepted
+// as the end of the day.
+func parseTimeOfDay(value string) (int, error) {
+	hours, minutes, found := strings.Cut(strings.TrimSpace(value), ":")
+	if !found {
+		return 0, errors.Errorf("'%s' must have the form HH:MM", value)
+	}
+
+	h, err := strconv.Atoi(hours)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not parse hours of '%s'", value)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not parse minutes of '%s'", value)
+	}
+
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, errors.Errorf("'%s' is not a valid time of day", value)
+	}
+	return h*60 + m, nil
+}
+
+// activeAt reports whether the time falls inside one of the windows, in the
+// schedule's time zone
+func (s *moderationSchedule) activeAt(t time.Time) bool {
+	local := t.In(s.location)
+	minute := local.Hour()*60 + local.Minute()
+	for _, window := range s.windows {
+		if window.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
+
+// moderating reports whether posts are currently moderated at all
+func (s *moderationSchedule) moderating() bool {
+	return s.offHoursThreshold != noOffHoursThreshold || s.activeAt(s.now())
+}
+
+// threshold returns the threshold currently in effect, given the threshold
+// used inside the windows
+func (s *moderationSchedule) threshold(activeThreshold int) int {
+	if s.offHoursThreshold == noOffHoursThreshold || s.activeAt(s.now()) {
+		return activeThreshold
+	}
+	return s.offHoursThreshold
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewModerationSchedule(t *testing.T) {
+	t.Run("No windows", func(t *testing.T) {
+		schedule, err := newModerationSchedule(" ", "America/New_York", noOffHoursThreshold)
+		assert.NoError(t, err)
+		assert.Nil(t, schedule)
+	})
+
+	t.Run("Valid windows", func(t *testing.T) {
+		schedule, err := newModerationSchedule("09:00-17:30, 22:00-06:00,18:00-24:00", "Europe/Berlin", 6)
+		require.NoError(t, err)
+		assert.Equal(t, []timeWindow{{540, 1050}, {1320, 360}, {1080, 1440}}, schedule.windows)
+		assert.Equal(t, "Europe/Berlin", schedule.location.String())
+		assert.Equal(t, 6, schedule.offHoursThreshold)
+	})
+
+	t.Run("Defaults to UTC", func(t *testing.T) {
+		schedule, err := newModerationSchedule("09:00-17:00", "", noOffHoursThreshold)
+		require.NoError(t, err)
+		assert.Equal(t, time.UTC, schedule.location)
+	})
+
+	for _, tc := range []struct{ windows, timezone string }{
+		{"09:00", ""},
+		{"9-17", ""},
+		{"09:00-25:00", ""},
+		{"09:60-17:00", ""},
+		{"24:30-06:00", ""},
+		{"09:00-09:00", ""},
+		{"09:00-17:00", "Mars/Olympus_Mons"},
+	} {
+		t.Run("Invalid "+tc.windows+" "+tc.timezone, func(t *testing.T) {
+			_, err := newModerationSchedule(tc.windows, tc.timezone, noOffHoursThreshold)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestModerationScheduleActiveAt(t *testing.T) {
+	schedule, err := newModerationSchedule("09:00-17:00,22:00-06:00", "America/New_York", noOffHoursThreshold)
+	require.NoError(t, err)
+
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2025, 3, 12, hour, minute, 0, 0, newYork)
+	}
+
+	assert.False(t, schedule.activeAt(at(8, 59)))
+	assert.True(t, schedule.activeAt(at(9, 0)))
+	assert.True(t, schedule.activeAt(at(16, 59)))
+	assert.False(t, schedule.activeAt(at(17, 0)))
+
+	// The overnight window crosses midnight
+	assert.False(t, schedule.activeAt(at(21, 59)))
+	assert.True(t, schedule.activeAt(at(23, 30)))
+	assert.True(t, schedule.activeAt(at(0, 0)))
+	assert.True(t, schedule.activeAt(at(5, 59)))
+	assert.False(t, schedule.activeAt(at(6, 0)))
+
+	// Times are converted to the schedule's time zone
+	assert.True(t, schedule.activeAt(time.Date(2025, 3, 12, 14, 0, 0, 0, time.UTC)))
+	assert.False(t, schedule.activeAt(time.Date(2025, 3, 12, 11, 0, 0, 0, time.UTC)))
+}
+
+func TestPolicySchedule(t *testing.T) {
+	businessHours := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	night := time.Date(2025, 3, 12, 20, 0, 0, 0, time.UTC)
+
+	newPolicy := func(t *testing.T, offHoursThreshold int, now time.Time) *moderationPolicy {
+		schedule, err := newModerationSchedule("09:00-17:00", "UTC", offHoursThreshold)
+		require.NoError(t, err)
+		schedule.now = func() time.Time { return now }
+		return newModerationPolicy(4, nil, map[string]int{"strict": 2}, nil, schedule)
+	}
+
+	t.Run("No schedule always moderates", func(t *testing.T) {
+		policy := newModerationPolicy(4, nil, nil, nil, nil)
+		assert.True(t, policy.moderating())
+		assert.Equal(t, 4, policy.channelThreshold(nil, "channel1"))
+	})
+
+	t.Run("Inside the schedule", func(t *testing.T) {
+		policy := newPolicy(t, 6, businessHours)
+		assert.True(t, policy.moderating())
+		assert.Equal(t, 4, policy.channelThreshold(nil, "channel1"))
+	})
+
+	t.Run("Outside the schedule without an off-hours threshold", func(t *testing.T) {
+		policy := newPolicy(t, noOffHoursThreshold, night)
+		assert.False(t, policy.moderating())
+	})
+
+	t.Run("Outside the schedule with an off-hours threshold", func(t *testing.T) {
+		policy := newPolicy(t, 6, night)
+		assert.True(t, policy.moderating())
+		assert.Equal(t, 6, policy.channelThreshold(nil, "channel1"))
+		assert.Equal(t, 2, policy.channelThreshold(nil, "strict"))
+	})
+}
+
+func TestModeratePostOutsideSchedule(t *testing.T) {
+	schedule, err := newModerationSchedule("09:00-17:00", "UTC", noOffHoursThreshold)
+	require.NoError(t, err)
+	schedule.now = func() time.Time { return time.Date(2025, 3, 12, 20, 0, 0, 0, time.UTC) }
+
+	mockModerator := &MockModerator{}
+	processor := &PostProcessor{
+		moderator:        mockModerator,
+		policy:           newModerationPolicy(4, nil, nil, nil, schedule),
+		excludedUsers:    map[string]struct{}{},
+		excludedChannels: map[string]struct{}{},
+	}
+
+	err = processor.moderatePost(&plugintest.API{}, &model.Post{UserId: "user1", ChannelId: "channel1", Message: "Test message"})
+	assert.NoError(t, err)
+	mockModerator.AssertNotCalled(t, "ModerateText")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+)
+
+// shortMessageSettings controls the moderation of very short messages, such
+// as "ok" or "lol". They rarely hold anything a provider would flag, so
+// sending them wastes quota, and providers can score very short strings
+// erratically. Short messages are only checked against the local blocklist.
+// All methods are safe to call on nil settings, which treat no message as
+// short.
+type shortMessageSettings struct {
+	// minCharacters and minWords are the lengths below which a message is
+	// short. Either is disabled when not positive.
+	minCharacters int
+	minWords      int
+
+	// blocklist moderates short messages, if set
+	blocklist moderation.Moderator
+}
+
+// newShortMessageSettings returns the short message settings, or nil when
+// neither minimum is set
+func newShortMessageSettings(minCharacters, minWords int, blocklist moderation.Moderator) *shortMessageSettings {
+	if minCharacters <= 0 && minWords <= 0 {
+		return nil
+	}
+
+	return &shortMessageSettings{
+		minCharacters: minCharacters,
+		minWords:      minWords,
+		blocklist:     blocklist,
+	}
+}
+
+// isShort reports whether the text is below either minimum. Empty text is
+// not short, since it is not moderated at all.
+func (s *shortMessageSettings) isShort(text string) bool {
+	if s == nil {
+		return false
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return false
+	}
+
+	if s.minCharacters > 0 && utf8.RuneCountInString(text) < s.minCharacters {
+		return true
+	}
+	return s.minWords > 0 && len(strings.Fields(text)) < s.minWords
+}
+
+// skipped reports whether short messages are not moderated at all, because
+// no blocklist is configured
+func (s *shortMessageSettings) skipped() bool {
+	return s == nil || s.blocklist == nil
+}
+
+// providers returns the moderator types that check short messages
+func (s *shortMessageSettings) providers() []string {
+	if s.skipped() {
+		return nil
+	}
+	return []string{"blocklist"}
+}
+
+// moderate checks a short message against the blocklist
+func (s *shortMessageSettings) moderate(ctx context.Context, text string) (moderation.Result, error) {
+	if s.skipped() {
+		return moderation.Result{}, nil
+	}
+	return s.blocklist.ModerateText(ctx, text)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation/blocklist"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShortMessageSettingsIsShort(t *testing.T) {
+	assert.Nil(t, newShortMessageSettings(0, 0, nil))
+
+	tests := []struct {
+		name          string
+		minCharacters int
+		minWords      int
+		text          string
+		expected      bool
+	}{
+		{name: "Below minimum characters", minCharacters: 4, text: "lol", expected: true},
+		{name: "At minimum characters", minCharacters: 4, text: "lols", expected: false},
+		{name: "Surrounding whitespace is not counted", minCharacters: 4, text: "  lol \n", expected: true},
+		{name: "Characters are counted, not bytes", minCharacters: 4, text: "héé", expected: true},
+		{name: "Below minimum words", minWords: 3, text: "ok thanks", expected: true},
+		{name: "At minimum words", minWords: 3, text: "ok thanks everyone", expected: false},
+		{name: "Either minimum makes a message short", minCharacters: 4, minWords: 3, text: "sounds good", expected: true},
+		{name: "Empty text is not short", minCharacters: 4, text: "   ", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			settings := newShortMessageSettings(tt.minCharacters, tt.minWords, nil)
+			assert.Equal(t, tt.expected, settings.isShort(tt.text))
+		})
+	}
+}
+
+func TestModerateShortMessages(t *testing.T) {
+	newBlocklist := func(t *testing.T) moderation.Moderator {
+		mod, err := blocklist.New(&blocklist.Config{Terms: []blocklist.Term{{Text: "slur", Severity: moderation.MaxSeverity}}, WholeWord: true})
+		require.NoError(t, err)
+		return mod
+	}
+
+	newProcessor := func(blocklist moderation.Moderator) (*PostProcessor, *MockModerator) {
+		moderator := &MockModerator{}
+		moderator.On("ModerateText", mock.Anything, mock.Anything).Return(moderation.Result{"hate": 0}, nil)
+
+		return &PostProcessor{
+			moderator:     moderator,
+			excludedUsers: map[string]struct{}{},
+			policy:        &moderationPolicy{thresholdValue: 4},
+			shortMessages: newShortMessageSettings(6, 0, blocklist),
+		}, moderator
+	}
+
+	moderate := func(processor *PostProcessor, api *plugintest.API, message string) error {
+		return processor.moderatePost(api, &model.Post{UserId: "user1", ChannelId: "channel1", Message: message})
+	}
+
+	t.Run("Short messages are skipped without a blocklist", func(t *testing.T) {
+		processor, moderator := newProcessor(nil)
+
+		assert.NoError(t, moderate(processor, &plugintest.API{}, "hello"))
+		moderator.AssertNotCalled(t, "ModerateText", mock.Anything, mock.Anything)
+
+		assert.NoError(t, moderate(processor, &plugintest.API{}, "hello!"))
+		moderator.AssertCalled(t, "ModerateText", mock.Anything, "hello!")
+	})
+
+	t.Run("Blocklist still catches short messages", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("LogInfo", "Content was flagged by moderation", "post_id", "", "severity_threshold", 4,
+			"computed_severity_"+blocklist.CategoryBlocklist, moderation.MaxSeverity, "severity_breakdown", mock.Anything,
+			"providers", "blocklist", "blocklist_match", true).Return()
+
+		processor, moderator := newProcessor(newBlocklist(t))
+
+		err := moderate(processor, api, "slur")
+		assert.True(t, errors.Is(err, ErrModerationRejection))
+
+		assert.NoError(t, moderate(processor, api, "ok"))
+		moderator.AssertNotCalled(t, "ModerateText", mock.Anything, mock.Anything)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Attachments of short messages are still moderated", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "report.pdf"}, nil)
+
+		processor, moderator := newProcessor(nil)
+		processor.moderateFilenames = true
+
+		err := processor.moderatePost(api, &model.Post{UserId: "user1", ChannelId: "channel1", Message: "lol", FileIds: []string{"file1"}})
+		assert.NoError(t, err)
+		moderator.AssertCalled(t, "ModerateText", mock.Anything, "report.pdf")
+		moderator.AssertNotCalled(t, "ModerateText", mock.Anything, "lol")
+	})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/store/sqlstore"
+	"github.com/mattermost/mattermost/server/public/model"
+)
+
+// defaultStatsRange is the period the statistics cover when the request does
+// not set where it starts
+const defaultStatsRange = 7 * 24 * time.Hour
+
+// moderationStats aggregates the moderation activity over a time range
+type moderationStats struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+
+	// Moderated and FlagRate come from the audit records, so they are only
+	// reported while every moderated post is audited
+	Moderated *int     `json:"moderated,omitempty"`
+	FlagRate  *float64 `json:"flag_rate,omitempty"`
+
+	// Flagged counts the flagged posts, Categories counts them by flagged
+	// category and Channels by channel ID
+	Flagged    int            `json:"flagged"`
+	Categories map[string]int `json:"categories"`
+	Channels   map[string]int `json:"channels"`
+}
+
+// addEventCounts adds the counted moderation events to the statistics. Each
+// event counts once for each canonical category it was flagged for, so that
+// events recorded under provider category names are counted with the rest.
+func (s *moderationStats) addEventCounts(counts []*sqlstore.ModerationEventCount) {
+	for _, count := range counts {
+		s.Flagged += count.Count
+		s.Channels[count.ChannelID] += count.Count
+
+		categories := make(map[string]struct{}, len(count.Categories))
+		for category := range count.Categories {
+			categories[canonicalCategory(category)] = struct{}{}
+		}
+		for category := range categories {
+			s.Categories[category] += count.Count
+		}
+	}
+}
+
+// addDecisionCounts sets the number of moderated posts and the share of them
+// that was flagged from the counted audit decisions
+func (s *moderationStats) addDecisionCounts(decisions map[string]int) {
+	moderated := decisions[auditDecisionAllowed] + decisions[auditDecisionFlagged]
+	flagRate := 0.0
+	if moderated > 0 {
+		flagRate = float64(decisions[auditDecisionFlagged]) / float64(moderated)
+	}
+	s.Moderated = &moderated
+	s.FlagRate = &flagRate
+}
+
+// getModerationStats handles the moderation statistics API endpoint. The from
+// and to query parameters are timestamps in milliseconds bounding the range,
+// which defaults to the last seven days.
+func (p *Plugin) getModerationStats(w http.ResponseWriter, r *http.Request) {
+	if p.eventStore == nil {
+		http.Error(w, "moderation events are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	query := r.URL.Query()
+
+	to := model.GetMillis()
+	if value := query.Get("to"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "to must be a timestamp in milliseconds", http.StatusBadRequest)
+			return
+		}
+		to = parsed
+	}
+
+	from := to - defaultStatsRange.Milliseconds()
+	if value := query.Get("from"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "from must be a timestamp in milliseconds", http.StatusBadRequest)
+			return
+		}
+		from = parsed
+	}
+	if from >= to {
+		http.Error(w, "from must be before to", http.StatusBadRequest)
+		return
+	}
+
+	stats := moderationStats{
+		From:       from,
+		To:         to,
+		Categories: make(map[string]int),
+		Channels:   make(map[string]int),
+	}
+
+	counts, err := p.eventStore.GetModerationEventCounts(from, to)
+	if err != nil {
+		http.Error(w, "failed to get moderation statistics", http.StatusInternalServerError)
+		p.API.LogError("failed to count moderation events", "error", err.Error())
+		return
+	}
+	stats.addEventCounts(counts)
+
+	if processor := p.getProcessor(); p.auditStore != nil && processor != nil && processor.audit != nil && processor.audit.level == auditLevelAll {
+		decisions, err := p.auditStore.GetAuditDecisionCounts(from, to)
+		if err != nil {
+			http.Error(w, "failed to get moderation statistics", http.StatusInternalServerError)
+			p.API.LogError("failed to count audit records", "error", err.Error())
+			return
+		}
+		stats.addDecisionCounts(decisions)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/store/sqlstore"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetModerationStats(t *testing.T) {
+	request := func(p *Plugin, url string) *httptest.ResponseRecorder {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("LogError", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+		p.SetAPI(api)
+
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		r.Header.Set("Mattermost-User-ID", "admin")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+		return w
+	}
+
+	decode := func(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var stats map[string]any
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&stats))
+		return stats
+	}
+
+	events := &fakeEventStore{events: []*sqlstore.ModerationEvent{
+		{ChannelID: "channel1", Categories: map[string]int{"hate": 4}, CreateAt: 1000},
+		{ChannelID: "channel1", Categories: map[string]int{"hate": 4}, CreateAt: 1500},
+		{ChannelID: "channel1", Categories: map[string]int{"hate": 5, "violence": 4}, CreateAt: 1999},
+		{ChannelID: "channel2", Categories: map[string]int{"Hate": 6}, CreateAt: 1200},
+		{ChannelID: "channel2", Categories: map[string]int{"blocklist": 6}, CreateAt: 2000},
+		{ChannelID: "channel3", Categories: map[string]int{"sexual": 4}, CreateAt: 999},
+	}}
+	audit := &fakeAuditStore{records: []*sqlstore.AuditRecord{
+		{Decision: auditDecisionFlagged, CreateAt: 1000},
+		{Decision: auditDecisionFlagged, CreateAt: 1500},
+		{Decision: auditDecisionAllowed, CreateAt: 1600},
+		{Decision: auditDecisionAllowed, CreateAt: 1700},
+		{Decision: auditDecisionAllowed, CreateAt: 3000},
+	}}
+	auditAll := &PostProcessor{audit: &auditSettings{level: auditLevelAll}}
+
+	t.Run("Aggregates the events in the range", func(t *testing.T) {
+		p := &Plugin{eventStore: events, auditStore: audit, processor: auditAll}
+
+		// Events recorded before categories were normalized count towards
+		// their canonical category
+		assert.Equal(t, map[string]any{
+			"from":       float64(1000),
+			"to":         float64(2000),
+			"moderated":  float64(4),
+			"flag_rate":  0.5,
+			"flagged":    float64(4),
+			"categories": map[string]any{"hate": float64(4), "violence": float64(1)},
+			"channels":   map[string]any{"channel1": float64(3), "channel2": float64(1)},
+		}, decode(t, request(p, "/api/v1/stats?from=1000&to=2000")))
+	})
+
+	t.Run("Empty range", func(t *testing.T) {
+		p := &Plugin{eventStore: events, auditStore: audit, processor: auditAll}
+
+		assert.Equal(t, map[string]any{
+			"from":       float64(5000),
+			"to":         float64(6000),
+			"moderated":  float64(0),
+			"flag_rate":  float64(0),
+			"flagged":    float64(0),
+			"categories": map[string]any{},
+			"channels":   map[string]any{},
+		}, decode(t, request(p, "/api/v1/stats?from=5000&to=6000")))
+	})
+
+	t.Run("Moderated posts need every post audited", func(t *testing.T) {
+		p := &Plugin{eventStore: events, auditStore: audit, processor: &PostProcessor{audit: &auditSettings{level: auditLevelFlagged}}}
+
+		stats := decode(t, request(p, "/api/v1/stats?from=1000&to=2000"))
+		assert.Equal(t, float64(4), stats["flagged"])
+		assert.NotContains(t, stats, "moderated")
+		assert.NotContains(t, stats, "flag_rate")
+	})
+
+	t.Run("Defaults to the last seven days", func(t *testing.T) {
+		p := &Plugin{eventStore: events}
+
+		to := strconv.FormatInt(defaultStatsRange.Milliseconds()+1500, 10)
+		stats := decode(t, request(p, "/api/v1/stats?to="+to))
+		assert.Equal(t, float64(1500), stats["from"])
+		assert.Equal(t, float64(3), stats["flagged"])
+	})
+
+	t.Run("Invalid range", func(t *testing.T) {
+		p := &Plugin{eventStore: events}
+
+		assert.Equal(t, http.StatusBadRequest, request(p, "/api/v1/stats?from=2000&to=1000").Code)
+		assert.Equal(t, http.StatusBadRequest, request(p, "/api/v1/stats?from=2000&to=2000").Code)
+		assert.Equal(t, http.StatusBadRequest, request(p, "/api/v1/stats?from=yesterday").Code)
+		assert.Equal(t, http.StatusBadRequest, request(p, "/api/v1/stats?to=-1").Code)
+	})
+
+	t.Run("No event store", func(t *testing.T) {
+		assert.Equal(t, http.StatusServiceUnavailable, request(&Plugin{}, "/api/v1/stats").Code)
+	})
+}
@@ -0,0 +1,85 @@
+package sqlstore
+
+import (
+	"encoding/json"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"github.com/mattermost/mattermost/server/public/model"
+
+	"github.com/pkg/errors"
+)
+
+const auditRecordsTable = "moderation_audit"
+
+// AuditRecord records a single moderation decision
+type AuditRecord struct {
+	ID        string
+	PostID    string
+	UserID    string
+	ChannelID string
+
+	// Result holds the severity reported for every category
+	Result    map[string]int
+	Threshold int
+	Decision  string
+
+	// Message is the moderated text, or empty when it is redacted
+	Message  string
+	CreateAt int64
+}
+
+// InsertAuditRecord stores a moderation decision, assigning it an ID and
+// creation time when they are not set
+func (ss SQLStore) InsertAuditRecord(record *AuditRecord) error {
+	if record.ID == "" {
+		record.ID = model.NewId()
+	}
+	if record.CreateAt == 0 {
+		record.CreateAt = model.GetMillis()
+	}
+
+	result, err := json.Marshal(record.Result)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode audit record result")
+	}
+
+	if _, err := ss.masterBuilder.
+		Insert(auditRecordsTable).
+		Columns("id", "post_id", "user_id", "channel_id", "result", "threshold", "decision", "message", "create_at").
+		Values(record.ID, record.PostID, record.UserID, record.ChannelID, string(result), record.Threshold, record.Decision, record.Message, record.CreateAt).
+		Exec(); err != nil {
+		return errors.Wrap(err, "failed to insert audit record")
+	}
+	return nil
+}
+
+// GetAuditDecisionCounts counts the audit records created from from up to,
+// but not including, to, both timestamps in milliseconds, keyed by decision
+func (ss SQLStore) GetAuditDecisionCounts(from, to int64) (map[string]int, error) {
+	query := ss.replicaBuilder.
+		Select("decision", "COUNT(*) AS count").
+		From(auditRecordsTable).
+		Where(sq.GtOrEq{"create_at": from}).
+		Where(sq.Lt{"create_at": to}).
+		GroupBy("decision")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build SQL query for audit decision counts")
+	}
+
+	var rows []struct {
+		Decision string `db:"decision"`
+		Count    int    `db:"count"`
+	}
+	if err := ss.replica.Select(&rows, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to count audit records")
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Decision] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,71 @@
+package sqlstore
+
+import (
+	"fmt"
+
+	"github.com/mattermost/mattermost/server/public/model"
+
+	"github.com/pkg/errors"
+)
+
+// table describes a plugin table and the column it is indexed by
+type table struct {
+	name        string
+	columns     string
+	indexColumn string
+}
+
+var tables = []table{
+	{
+		name: moderationEventsTable,
+		columns: `
+			id VARCHAR(26) PRIMARY KEY,
+			post_id VARCHAR(26) NOT NULL,
+			user_id VARCHAR(26) NOT NULL,
+			channel_id VARCHAR(26) NOT NULL,
+			categories TEXT NOT NULL,
+			action VARCHAR(32) NOT NULL,
+			create_at BIGINT NOT NULL`,
+		indexColumn: "create_at",
+	},
+	{
+		name: auditRecordsTable,
+		columns: `
+			id VARCHAR(26) PRIMARY KEY,
+			post_id VARCHAR(26) NOT NULL,
+			user_id VARCHAR(26) NOT NULL,
+			channel_id VARCHAR(26) NOT NULL,
+			result TEXT NOT NULL,
+			threshold INTEGER NOT NULL,
+			decision VARCHAR(32) NOT NULL,
+			message TEXT NOT NULL,
+			create_at BIGINT NOT NULL`,
+		indexColumn: "create_at",
+	},
+}
+
+// Migrate creates the tables used by the plugin when they do not exist
+func (ss SQLStore) Migrate() error {
+	for _, t := range tables {
+		index := fmt.Sprintf("idx_%s_%s", t.name, t.indexColumn)
+
+		// MySQL has no CREATE INDEX IF NOT EXISTS, so there the index is
+		// declared along with the table
+		statements := []string{}
+		if ss.src.DriverName() == model.DatabaseDriverMysql {
+			statements = append(statements, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s,\n\t\t\tINDEX %s (%s)\n\t\t)", t.name, t.columns, index, t.indexColumn))
+		} else {
+			statements = append(statements,
+				fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s\n\t\t)", t.name, t.columns),
+				fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", index, t.name, t.indexColumn),
+			)
+		}
+
+		for _, statement := range statements {
+			if _, err := ss.master.Exec(statement); err != nil {
+				return errors.Wrapf(err, "failed to create %s table", t.name)
+			}
+		}
+	}
+	return nil
+}
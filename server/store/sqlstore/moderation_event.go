@@ -0,0 +1,150 @@
+package sqlstore
+
+import (
+	"encoding/json"
+
+	sq "github.com/Masterminds/squirrel"
+
+	"github.com/mattermost/mattermost/server/public/model"
+
+	"github.com/pkg/errors"
+)
+
+const moderationEventsTable = "moderation_events"
+
+// ModerationEvent records a post that content moderation flagged and the
+// action taken on it
+type ModerationEvent struct {
+	ID         string         `json:"id"`
+	PostID     string         `json:"post_id"`
+	UserID     string         `json:"user_id"`
+	ChannelID  string         `json:"channel_id"`
+	Categories map[string]int `json:"categories"`
+	Action     string         `json:"action"`
+	CreateAt   int64          `json:"create_at"`
+}
+
+// moderationEventRow is a ModerationEvent as stored in the database, with the
+// categories and their severities encoded as JSON
+type moderationEventRow struct {
+	ID         string `db:"id"`
+	PostID     string `db:"post_id"`
+	UserID     string `db:"user_id"`
+	ChannelID  string `db:"channel_id"`
+	Categories string `db:"categories"`
+	Action     string `db:"action"`
+	CreateAt   int64  `db:"create_at"`
+}
+
+// InsertModerationEvent stores a moderation event, assigning it an ID and
+// creation time when they are not set
+func (ss SQLStore) InsertModerationEvent(event *ModerationEvent) error {
+	if event.ID == "" {
+		event.ID = model.NewId()
+	}
+	if event.CreateAt == 0 {
+		event.CreateAt = model.GetMillis()
+	}
+
+	categories, err := json.Marshal(event.Categories)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode moderation event categories")
+	}
+
+	if _, err := ss.masterBuilder.
+		Insert(moderationEventsTable).
+		Columns("id", "post_id", "user_id", "channel_id", "categories", "action", "create_at").
+		Values(event.ID, event.PostID, event.UserID, event.ChannelID, string(categories), event.Action, event.CreateAt).
+		Exec(); err != nil {
+		return errors.Wrap(err, "failed to insert moderation event")
+	}
+	return nil
+}
+
+// GetModerationEvents returns up to limit moderation events created after
+// since and, when before is set, before it, both timestamps in milliseconds.
+// The most recent events come first, so passing the creation time of the
+// oldest event returned as before pages back through older events.
+func (ss SQLStore) GetModerationEvents(since, before int64, limit int) ([]*ModerationEvent, error) {
+	query := ss.replicaBuilder.
+		Select("id", "post_id", "user_id", "channel_id", "categories", "action", "create_at").
+		From(moderationEventsTable).
+		Where(sq.Gt{"create_at": since}).
+		OrderBy("create_at DESC", "id").
+		Limit(uint64(limit))
+	if before > 0 {
+		query = query.Where(sq.Lt{"create_at": before})
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build SQL query for moderation events")
+	}
+
+	var rows []moderationEventRow
+	if err := ss.replica.Select(&rows, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to get moderation events")
+	}
+
+	events := make([]*ModerationEvent, 0, len(rows))
+	for _, row := range rows {
+		event := &ModerationEvent{
+			ID:        row.ID,
+			PostID:    row.PostID,
+			UserID:    row.UserID,
+			ChannelID: row.ChannelID,
+			Action:    row.Action,
+			CreateAt:  row.CreateAt,
+		}
+		if err := json.Unmarshal([]byte(row.Categories), &event.Categories); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode categories of moderation event %s", event.ID)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// ModerationEventCount is the number of moderation events in a time range
+// with the same channel and flagged categories
+type ModerationEventCount struct {
+	ChannelID  string
+	Categories map[string]int
+	Count      int
+}
+
+// GetModerationEventCounts counts the moderation events created from from up
+// to, but not including, to, both timestamps in milliseconds. Events are
+// grouped by channel and categories, so that the database only returns one
+// row per combination and the range is read through the create_at index.
+func (ss SQLStore) GetModerationEventCounts(from, to int64) ([]*ModerationEventCount, error) {
+	query := ss.replicaBuilder.
+		Select("channel_id", "categories", "COUNT(*) AS count").
+		From(moderationEventsTable).
+		Where(sq.GtOrEq{"create_at": from}).
+		Where(sq.Lt{"create_at": to}).
+		GroupBy("channel_id", "categories")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build SQL query for moderation event counts")
+	}
+
+	var rows []struct {
+		ChannelID  string `db:"channel_id"`
+		Categories string `db:"categories"`
+		Count      int    `db:"count"`
+	}
+	if err := ss.replica.Select(&rows, sql, args...); err != nil {
+		return nil, errors.Wrap(err, "failed to count moderation events")
+	}
+
+	counts := make([]*ModerationEventCount, 0, len(rows))
+	for _, row := range rows {
+		count := &ModerationEventCount{ChannelID: row.ChannelID, Count: row.Count}
+		if err := json.Unmarshal([]byte(row.Categories), &count.Categories); err != nil {
+			return nil, errors.Wrap(err, "failed to decode categories of moderation events")
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
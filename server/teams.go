@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+const (
+	teamModerationEnabled  = "enabled"
+	teamModerationDisabled = "disabled"
+)
+
+// teamSettings enables or disables moderation per team. Teams without an
+// override, and channels outside any team such as direct messages, follow
+// the global setting.
+type teamSettings struct {
+	defaultEnabled bool
+	overrides      map[string]bool
+
+	// channelTeams caches the team of each channel looked up, since a
+	// channel never moves between teams
+	channelTeams sync.Map
+}
+
+func newTeamSettings(defaultEnabled bool, overrides map[string]bool) *teamSettings {
+	return &teamSettings{
+		defaultEnabled: defaultEnabled,
+		overrides:      overrides,
+	}
+}
+
+// anyEnabled reports whether moderation is enabled globally or for any team
+func (t *teamSettings) anyEnabled() bool {
+	if t.defaultEnabled {
+		return true
+	}
+	for _, enabled := range t.overrides {
+		if enabled {
+			return true
+		}
+	}
+	return false
+}
+
+// enabledForChannel reports whether moderation is enabled for the team of
+// the channel. The channel is only looked up when there are team overrides.
+func (t *teamSettings) enabledForChannel(api plugin.API, channelID string) bool {
+	if len(t.overrides) == 0 {
+		return t.defaultEnabled
+	}
+
+	teamID, ok := t.channelTeam(api, channelID)
+	if !ok {
+		return t.defaultEnabled
+	}
+
+	if enabled, ok := t.overrides[teamID]; ok {
+		return enabled
+	}
+	return t.defaultEnabled
+}
+
+// channelTeam returns the team of the channel, caching successful lookups
+func (t *teamSettings) channelTeam(api plugin.API, channelID string) (string, bool) {
+	if teamID, ok := t.channelTeams.Load(channelID); ok {
+		return teamID.(string), true
+	}
+
+	channel, appErr := api.GetChannel(channelID)
+	if appErr != nil {
+		api.LogWarn("Failed to get channel to resolve its team for content moderation", "channel_id", channelID, "err", appErr)
+		return "", false
+	}
+
+	t.channelTeams.Store(channelID, channel.TeamId)
+	return channel.TeamId, true
+}
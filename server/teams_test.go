@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestTeamSettingsAnyEnabled(t *testing.T) {
+	assert.True(t, newTeamSettings(true, nil).anyEnabled())
+	assert.False(t, newTeamSettings(false, nil).anyEnabled())
+	assert.False(t, newTeamSettings(false, map[string]bool{"team1": false}).anyEnabled())
+	assert.True(t, newTeamSettings(false, map[string]bool{"team1": false, "team2": true}).anyEnabled())
+}
+
+func TestTeamSettingsEnabledForChannel(t *testing.T) {
+	t.Run("No overrides does not look up the channel", func(t *testing.T) {
+		api := &plugintest.API{}
+		defer api.AssertExpectations(t)
+
+		assert.True(t, newTeamSettings(true, nil).enabledForChannel(api, "channel1"))
+		assert.False(t, newTeamSettings(false, nil).enabledForChannel(api, "channel1"))
+	})
+
+	t.Run("Team overrides win over the global setting", func(t *testing.T) {
+		api := &plugintest.API{}
+		defer api.AssertExpectations(t)
+		api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1"}, nil)
+		api.On("GetChannel", "channel2").Return(&model.Channel{Id: "channel2", TeamId: "team2"}, nil)
+		api.On("GetChannel", "channel3").Return(&model.Channel{Id: "channel3", TeamId: "team3"}, nil)
+
+		teams := newTeamSettings(true, map[string]bool{"team1": false, "team2": true})
+		assert.False(t, teams.enabledForChannel(api, "channel1"))
+		assert.True(t, teams.enabledForChannel(api, "channel2"))
+		assert.True(t, teams.enabledForChannel(api, "channel3"))
+
+		teams = newTeamSettings(false, map[string]bool{"team2": true})
+		assert.False(t, teams.enabledForChannel(api, "channel1"))
+		assert.True(t, teams.enabledForChannel(api, "channel2"))
+	})
+
+	t.Run("Direct messages follow the global setting", func(t *testing.T) {
+		api := &plugintest.API{}
+		defer api.AssertExpectations(t)
+		api.On("GetChannel", "dm").Return(&model.Channel{Id: "dm", Type: model.ChannelTypeDirect}, nil)
+
+		teams := newTeamSettings(false, map[string]bool{"team1": true})
+		assert.False(t, teams.enabledForChannel(api, "dm"))
+	})
+
+	t.Run("Channel teams are cached", func(t *testing.T) {
+		api := &plugintest.API{}
+		defer api.AssertExpectations(t)
+		api.On("GetChannel", "channel1").Return(&model.Channel{Id: "channel1", TeamId: "team1"}, nil).Once()
+
+		teams := newTeamSettings(true, map[string]bool{"team1": false})
+		assert.False(t, teams.enabledForChannel(api, "channel1"))
+		assert.False(t, teams.enabledForChannel(api, "channel1"))
+	})
+
+	t.Run("Lookup failure falls back to the global setting", func(t *testing.T) {
+		api := &plugintest.API{}
+		defer api.AssertExpectations(t)
+		api.On("GetChannel", "channel1").Return(nil, model.NewAppError("GetChannel", "not_found", nil, "", 404))
+		api.On("LogWarn", "Failed to get channel to resolve its team for content moderation", "channel_id", "channel1", "err", mock.Anything)
+
+		teams := newTeamSettings(true, map[string]bool{"team1": false})
+		assert.True(t, teams.enabledForChannel(api, "channel1"))
+	})
+}
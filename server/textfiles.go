@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+)
+
+// defaultMaxTextFileSizeKB is the largest text file downloaded for moderation
+// when no maximum is configured. Each chunk of a file is a separate, rate
+// limited request, and a file of this size needs only a few of them to fit
+// within the moderation timeout.
+const defaultMaxTextFileSizeKB = 32
+
+// textFileSettings controls the moderation of the contents of text files
+// attached to posts, such as .txt, .md or .csv uploads, which can hold the
+// same abuse as a message. Files with other extensions, files over the
+// maximum size and files that are not valid UTF-8 text are skipped.
+type textFileSettings struct {
+	// extensions holds the lowercase extensions of the files moderated,
+	// without the leading dot
+	extensions map[string]struct{}
+
+	// maxSize is the largest file downloaded, in bytes
+	maxSize int64
+}
+
+// newTextFileSettings returns the text file settings, or nil when no
+// extension is configured. A maximum size that is not positive uses the
+// default.
+func newTextFileSettings(extensions []string, maxSizeKB int) *textFileSettings {
+	set := make(map[string]struct{}, len(extensions))
+	for _, extension := range extensions {
+		if extension = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(extension), ".")); extension != "" {
+			set[extension] = struct{}{}
+		}
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	if maxSizeKB <= 0 {
+		maxSizeKB = defaultMaxTextFileSizeKB
+	}
+
+	return &textFileSettings{
+		extensions: set,
+		maxSize:    int64(maxSizeKB) * 1024,
+	}
+}
+
+// moderates reports whether files with the extension of the file are
+// moderated
+func (s *textFileSettings) moderates(info *model.FileInfo) bool {
+	if s == nil {
+		return false
+	}
+	_, ok := s.extensions[strings.ToLower(strings.TrimPrefix(info.Extension, "."))]
+	return ok
+}
+
+// isText reports whether the file contents look like text rather than binary
+// data saved under a text extension
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// moderateTextFiles moderates the contents of the text files attached to the
+// post, merging the severities into result. It reports whether a file was too
+// long to moderate and the post must be held for review, following the text
+// limit settings.
+func (p *PostProcessor) moderateTextFiles(ctx context.Context, api plugin.API, postID string, files []*model.FileInfo, result moderation.Result) (bool, error) {
+	held := false
+	for _, info := range files {
+		if !p.textFiles.moderates(info) {
+			continue
+		}
+
+		if info.Size > p.textFiles.maxSize {
+			api.LogDebug("Skipping moderation of text file exceeding the maximum size", append(p.policy.loggedIDs("post_id", postID), "file_id", info.Id, "size", info.Size)...)
+			continue
+		}
+
+		data, appErr := api.GetFile(info.Id)
+		if appErr != nil {
+			api.LogError("Failed to get text file for content moderation", append(p.policy.loggedIDs("post_id", postID), "file_id", info.Id, "err", appErr)...)
+			return false, ErrModerationUnavailable
+		}
+
+		if !isText(data) {
+			api.LogDebug("Skipping moderation of binary file with a text extension", append(p.policy.loggedIDs("post_id", postID), "file_id", info.Id)...)
+			continue
+		}
+
+		text := strings.TrimSpace(string(data))
+		if p.textLimit.exceeds(text) {
+			if !p.textLimit.truncates() {
+				held = true
+				continue
+			}
+			text = p.textLimit.truncate(text)
+		}
+		if text == "" {
+			continue
+		}
+
+		fileResult, err := p.moderateText(ctx, text)
+		if err != nil {
+			return false, moderationUnavailable(err)
+		}
+		result.Merge(fileResult)
+	}
+
+	return held, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTextFileSettings(t *testing.T) {
+	assert.Nil(t, newTextFileSettings(nil, 100))
+	assert.Nil(t, newTextFileSettings([]string{" ", "."}, 100))
+
+	settings := newTextFileSettings([]string{"txt", ".MD", " csv "}, 0)
+	require.NotNil(t, settings)
+	assert.Equal(t, int64(32*1024), settings.maxSize)
+	assert.True(t, settings.moderates(&model.FileInfo{Extension: "txt"}))
+	assert.True(t, settings.moderates(&model.FileInfo{Extension: "md"}))
+	assert.True(t, settings.moderates(&model.FileInfo{Extension: "CSV"}))
+	assert.False(t, settings.moderates(&model.FileInfo{Extension: "pdf"}))
+}
+
+func TestIsText(t *testing.T) {
+	assert.True(t, isText([]byte("name,comment\nalice,héllo\n")))
+	assert.False(t, isText([]byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}))
+	assert.False(t, isText([]byte("text\x00with a NUL byte")))
+}
+
+func TestModeratePostTextFiles(t *testing.T) {
+	newProcessor := func(moderator moderation.Moderator) *PostProcessor {
+		return &PostProcessor{
+			moderator: moderator,
+			policy:    newModerationPolicy(4, nil, nil, nil, nil),
+			textFiles: newTextFileSettings([]string{"txt", "md", "csv"}, 1),
+		}
+	}
+	newStub := func() *moderation.Stub {
+		return &moderation.Stub{
+			Results: map[string]moderation.Result{"you are all worthless": {"harassment": 6}},
+			Default: moderation.Result{"harassment": 0},
+		}
+	}
+	post := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Meeting notes attached", FileIds: []string{"file1"}}
+
+	t.Run("Flagged text attachment on a clean post", func(t *testing.T) {
+		stub := newStub()
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "notes.txt", Extension: "txt", Size: 22}, nil)
+		api.On("GetFile", "file1").Return([]byte("you are all worthless\n"), nil)
+		api.On("LogInfo", "Content was flagged by moderation", "post_id", "post1", "severity_threshold", 4,
+			"computed_severity_harassment", 6, "severity_breakdown", "harassment: 6").Return()
+
+		err := newProcessor(stub).moderatePost(api, post)
+		assert.ErrorIs(t, err, ErrModerationRejection)
+		assert.Equal(t, []string{"Meeting notes attached", "you are all worthless"}, stub.Texts())
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Other extensions are not downloaded", func(t *testing.T) {
+		stub := newStub()
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "report.pdf", Extension: "pdf", Size: 22}, nil)
+
+		require.NoError(t, newProcessor(stub).moderatePost(api, post))
+		assert.Equal(t, []string{"Meeting notes attached"}, stub.Texts())
+		api.AssertNotCalled(t, "GetFile", mock.Anything)
+	})
+
+	t.Run("Files over the maximum size are not downloaded", func(t *testing.T) {
+		stub := newStub()
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "dump.txt", Extension: "txt", Size: 1025}, nil)
+		api.On("LogDebug", "Skipping moderation of text file exceeding the maximum size", "post_id", "post1", "file_id", "file1", "size", int64(1025)).Return().Once()
+
+		require.NoError(t, newProcessor(stub).moderatePost(api, post))
+		assert.Equal(t, []string{"Meeting notes attached"}, stub.Texts())
+		api.AssertNotCalled(t, "GetFile", mock.Anything)
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Binary files are skipped", func(t *testing.T) {
+		stub := newStub()
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "image.txt", Extension: "txt", Size: 8}, nil)
+		api.On("GetFile", "file1").Return([]byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a}, nil)
+		api.On("LogDebug", "Skipping moderation of binary file with a text extension", "post_id", "post1", "file_id", "file1").Return().Once()
+
+		require.NoError(t, newProcessor(stub).moderatePost(api, post))
+		assert.Equal(t, []string{"Meeting notes attached"}, stub.Texts())
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Each file waits for the rate limiter", func(t *testing.T) {
+		tokens := make(chan struct{}, 10)
+		for range cap(tokens) {
+			tokens <- struct{}{}
+		}
+
+		stub := newStub()
+		processor := newProcessor(stub)
+		processor.limiter = &dispatchLimiter{C: tokens}
+
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "notes.txt", Extension: "txt", Size: 11}, nil)
+		api.On("GetFileInfo", "file2").Return(&model.FileInfo{Id: "file2", Name: "todo.md", Extension: "md", Size: 11}, nil)
+		api.On("GetFile", "file1").Return([]byte("first file\n"), nil)
+		api.On("GetFile", "file2").Return([]byte("second file"), nil)
+
+		twoFiles := &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "Meeting notes attached", FileIds: []string{"file1", "file2"}}
+		require.NoError(t, processor.moderatePost(api, twoFiles))
+		assert.Equal(t, []string{"Meeting notes attached", "first file", "second file"}, stub.Texts())
+		assert.Len(t, tokens, cap(tokens)-2)
+	})
+
+	t.Run("Unavailable files are retried", func(t *testing.T) {
+		api := &plugintest.API{}
+		api.On("GetFileInfo", "file1").Return(&model.FileInfo{Id: "file1", Name: "notes.txt", Extension: "txt", Size: 22}, nil)
+		api.On("GetFile", "file1").Return(nil, model.NewAppError("GetFile", "app.file.read.app_error", nil, "", 500))
+		api.On("LogError", "Failed to get text file for content moderation", "post_id", "post1", "file_id", "file1", "err", mock.Anything).Return().Once()
+
+		err := newProcessor(newStub()).moderatePost(api, post)
+		assert.ErrorIs(t, err, ErrModerationUnavailable)
+	})
+}
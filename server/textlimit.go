@@ -0,0 +1,89 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// Actions taken on post text longer than the maximum moderated length
+const (
+	overLimitTruncate = "truncate"
+	overLimitReview   = "review"
+)
+
+const oversizedTextNotificationTemplate = "_A post too long to moderate was held for review:_ %s"
+
+// textLimitSettings caps the text submitted for moderation, so that pasting a
+// huge post cannot cost a very expensive provider request or a long series of
+// chunk requests. Longer text is either truncated to the maximum and
+// moderated, or held for review without calling the provider. All methods
+// are safe to call on nil settings, which do not limit the text.
+type textLimitSettings struct {
+	// maxCharacters is the longest text moderated, in characters
+	maxCharacters int
+
+	// action is overLimitTruncate or overLimitReview
+	action          string
+	reviewChannelID string
+}
+
+// newTextLimitSettings returns the text limit settings, or nil when the
+// maximum is not positive. An empty action truncates.
+func newTextLimitSettings(maxCharacters int, action, reviewChannelID string) (*textLimitSettings, error) {
+	if maxCharacters <= 0 {
+		return nil, nil
+	}
+
+	switch action {
+	case "":
+		action = overLimitTruncate
+	case overLimitTruncate:
+	case overLimitReview:
+		if !model.IsValidId(reviewChannelID) {
+			return nil, errors.New("a valid review channel ID is required to hold posts over the maximum moderated length for review")
+		}
+	default:
+		return nil, errors.Errorf("unknown over-limit action %q", action)
+	}
+
+	return &textLimitSettings{
+		maxCharacters:   maxCharacters,
+		action:          action,
+		reviewChannelID: reviewChannelID,
+	}, nil
+}
+
+// exceeds reports whether the text is longer than the maximum
+func (s *textLimitSettings) exceeds(text string) bool {
+	return s != nil && utf8.RuneCountInString(text) > s.maxCharacters
+}
+
+// truncates reports whether text over the maximum is truncated and
+// moderated, rather than held for review
+func (s *textLimitSettings) truncates() bool {
+	return s != nil && s.action == overLimitTruncate
+}
+
+// truncate returns the first maxCharacters characters of the text
+func (s *textLimitSettings) truncate(text string) string {
+	if !s.exceeds(text) {
+		return text
+	}
+	return string([]rune(text)[:s.maxCharacters])
+}
+
+// holdForTextReview marks a post whose text was too long to moderate as
+// pending review. Posts are left alone in monitor-only mode.
+func (p *PostProcessor) holdForTextReview(api plugin.API, post *model.Post) {
+	if p.action != nil && p.action.monitorOnly {
+		return
+	}
+
+	api.LogInfo("Post text is longer than the maximum moderated length, holding it for review", p.policy.loggedIDs("post_id", post.Id)...)
+	if err := p.markPendingReview(api, post, p.textLimit.reviewChannelID, oversizedTextNotificationTemplate); err != nil {
+		api.LogError("Failed to hold post with oversized text for review", append(p.policy.loggedIDs("post_id", post.Id), "err", err)...)
+	}
+}
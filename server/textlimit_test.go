@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost-plugin-content-moderation/server/moderation"
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTextLimitSettings(t *testing.T) {
+	settings, err := newTextLimitSettings(0, overLimitReview, "")
+	require.NoError(t, err)
+	assert.Nil(t, settings)
+	assert.False(t, settings.exceeds(strings.Repeat("a", 100000)))
+
+	settings, err = newTextLimitSettings(10, "", "")
+	require.NoError(t, err)
+	assert.True(t, settings.truncates())
+
+	_, err = newTextLimitSettings(10, overLimitReview, "")
+	assert.Error(t, err, "holding posts for review requires a review channel")
+
+	_, err = newTextLimitSettings(10, "drop", "")
+	assert.Error(t, err)
+}
+
+func TestTextLimitSettingsTruncate(t *testing.T) {
+	settings, err := newTextLimitSettings(5, overLimitTruncate, "")
+	require.NoError(t, err)
+
+	assert.False(t, settings.exceeds("héllo"), "characters are counted, not bytes")
+	assert.Equal(t, "héllo", settings.truncate("héllo"))
+	assert.True(t, settings.exceeds("héllo!"))
+	assert.Equal(t, "héllo", settings.truncate("héllo!"))
+}
+
+func TestModeratePostTextLimit(t *testing.T) {
+	reviewChannelID := model.NewId()
+
+	newProcessor := func(moderator moderation.Moderator, action string) *PostProcessor {
+		textLimit, err := newTextLimitSettings(10, action, reviewChannelID)
+		require.NoError(t, err)
+		return &PostProcessor{
+			botID:     "bot",
+			moderator: moderator,
+			policy:    newModerationPolicy(4, nil, nil, nil, nil),
+			action:    &flaggedPostAction{action: moderationActionDelete},
+			textLimit: textLimit,
+		}
+	}
+
+	t.Run("Text at the maximum is moderated whole", func(t *testing.T) {
+		stub := &moderation.Stub{Default: moderation.Result{"hate": 0}}
+		processor := newProcessor(stub, overLimitTruncate)
+
+		require.NoError(t, processor.moderatePost(&plugintest.API{}, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "0123456789"}))
+		assert.Equal(t, []string{"0123456789"}, stub.Texts())
+	})
+
+	t.Run("Text over the maximum is truncated and moderated", func(t *testing.T) {
+		stub := &moderation.Stub{
+			Results: map[string]moderation.Result{"slur 56789": {"hate": 6}},
+			Default: moderation.Result{"hate": 0},
+		}
+		processor := newProcessor(stub, overLimitTruncate)
+
+		api := &plugintest.API{}
+		api.On("LogDebug", "Truncating post text longer than the maximum moderated length", "post_id", "post1", "max_characters", 10).Return()
+		api.On("LogInfo", "Content was flagged by moderation", "post_id", "post1", "severity_threshold", 4,
+			"computed_severity_hate", 6, "severity_breakdown", "hate: 6").Return()
+
+		err := processor.moderatePost(api, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "slur 56789" + strings.Repeat(" padding", 1000)})
+		assert.ErrorIs(t, err, ErrModerationRejection)
+		assert.Equal(t, []string{"slur 56789"}, stub.Texts())
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Text over the maximum is held for review without calling the provider", func(t *testing.T) {
+		stub := &moderation.Stub{Default: moderation.Result{"hate": 0}}
+		processor := newProcessor(stub, overLimitReview)
+
+		api := &plugintest.API{}
+		api.On("LogInfo", "Post text is longer than the maximum moderated length, holding it for review", "post_id", "post1").Return().Once()
+		api.On("GetConfig").Return(&model.Config{})
+		api.On("AddReaction", &model.Reaction{UserId: "bot", PostId: "post1", EmojiName: pendingReviewEmoji, ChannelId: "channel1"}).Return(&model.Reaction{}, nil).Once()
+		api.On("CreatePost", mock.MatchedBy(func(post *model.Post) bool {
+			return post.ChannelId == reviewChannelID && post.Message == "_A post too long to moderate was held for review:_ /_redirect/pl/post1"
+		})).Return(&model.Post{}, nil).Once()
+
+		require.NoError(t, processor.moderatePost(api, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "01234567890"}))
+		assert.Empty(t, stub.Texts())
+		api.AssertExpectations(t)
+	})
+
+	t.Run("Posts are not held in monitor-only mode", func(t *testing.T) {
+		stub := &moderation.Stub{}
+		processor := newProcessor(stub, overLimitReview)
+		processor.action.monitorOnly = true
+
+		api := &plugintest.API{}
+		require.NoError(t, processor.moderatePost(api, &model.Post{Id: "post1", UserId: "user1", ChannelId: "channel1", Message: "01234567890"}))
+		assert.Empty(t, stub.Texts())
+		api.AssertNotCalled(t, "AddReaction", mock.Anything)
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin"
+	"github.com/pkg/errors"
+)
+
+// validationText is moderated to confirm that a candidate configuration can
+// moderate content, not only pass a health check
+const validationText = "test"
+
+// configValidationResult is the response of the configuration validation endpoint
+type configValidationResult struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// validateConfig handles the configuration validation API endpoint. The body
+// is a candidate plugin configuration using the same keys as the plugin
+// settings. A moderator is built from it, health checked and asked to
+// moderate a short text. The running moderator is never modified.
+func (p *Plugin) validateConfig(w http.ResponseWriter, r *http.Request) {
+	candidate := &configuration{}
+	if err := json.NewDecoder(r.Body).Decode(candidate); err != nil {
+		http.Error(w, "invalid configuration", http.StatusBadRequest)
+		return
+	}
+	restoreSecrets(candidate, p.getConfiguration())
+
+	result := configValidationResult{Valid: true}
+	if err := checkModeratorConfig(p.API, candidate); err != nil {
+		result = configValidationResult{Error: err.Error()}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		p.API.LogError("failed to write http response", "error", err.Error())
+	}
+}
+
+// checkModeratorConfig builds a moderator from the candidate configuration
+// and verifies that it can moderate text
+func checkModeratorConfig(api plugin.API, candidate *configuration) error {
+	if _, err := candidate.ThresholdValue(); err != nil {
+		return errors.Wrap(err, "invalid moderation threshold")
+	}
+
+	timeout, err := candidate.ModerationTimeoutValue()
+	if err != nil {
+		return errors.Wrap(err, "invalid moderation timeout")
+	}
+
+	mod, err := buildModerator(api, candidate)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := mod.HealthCheck(ctx); err != nil {
+		return errors.Wrap(err, "health check failed")
+	}
+
+	if _, err := mod.ModerateText(ctx, validationText); err != nil {
+		return errors.Wrap(err, "test moderation request failed")
+	}
+
+	return nil
+}
+
+// restoreSecrets replaces secrets that the System Console masked with the
+// saved values, so that unchanged secrets can be validated
+func restoreSecrets(candidate, current *configuration) {
+	secrets := []struct {
+		candidate *string
+		current   string
+	}{
+		{&candidate.APIKey, current.APIKey},
+		{&candidate.AzureClientSecret, current.AzureClientSecret},
+		{&candidate.OpenAIAPIKey, current.OpenAIAPIKey},
+		{&candidate.PerspectiveAPIKey, current.PerspectiveAPIKey},
+		{&candidate.WebhookToken, current.WebhookToken},
+	}
+
+	for _, secret := range secrets {
+		if *secret.candidate == model.FakeSetting {
+			*secret.candidate = secret.current
+		}
+	}
+}
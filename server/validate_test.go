@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mattermost/mattermost/server/public/model"
+	"github.com/mattermost/mattermost/server/public/plugin/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateConfig(t *testing.T) {
+	validate := func(p *Plugin, body string) (*httptest.ResponseRecorder, configValidationResult) {
+		api := &plugintest.API{}
+		api.On("HasPermissionTo", "admin", model.PermissionManageSystem).Return(true)
+		api.On("LogInfo", mock.Anything).Return().Maybe()
+		p.SetAPI(api)
+
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/config/validate", strings.NewReader(body))
+		r.Header.Set("Mattermost-User-ID", "admin")
+		w := httptest.NewRecorder()
+		p.ServeHTTP(nil, w, r)
+
+		var result configValidationResult
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&result))
+		}
+		return w, result
+	}
+
+	t.Run("Valid configuration", func(t *testing.T) {
+		_, result := validate(&Plugin{}, `{"type":"blocklist","blocklist_terms":"foo","azure_threshold":"2"}`)
+		assert.Equal(t, configValidationResult{Valid: true}, result)
+	})
+
+	t.Run("Unknown provider", func(t *testing.T) {
+		_, result := validate(&Plugin{}, `{"type":"nope","azure_threshold":"2"}`)
+		assert.False(t, result.Valid)
+		assert.Equal(t, "unknown moderator type: nope", result.Error)
+	})
+
+	t.Run("Missing threshold", func(t *testing.T) {
+		_, result := validate(&Plugin{}, `{"type":"blocklist","blocklist_terms":"foo"}`)
+		assert.False(t, result.Valid)
+		assert.Contains(t, result.Error, "invalid moderation threshold")
+	})
+
+	t.Run("Rejected credentials", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":"401","message":"Access denied due to invalid subscription key"}}`))
+		}))
+		defer server.Close()
+
+		_, result := validate(&Plugin{}, `{"type":"azure","azure_endpoint":"`+server.URL+`","azure_apiKey":"wrong","azure_threshold":"2"}`)
+		assert.False(t, result.Valid)
+		assert.Contains(t, result.Error, "health check failed")
+		assert.Contains(t, result.Error, "invalid subscription key")
+	})
+
+	t.Run("Masked secrets use the saved value and the live config is untouched", func(t *testing.T) {
+		var keys []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys = append(keys, r.Header.Get("Ocp-Apim-Subscription-Key"))
+			_, _ = w.Write([]byte(`{"categoriesAnalysis":[{"category":"Hate","severity":0}]}`))
+		}))
+		defer server.Close()
+
+		live := &configuration{Type: "azure", Endpoint: "https://live.example.com", APIKey: "saved-key", Threshold: "2"}
+		processor := &PostProcessor{}
+		p := &Plugin{configuration: live, processor: processor}
+
+		_, result := validate(p, `{"type":"azure","azure_endpoint":"`+server.URL+`","azure_apiKey":"`+model.FakeSetting+`","azure_threshold":"2"}`)
+		assert.Equal(t, configValidationResult{Valid: true}, result)
+
+		// One request for the health check and one for the test moderation
+		assert.Equal(t, []string{"saved-key", "saved-key"}, keys)
+		assert.Same(t, live, p.configuration)
+		assert.Equal(t, "https://live.example.com", live.Endpoint)
+		assert.Same(t, processor, p.processor)
+	})
+
+	t.Run("Invalid body", func(t *testing.T) {
+		w, _ := validate(&Plugin{}, `not json`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
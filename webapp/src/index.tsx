@@ -10,6 +10,7 @@ export default class Plugin {
     public async initialize(registry: PluginRegistry) {
         registry.registerAdminConsoleCustomSetting('excludedUsers', UserSettings, {showTitle: true});
         registry.registerAdminConsoleCustomSetting('excludedChannels', ChannelSettings, {showTitle: true});
+        registry.registerAdminConsoleCustomSetting('includedChannels', ChannelSettings, {showTitle: true});
     }
 }
 